@@ -0,0 +1,58 @@
+package notmain
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// ClientAllowlistConfig lists client networks, such as our own monitoring and
+// internal services, whose requests are never shed. The zero value exempts
+// nothing.
+type ClientAllowlistConfig struct {
+	// CIDRs are the networks whose clients are exempt, e.g. "10.0.0.0/8" or
+	// "2001:db8::/32". Clients are identified by the address of the
+	// connection, so a proxy in front of the responder must be listed itself.
+	CIDRs []string `validate:"dive,cidr"`
+}
+
+// clientAllowlist decides whether a request comes from an allowlisted
+// client. A nil *clientAllowlist allows nothing.
+type clientAllowlist struct {
+	prefixes []netip.Prefix
+}
+
+// newClientAllowlist returns a clientAllowlist as configured by conf, or nil
+// if conf lists nothing.
+func newClientAllowlist(conf ClientAllowlistConfig) (*clientAllowlist, error) {
+	if len(conf.CIDRs) == 0 {
+		return nil, nil
+	}
+	a := &clientAllowlist{}
+	for _, cidr := range conf.CIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing allowlisted CIDR %q: %w", cidr, err)
+		}
+		a.prefixes = append(a.prefixes, prefix.Masked())
+	}
+	return a, nil
+}
+
+// allows returns true if remoteAddr, an address:port as found in
+// http.Request.RemoteAddr, is in an allowlisted network.
+func (a *clientAllowlist) allows(remoteAddr string) bool {
+	if a == nil {
+		return false
+	}
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range a.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package notmain
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestClientAllowlist(t *testing.T) {
+	_, err := newClientAllowlist(ClientAllowlistConfig{CIDRs: []string{"10.0.0.0/33"}})
+	test.AssertError(t, err, "accepted invalid CIDR")
+	empty, err := newClientAllowlist(ClientAllowlistConfig{})
+	test.AssertNotError(t, err, "creating empty allowlist")
+	test.Assert(t, empty == nil, "empty allowlist should be nil")
+	test.Assert(t, !empty.allows("10.0.0.1:443"), "empty allowlist allowed a client")
+
+	allowlist, err := newClientAllowlist(ClientAllowlistConfig{CIDRs: []string{"10.1.0.0/16", "2001:db8::/32"}})
+	test.AssertNotError(t, err, "creating allowlist")
+	for _, tc := range []struct {
+		remoteAddr string
+		allowed    bool
+	}{
+		{"10.1.2.3:1234", true},
+		{"10.2.0.1:1234", false},
+		{"[2001:db8::1]:1234", true},
+		{"[2001:db9::1]:1234", false},
+		// IPv4 clients of a dual-stack listener appear as mapped addresses.
+		{"[::ffff:10.1.2.3]:1234", true},
+		{"garbage", false},
+	} {
+		test.AssertEquals(t, allowlist.allows(tc.remoteAddr), tc.allowed)
+	}
+}
+
+func TestMuxClientAllowlist(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+
+	allowlist, err := newClientAllowlist(ClientAllowlistConfig{CIDRs: []string{"192.0.2.0/24"}})
+	test.AssertNotError(t, err, "creating allowlist")
+	denied, err := newUserAgentDenylist(UserAgentDenylistConfig{Exact: []string{"monitor/1.0"}})
+	test.AssertNotError(t, err, "creating denylist")
+
+	// A negative ceiling keeps the responder permanently saturated, so every
+	// request which isn't exempt is shed.
+	reg := prometheus.NewRegistry()
+	inFlight := responder.NewInFlightBytes(-1, responder.MemoryLimitConfig{}, reg)
+	src := &countingSource{}
+	h := mux(src, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, InFlight: inFlight, LogSampleRate: 1000}, deniedAgents: denied, allowlist: allowlist}, reg, blog.NewMock())
+
+	serve := func(remoteAddr, ua string) int {
+		r := httptest.NewRequest("POST", "/", bytes.NewReader(reqBytes))
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("User-Agent", ua)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// A client outside the allowlist is shed before any lookup.
+	test.AssertEquals(t, serve("198.51.100.1:1234", "Mozilla/5.0"), http.StatusServiceUnavailable)
+	test.AssertEquals(t, src.lookups, 0)
+
+	// An allowlisted client is looked up and answered; the source has no
+	// response, so that's a 200 with unauthorized.
+	test.AssertEquals(t, serve("192.0.2.10:1234", "Mozilla/5.0"), http.StatusOK)
+	test.AssertEquals(t, src.lookups, 1)
+
+	// Its user agent is never denied either.
+	test.AssertEquals(t, serve("198.51.100.1:1234", "monitor/1.0"), http.StatusForbidden)
+	test.AssertEquals(t, serve("192.0.2.10:1234", "monitor/1.0"), http.StatusOK)
+	test.AssertEquals(t, src.lookups, 2)
+
+	var out bytes.Buffer
+	err = writeMetrics(reg, &out)
+	test.AssertNotError(t, err, "writing metrics")
+	test.AssertContains(t, out.String(), "ocsp_allowlisted_requests 2")
+	test.AssertContains(t, out.String(), "ocsp_inflight_bytes_shed 1")
+}
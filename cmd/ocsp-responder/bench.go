@@ -0,0 +1,194 @@
+package notmain
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// benchConfig describes the load generated by runBench.
+type benchConfig struct {
+	// requests is the total number of requests to send.
+	requests int
+	// concurrency is the most requests in flight at once.
+	concurrency int
+	// qps is the target rate at which requests are started. Zero means as
+	// fast as concurrency allows.
+	qps float64
+}
+
+// benchResults are the outcomes of the requests sent by runBench.
+type benchResults struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	statuses  map[string]int
+	elapsed   time.Duration
+}
+
+func (br *benchResults) record(latency time.Duration, status string) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.latencies = append(br.latencies, latency)
+	br.statuses[status]++
+}
+
+// percentile returns the latency below which p percent of requests
+// completed.
+func (br *benchResults) percentile(p float64) time.Duration {
+	if len(br.latencies) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(br.latencies)
+	slices.Sort(sorted)
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
+
+// write prints a summary of br to out.
+func (br *benchResults) write(out io.Writer) error {
+	sent := len(br.latencies)
+	var rate float64
+	if br.elapsed > 0 {
+		rate = float64(sent) / br.elapsed.Seconds()
+	}
+	_, err := fmt.Fprintf(out, "Sent %d requests in %s (%.1f/s)\nLatency: p50 %s, p90 %s, p99 %s, max %s\n",
+		sent, br.elapsed.Round(time.Millisecond), rate,
+		br.percentile(50), br.percentile(90), br.percentile(99), br.percentile(100))
+	if err != nil {
+		return err
+	}
+	statuses := make([]string, 0, len(br.statuses))
+	for status := range br.statuses {
+		statuses = append(statuses, status)
+	}
+	slices.Sort(statuses)
+	for _, status := range statuses {
+		_, err = fmt.Fprintf(out, "Status %s: %d\n", status, br.statuses[status])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runBench sends conf.requests requests with send, cycling through reqs, from
+// conf.concurrency workers. If conf.qps is non-zero, the i'th request isn't
+// started before i/qps seconds have passed. send returns the HTTP status
+// code of the response. It stops early if ctx is done.
+func runBench(ctx context.Context, conf benchConfig, reqs [][]byte, send func(context.Context, []byte) (int, error)) *benchResults {
+	results := &benchResults{statuses: make(map[string]int)}
+	jobs := make(chan []byte)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for range max(conf.concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range jobs {
+				sent := time.Now()
+				code, err := send(ctx, req)
+				status := strconv.Itoa(code)
+				if err != nil {
+					status = "error"
+				}
+				results.record(time.Since(sent), status)
+			}
+		}()
+	}
+
+dispatch:
+	for i := range conf.requests {
+		if conf.qps > 0 {
+			due := start.Add(time.Duration(float64(i) / conf.qps * float64(time.Second)))
+			timer := time.NewTimer(time.Until(due))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				break dispatch
+			}
+		}
+		select {
+		case jobs <- reqs[i%len(reqs)]:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	results.elapsed = time.Since(start)
+	return results
+}
+
+// loadBenchRequests builds a DER-encoded OCSP request for each hex-encoded
+// serial, one per line, in serialsFile, issued by the certificate in
+// issuerFile.
+func loadBenchRequests(serialsFile, issuerFile string, hash crypto.Hash) ([][]byte, error) {
+	issuer, err := core.LoadCert(issuerFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading issuer: %w", err)
+	}
+	f, err := os.Open(serialsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var reqs [][]byte
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		serial, err := core.StringToSerial(line)
+		if err != nil {
+			return nil, err
+		}
+		req, err := createRequest(serial, issuer, hash)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("no serials in %q", serialsFile)
+	}
+	return reqs, nil
+}
+
+// benchSender returns a send function for runBench which makes GET requests
+// to the responder at responderURL.
+func benchSender(client *http.Client, responderURL string) func(context.Context, []byte) (int, error) {
+	base := strings.TrimSuffix(responderURL, "/") + "/"
+	return func(ctx context.Context, req []byte) (int, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, "GET", base+url.PathEscape(base64.StdEncoding.EncodeToString(req)), nil)
+		if err != nil {
+			return 0, err
+		}
+		resp, err := client.Do(httpReq)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		_, err = io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, err
+	}
+}
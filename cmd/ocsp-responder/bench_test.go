@@ -0,0 +1,132 @@
+package notmain
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestRunBenchCounts(t *testing.T) {
+	reqs := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	var mu sync.Mutex
+	sent := make(map[string]int)
+	var inFlight, maxInFlight atomic.Int64
+	send := func(_ context.Context, req []byte) (int, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		sent[string(req)]++
+		mu.Unlock()
+		switch string(req) {
+		case "b":
+			return 0, errors.New("connection refused")
+		case "c":
+			return 503, nil
+		}
+		return 200, nil
+	}
+
+	results := runBench(context.Background(), benchConfig{requests: 10, concurrency: 4}, reqs, send)
+	test.AssertEquals(t, len(results.latencies), 10)
+	test.AssertDeepEquals(t, sent, map[string]int{"a": 4, "b": 3, "c": 3})
+	test.AssertDeepEquals(t, results.statuses, map[string]int{"200": 4, "error": 3, "503": 3})
+	test.Assert(t, maxInFlight.Load() <= 4, "more requests in flight than the concurrency")
+}
+
+func TestRunBenchPacing(t *testing.T) {
+	var mu sync.Mutex
+	var offsets []time.Duration
+	start := time.Now()
+	send := func(context.Context, []byte) (int, error) {
+		mu.Lock()
+		offsets = append(offsets, time.Since(start))
+		mu.Unlock()
+		return 200, nil
+	}
+
+	// At 100 QPS, the i'th request isn't started before i*10ms, however
+	// many workers are free.
+	results := runBench(context.Background(), benchConfig{requests: 11, concurrency: 10, qps: 100}, [][]byte{[]byte("a")}, send)
+	test.AssertEquals(t, len(results.latencies), 11)
+	test.Assert(t, results.elapsed >= 100*time.Millisecond, "requests sent faster than the target rate")
+	for i, offset := range offsets {
+		test.Assert(t, offset >= time.Duration(i)*10*time.Millisecond, "request started before it was due")
+	}
+
+	// Cancelling stops further requests being started.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	results = runBench(ctx, benchConfig{requests: 1000, concurrency: 1, qps: 100}, [][]byte{[]byte("a")}, send)
+	test.Assert(t, len(results.latencies) < 1000, "cancelled benchmark sent every request")
+}
+
+func TestBenchResultsWrite(t *testing.T) {
+	results := &benchResults{statuses: map[string]int{"200": 99, "503": 1}, elapsed: time.Second}
+	for i := range 100 {
+		results.latencies = append(results.latencies, time.Duration(100-i)*time.Millisecond)
+	}
+	test.AssertEquals(t, results.percentile(50), 50*time.Millisecond)
+	test.AssertEquals(t, results.percentile(99), 99*time.Millisecond)
+	test.AssertEquals(t, results.percentile(100), 100*time.Millisecond)
+
+	var out bytes.Buffer
+	err := results.write(&out)
+	test.AssertNotError(t, err, "writing results")
+	test.AssertEquals(t, out.String(), "Sent 100 requests in 1s (100.0/s)\nLatency: p50 50ms, p90 90ms, p99 99ms, max 100ms\nStatus 200: 99\nStatus 503: 1\n")
+}
+
+func TestLoadBenchRequests(t *testing.T) {
+	dir := t.TempDir()
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "generating issuer key")
+	issuer, issuerFile := writeTestCert(t, dir, "issuer", 1, issuerKey, nil, nil)
+
+	serials := []string{"000000000000000000000000000000000001", "00000000000000000000000000000000abcd"}
+	serialsFile := filepath.Join(dir, "serials")
+	err = os.WriteFile(serialsFile, []byte(serials[0]+"\n\n"+serials[1]+"\n"), 0600)
+	test.AssertNotError(t, err, "writing serials")
+
+	reqs, err := loadBenchRequests(serialsFile, issuerFile, crypto.SHA1)
+	test.AssertNotError(t, err, "loading requests")
+	test.AssertEquals(t, len(reqs), 2)
+	for i, der := range reqs {
+		req, err := ocsp.ParseRequest(der)
+		test.AssertNotError(t, err, "parsing request")
+		test.AssertEquals(t, core.SerialToString(req.SerialNumber), serials[i])
+		expected, err := createRequest(req.SerialNumber, issuer, crypto.SHA1)
+		test.AssertNotError(t, err, "creating request")
+		test.AssertByteEquals(t, der, expected)
+	}
+
+	err = os.WriteFile(serialsFile, []byte("not-a-serial\n"), 0600)
+	test.AssertNotError(t, err, "writing serials")
+	_, err = loadBenchRequests(serialsFile, issuerFile, crypto.SHA1)
+	test.AssertError(t, err, "loaded invalid serial")
+
+	err = os.WriteFile(serialsFile, nil, 0600)
+	test.AssertNotError(t, err, "writing serials")
+	_, err = loadBenchRequests(serialsFile, issuerFile, crypto.SHA1)
+	test.AssertError(t, err, "loaded empty serials file")
+}
@@ -0,0 +1,86 @@
+package notmain
+
+import (
+	"crypto"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/letsencrypt/boulder/ocsp/responder"
+)
+
+// CapabilitiesConfig configures a JSON document describing what the responder
+// supports, such as the CertID hash algorithms it accepts, for relying
+// parties deciding how to build their requests. The zero value serves none.
+type CapabilitiesConfig struct {
+	// Path is the path at which GET, HEAD and OPTIONS requests are answered
+	// with the capabilities document. It's matched exactly, before the OCSP
+	// path. OPTIONS requests for other paths get the responder's usual empty
+	// answer.
+	Path string `validate:"omitempty,startswith=/"`
+}
+
+// capabilities is the document served at CapabilitiesConfig.Path. A nil
+// *capabilities serves nothing.
+type capabilities struct {
+	// HashAlgorithms are the CertID hash algorithms accepted in requests.
+	HashAlgorithms []string `json:"hashAlgorithms"`
+	// Methods are the HTTP methods which the responder answers, as in the
+	// Allow header.
+	Methods []string `json:"methods"`
+	// Features lists optional behaviours which are enabled.
+	Features []string `json:"features"`
+
+	path string
+}
+
+// newCapabilities returns the capabilities of a responder running with c and
+// accepting the given CertID hash algorithms, or nil if c doesn't configure a
+// capabilities path.
+func newCapabilities(c *Config, hashAlgorithms ...crypto.Hash) *capabilities {
+	if c.OCSPResponder.Capabilities.Path == "" {
+		return nil
+	}
+	caps := &capabilities{
+		HashAlgorithms: []string{},
+		Methods:        strings.Split(responder.AllowedMethods, ", "),
+		Features:       []string{},
+		path:           c.OCSPResponder.Capabilities.Path,
+	}
+	for _, h := range hashAlgorithms {
+		caps.HashAlgorithms = append(caps.HashAlgorithms, h.String())
+	}
+	if c.OCSPResponder.Stapling.Path != "" {
+		caps.Features = append(caps.Features, "stapling")
+	}
+	if c.OCSPResponder.BlocklistFile != "" {
+		caps.Features = append(caps.Features, "blocklist")
+	}
+	if c.OCSPResponder.MissingStatus.TryLaterIfIssued {
+		caps.Features = append(caps.Features, "trylater-if-issued")
+	}
+	return caps
+}
+
+// serves returns true if r is a request for the capabilities document.
+func (caps *capabilities) serves(r *http.Request) bool {
+	if caps == nil || r.URL.Path != caps.path {
+		return false
+	}
+	return r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+}
+
+// ServeHTTP writes the capabilities document.
+func (caps *capabilities) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(caps)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Allow", responder.AllowedMethods)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
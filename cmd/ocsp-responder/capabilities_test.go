@@ -0,0 +1,72 @@
+package notmain
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/issuance"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestMuxCapabilities(t *testing.T) {
+	issuer, err := issuance.LoadCertificate("../../ocsp/responder/testdata/test-ca.der.pem")
+	test.AssertNotError(t, err, "loading issuer cert")
+	src := &countingSource{}
+	filter, err := responder.NewFilterSource(responder.StaticIssuers{issuer}, responder.FilterConfig{}, src, metrics.NoopRegisterer, blog.NewMock(), clock.NewFake())
+	test.AssertNotError(t, err, "creating filter source")
+
+	var c Config
+	c.OCSPResponder.Capabilities.Path = "/capabilities"
+	c.OCSPResponder.Stapling.Path = "/stapling/"
+	c.OCSPResponder.BlocklistFile = "blocklist.yaml"
+	caps := newCapabilities(&c, filter.HashAlgorithm())
+	h := mux(filter, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, Stapling: c.OCSPResponder.Stapling, LogSampleRate: 1000}, caps: caps}, metrics.NoopRegisterer, blog.NewMock())
+
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/capabilities", nil),
+		httptest.NewRequest("OPTIONS", "/capabilities", nil),
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		test.AssertEquals(t, w.Code, http.StatusOK)
+		test.AssertEquals(t, w.Header().Get("Content-Type"), "application/json")
+		test.AssertEquals(t, w.Header().Get("Allow"), "GET, HEAD, POST")
+
+		var got capabilities
+		err = json.Unmarshal(w.Body.Bytes(), &got)
+		test.AssertNotError(t, err, "decoding capabilities")
+		test.AssertDeepEquals(t, got.HashAlgorithms, []string{"SHA-1"})
+		test.AssertDeepEquals(t, got.Methods, []string{"GET", "HEAD", "POST"})
+		test.AssertDeepEquals(t, got.Features, []string{"stapling", "blocklist"})
+	}
+	test.AssertEquals(t, src.lookups, 0)
+
+	// OPTIONS requests for other paths get the responder's usual empty
+	// answer.
+	for _, path := range []string{"/", "/anything"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("OPTIONS", path, nil))
+		test.AssertEquals(t, w.Code, http.StatusNoContent)
+		test.AssertEquals(t, w.Header().Get("Allow"), "GET, HEAD, POST")
+		test.AssertEquals(t, w.Body.Len(), 0)
+	}
+
+	// Without a capabilities path, nothing is advertised, and OPTIONS
+	// requests get the responder's usual empty answer.
+	c.OCSPResponder.Capabilities.Path = ""
+	caps = newCapabilities(&c, filter.HashAlgorithm())
+	test.Assert(t, caps == nil, "expected disabled capabilities to be nil")
+	h = mux(filter, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}, caps: caps}, metrics.NoopRegisterer, blog.NewMock())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/", nil))
+	test.AssertEquals(t, w.Code, http.StatusNoContent)
+	test.AssertEquals(t, w.Body.Len(), 0)
+}
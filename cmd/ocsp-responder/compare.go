@@ -0,0 +1,151 @@
+package notmain
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+)
+
+// comparedSource is one side of a comparison: the fully filtered source built
+// from a config, and a description of it for the report.
+type comparedSource struct {
+	// name identifies the config, e.g. by its file name.
+	name string
+	// backends lists the sources the config is served from, as in the
+	// startup summary.
+	backends []string
+	source   responder.Source
+}
+
+// newComparedSource builds the filtered source of conf, named name, for
+// comparison. Like -lookup, it's read-only: nothing is signed, so the RA isn't
+// called, nothing is written to Redis, and writes to the DB are refused, and
+// the blocklist, status source and prefetcher, which sign, aren't run. The
+// source's metrics go to a registry of its own, which isn't served, since
+// each config's sources register the same ones. Failures are fatal.
+func newComparedSource(conf *Config, name string, logger blog.Logger, clk clock.Clock) comparedSource {
+	reg := prometheus.NewRegistry()
+	source, _, _ := newSource(conf, true, reg, logger, clk)
+	resolver := responder.NewFileIssuerResolver(conf.OCSPResponder.IssuerCerts, conf.OCSPResponder.AllowPartialIssuers, conf.OCSPResponder.MaxIssuers, reg, logger)
+	filter, _ := newFilteredSource(conf, true, source, resolver, reg, logger, clk)
+	backends := slices.DeleteFunc(summarizeConfig(conf, 0).Sources, func(backend string) bool {
+		return backend == "blocklist"
+	})
+	return comparedSource{
+		name:     name,
+		backends: backends,
+		source:   filter,
+	}
+}
+
+// replayOutcome is how a source answered a replayed request: the status of
+// its response, or the error it returned, and the response bytes, if any.
+type replayOutcome struct {
+	status string
+	raw    []byte
+}
+
+// replay looks up req in source, within timeout if it's non-zero.
+func replay(ctx context.Context, source responder.Source, req *ocsp.Request, timeout time.Duration) replayOutcome {
+	if timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	resp, err := source.Response(ctx, req)
+	if err != nil && !errors.Is(err, responder.ErrNotFound) {
+		return replayOutcome{status: fmt.Sprintf("error (%s)", err)}
+	}
+	outcome := replayOutcome{status: watchedStatus(resp, err)}
+	if err == nil {
+		outcome.raw = resp.Raw
+	}
+	return outcome
+}
+
+// compareSources replays each of reqs against both a and b, and writes a line
+// to out for each request whose outcomes diverge, in status or in response
+// bytes, followed by a summary. It returns the number of divergent requests.
+func compareSources(ctx context.Context, reqs []*ocsp.Request, a, b comparedSource, timeout time.Duration, out io.Writer) (int, error) {
+	describe := func(cs comparedSource, outcome replayOutcome) string {
+		return fmt.Sprintf("%s [%s]: %s, %d bytes", cs.name, strings.Join(cs.backends, "+"), outcome.status, len(outcome.raw))
+	}
+
+	var diverged int
+	for _, req := range reqs {
+		outcomeA := replay(ctx, a.source, req, timeout)
+		outcomeB := replay(ctx, b.source, req, timeout)
+		var kind string
+		if outcomeA.status != outcomeB.status {
+			kind = "status"
+		} else if !bytes.Equal(outcomeA.raw, outcomeB.raw) {
+			kind = "bytes"
+		} else {
+			continue
+		}
+		diverged++
+		_, err := fmt.Fprintf(out, "Serial %s diverges in %s: %s; %s\n", core.SerialToString(req.SerialNumber), kind, describe(a, outcomeA), describe(b, outcomeB))
+		if err != nil {
+			return diverged, err
+		}
+	}
+	_, err := fmt.Fprintf(out, "Replayed %d requests: %d diverged\n", len(reqs), diverged)
+	return diverged, err
+}
+
+// loadReplayRequests parses the OCSP requests in replayFile, one per line, as
+// base64, optionally URL-escaped, DER. This is the form printed by
+// -gen-request and found in GET request paths.
+func loadReplayRequests(replayFile string) ([]*ocsp.Request, error) {
+	f, err := os.Open(replayFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var reqs []*ocsp.Request
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		unescaped, err := url.PathUnescape(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		der, err := base64.StdEncoding.DecodeString(unescaped)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		req, err := ocsp.ParseRequest(der)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		reqs = append(reqs, req)
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("no requests in %q", replayFile)
+	}
+	return reqs, nil
+}
@@ -0,0 +1,139 @@
+package notmain
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"golang.org/x/crypto/ocsp"
+
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// writeResponseFile writes the given DER-encoded responses to a file in dir,
+// one per line in base64, and returns a config whose Source is that file and
+// whose issuer is issuerFile.
+func writeResponseFile(t *testing.T, dir, name, issuerFile string, ders ...[]byte) *Config {
+	t.Helper()
+	var contents strings.Builder
+	for _, der := range ders {
+		contents.WriteString(base64.StdEncoding.EncodeToString(der) + "\n")
+	}
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, []byte(contents.String()), 0600)
+	test.AssertNotError(t, err, "writing response file")
+
+	var c Config
+	c.OCSPResponder.Source = "file:" + path
+	c.OCSPResponder.IssuerCerts = []string{issuerFile}
+	return &c
+}
+
+func TestCompareSources(t *testing.T) {
+	dir := t.TempDir()
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "generating issuer key")
+	issuer, issuerFile := writeTestCert(t, dir, "issuer", 1, issuerKey, nil, nil)
+
+	now := time.Now().Truncate(time.Second)
+	sign := func(serial int64, status int, thisUpdate time.Time) []byte {
+		t.Helper()
+		der, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+			SerialNumber: big.NewInt(serial),
+			Status:       status,
+			RevokedAt:    thisUpdate,
+			ThisUpdate:   thisUpdate,
+			NextUpdate:   thisUpdate.Add(time.Hour),
+		}, issuerKey)
+		test.AssertNotError(t, err, "signing response")
+		return der
+	}
+	same := sign(1, ocsp.Good, now)
+
+	// The configs agree on serial 1, and neither has serial 4. They disagree
+	// on the status of serial 2, and on the bytes of serial 3.
+	configA := writeResponseFile(t, dir, "a.b64", issuerFile, same, sign(2, ocsp.Good, now), sign(3, ocsp.Good, now))
+	configB := writeResponseFile(t, dir, "b.b64", issuerFile, same, sign(2, ocsp.Revoked, now), sign(3, ocsp.Good, now.Add(-time.Minute)))
+
+	// Serial 1 is blocklisted in b, but the compared sources are read-only,
+	// so the blocklist, which signs its responses, isn't applied.
+	blocklist := filepath.Join(dir, "blocklist.yaml")
+	err = os.WriteFile(blocklist, []byte("- serial: \"01\"\n  action: force-revoked\n  reason: 1\n"), 0600)
+	test.AssertNotError(t, err, "writing blocklist")
+	configB.OCSPResponder.BlocklistFile = blocklist
+
+	compared := []comparedSource{
+		newComparedSource(configA, "a.json", blog.NewMock(), clock.New()),
+		newComparedSource(configB, "b.json", blog.NewMock(), clock.New()),
+	}
+
+	var reqs []*ocsp.Request
+	for serial := range int64(4) {
+		der, err := createRequest(big.NewInt(serial+1), issuer, crypto.SHA1)
+		test.AssertNotError(t, err, "creating request")
+		req, err := ocsp.ParseRequest(der)
+		test.AssertNotError(t, err, "parsing request")
+		reqs = append(reqs, req)
+	}
+
+	var out bytes.Buffer
+	diverged, err := compareSources(context.Background(), reqs, compared[0], compared[1], time.Second, &out)
+	test.AssertNotError(t, err, "comparing sources")
+	test.AssertEquals(t, diverged, 2)
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	test.AssertEquals(t, len(lines), 3)
+	test.AssertContains(t, lines[0], "Serial 000000000000000000000000000000000002 diverges in status: a.json [file]: good")
+	test.AssertContains(t, lines[0], "b.json [file]: revoked (reason 0)")
+	test.AssertContains(t, lines[1], "Serial 000000000000000000000000000000000003 diverges in bytes")
+	test.AssertEquals(t, lines[2], "Replayed 4 requests: 2 diverged")
+
+	// A source compared with itself never diverges.
+	out.Reset()
+	diverged, err = compareSources(context.Background(), reqs, compared[0], compared[0], time.Second, &out)
+	test.AssertNotError(t, err, "comparing source with itself")
+	test.AssertEquals(t, diverged, 0)
+	test.AssertEquals(t, out.String(), "Replayed 4 requests: 0 diverged\n")
+}
+
+func TestLoadReplayRequests(t *testing.T) {
+	dir := t.TempDir()
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "generating issuer key")
+	issuer, _ := writeTestCert(t, dir, "issuer", 1, issuerKey, nil, nil)
+
+	var contents bytes.Buffer
+	for _, serial := range []int64{10, 11} {
+		der, err := createRequest(big.NewInt(serial), issuer, crypto.SHA1)
+		test.AssertNotError(t, err, "creating request")
+		test.AssertNotError(t, writeRequest(der, false, &contents), "writing request")
+		contents.WriteString("\n")
+	}
+	replayFile := filepath.Join(dir, "replay.txt")
+	test.AssertNotError(t, os.WriteFile(replayFile, contents.Bytes(), 0600), "writing replay file")
+
+	reqs, err := loadReplayRequests(replayFile)
+	test.AssertNotError(t, err, "loading replay requests")
+	test.AssertEquals(t, len(reqs), 2)
+	test.AssertEquals(t, reqs[1].SerialNumber.Int64(), int64(11))
+
+	test.AssertNotError(t, os.WriteFile(replayFile, []byte("not base64!\n"), 0600), "writing replay file")
+	_, err = loadReplayRequests(replayFile)
+	test.AssertError(t, err, "loaded malformed replay file")
+
+	test.AssertNotError(t, os.WriteFile(replayFile, []byte("\n"), 0600), "writing replay file")
+	_, err = loadReplayRequests(replayFile)
+	test.AssertError(t, err, "loaded empty replay file")
+}
@@ -0,0 +1,74 @@
+package notmain
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	"github.com/letsencrypt/boulder/test/ocsp/helper"
+)
+
+// debugOCSPPath is the path on the admin server at which OCSP requests can be
+// replayed for debugging.
+const debugOCSPPath = "/debug/ocsp"
+
+// debugOCSPHandler returns a handler which decodes the base64 OCSP request in
+// the "req" query parameter, looks it up in source, and pretty-prints the
+// request and the response which would be served, along with any optional
+// behaviours which affected the lookup. It's intended for the
+// admin server only. Requests bypass the responder, so they aren't logged or
+// counted as HTTP traffic, though source's own metrics still see them.
+func debugOCSPHandler(source responder.Source, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		// A '+' pasted into a query string unescaped arrives as a space.
+		b64 := strings.ReplaceAll(r.URL.Query().Get("req"), " ", "+")
+		if b64 == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Usage: %s?req=<base64 OCSP request>\n", debugOCSPPath)
+			return
+		}
+		der, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Decoding base64: %s\n", err)
+			return
+		}
+		req, err := ocsp.ParseRequest(der)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Parsing OCSP request: %s\n", err)
+			return
+		}
+
+		fmt.Fprintf(w, "Request:\n")
+		fmt.Fprintf(w, "  SerialNumber %s\n", core.SerialToString(req.SerialNumber))
+		fmt.Fprintf(w, "  HashAlgorithm %s\n", req.HashAlgorithm)
+		fmt.Fprintf(w, "  IssuerNameHash %x\n", req.IssuerNameHash)
+		fmt.Fprintf(w, "  IssuerKeyHash %x\n", req.IssuerKeyHash)
+
+		ctx, behaviors := responder.WithBehaviors(r.Context())
+		if timeout != 0 {
+			var cancel func()
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		resp, err := source.Response(ctx, req)
+		if noted := behaviors.List(); len(noted) > 0 {
+			fmt.Fprintf(w, "\nBehaviors: %s\n", strings.Join(noted, ", "))
+		}
+		if err != nil {
+			fmt.Fprintf(w, "\nLookup failed: %s\n", err)
+			return
+		}
+		fmt.Fprint(w, helper.PrettyResponse(resp.Response))
+	})
+}
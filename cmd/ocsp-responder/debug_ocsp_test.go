@@ -0,0 +1,74 @@
+package notmain
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestDebugOCSPHandler(t *testing.T) {
+	respBytes, err := os.ReadFile("./testdata/ocsp.resp")
+	test.AssertNotError(t, err, "failed to read OCSP response")
+	resp, err := ocsp.ParseResponse(respBytes, nil)
+	test.AssertNotError(t, err, "failed to parse OCSP response")
+	src, err := responder.NewMemorySource(map[string]*responder.Response{
+		resp.SerialNumber.String(): {Response: resp, Raw: respBytes},
+	}, blog.NewMock())
+	test.AssertNotError(t, err, "failed to create inMemorySource")
+	h := debugOCSPHandler(src, time.Second)
+
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", debugOCSPPath+"?"+query, nil))
+		return w
+	}
+
+	// A valid request, properly escaped, shows the request and response.
+	w := get("req=" + url.QueryEscape(base64.StdEncoding.EncodeToString(reqBytes)))
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertContains(t, w.Body.String(), fmt.Sprintf("SerialNumber %s", core.SerialToString(req.SerialNumber)))
+	test.AssertContains(t, w.Body.String(), fmt.Sprintf("IssuerKeyHash %x", req.IssuerKeyHash))
+	test.AssertContains(t, w.Body.String(), fmt.Sprintf("ThisUpdate %s", resp.ThisUpdate))
+
+	// Pasted unescaped, any '+' arrives as a space, which is tolerated.
+	w = get("req=" + base64.StdEncoding.EncodeToString(reqBytes))
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertContains(t, w.Body.String(), fmt.Sprintf("ThisUpdate %s", resp.ThisUpdate))
+
+	// Invalid base64 is refused.
+	w = get("req=not*base64")
+	test.AssertEquals(t, w.Code, http.StatusBadRequest)
+	test.AssertContains(t, w.Body.String(), "Decoding base64")
+
+	// As are valid base64 which isn't an OCSP request, and a missing request.
+	w = get("req=" + base64.StdEncoding.EncodeToString([]byte("hello")))
+	test.AssertEquals(t, w.Code, http.StatusBadRequest)
+	test.AssertContains(t, w.Body.String(), "Parsing OCSP request")
+	w = get("")
+	test.AssertEquals(t, w.Code, http.StatusBadRequest)
+
+	// Lookup failures are reported along with the decoded request.
+	empty, err := responder.NewMemorySource(map[string]*responder.Response{}, blog.NewMock())
+	test.AssertNotError(t, err, "failed to create inMemorySource")
+	w = httptest.NewRecorder()
+	debugOCSPHandler(empty, 0).ServeHTTP(w, httptest.NewRequest("GET", debugOCSPPath+"?req="+url.QueryEscape(base64.StdEncoding.EncodeToString(reqBytes)), nil))
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertContains(t, w.Body.String(), "Lookup failed: "+responder.ErrNotFound.Error())
+}
@@ -0,0 +1,93 @@
+package notmain
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/letsencrypt/boulder/config"
+)
+
+// HealthConfig configures the static responses served for health checks,
+// outside of OCSP request handling. The zero value answers GET and HEAD
+// requests for "/" with a 200 and serves no other health paths.
+type HealthConfig struct {
+	// RootStatus is the status code sent for GET and HEAD requests for "/".
+	// The default of 200 suits load balancers which probe "/". Setting it to
+	// 404 stops answering "/" as a health check, so that it can't be used to
+	// bypass the real ones, and so that a proxy which wrongly forwards such
+	// probes, rather than requests under its OCSP path, shows up as failing
+	// health checks.
+	RootStatus int `validate:"omitempty,oneof=200 404"`
+
+	// Paths lists further paths for which GET and HEAD requests are answered
+	// with a static 200, for use as health checks when "/" isn't. They are
+	// matched exactly, before the OCSP path.
+	Paths []string `validate:"dive,startswith=/"`
+
+	// IssuerExpiryWindow, if non-zero, marks the responder as degraded while
+	// any issuer certificate expires within this long. Every replica loading
+	// the same issuers is degraded at once, so this is for alerting, not for
+	// draining traffic.
+	IssuerExpiryWindow config.Duration `validate:"-"`
+
+	// DegradedStatus is the status code sent for health checks, in place of
+	// a 200, while the responder is degraded. Defaults to 503.
+	DegradedStatus int `validate:"omitempty,min=300,max=599"`
+}
+
+// rootStatus returns the status code sent for GET and HEAD requests for "/".
+func (hc HealthConfig) rootStatus() int {
+	if hc.RootStatus == 0 {
+		return http.StatusOK
+	}
+	return hc.RootStatus
+}
+
+// healthStatus returns the status code with which to answer r if it's a
+// health check, and false if it isn't.
+func (hc HealthConfig) healthStatus(r *http.Request) (int, bool) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return 0, false
+	}
+	if r.URL.Path == "/" {
+		return hc.rootStatus(), true
+	}
+	for _, path := range hc.Paths {
+		if r.URL.Path == path {
+			return http.StatusOK, true
+		}
+	}
+	return 0, false
+}
+
+// degradedStatus returns status, or the configured degraded status if status
+// is a 200 and expiry is degraded.
+func (hc HealthConfig) degradedStatus(status int, expiry *issuerExpiry) int {
+	if status != http.StatusOK || !expiry.degraded() {
+		return status
+	}
+	if hc.DegradedStatus == 0 {
+		return http.StatusServiceUnavailable
+	}
+	return hc.DegradedStatus
+}
+
+// lameDuck tracks whether the responder is in lame-duck mode: about to shut
+// down, and so failing its health checks to have load balancers drain it,
+// while still answering OCSP requests. A nil *lameDuck is never active.
+type lameDuck struct {
+	active atomic.Bool
+}
+
+// enter puts the responder into lame-duck mode.
+func (ld *lameDuck) enter() {
+	ld.active.Store(true)
+}
+
+// healthStatus returns status, or a 503 if in lame-duck mode.
+func (ld *lameDuck) healthStatus(status int) int {
+	if ld == nil || !ld.active.Load() {
+		return status
+	}
+	return http.StatusServiceUnavailable
+}
@@ -0,0 +1,92 @@
+package notmain
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/issuance"
+)
+
+// issuerExpiry tracks how soon the loaded issuer certificates expire. Our
+// responses for an issuer are worthless once its certificate has expired, so
+// an issuer nearing expiry marks the responder as degraded, if a window is
+// configured. A nil *issuerExpiry is never degraded.
+type issuerExpiry struct {
+	mu       sync.RWMutex
+	certs    []*issuance.Certificate
+	earliest time.Time
+
+	window time.Duration
+	clk    clock.Clock
+	desc   *prometheus.Desc
+}
+
+// newIssuerExpiry exports the time until each of certs expires as a gauge,
+// and returns an issuerExpiry which is degraded while any of them expires
+// within window. If window is zero, it's never degraded. The certificates can
+// be replaced, when the issuers are reloaded, with update.
+func newIssuerExpiry(certs []*issuance.Certificate, window time.Duration, stats prometheus.Registerer, clk clock.Clock) *issuerExpiry {
+	ie := &issuerExpiry{
+		window: window,
+		clk:    clk,
+		// Variants of an issuer, such as cross-signs, share a common name,
+		// so the certificate's serial tells them apart.
+		desc: prometheus.NewDesc(
+			"ocsp_issuer_cert_expiry_seconds",
+			"Seconds until the issuer certificate expires, negative once it has",
+			[]string{"issuer", "serial"},
+			nil,
+		),
+	}
+	ie.update(certs)
+	stats.MustRegister(ie)
+	return ie
+}
+
+// update replaces the certificates whose expiry is tracked.
+func (ie *issuerExpiry) update(certs []*issuance.Certificate) {
+	var earliest time.Time
+	for _, cert := range certs {
+		if earliest.IsZero() || cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+	}
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+	ie.certs = certs
+	ie.earliest = earliest
+}
+
+// Describe implements prometheus.Collector.
+func (ie *issuerExpiry) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ie.desc
+}
+
+// Collect implements prometheus.Collector.
+func (ie *issuerExpiry) Collect(ch chan<- prometheus.Metric) {
+	ie.mu.RLock()
+	defer ie.mu.RUnlock()
+	for _, cert := range ie.certs {
+		ch <- prometheus.MustNewConstMetric(
+			ie.desc,
+			prometheus.GaugeValue,
+			cert.NotAfter.Sub(ie.clk.Now()).Seconds(),
+			cert.Subject.CommonName,
+			core.SerialToString(cert.SerialNumber),
+		)
+	}
+}
+
+// degraded returns true if any issuer certificate expires within the window.
+func (ie *issuerExpiry) degraded() bool {
+	if ie == nil || ie.window == 0 {
+		return false
+	}
+	ie.mu.RLock()
+	defer ie.mu.RUnlock()
+	return ie.earliest.Sub(ie.clk.Now()) < ie.window
+}
@@ -0,0 +1,103 @@
+package notmain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/letsencrypt/boulder/config"
+	"github.com/letsencrypt/boulder/issuance"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// nearExpiryIssuer returns an issuer certificate which expires an hour from
+// now.
+func nearExpiryIssuer(t *testing.T) *issuance.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "generating issuer key")
+	cert, _ := writeTestCert(t, t.TempDir(), "expiring issuer", 7, key, nil, nil)
+	ic, err := issuance.NewCertificate(cert)
+	test.AssertNotError(t, err, "loading issuer certificate")
+	return ic
+}
+
+func TestIssuerExpiry(t *testing.T) {
+	issuer := nearExpiryIssuer(t)
+	clk := clock.NewFake()
+	clk.Set(issuer.NotAfter.Add(-time.Hour))
+
+	// Without a window, the gauge is still exported, but the responder is
+	// never degraded.
+	reg := prometheus.NewRegistry()
+	expiry := newIssuerExpiry([]*issuance.Certificate{issuer}, 0, reg, clk)
+	test.Assert(t, !expiry.degraded(), "issuerExpiry without a window is degraded")
+	var nilExpiry *issuerExpiry
+	test.Assert(t, !nilExpiry.degraded(), "nil issuerExpiry is degraded")
+	var out bytes.Buffer
+	err := writeMetrics(reg, &out)
+	test.AssertNotError(t, err, "writing metrics")
+	test.AssertContains(t, out.String(), `ocsp_issuer_cert_expiry_seconds{issuer="expiring issuer",serial="000000000000000000000000000000000007"} 3600`)
+
+	// Replacing the issuers, as a reload does, replaces their gauges too.
+	expiry.update([]*issuance.Certificate{testIssuer(t, "reloaded issuer", 8)})
+	out.Reset()
+	err = writeMetrics(reg, &out)
+	test.AssertNotError(t, err, "writing metrics")
+	test.AssertContains(t, out.String(), `ocsp_issuer_cert_expiry_seconds{issuer="reloaded issuer",serial="000000000000000000000000000000000008"}`)
+	test.AssertNotContains(t, out.String(), `issuer="expiring issuer"`)
+
+	expiry = newIssuerExpiry([]*issuance.Certificate{issuer}, 24*time.Hour, metrics.NoopRegisterer, clk)
+	test.Assert(t, expiry.degraded(), "issuer expiring within the window isn't degraded")
+
+	// Two days earlier, the issuer was outside the window.
+	clk.Add(-48 * time.Hour)
+	test.Assert(t, !expiry.degraded(), "issuer expiring outside the window is degraded")
+}
+
+func TestMuxIssuerExpiry(t *testing.T) {
+	issuer := nearExpiryIssuer(t)
+	clk := clock.NewFake()
+	clk.Set(issuer.NotAfter.Add(-time.Hour))
+	expiry := newIssuerExpiry([]*issuance.Certificate{issuer}, 24*time.Hour, metrics.NoopRegisterer, clk)
+
+	serve := func(health HealthConfig, ld *lameDuck) *httptest.ResponseRecorder {
+		t.Helper()
+		h := mux(&countingSource{}, muxConfig{responderPath: "/ocsp/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}, health: health, lameDuck: ld, expiry: expiry}, metrics.NoopRegisterer, blog.NewMock())
+		r, err := http.NewRequest("GET", "/", nil)
+		test.AssertNotError(t, err, "creating request")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	window := config.Duration{Duration: 24 * time.Hour}
+	w := serve(HealthConfig{IssuerExpiryWindow: window}, nil)
+	test.AssertEquals(t, w.Code, http.StatusServiceUnavailable)
+	test.AssertEquals(t, w.Header().Get("Cache-Control"), "")
+
+	test.AssertEquals(t, serve(HealthConfig{IssuerExpiryWindow: window, DegradedStatus: 429}, nil).Code, http.StatusTooManyRequests)
+
+	// A health check configured to fail anyway keeps its own status.
+	test.AssertEquals(t, serve(HealthConfig{IssuerExpiryWindow: window, RootStatus: 404}, nil).Code, http.StatusNotFound)
+
+	// Lame-duck mode takes precedence.
+	ld := &lameDuck{}
+	ld.enter()
+	test.AssertEquals(t, serve(HealthConfig{IssuerExpiryWindow: window, DegradedStatus: 429}, ld).Code, http.StatusServiceUnavailable)
+
+	// Once the issuer is outside the window, health checks pass again.
+	clk.Add(-48 * time.Hour)
+	test.AssertEquals(t, serve(HealthConfig{IssuerExpiryWindow: window}, nil).Code, http.StatusOK)
+}
@@ -0,0 +1,148 @@
+package notmain
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/issuance"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+)
+
+// issuerReloader is implemented by the filter source, whose issuers can be
+// replaced while serving.
+type issuerReloader interface {
+	ReloadIssuers(resolver responder.IssuerResolver, check func([]*issuance.Certificate) error) ([]*issuance.Certificate, []*issuance.Certificate, error)
+}
+
+// issuerReload reloads the filter's issuers, along with the state derived
+// from them elsewhere: the issuer serial prefixes are checked against the new
+// issuers, which are refused if they don't match, and the issuer expiry
+// metrics and health are updated. The signing keys of the status and
+// blocklist sources are configured separately, and aren't reloaded.
+type issuerReload struct {
+	// mu serializes reloads, so that the expiry and audit log follow the
+	// filter's issuers in the order they were replaced.
+	mu       sync.Mutex
+	filter   issuerReloader
+	resolver responder.IssuerResolver
+	// prefixes, if non-nil, are the configured serial prefixes of each
+	// issuer, which the new issuers must match.
+	prefixes responder.IssuerSerialPrefixes
+	expiry   *issuerExpiry
+	logger   blog.Logger
+}
+
+// The sources of an issuer reload, recorded in its audit log entry.
+const (
+	reloadSourceInterval = "interval"
+	reloadSourceSignal   = "signal"
+	reloadSourceAdmin    = "admin"
+)
+
+// reload reloads the issuers once, on behalf of source. A successful reload
+// is audit logged with source, the fingerprints of the issuer sets before and
+// after it, those issuers, and the change in their number. The issuer expiry
+// follows the issuers the filter is using afterwards, which a failed reload
+// may also have changed, depending on the filter's reload policy.
+func (ir *issuerReload) reload(source string) error {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	var check func([]*issuance.Certificate) error
+	if ir.prefixes != nil {
+		check = ir.prefixes.Check
+	}
+	old, loaded, err := ir.filter.ReloadIssuers(ir.resolver, check)
+	if ir.expiry != nil {
+		ir.expiry.update(loaded)
+	}
+	if err != nil {
+		return err
+	}
+	ir.logger.AuditInfof("Reloaded issuer certificates from %s: fingerprint %s (was %s), %d issuers (%+d): [%s] (was [%s])",
+		source, issuerFingerprint(loaded), issuerFingerprint(old), len(loaded), len(loaded)-len(old), issuerIDs(loaded), issuerIDs(old))
+	return nil
+}
+
+// issuerFingerprint returns the hex SHA-256 of the sorted SHA-256s of each of
+// certs, which identifies the set of issuer certificates regardless of the
+// order in which they were configured.
+func issuerFingerprint(certs []*issuance.Certificate) string {
+	hashes := make([][]byte, 0, len(certs))
+	for _, cert := range certs {
+		hash := sha256.Sum256(cert.Raw)
+		hashes = append(hashes, hash[:])
+	}
+	slices.SortFunc(hashes, bytes.Compare)
+	fingerprint := sha256.Sum256(bytes.Join(hashes, nil))
+	return fmt.Sprintf("%x", fingerprint)
+}
+
+// issuerIDs describes each of certs by common name and issuer ID.
+func issuerIDs(certs []*issuance.Certificate) string {
+	ids := make([]string, 0, len(certs))
+	for _, cert := range certs {
+		ids = append(ids, fmt.Sprintf("%s (%d)", cert.Subject.CommonName, cert.NameID()))
+	}
+	return strings.Join(ids, ", ")
+}
+
+// reloadIssuers reloads the issuers every interval, if it's non-zero, and
+// whenever a signal is received, until ctx is done. A failed reload is
+// logged, and also audit logged by the filter, which keeps or drops the
+// previously loaded issuers according to its reload policy.
+func reloadIssuers(ctx context.Context, ir *issuerReload, interval time.Duration, signals <-chan os.Signal, clk clock.Clock) {
+	for {
+		var tick <-chan time.Time
+		if interval > 0 {
+			tick = clk.After(interval)
+		}
+		source := reloadSourceInterval
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case <-signals:
+			source = reloadSourceSignal
+		}
+		err := ir.reload(source)
+		if err != nil {
+			ir.logger.Errf("Reloading issuer certificates: %s", err)
+		}
+	}
+}
+
+// reloadIssuersPath is the path on the admin server to which a POST reloads
+// the issuers.
+const reloadIssuersPath = "/reload-issuers"
+
+// reloadIssuersHandler returns a handler which reloads the issuers on a POST,
+// and reports the outcome.
+func reloadIssuersHandler(ir *issuerReload) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		err := ir.reload(reloadSourceAdmin)
+		if err != nil {
+			ir.logger.Errf("Reloading issuer certificates: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Reloading issuer certificates: %s\n", err)
+			return
+		}
+		fmt.Fprintf(w, "Reloaded issuer certificates\n")
+	})
+}
@@ -0,0 +1,202 @@
+package notmain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/issuance"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// countingReloader reports each reload on calls, failing the first.
+type countingReloader struct {
+	calls chan int
+	n     int
+}
+
+func (cr *countingReloader) ReloadIssuers(responder.IssuerResolver, func([]*issuance.Certificate) error) ([]*issuance.Certificate, []*issuance.Certificate, error) {
+	cr.n++
+	cr.calls <- cr.n
+	if cr.n == 1 {
+		return nil, nil, errors.New("no issuers")
+	}
+	return nil, nil, nil
+}
+
+func TestReloadIssuers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reloader := &countingReloader{calls: make(chan int, 100)}
+	log := blog.NewMock()
+	done := make(chan struct{})
+	go func() {
+		reloadIssuers(ctx, &issuerReload{filter: reloader, logger: log}, time.Millisecond, nil, clock.New())
+		close(done)
+	}()
+
+	// A failed reload is logged, and reloading carries on.
+	test.AssertEquals(t, <-reloader.calls, 1)
+	test.AssertEquals(t, <-reloader.calls, 2)
+	test.AssertEquals(t, len(log.GetAllMatching("Reloading issuer certificates: no issuers")), 1)
+
+	cancel()
+	<-done
+}
+
+func TestReloadIssuersOnSignal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reloader := &countingReloader{calls: make(chan int, 100)}
+	log := blog.NewMock()
+	signals := make(chan os.Signal)
+	done := make(chan struct{})
+	go func() {
+		// Without an interval, reloads only happen on a signal.
+		reloadIssuers(ctx, &issuerReload{filter: reloader, logger: log}, 0, signals, clock.New())
+		close(done)
+	}()
+
+	signals <- syscall.SIGUSR1
+	test.AssertEquals(t, <-reloader.calls, 1)
+	signals <- syscall.SIGUSR1
+	test.AssertEquals(t, <-reloader.calls, 2)
+	test.AssertEquals(t, len(log.GetAllMatching(`\[AUDIT\] Reloaded issuer certificates from signal`)), 1)
+
+	cancel()
+	<-done
+}
+
+// testIssuer returns a self-signed issuer certificate with the given common
+// name and serial.
+func testIssuer(t *testing.T, name string, serial int64) *issuance.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "generating issuer key")
+	cert, _ := writeTestCert(t, t.TempDir(), name, serial, key, nil, nil)
+	ic, err := issuance.NewCertificate(cert)
+	test.AssertNotError(t, err, "loading issuer certificate")
+	return ic
+}
+
+func TestIssuerReload(t *testing.T) {
+	issuerA := testIssuer(t, "issuer A", 1)
+	issuerB := testIssuer(t, "issuer B", 2)
+	clk := clock.NewFake()
+
+	filter, err := responder.NewFilterSource(responder.StaticIssuers{issuerA}, responder.FilterConfig{}, nil, metrics.NoopRegisterer, blog.NewMock(), clk)
+	test.AssertNotError(t, err, "creating filter")
+	expiry := newIssuerExpiry(filter.IssuerCertificates(), time.Hour, metrics.NoopRegisterer, clk)
+	log := blog.NewMock()
+	ir := &issuerReload{
+		filter:   filter,
+		prefixes: responder.IssuerSerialPrefixes{"issuer A": {"01"}},
+		expiry:   expiry,
+		logger:   log,
+	}
+
+	// Issuers which don't match the serial prefixes are refused, so the
+	// filter, expiry and prefixes stay consistent.
+	ir.resolver = responder.StaticIssuers{issuerB}
+	err = ir.reload(reloadSourceInterval)
+	test.AssertError(t, err, "reloaded issuers which don't match the serial prefixes")
+	test.AssertContains(t, err.Error(), `no serial prefixes for loaded issuer "issuer B"`)
+	test.AssertDeepEquals(t, filter.IssuerCertificates(), []*issuance.Certificate{issuerA})
+	test.AssertEquals(t, len(log.GetAllMatching(`\[AUDIT\] Reloaded issuer certificates`)), 0)
+
+	// Once they match, the reload is audit logged with its source, the
+	// fingerprints of the issuer sets and the issuers before and after it,
+	// and the issuer expiry follows the new issuers.
+	ir.prefixes = responder.IssuerSerialPrefixes{"issuer A": {"01"}, "issuer B": {"02"}}
+	ir.resolver = responder.StaticIssuers{issuerA, issuerB}
+	err = ir.reload(reloadSourceInterval)
+	test.AssertNotError(t, err, "reloading issuers")
+	test.AssertDeepEquals(t, filter.IssuerCertificates(), []*issuance.Certificate{issuerA, issuerB})
+	test.AssertEquals(t, len(log.GetAllMatching(fmt.Sprintf(
+		`\[AUDIT\] Reloaded issuer certificates from interval: fingerprint %s \(was %s\), 2 issuers \(\+1\): \[issuer A \(%d\), issuer B \(%d\)\] \(was \[issuer A \(%d\)\]\)`,
+		issuerFingerprint([]*issuance.Certificate{issuerB, issuerA}), issuerFingerprint([]*issuance.Certificate{issuerA}),
+		issuerA.NameID(), issuerB.NameID(), issuerA.NameID(),
+	))), 1)
+	test.AssertNotEquals(t, issuerFingerprint([]*issuance.Certificate{issuerA}), issuerFingerprint([]*issuance.Certificate{issuerB}))
+	expiry.mu.RLock()
+	test.AssertEquals(t, len(expiry.certs), 2)
+	expiry.mu.RUnlock()
+
+	// Without prefixes, any issuers are accepted.
+	ir.prefixes = nil
+	ir.resolver = responder.StaticIssuers{issuerB}
+	err = ir.reload(reloadSourceInterval)
+	test.AssertNotError(t, err, "reloading issuers without prefixes")
+	test.AssertDeepEquals(t, filter.IssuerCertificates(), []*issuance.Certificate{issuerB})
+	test.AssertEquals(t, len(log.GetAllMatching(`\[AUDIT\] Reloaded issuer certificates from interval: .*, 1 issuers \(-1\)`)), 1)
+}
+
+func TestReloadIssuersHandler(t *testing.T) {
+	issuerA := testIssuer(t, "issuer A", 1)
+	filter, err := responder.NewFilterSource(responder.StaticIssuers{issuerA}, responder.FilterConfig{}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.NewFake())
+	test.AssertNotError(t, err, "creating filter")
+	log := blog.NewMock()
+	ir := &issuerReload{filter: filter, resolver: responder.StaticIssuers{issuerA}, logger: log}
+	h := reloadIssuersHandler(ir)
+
+	// Only a POST reloads the issuers.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", reloadIssuersPath, nil))
+	test.AssertEquals(t, w.Code, http.StatusMethodNotAllowed)
+	test.AssertEquals(t, w.Header().Get("Allow"), "POST")
+	test.AssertEquals(t, len(log.GetAllMatching(`Reloaded issuer certificates`)), 0)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", reloadIssuersPath, nil))
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, len(log.GetAllMatching(`\[AUDIT\] Reloaded issuer certificates from admin: .*, 1 issuers \(\+0\)`)), 1)
+
+	// A failed reload is reported.
+	ir.resolver = responder.StaticIssuers{}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", reloadIssuersPath, nil))
+	test.AssertEquals(t, w.Code, http.StatusInternalServerError)
+	test.AssertContains(t, w.Body.String(), "Reloading issuer certificates: ")
+	test.AssertEquals(t, len(log.GetAllMatching(`Reloading issuer certificates: `)), 1)
+}
+
+func TestIssuerReloadFailClosed(t *testing.T) {
+	issuerA := testIssuer(t, "issuer A", 1)
+	clk := clock.NewFake()
+	clk.Set(issuerA.NotBefore)
+
+	filter, err := responder.NewFilterSource(responder.StaticIssuers{issuerA}, responder.FilterConfig{ReloadPolicy: responder.ReloadFailClosed}, nil, metrics.NoopRegisterer, blog.NewMock(), clk)
+	test.AssertNotError(t, err, "creating filter")
+	expiry := newIssuerExpiry(filter.IssuerCertificates(), time.Minute, metrics.NoopRegisterer, clk)
+	test.Assert(t, !expiry.degraded(), "degraded before reload")
+	ir := &issuerReload{
+		filter:   filter,
+		resolver: responder.StaticIssuers{},
+		expiry:   expiry,
+		logger:   blog.NewMock(),
+	}
+
+	// A failed reload drops the issuers, and the expiry with them, so the
+	// responder is degraded until a reload succeeds.
+	err = ir.reload(reloadSourceInterval)
+	test.AssertError(t, err, "reloaded no issuers")
+	test.AssertEquals(t, len(filter.IssuerCertificates()), 0)
+	test.Assert(t, expiry.degraded(), "not degraded after failed reload")
+
+	ir.resolver = responder.StaticIssuers{issuerA}
+	err = ir.reload(reloadSourceInterval)
+	test.AssertNotError(t, err, "reloading issuers")
+	test.Assert(t, !expiry.degraded(), "degraded after successful reload")
+}
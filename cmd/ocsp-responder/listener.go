@@ -0,0 +1,220 @@
+package notmain
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/config"
+)
+
+// ListenerConfig tunes the socket-level behaviour of the HTTP listener,
+// independently of how many requests may be in flight. The zero value uses
+// Go's defaults and imposes no connection limit.
+type ListenerConfig struct {
+	// KeepAlive is the interval between TCP keep-alive probes on accepted
+	// connections. Zero uses Go's default of 15 seconds.
+	KeepAlive config.Duration `validate:"-"`
+
+	// SocketMode is the octal file mode, e.g. "0660", given to a Unix domain
+	// socket listened on with a "unix:" address. By default the mode is
+	// determined by the process's umask.
+	SocketMode string `validate:"omitempty,numeric"`
+
+	// MaxConnections caps the number of connections open at once. Zero means
+	// no limit.
+	MaxConnections int `validate:"min=0"`
+
+	// RejectExcessConnections causes connections beyond MaxConnections to be
+	// accepted and immediately closed. By default they are instead left
+	// queued in the kernel's backlog until an open connection closes.
+	RejectExcessConnections bool
+}
+
+// unixPrefix marks a listen address as the path of a Unix domain socket.
+const unixPrefix = "unix:"
+
+// listen returns a listener on addr, configured as described by conf. If addr
+// starts with "unix:", it's a Unix domain socket at the path which follows;
+// otherwise it's a TCP address.
+func listen(addr string, conf ListenerConfig, stats prometheus.Registerer) (net.Listener, error) {
+	var ln net.Listener
+	var err error
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		ln, err = listenUnix(path, conf.SocketMode)
+	} else {
+		lc := net.ListenConfig{KeepAlive: conf.KeepAlive.Duration}
+		ln, err = lc.Listen(context.Background(), "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if conf.MaxConnections == 0 {
+		return ln, nil
+	}
+
+	rejected := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ocsp_listener_rejected_connections",
+		Help: "Count of connections closed on accept because the connection limit was reached",
+	})
+	stats.MustRegister(rejected)
+	ll := &limitListener{
+		Listener: ln,
+		sem:      make(chan struct{}, conf.MaxConnections),
+		done:     make(chan struct{}),
+		reject:   conf.RejectExcessConnections,
+		rejected: rejected,
+	}
+	stats.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ocsp_listener_open_connections",
+		Help: "Number of connections currently open, out of the configured limit",
+	}, func() float64 {
+		return float64(len(ll.sem))
+	}))
+	return ll, nil
+}
+
+// HTTPSConfig configures an optional HTTPS listener, on which the same
+// handler as the plain HTTP listener is served, for relying parties which
+// require OCSP over HTTPS. The zero value serves no HTTPS.
+type HTTPSConfig struct {
+	// ListenAddress is the address:port on which to serve HTTPS, e.g. ":443".
+	ListenAddress string `validate:"omitempty,hostname_port"`
+
+	// TLS holds the server's certificate and key. Clients aren't
+	// authenticated, so CACertFile is required by the loader but unused.
+	TLS cmd.TLSConfig `validate:"required_with=ListenAddress,structonly"`
+}
+
+// listenHTTPS returns a listener which accepts TLS connections on the
+// address in conf, presenting the certificate in conf.TLS. The listener is
+// otherwise configured by listenerConf, as for listen, with its metrics
+// prefixed by "https_" to keep them apart from the plain listener's.
+func listenHTTPS(conf HTTPSConfig, listenerConf ListenerConfig, stats prometheus.Registerer) (net.Listener, error) {
+	tlsConfig, err := conf.TLS.Load(stats)
+	if err != nil {
+		return nil, err
+	}
+	// Load returns a config for our internal mTLS connections. Relying
+	// parties are anonymous, and some predate TLS 1.3.
+	tlsConfig.ClientAuth = tls.NoClientCert
+	tlsConfig.ClientCAs = nil
+	tlsConfig.MinVersion = tls.VersionTLS12
+
+	ln, err := listen(conf.ListenAddress, listenerConf, prometheus.WrapRegistererWithPrefix("https_", stats))
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(ln, tlsConfig), nil
+}
+
+// listenUnix returns a listener on a Unix domain socket at path, with the
+// given octal file mode if it's non-empty. A socket left at path by a previous
+// run is removed first; any other kind of file there is an error.
+func listenUnix(path string, mode string) (net.Listener, error) {
+	info, err := os.Lstat(path)
+	if err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return nil, fmt.Errorf("removing stale socket: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != "" {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("parsing socket mode %q: %w", mode, err)
+		}
+		err = os.Chmod(path, os.FileMode(perm))
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("setting socket mode: %w", err)
+		}
+	}
+	return ln, nil
+}
+
+// limitListener is a net.Listener which allows at most cap(sem) connections
+// to be open at once.
+type limitListener struct {
+	net.Listener
+	sem       chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	reject    bool
+	rejected  prometheus.Counter
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	if l.reject {
+		for {
+			conn, err := l.Listener.Accept()
+			if err != nil {
+				return nil, err
+			}
+			select {
+			case l.sem <- struct{}{}:
+				return &limitConn{Conn: conn, release: l.release}, nil
+			default:
+				l.rejected.Inc()
+				conn.Close()
+			}
+		}
+	}
+
+	// Wait for a free slot before accepting, so that excess connections stay
+	// in the kernel's backlog.
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		l.release()
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: l.release}, nil
+}
+
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+func (l *limitListener) release() {
+	<-l.sem
+}
+
+// limitConn returns its slot to the limitListener when closed.
+type limitConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
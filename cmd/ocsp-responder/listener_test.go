@@ -0,0 +1,266 @@
+package notmain
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/cmd"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// acceptAsync calls ln.Accept in a goroutine, delivering the result on the
+// returned channel.
+func acceptAsync(ln net.Listener) <-chan net.Conn {
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+	return accepted
+}
+
+func TestListenerNoLimit(t *testing.T) {
+	ln, err := listen("127.0.0.1:0", ListenerConfig{}, metrics.NoopRegisterer)
+	test.AssertNotError(t, err, "listening")
+	defer ln.Close()
+	_, ok := ln.(*limitListener)
+	test.Assert(t, !ok, "listener without a connection limit was wrapped")
+}
+
+func TestListenerQueuesExcessConnections(t *testing.T) {
+	ln, err := listen("127.0.0.1:0", ListenerConfig{MaxConnections: 1}, metrics.NoopRegisterer)
+	test.AssertNotError(t, err, "listening")
+	defer ln.Close()
+
+	c1, err := net.Dial("tcp", ln.Addr().String())
+	test.AssertNotError(t, err, "dialing first connection")
+	defer c1.Close()
+	a1, err := ln.Accept()
+	test.AssertNotError(t, err, "accepting first connection")
+
+	c2, err := net.Dial("tcp", ln.Addr().String())
+	test.AssertNotError(t, err, "dialing second connection")
+	defer c2.Close()
+	accepted := acceptAsync(ln)
+	select {
+	case <-accepted:
+		t.Fatal("accepted a connection beyond the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Closing the first connection frees a slot for the queued one.
+	a1.Close()
+	select {
+	case a2, ok := <-accepted:
+		test.Assert(t, ok, "accept failed after a slot was freed")
+		a2.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued connection was not accepted after a slot was freed")
+	}
+}
+
+func TestListenerRejectsExcessConnections(t *testing.T) {
+	stats := prometheus.NewRegistry()
+	ln, err := listen("127.0.0.1:0", ListenerConfig{MaxConnections: 1, RejectExcessConnections: true}, stats)
+	test.AssertNotError(t, err, "listening")
+
+	c1, err := net.Dial("tcp", ln.Addr().String())
+	test.AssertNotError(t, err, "dialing first connection")
+	defer c1.Close()
+	a1, err := ln.Accept()
+	test.AssertNotError(t, err, "accepting first connection")
+	defer a1.Close()
+
+	c2, err := net.Dial("tcp", ln.Addr().String())
+	test.AssertNotError(t, err, "dialing second connection")
+	defer c2.Close()
+	accepted := acceptAsync(ln)
+
+	// The excess connection is closed by the server without being handed to
+	// the caller of Accept.
+	err = c2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	test.AssertNotError(t, err, "setting read deadline")
+	_, err = c2.Read(make([]byte, 1))
+	test.AssertErrorIs(t, err, io.EOF)
+	test.AssertMetricWithLabelsEquals(t, ln.(*limitListener).rejected, nil, 1)
+
+	ln.Close()
+	_, ok := <-accepted
+	test.Assert(t, !ok, "accepted a connection beyond the limit")
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ocsp.sock")
+
+	// A non-socket file at the path is not replaced.
+	err := os.WriteFile(path, nil, 0600)
+	test.AssertNotError(t, err, "writing file")
+	_, err = listen(unixPrefix+path, ListenerConfig{}, metrics.NoopRegisterer)
+	test.AssertError(t, err, "listened over a regular file")
+	err = os.Remove(path)
+	test.AssertNotError(t, err, "removing file")
+
+	// A stale socket is replaced.
+	stale, err := net.Listen("unix", path)
+	test.AssertNotError(t, err, "creating stale socket")
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listen(unixPrefix+path, ListenerConfig{SocketMode: "0660", MaxConnections: 2}, metrics.NoopRegisterer)
+	test.AssertNotError(t, err, "listening")
+	defer ln.Close()
+	info, err := os.Stat(path)
+	test.AssertNotError(t, err, "stat socket")
+	test.AssertEquals(t, info.Mode().Perm(), os.FileMode(0660))
+
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+	respBytes, err := os.ReadFile("./testdata/ocsp.resp")
+	test.AssertNotError(t, err, "failed to read OCSP response")
+	resp, err := ocsp.ParseResponse(respBytes, nil)
+	test.AssertNotError(t, err, "failed to parse OCSP response")
+	src, err := responder.NewMemorySource(map[string]*responder.Response{
+		req.SerialNumber.String(): {Response: resp, Raw: respBytes},
+	}, blog.NewMock())
+	test.AssertNotError(t, err, "failed to create inMemorySource")
+
+	srv := &http.Server{
+		Handler: mux(src, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}}, metrics.NoopRegisterer, blog.NewMock()),
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	httpResp, err := client.Post("http://ocsp/", "application/ocsp-request", bytes.NewReader(reqBytes))
+	test.AssertNotError(t, err, "sending request over socket")
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(httpResp.Body)
+	test.AssertNotError(t, err, "reading response")
+	test.AssertEquals(t, httpResp.StatusCode, http.StatusOK)
+	test.AssertByteEquals(t, body, respBytes)
+}
+
+// writeServerCert writes a self-signed certificate for 127.0.0.1, and its
+// key, to dir, and returns the certificate along with a TLSConfig naming the
+// files.
+func writeServerCert(t *testing.T, dir string) (*x509.Certificate, cmd.TLSConfig) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "generating key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(443),
+		Subject:      pkix.Name{CommonName: "ocsp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	test.AssertNotError(t, err, "creating certificate")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "parsing certificate")
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	test.AssertNotError(t, err, "marshaling key")
+
+	conf := cmd.TLSConfig{
+		CertFile:   filepath.Join(dir, "cert.pem"),
+		KeyFile:    filepath.Join(dir, "key.pem"),
+		CACertFile: filepath.Join(dir, "cert.pem"),
+	}
+	err = os.WriteFile(conf.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	test.AssertNotError(t, err, "writing certificate")
+	err = os.WriteFile(conf.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	test.AssertNotError(t, err, "writing key")
+	return cert, conf
+}
+
+func TestListenHTTPS(t *testing.T) {
+	cert, tlsConf := writeServerCert(t, t.TempDir())
+
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+	respBytes, err := os.ReadFile("./testdata/ocsp.resp")
+	test.AssertNotError(t, err, "failed to read OCSP response")
+	resp, err := ocsp.ParseResponse(respBytes, nil)
+	test.AssertNotError(t, err, "failed to parse OCSP response")
+	src, err := responder.NewMemorySource(map[string]*responder.Response{
+		req.SerialNumber.String(): {Response: resp, Raw: respBytes},
+	}, blog.NewMock())
+	test.AssertNotError(t, err, "failed to create inMemorySource")
+	h := mux(src, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}}, metrics.NoopRegisterer, blog.NewMock())
+
+	// Both listeners share a connection limit configuration, so the HTTPS
+	// listener's metrics must not collide with the plain listener's.
+	reg := prometheus.NewRegistry()
+	listenerConf := ListenerConfig{MaxConnections: 2}
+	ln, err := listen("127.0.0.1:0", listenerConf, reg)
+	test.AssertNotError(t, err, "listening for HTTP")
+	httpsLn, err := listenHTTPS(HTTPSConfig{ListenAddress: "127.0.0.1:0", TLS: tlsConf}, listenerConf, reg)
+	test.AssertNotError(t, err, "listening for HTTPS")
+
+	srv := newServer("", h, ServerTimeoutConfig{})
+	go srv.Serve(ln)
+	defer srv.Close()
+	httpsSrv := newServer("", h, ServerTimeoutConfig{})
+	go httpsSrv.Serve(httpsLn)
+	defer httpsSrv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	for _, url := range []string{"http://" + ln.Addr().String() + "/", "https://" + httpsLn.Addr().String() + "/"} {
+		httpResp, err := client.Post(url, "application/ocsp-request", bytes.NewReader(reqBytes))
+		test.AssertNotError(t, err, "sending request to "+url)
+		body, err := io.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+		test.AssertNotError(t, err, "reading response")
+		test.AssertEquals(t, httpResp.StatusCode, http.StatusOK)
+		test.AssertByteEquals(t, body, respBytes)
+	}
+
+	// Clients without a certificate are served; the config's client
+	// authentication and TLS 1.3 minimum are for internal connections only.
+	tls12 := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MaxVersion: tls.VersionTLS12}}}
+	httpResp, err := tls12.Post("https://"+httpsLn.Addr().String()+"/", "application/ocsp-request", bytes.NewReader(reqBytes))
+	test.AssertNotError(t, err, "sending request over TLS 1.2")
+	httpResp.Body.Close()
+	test.AssertEquals(t, httpResp.StatusCode, http.StatusOK)
+
+	var out bytes.Buffer
+	err = writeMetrics(reg, &out)
+	test.AssertNotError(t, err, "writing metrics")
+	test.AssertContains(t, out.String(), "https_ocsp_listener_open_connections")
+}
@@ -1,20 +1,40 @@
 package notmain
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"expvar"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"regexp"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/jmhodges/clock"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/crypto/ocsp"
 
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/config"
+	"github.com/letsencrypt/boulder/core"
 	"github.com/letsencrypt/boulder/db"
 	"github.com/letsencrypt/boulder/features"
 	bgrpc "github.com/letsencrypt/boulder/grpc"
@@ -24,37 +44,278 @@ import (
 	"github.com/letsencrypt/boulder/ocsp/responder"
 	"github.com/letsencrypt/boulder/ocsp/responder/live"
 	redis_responder "github.com/letsencrypt/boulder/ocsp/responder/redis"
+	"github.com/letsencrypt/boulder/ocsp/responder/revinfo"
 	rapb "github.com/letsencrypt/boulder/ra/proto"
+	"github.com/letsencrypt/boulder/rocsp"
 	rocsp_config "github.com/letsencrypt/boulder/rocsp/config"
 	"github.com/letsencrypt/boulder/sa"
 	sapb "github.com/letsencrypt/boulder/sa/proto"
+	"github.com/letsencrypt/boulder/test/ocsp/helper"
 )
 
+// statusSourceURL is the Source value which selects signing responses on
+// demand from the status held by the SA.
+const statusSourceURL = "status:"
+
+// revinfoSourceURL is the Source value which selects looking up stored
+// responses in the revocation-info gRPC service.
+const revinfoSourceURL = "revinfo:"
+
 type Config struct {
 	OCSPResponder struct {
 		DebugAddr string       `validate:"omitempty,hostname_port"`
 		DB        cmd.DBConfig `validate:"required_without_all=Source SAService,structonly"`
 
+		// AdminAddr, if set, is the address:port on which to serve admin-only
+		// debugging endpoints, such as /debug/ocsp?req=<base64>, which shows
+		// the response that would be served for an OCSP request, and
+		// /reload-issuers, which reloads IssuerCerts on a POST. It should not
+		// be reachable from outside.
+		AdminAddr string `validate:"omitempty,hostname_port"`
+
+		// MetricsPrefix, if set, is prepended to the names of the metrics
+		// registered by the responder and its sources, so that several
+		// responders for different PKIs can share a registry, e.g. "pki_a_".
+		// Process-wide metrics, such as Go runtime stats, are unaffected.
+		MetricsPrefix string
+
+		// AnnotateDBQueries causes queries made directly against the DB to be
+		// prefixed with a SQL comment containing the request's trace ID, for
+		// correlating slow query log entries with OCSP requests.
+		AnnotateDBQueries bool
+
+		// ReadOnlyDB is for disaster recovery, when serving from a restored
+		// snapshot which must not be modified. At startup the responder
+		// attempts a harmless write and refuses to start unless the DB rejects
+		// it, so DB should name a read-only user. Any write later attempted
+		// through the DB connection is refused and counted.
+		ReadOnlyDB bool
+
+		// MissingStatus configures how serials with no certificateStatus row
+		// are handled. By default they are served an unauthorized response.
+		MissingStatus redis_responder.MissingStatusConfig
+
+		// DuplicateStatus configures how serials with more than one
+		// certificateStatus row are handled. By default they aren't detected,
+		// and whichever row the DB returns first is used.
+		DuplicateStatus redis_responder.DuplicateStatusConfig
+
+		// MaxThisUpdateDivergence, if set, causes responses served from Redis
+		// whose thisUpdate differs from the DB's ocspLastUpdated by more than
+		// this to be counted, as a sign of a stale cache node. It only applies
+		// when querying the DB directly, as the SA doesn't return
+		// ocspLastUpdated.
+		MaxThisUpdateDivergence config.Duration `validate:"-"`
+
+		// LookupRetries is the number of times failed DB and Redis lookups may
+		// be retried for a single request, in total across both, within the
+		// request's Timeout. The default of 0 means no retries.
+		LookupRetries int `validate:"min=0"`
+
+		// NegativeCache optionally remembers, for a short TTL, serials found to
+		// have no certificateStatus row, so that scanners repeatedly asking
+		// for them don't cost a DB and Redis lookup each time.
+		NegativeCache redis_responder.NegativeCacheConfig
+
+		// MaxRedisLookups, if non-zero, limits the Redis lookups in flight at
+		// once, separately from the DB lookups. Requests beyond the limit skip
+		// Redis and are served by signing a fresh response for the DB's
+		// status, so that a slow Redis can't hold up every request. The
+		// default of 0 means no limit.
+		MaxRedisLookups int `validate:"min=0"`
+
 		// Source indicates the source of pre-signed OCSP responses to be used. It
 		// can be a DBConnect string or a file URL. The file URL style is used
 		// when responding from a static file for intermediates and roots.
+		// The value "status:" signs responses on demand from the revocation
+		// status held by the SA, as configured by StatusSigning.
+		// The value "revinfo:" looks up stored responses in the
+		// revocation-info gRPC service configured by RevocationInfoService.
 		// If DBConfig has non-empty fields, it takes precedence over this.
 		Source string `validate:"required_without_all=DB.DBConnectFile SAService Redis"`
 
 		// The list of issuer certificates, against which OCSP requests/responses
 		// are checked to ensure we're not responding for anyone else's certs.
+		// Each entry may be a PEM certificate or a PKCS#7 (.p7b) bundle, in
+		// which case every certificate in the bundle is used.
 		IssuerCerts []string `validate:"min=1,dive,required"`
 
+		// AllowPartialIssuers causes issuer certificate files which fail to
+		// load to be skipped, with an audit log entry, rather than preventing
+		// startup. At least one issuer certificate must still load.
+		AllowPartialIssuers bool
+
+		// MaxIssuers is the most issuer certificates which may be loaded from
+		// IssuerCerts, counting each certificate in a bundle, so that a
+		// misconfigured path can't exhaust memory. Exceeding it prevents
+		// startup. This defaults to 1000.
+		MaxIssuers int `validate:"min=0"`
+
+		// AllowDuplicateIssuers permits IssuerCerts to contain several
+		// certificates with the same subject and key, such as cross-signed
+		// variants of one intermediate. Requests for such an issuer can't say
+		// which variant they mean, so responses are accepted from any of
+		// them. By default duplicates prevent startup, as they more often
+		// indicate a misconfiguration.
+		AllowDuplicateIssuers bool
+
+		// IssuerReloadInterval, if set, causes IssuerCerts to be reloaded this
+		// often, so that issuers can be added or removed without a restart.
+		// Whether or not this is set, they're also reloaded on SIGUSR1, and
+		// on a POST to /reload-issuers on the AdminAddr server. Each successful reload is audit logged
+		// with what caused it, the fingerprints of the issuer sets before and
+		// after it, and those issuers, and updates the issuer expiry metrics
+		// and health. A
+		// reload which fails, finds no issuer certificates at all, or finds
+		// issuers which don't match IssuerSerialPrefixesFile is audit logged
+		// and handled according to IssuerReloadFailurePolicy; finding none is
+		// also counted in ocsp_filter_empty_issuer_reloads. The StatusSigning
+		// and BlocklistSigners keys aren't reloaded, so a reloaded issuer
+		// without one can't be signed for by those sources.
+		IssuerReloadInterval config.Duration `validate:"-"`
+
+		// IssuerReloadFailurePolicy is what a failed issuer reload does with
+		// the previously loaded issuers. "fail-open", the default, keeps
+		// serving for them. "fail-closed" drops them, refusing every request
+		// until a reload succeeds, and so also marks the responder as
+		// degraded if Health.IssuerExpiryWindow is set.
+		IssuerReloadFailurePolicy responder.ReloadPolicy `validate:"omitempty,oneof=fail-open fail-closed"`
+
+		// Path is the prefix stripped from the paths of OCSP requests before
+		// they are decoded. It must begin with "/", and is matched against the
+		// unescaped request path, so it must not be percent-encoded. Startup
+		// fails if it couldn't match any request.
 		Path string
 
 		// ListenAddress is the address:port on which to listen for incoming
-		// OCSP requests. This has a default value of ":80".
-		ListenAddress string `validate:"omitempty,hostname_port"`
+		// OCSP requests. This has a default value of ":80". Alternatively,
+		// "unix:" followed by a path listens on a Unix domain socket at that
+		// path, e.g. for a local proxy in the same pod.
+		ListenAddress string `validate:"omitempty,hostname_port|startswith=unix:"`
+
+		// Listener optionally tunes TCP keep-alive and caps the number of
+		// concurrent connections on the HTTP listener.
+		Listener ListenerConfig
+
+		// ServerTimeouts optionally bounds how long the HTTP server waits on
+		// clients which are slow to send a request or to read a response,
+		// so that stalled connections are dropped.
+		ServerTimeouts ServerTimeoutConfig
+
+		// HTTPS optionally serves OCSP over HTTPS as well, on a second
+		// listener sharing the handler, Listener settings and ServerTimeouts
+		// of the plain HTTP one.
+		HTTPS HTTPSConfig
+
+		// Health optionally configures the static responses served to health
+		// checks, for "/" and any further paths.
+		Health HealthConfig
+
+		// LameDuckDuration, if non-zero, is how long to keep serving after a
+		// shutdown signal before shutting down. Throughout it, health checks
+		// fail with a 503 so that load balancers drain the responder, while
+		// OCSP requests are still answered.
+		LameDuckDuration config.Duration `validate:"-"`
 
 		// When to timeout a request. This should be slightly lower than the
 		// upstream's timeout when making request to ocsp-responder.
 		Timeout config.Duration `validate:"-"`
 
+		// IssuerTimeouts optionally overrides Timeout for requests for
+		// specific issuers, and caps the timeout of all requests.
+		IssuerTimeouts responder.IssuerTimeoutConfig
+
+		// Priority optionally configures a shorter Timeout for requests which
+		// an upstream CDN has marked as low priority.
+		Priority responder.PriorityConfig
+
+		// Stapling optionally configures a shorter Cache-Control max-age for
+		// requests from OCSP stapling clients, identified by a separate path
+		// or a request header.
+		Stapling responder.StaplingConfig
+
+		// ResponseHeaders are added to every OCSP response, for CDNs which
+		// require particular headers, such as X-Content-Type-Options or Vary.
+		// Headers the responder sets itself, such as Content-Type and
+		// Cache-Control, can't be configured; startup fails if they are.
+		ResponseHeaders map[string]string
+
+		// StatusCodes optionally overrides the HTTP status code sent for each
+		// reason a request can fail, for CDNs which expect particular codes.
+		StatusCodes responder.StatusCodeConfig
+
+		// ProfileTags optionally derives a tag naming each response's
+		// issuance profile, from its serial prefix or issuer, and sends it
+		// as a second Edge-Cache-Tag so that a CDN can purge a whole
+		// profile's responses at once.
+		ProfileTags responder.ProfileTagConfig
+
+		// MaxAgeJitter, if non-zero, shortens the Cache-Control max-age of
+		// each response by up to this much, by an amount derived from its
+		// serial, so that CDN caches don't all expire at once. Each serial's
+		// max-age is shortened by the same amount every time.
+		MaxAgeJitter config.Duration `validate:"-"`
+
+		// IfModifiedSince causes GET requests whose If-Modified-Since is no
+		// earlier than the response's thisUpdate, which is sent as its
+		// Last-Modified, to be answered with a 304, so that a CDN can
+		// revalidate its cached copy by date as well as by ETag. As RFC 7232
+		// requires, it's ignored when the request has an If-None-Match.
+		IfModifiedSince bool
+
+		// MaxGETRequestSize, if non-zero, is the longest base64-encoded OCSP
+		// request accepted by GET. Longer GET requests are refused with a 405
+		// and an "Allow: POST" header, since RFC 5019 only has clients use
+		// GET for small requests: 255 bytes is the threshold it sets, though
+		// that includes the URL scheme and host. Larger requests should be
+		// sent by POST.
+		MaxGETRequestSize int `validate:"min=0"`
+
+		// MaxCertIDs, if non-zero, is the most certIDs accepted in one OCSP
+		// request. Only the first certID of a request is answered, but all of
+		// them are parsed, so requests carrying more than this are rejected as
+		// malformed before any lookup.
+		MaxCertIDs int `validate:"min=0"`
+
+		// Capabilities optionally serves a description of the hash algorithms
+		// and features this responder supports.
+		Capabilities CapabilitiesConfig
+
+		// Capture optionally records the complete request and response bytes
+		// for requests whose serial matches a pattern, to a separate file.
+		Capture responder.CaptureConfig
+
+		// SlowRequests optionally records the timings of requests which take
+		// longer than a threshold to handle. The most recent are served as
+		// "ocspSlowRequests" from /debug/vars on the DebugAddr.
+		SlowRequests responder.SlowRequestConfig
+
+		// MaxInFlightResponseBytes, if non-zero, caps the total size of the
+		// OCSP responses being written at once. Requests arriving once it's
+		// reached are shed with an HTTP 503 and a tryLater response.
+		MaxInFlightResponseBytes int64 `validate:"min=0"`
+
+		// MemoryLimit optionally sets the Go runtime's soft memory limit, and
+		// sheds requests with an HTTP 503 and a tryLater response while
+		// memory usage is near it, so that a containerized responder slows
+		// down rather than being killed for running out of memory.
+		MemoryLimit responder.MemoryLimitConfig
+
+		// RequestExtensions optionally counts requests by the OIDs of the
+		// extensions they carry, to show which extensions clients send.
+		RequestExtensions responder.RequestExtensionConfig
+
+		// UserAgentDenylist optionally lists user agents whose requests are
+		// refused with an HTTP 403 before any lookup.
+		UserAgentDenylist UserAgentDenylistConfig
+
+		// ClientAllowlist optionally lists client networks, such as our own
+		// monitoring, whose requests are exempt from the user agent denylist,
+		// in-flight shedding, goroutine and Redis lookup limits, and the
+		// negative cache. They're counted in ocsp_allowlisted_requests. The
+		// connection limit in Listener still applies to them.
+		ClientAllowlist ClientAllowlistConfig
+
 		// How often a response should be signed when using Redis/live-signing
 		// path. This has a default value of 60h.
 		LiveSigningPeriod config.Duration `validate:"-"`
@@ -80,16 +341,138 @@ type Config struct {
 		// 40 * 5 / 0.02 = 10,000 requests before the oldest request times out.
 		MaxSigningWaiters int `validate:"min=0"`
 
+		// A limit on how many goroutines the Redis and DB lookups may have
+		// running at once, across all in-flight requests. When it is reached,
+		// further requests immediately receive an HTTP 503 with an OCSP
+		// tryLater response. This is a coarse safety net against memory
+		// exhaustion, complementary to MaxInflightSignings. The default of 0
+		// means "no limit."
+		MaxGoroutines int `validate:"min=0"`
+
 		ShutdownStopTimeout config.Duration
 
 		RequiredSerialPrefixes []string `validate:"omitempty,dive,hexadecimal"`
 
+		// IssuerSerialPrefixesFile is the path to a YAML mapping from the
+		// common name of each issuer to the hex serial prefixes of the
+		// certificates it issues, kept alongside IssuerCerts. If set, the
+		// required serial prefixes are derived from it, rather than listed
+		// in RequiredSerialPrefixes, and startup fails unless it names
+		// exactly the loaded issuers.
+		IssuerSerialPrefixesFile string `validate:"excluded_with=RequiredSerialPrefixes"`
+
+		// VerifyResponseSignatures causes the signature of every response to
+		// be checked against its issuer's certificate before it is served, as a
+		// defense against tampering in storage. This costs a signature
+		// verification per request, so it is off by default.
+		VerifyResponseSignatures bool
+
+		// ReportDeprecatedSignatures causes responses signed with a deprecated
+		// algorithm, such as SHA-1, to be counted by issuer and algorithm as
+		// they are served, and logged once per issuer and algorithm, to drive
+		// remediation. They are still served.
+		ReportDeprecatedSignatures bool
+
+		// MaxResponseAge, if set, causes responses whose thisUpdate is older
+		// than this to be treated as not found, even if their nextUpdate has
+		// not yet passed. This is a policy safeguard against serving
+		// responses which should have been refreshed long ago.
+		MaxResponseAge config.Duration `validate:"-"`
+
+		// RequireNextUpdate causes stored responses without a nextUpdate to be
+		// refused with an HTTP 500 and counted separately. RFC 6960 allows
+		// omitting nextUpdate, but we always set it, so a response without one
+		// indicates a regression in the signing pipeline. By default such
+		// responses are treated as expired.
+		RequireNextUpdate bool
+
+		// MinValidity and MaxValidity, if set, bound the validity interval
+		// (nextUpdate minus thisUpdate) of the responses we'll serve.
+		// Responses outside the bounds are refused with an HTTP 500 and
+		// counted separately, as they indicate a misconfigured signer: one
+		// producing responses valid for only minutes, or for years.
+		MinValidity config.Duration `validate:"-"`
+		MaxValidity config.Duration `validate:"-"`
+
+		// ThisUpdateSkewTolerance, if set, is how far in the future a
+		// response's thisUpdate may be and still be served, allowing for
+		// clock skew between the signer and the responder. Responses further
+		// in the future are refused with an HTTP 500 and counted separately.
+		// By default, thisUpdate isn't checked against the current time.
+		ThisUpdateSkewTolerance config.Duration `validate:"-"`
+
+		// StagingSource is a file: URL, in the same format as Source, of
+		// responses from a signing pipeline under test. It is consulted first
+		// for serials in StagingSerials; all other serials, and any staging
+		// serial missing from StagingSource, are served as usual.
+		StagingSource string `validate:"required_with=StagingSerials,omitempty,startswith=file:"`
+
+		// StagingSerials is the allowlist of hex-encoded serials which are
+		// served from StagingSource.
+		StagingSerials []string `validate:"omitempty,dive,hexadecimal"`
+
+		// BlocklistFile is the path to a YAML list of serials for which a
+		// freshly signed unknown or revoked response is served regardless of
+		// what the backend holds. Every hit is audit logged.
+		BlocklistFile string
+
+		// BlocklistSigners are the issuers used to sign the synthetic responses
+		// served for blocklisted serials. Required if BlocklistFile is set.
+		BlocklistSigners []issuance.IssuerConfig `validate:"required_with=BlocklistFile,dive"`
+
+		// StatusSigning configures the "status:" Source, for backends which
+		// store only each certificate's revocation status rather than
+		// pre-signed responses. Responses are signed in-process with the
+		// configured issuers' keys and cached for a short TTL.
+		StatusSigning responder.StatusSigningConfig
+
+		// ProducedAtOffset is added to the current time to give the producedAt
+		// of the responses signed for blocklisted serials, for example to
+		// backdate them slightly for relying parties with skewed clocks. It may
+		// be negative.
+		ProducedAtOffset config.Duration `validate:"-"`
+
 		Features features.Config
 
 		// Configuration for using Redis as a cache. This configuration should
 		// allow for both read and write access.
 		Redis *rocsp_config.RedisConfig `validate:"required_without=Source"`
 
+		// RedisFallbacks are independent Redis clusters, consulted in order
+		// when a lookup misses or fails in Redis. Responses are stored to
+		// Redis and to every fallback.
+		RedisFallbacks []*rocsp_config.RedisConfig `validate:"omitempty,dive,required"`
+
+		// RedisByIssuer maps hex-encoded SHA-1 issuer key hashes to the Redis
+		// cluster holding that issuer's responses, for deployments which
+		// shard Redis by issuer. Lookups and stores for those issuers use
+		// their cluster, without the RedisBreaker or RedisFallbacks; all
+		// other issuers use Redis.
+		RedisByIssuer map[string]*rocsp_config.RedisConfig `validate:"omitempty,dive,keys,hexadecimal,len=40,endkeys,required"`
+
+		// RedisBreaker configures a circuit breaker around the Redis client.
+		// While it is open, Redis lookups are skipped and responses are signed
+		// live. By default the breaker is disabled.
+		RedisBreaker redis_responder.BreakerConfig
+
+		// DBBreaker configures a circuit breaker around the DB (or SA) status
+		// lookups. While it is open, requests are answered with tryLater,
+		// unless DBBreaker.ServeRedisUnchecked is set, in which case Redis
+		// responses are served without checking them against the DB. By
+		// default the breaker is disabled.
+		DBBreaker redis_responder.DBBreakerConfig
+
+		// RedisSerialCase is the hex casing, "lower" or "upper", of the serials
+		// in the keys under which responses were stored in Redis. Responses
+		// stored by this responder always use lowercase, so with "upper" those
+		// are looked up second. The default is "lower".
+		RedisSerialCase redis_responder.SerialCase `validate:"omitempty,oneof=lower upper"`
+
+		// RedisPrefetch configures a background job which re-signs responses
+		// in Redis shortly before they would go stale, so that requests for
+		// them can be served from the cache. By default it is disabled.
+		RedisPrefetch redis_responder.PrefetchConfig
+
 		// TLS client certificate, private key, and trusted root bundle.
 		TLS cmd.TLSConfig `validate:"required_without=Source,structonly"`
 
@@ -102,6 +485,10 @@ type Config struct {
 		// Redis is up-to-date.
 		SAService *cmd.GRPCClientConfig `validate:"required_without_all=DB.DBConnectFile Source"`
 
+		// RevocationInfoService configures how to communicate with the
+		// revocation-info service for the "revinfo:" Source.
+		RevocationInfoService *cmd.GRPCClientConfig
+
 		// LogSampleRate sets how frequently error logs should be emitted. This
 		// avoids flooding the logs during outages. 1 out of N log lines will be emitted.
 		// If LogSampleRate is 0, no logs will be emitted.
@@ -119,13 +506,63 @@ func main() {
 	listenAddr := flag.String("addr", "", "OCSP listen address override")
 	debugAddr := flag.String("debug-addr", "", "Debug server address override")
 	configFile := flag.String("config", "", "File path to the configuration file for this service")
+	lookupSerial := flag.String("lookup", "", "Print the stored response for this hex-encoded serial from the configured source and exit, without serving or signing. Requires -issuer")
+	watchSerial := flag.String("watch", "", "Look up the stored response for this hex-encoded serial in the configured source every -watch-interval, without serving or signing, and exit non-zero when its status changes. Requires -issuer")
+	watchInterval := flag.Duration("watch-interval", time.Minute, "How often to look up the serial given by -watch")
+	lookupIssuer := flag.String("issuer", "", "Issuer certificate PEM file of the serial given to -lookup or -watch")
+	dumpMetrics := flag.Int("dump-metrics", 0, "Perform this many synthetic lookups of random serials, print a snapshot of the resulting metrics to stdout, and exit, without serving, signing, or storing responses")
+	genRequest := flag.Bool("gen-request", false, "Print an OCSP request for the certificate and issuer PEM files given as arguments (cert.pem issuer.pem), and exit. No config is needed")
+	genRequestHash := flag.String("gen-request-hash", "SHA1", "Hash of the issuer name and key in generated requests: SHA1 or SHA256")
+	genRequestDER := flag.Bool("gen-request-der", false, "Print generated requests as raw DER, for a POST body, rather than URL-escaped base64, for a GET path")
+	benchURL := flag.String("bench", "", "Send OCSP GET requests to the responder at this URL, for the serials in -bench-serials, report latency percentiles and status codes, and exit. No config is needed")
+	benchSerials := flag.String("bench-serials", "", "File of hex-encoded serials, one per line, for -bench")
+	benchIssuer := flag.String("bench-issuer", "", "Issuer certificate PEM file of the serials in -bench-serials. Requests use -gen-request-hash")
+	benchRequests := flag.Int("bench-requests", 1000, "Total number of requests sent by -bench, cycling through the serials")
+	benchConcurrency := flag.Int("bench-concurrency", 10, "Most requests in flight at once for -bench")
+	benchQPS := flag.Float64("bench-qps", 0, "Target rate of requests per second for -bench. 0 sends as fast as -bench-concurrency allows")
+	compareConfig := flag.String("compare-config", "", "Replay the requests in -replay against the sources configured by both -config and this config file, print where their responses diverge, and exit non-zero if any do, without serving")
+	replayFile := flag.String("replay", "", "File of OCSP requests for -compare-config, one per line as printed by -gen-request")
 	flag.Parse()
 
+	if *benchURL != "" {
+		hash, ok := requestHashes[*genRequestHash]
+		if !ok {
+			cmd.Fail(fmt.Sprintf("Unsupported -gen-request-hash %q", *genRequestHash))
+		}
+		reqs, err := loadBenchRequests(*benchSerials, *benchIssuer, hash)
+		cmd.FailOnError(err, "Loading -bench-serials")
+		conf := benchConfig{requests: *benchRequests, concurrency: *benchConcurrency, qps: *benchQPS}
+		client := &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{MaxIdleConnsPerHost: conf.concurrency},
+		}
+		results := runBench(context.Background(), conf, reqs, benchSender(client, *benchURL))
+		err = results.write(os.Stdout)
+		cmd.FailOnError(err, "Writing results")
+		return
+	}
+
+	if *genRequest {
+		if flag.NArg() != 2 {
+			cmd.Fail("-gen-request requires a certificate and an issuer PEM file")
+		}
+		hash, ok := requestHashes[*genRequestHash]
+		if !ok {
+			cmd.Fail(fmt.Sprintf("Unsupported -gen-request-hash %q", *genRequestHash))
+		}
+		req, err := generateRequest(flag.Arg(0), flag.Arg(1), hash)
+		cmd.FailOnError(err, "Generating OCSP request")
+		err = writeRequest(req, *genRequestDER, os.Stdout)
+		cmd.FailOnError(err, "Writing OCSP request")
+		return
+	}
+
 	if *configFile == "" {
 		fmt.Fprintf(os.Stderr, `Usage of %s:
 Config JSON should contain either a DBConnectFile or a Source value containing a file: URL.
 If Source is a file: URL, the file should contain a list of OCSP responses in base64-encoded DER,
-as generated by Boulder's ceremony command.
+as generated by Boulder's ceremony command. If Source is "status:", responses are signed on demand
+from the status held by the SA, using the issuers in StatusSigning.
 `, os.Args[0])
 		flag.PrintDefaults()
 		os.Exit(1)
@@ -147,21 +584,347 @@ as generated by Boulder's ceremony command.
 	scope, logger, oTelShutdown := cmd.StatsAndLogging(c.Syslog, c.OpenTelemetry, c.OCSPResponder.DebugAddr)
 	logger.Info(cmd.VersionString())
 
+	gatherer, _ := scope.(prometheus.Gatherer)
+	scope, err = prefixedScope(scope, c.OCSPResponder.MetricsPrefix)
+	cmd.FailOnError(err, "Invalid metrics prefix")
+
 	clk := cmd.Clock()
 
+	if *compareConfig != "" {
+		var other Config
+		err = cmd.ReadConfigFile(*compareConfig, &other)
+		cmd.FailOnError(err, "Reading -compare-config file")
+		reqs, err := loadReplayRequests(*replayFile)
+		cmd.FailOnError(err, "Loading -replay requests")
+
+		// Features are global, so both configs' sources run with those of
+		// -config.
+		compared := []comparedSource{
+			newComparedSource(&c, *configFile, logger, clk),
+			newComparedSource(&other, *compareConfig, logger, clk),
+		}
+		diverged, err := compareSources(context.Background(), reqs, compared[0], compared[1], c.OCSPResponder.Timeout.Duration, os.Stdout)
+		cmd.FailOnError(err, "Writing comparison")
+		if diverged > 0 {
+			cmd.Fail(fmt.Sprintf("%d of %d replayed requests diverged", diverged, len(reqs)))
+		}
+		return
+	}
+
+	if *lookupSerial != "" || *watchSerial != "" {
+		if *lookupIssuer == "" {
+			cmd.Fail("-lookup and -watch require -issuer")
+		}
+		issuer, err := core.LoadCert(*lookupIssuer)
+		cmd.FailOnError(err, "Loading -issuer")
+
+		// Requests go through the same filter as when serving, so they're
+		// checked against the configured issuers and routed by issuer, but
+		// the sources are read-only: nothing is signed, so the RA isn't
+		// called and nothing is written to Redis.
+		source, _, _ := newSource(&c, true, scope, logger, clk)
+		resolver := responder.NewFileIssuerResolver(c.OCSPResponder.IssuerCerts, c.OCSPResponder.AllowPartialIssuers, c.OCSPResponder.MaxIssuers, scope, logger)
+		filter, _ := newFilteredSource(&c, true, source, resolver, scope, logger, clk)
+
+		if *lookupSerial != "" {
+			req, err := lookupRequest(*lookupSerial, issuer, filter.HashAlgorithm())
+			cmd.FailOnError(err, "Building request for -lookup")
+			ctx := context.Background()
+			if c.OCSPResponder.Timeout.Duration != 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, c.OCSPResponder.Timeout.Duration)
+				defer cancel()
+			}
+			err = lookup(ctx, filter, req, os.Stdout)
+			cmd.FailOnError(err, "Looking up serial")
+			return
+		}
+
+		req, err := lookupRequest(*watchSerial, issuer, filter.HashAlgorithm())
+		cmd.FailOnError(err, "Building request for -watch")
+		err = watch(context.Background(), filter, req, *watchInterval, c.OCSPResponder.Timeout.Duration, clk, logger)
+		cmd.FailOnError(err, "Watching serial")
+		return
+	}
+
+	// A metrics snapshot is taken with read-only sources, so that its
+	// synthetic lookups don't sign responses or store them to Redis.
+	readOnly := *dumpMetrics > 0
+	source, runPrefetch, saveStatusCache := newSource(&c, readOnly, scope, logger, clk)
+
+	// The issuer certificates are loaded from the file paths, which may be PEM
+	// certificates or PKCS#7 bundles.
+	issuerResolver := responder.NewFileIssuerResolver(c.OCSPResponder.IssuerCerts, c.OCSPResponder.AllowPartialIssuers, c.OCSPResponder.MaxIssuers, scope, logger)
+	filter, issuerPrefixes := newFilteredSource(&c, readOnly, source, issuerResolver, scope, logger, clk)
+	source = filter
+	issuerCerts := filter.IssuerCertificates()
+
+	logger.InfoObject("Effective OCSP responder configuration", summarizeConfig(&c, len(issuerCerts)))
+
+	expiry := newIssuerExpiry(issuerCerts, c.OCSPResponder.Health.IssuerExpiryWindow.Duration, scope, clk)
+
+	ir := &issuerReload{
+		filter:   filter,
+		resolver: issuerResolver,
+		prefixes: issuerPrefixes,
+		expiry:   expiry,
+		logger:   logger,
+	}
+
+	capture, err := responder.NewCapturer(c.OCSPResponder.Capture, clk)
+	cmd.FailOnError(err, "Could not set up request capture")
+
+	// Slow requests are served from the debug server's /debug/vars.
+	slowRequests := responder.NewSlowRequests(c.OCSPResponder.SlowRequests)
+	if slowRequests != nil {
+		expvar.Publish("ocspSlowRequests", expvar.Func(func() any { return slowRequests.Requests() }))
+	}
+
+	if limit := c.OCSPResponder.MemoryLimit.Limit; limit > 0 {
+		debug.SetMemoryLimit(limit)
+	}
+	if c.OCSPResponder.MemoryLimit.ShedFraction > 0 && debug.SetMemoryLimit(-1) == math.MaxInt64 {
+		cmd.Fail("MemoryLimit.ShedFraction requires a memory limit, from MemoryLimit.Limit or GOMEMLIMIT")
+	}
+	inFlight := responder.NewInFlightBytes(c.OCSPResponder.MaxInFlightResponseBytes, c.OCSPResponder.MemoryLimit, scope)
+	extensions := responder.NewRequestExtensions(c.OCSPResponder.RequestExtensions, scope)
+
+	allowlist, err := newClientAllowlist(c.OCSPResponder.ClientAllowlist)
+	cmd.FailOnError(err, "Could not load client allowlist")
+
+	deniedAgents, err := newUserAgentDenylist(c.OCSPResponder.UserAgentDenylist)
+	cmd.FailOnError(err, "Could not load user agent denylist")
+
+	responseHeaders, err := newResponseHeaders(c.OCSPResponder.ResponseHeaders)
+	cmd.FailOnError(err, "Invalid ResponseHeaders")
+
+	caps := newCapabilities(&c, filter.HashAlgorithm())
+
+	err = validateResponderPath(c.OCSPResponder.Path)
+	cmd.FailOnError(err, "Invalid Path")
+	err = validateResponderPath(c.OCSPResponder.Stapling.Path)
+	cmd.FailOnError(err, "Invalid Stapling.Path")
+	logger.Infof("Serving OCSP requests under path prefix %q", c.OCSPResponder.Path)
+
+	ld := &lameDuck{}
+	m := mux(source, muxConfig{
+		responderPath: c.OCSPResponder.Path,
+		responder: responder.Options{
+			Timeout:         c.OCSPResponder.Timeout.Duration,
+			IssuerTimeouts:  c.OCSPResponder.IssuerTimeouts,
+			Priority:        c.OCSPResponder.Priority,
+			Stapling:        c.OCSPResponder.Stapling,
+			StatusCodes:     c.OCSPResponder.StatusCodes,
+			ProfileTags:     c.OCSPResponder.ProfileTags,
+			MaxAgeJitter:    c.OCSPResponder.MaxAgeJitter.Duration,
+			IfModifiedSince: c.OCSPResponder.IfModifiedSince,
+			MaxGETSize:      c.OCSPResponder.MaxGETRequestSize,
+			MaxCertIDs:      c.OCSPResponder.MaxCertIDs,
+			Capture:         capture,
+			SlowRequests:    slowRequests,
+			InFlight:        inFlight,
+			Extensions:      extensions,
+			LogSampleRate:   c.OCSPResponder.LogSampleRate,
+		},
+		deniedAgents:    deniedAgents,
+		allowlist:       allowlist,
+		responseHeaders: responseHeaders,
+		health:          c.OCSPResponder.Health,
+		lameDuck:        ld,
+		expiry:          expiry,
+		caps:            caps,
+		oTelHTTPOptions: c.OpenTelemetryHTTPConfig.Options(),
+	}, scope, logger)
+
+	if *dumpMetrics > 0 {
+		if gatherer == nil {
+			cmd.Fail("Metrics registry does not support gathering")
+		}
+		err = syntheticLookups(m, c.OCSPResponder.Path, issuerCerts, *dumpMetrics)
+		cmd.FailOnError(err, "Performing synthetic lookups")
+		err = writeMetrics(gatherer, os.Stdout)
+		cmd.FailOnError(err, "Writing metrics snapshot")
+		return
+	}
+
+	if runPrefetch != nil {
+		prefetchCtx, cancelPrefetch := context.WithCancel(context.Background())
+		defer cancelPrefetch()
+		go runPrefetch(prefetchCtx)
+	}
+
+	reloadCtx, cancelReload := context.WithCancel(context.Background())
+	defer cancelReload()
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGUSR1)
+	go reloadIssuers(reloadCtx, ir, c.OCSPResponder.IssuerReloadInterval.Duration, reloadSignals, clk)
+
+	if c.OCSPResponder.ListenAddress == "" {
+		cmd.Fail("HTTP listen address is not configured")
+	}
+
+	logger.Infof("HTTP server listening on %s", c.OCSPResponder.ListenAddress)
+
+	srv := newServer(c.OCSPResponder.ListenAddress, m, c.OCSPResponder.ServerTimeouts)
+
+	var adminSrv *http.Server
+	if c.OCSPResponder.AdminAddr != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle(debugOCSPPath, debugOCSPHandler(source, c.OCSPResponder.Timeout.Duration))
+		adminMux.Handle(debugPathsPath, debugPathsHandler(c.OCSPResponder.Path, c.OCSPResponder.Stapling.Path))
+		adminMux.Handle(reloadIssuersPath, reloadIssuersHandler(ir))
+		adminSrv = &http.Server{
+			ReadTimeout:  30 * time.Second,
+			WriteTimeout: 120 * time.Second,
+			Addr:         c.OCSPResponder.AdminAddr,
+			Handler:      adminMux,
+		}
+		logger.Infof("Admin server listening on %s", c.OCSPResponder.AdminAddr)
+		go func() {
+			err := adminSrv.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				cmd.FailOnError(err, "Running admin server")
+			}
+		}()
+	}
+
+	ln, err := listen(c.OCSPResponder.ListenAddress, c.OCSPResponder.Listener, scope)
+	cmd.FailOnError(err, "Listening for HTTP connections")
+
+	go func() {
+		err := srv.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			cmd.FailOnError(err, "Running HTTP server")
+		}
+	}()
+
+	var httpsSrv *http.Server
+	if c.OCSPResponder.HTTPS.ListenAddress != "" {
+		httpsLn, err := listenHTTPS(c.OCSPResponder.HTTPS, c.OCSPResponder.Listener, scope)
+		cmd.FailOnError(err, "Listening for HTTPS connections")
+		httpsSrv = newServer(c.OCSPResponder.HTTPS.ListenAddress, m, c.OCSPResponder.ServerTimeouts)
+		logger.Infof("HTTPS server listening on %s", c.OCSPResponder.HTTPS.ListenAddress)
+		go func() {
+			err := httpsSrv.Serve(httpsLn)
+			if err != nil && err != http.ErrServerClosed {
+				cmd.FailOnError(err, "Running HTTPS server")
+			}
+		}()
+	}
+
+	// When main is ready to exit (because it has received a shutdown signal),
+	// gracefully shutdown the servers. Calling these shutdown functions causes
+	// Serve() to immediately return, cleaning up the server goroutines
+	// as well, then waits for any lingering connection-handing goroutines to
+	// finish and clean themselves up.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			c.OCSPResponder.ShutdownStopTimeout.Duration)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+		if httpsSrv != nil {
+			_ = httpsSrv.Shutdown(ctx)
+		}
+		if saveStatusCache != nil {
+			// Save only once the servers have stopped, so the file includes
+			// every response signed before shutdown.
+			saveStatusCache()
+		}
+		if adminSrv != nil {
+			_ = adminSrv.Shutdown(ctx)
+		}
+		oTelShutdown(ctx)
+	}()
+
+	cmd.WaitForSignal()
+	if lameDuckDuration := c.OCSPResponder.LameDuckDuration.Duration; lameDuckDuration > 0 {
+		logger.Infof("Entering lame-duck mode for %s before shutting down", lameDuckDuration)
+		ld.enter()
+		time.Sleep(lameDuckDuration)
+	}
+}
+
+// newSource builds the source of responses configured by c: a file, status
+// or Redis source, behind the staging source if one is configured. It also
+// returns functions to run the Redis prefetcher and to save the status
+// source's cache, which are nil unless those are configured. If readOnly is
+// set, the source only returns stored responses, and never signs or stores
+// one, so the status source, which signs every response, can't be used, and
+// writes to the DB are refused. Failures are fatal.
+func newSource(c *Config, readOnly bool, scope prometheus.Registerer, logger blog.Logger, clk clock.Clock) (responder.Source, func(context.Context), func()) {
 	var source responder.Source
+	var runPrefetch func(context.Context)
+	var saveStatusCache func()
+	var err error
 
 	if strings.HasPrefix(c.OCSPResponder.Source, "file:") {
-		url, err := url.Parse(c.OCSPResponder.Source)
-		cmd.FailOnError(err, "Source was not a URL")
-		filename := url.Path
-		// Go interprets cwd-relative file urls (file:test/foo.txt) as having the
-		// relative part of the path in the 'Opaque' field.
-		if filename == "" {
-			filename = url.Opaque
-		}
-		source, err = responder.NewMemorySourceFromFile(filename, logger)
-		cmd.FailOnError(err, fmt.Sprintf("Couldn't read file: %s", url.Path))
+		source, err = fileSource(c.OCSPResponder.Source, scope, logger)
+		cmd.FailOnError(err, "Couldn't load Source")
+	} else if c.OCSPResponder.Source == statusSourceURL {
+		if readOnly {
+			cmd.Fail(`Source "status:" signs every response, so it can't be looked up read-only`)
+		}
+		if c.OCSPResponder.SAService == nil {
+			cmd.Fail(`Source "status:" requires SAService`)
+		}
+		tlsConfig, err := c.OCSPResponder.TLS.Load(scope)
+		cmd.FailOnError(err, "TLS config")
+		saConn, err := bgrpc.ClientSetup(c.OCSPResponder.SAService, tlsConfig, scope, clk)
+		cmd.FailOnError(err, "Failed to load credentials and create gRPC connection to SA")
+
+		var issuers []*issuance.Issuer
+		for _, issuerConfig := range c.OCSPResponder.StatusSigning.Issuers {
+			issuer, err := issuance.LoadIssuer(issuerConfig, clk)
+			cmd.FailOnError(err, "Could not load status signing issuer")
+			issuers = append(issuers, issuer)
+		}
+
+		statusSource, err := responder.NewStatusSource(sapb.NewStorageAuthorityReadOnlyClient(saConn), issuers, c.OCSPResponder.StatusSigning, scope, clk)
+		cmd.FailOnError(err, "Could not create status source")
+		source = statusSource
+
+		if cacheFile := c.OCSPResponder.StatusSigning.CacheFile; cacheFile != "" {
+			loaded, err := statusSource.LoadCache(cacheFile)
+			if err != nil {
+				// A bad cache file only costs some extra signing.
+				logger.Warningf("Loading status cache from %s: %s", cacheFile, err)
+			} else {
+				logger.Infof("Loaded %d cached responses from %s", loaded, cacheFile)
+			}
+			saveStatusCache = func() {
+				saved, err := statusSource.SaveCache(cacheFile)
+				if err != nil {
+					logger.Warningf("Saving status cache to %s: %s", cacheFile, err)
+					return
+				}
+				logger.Infof("Saved %d cached responses to %s", saved, cacheFile)
+			}
+		}
+
+		if warmFile := c.OCSPResponder.StatusSigning.WarmFile; warmFile != "" {
+			serials, err := responder.LoadWarmSerials(warmFile)
+			cmd.FailOnError(err, "Could not load status cache warm-up serials")
+			concurrency := c.OCSPResponder.StatusSigning.WarmConcurrency
+			if concurrency == 0 {
+				concurrency = 10
+			}
+			warmed, err := statusSource.WarmCache(context.Background(), serials, concurrency)
+			if err != nil {
+				// Like a bad cache file, a failed warm-up only costs some
+				// extra signing once serving.
+				logger.Warningf("Warming status cache from %s: %s", warmFile, err)
+			}
+			logger.Infof("Warmed %d cached responses for %d serials from %s", warmed, len(serials), warmFile)
+		}
+	} else if c.OCSPResponder.Source == revinfoSourceURL {
+		if c.OCSPResponder.RevocationInfoService == nil {
+			cmd.Fail(`Source "revinfo:" requires RevocationInfoService`)
+		}
+		tlsConfig, err := c.OCSPResponder.TLS.Load(scope)
+		cmd.FailOnError(err, "TLS config")
+		revinfoConn, err := bgrpc.ClientSetup(c.OCSPResponder.RevocationInfoService, tlsConfig, scope, clk)
+		cmd.FailOnError(err, "Failed to load credentials and create gRPC connection to revocation-info service")
+		source = revinfo.New(revinfo.NewClient(revinfoConn))
 	} else {
 		// Set up the redis source and the combined multiplex source.
 		rocspRWClient, err := rocsp_config.MakeClient(c.OCSPResponder.Redis, clk, scope)
@@ -170,6 +933,27 @@ as generated by Boulder's ceremony command.
 		err = rocspRWClient.Ping(context.Background())
 		cmd.FailOnError(err, "pinging Redis")
 
+		var fallbackClients []*rocsp.RWClient
+		for i, fallbackConfig := range c.OCSPResponder.RedisFallbacks {
+			// Each client registers the same metrics, so prefix them to keep
+			// them distinct.
+			prefix := fmt.Sprintf("fallback%d_", i+1)
+			fallbackClient, err := rocsp_config.MakeClient(fallbackConfig, clk, prometheus.WrapRegistererWithPrefix(prefix, scope))
+			cmd.FailOnError(err, "Could not make fallback redis client")
+			fallbackClients = append(fallbackClients, fallbackClient)
+		}
+
+		issuerClients := make(map[string]*rocsp.RWClient, len(c.OCSPResponder.RedisByIssuer))
+		for keyHash, issuerConfig := range c.OCSPResponder.RedisByIssuer {
+			keyHash = strings.ToLower(keyHash)
+			prefix := fmt.Sprintf("issuer_%s_", keyHash)
+			issuerClient, err := rocsp_config.MakeClient(issuerConfig, clk, prometheus.WrapRegistererWithPrefix(prefix, scope))
+			cmd.FailOnError(err, fmt.Sprintf("Could not make redis client for issuer %s", keyHash))
+			err = issuerClient.Ping(context.Background())
+			cmd.FailOnError(err, fmt.Sprintf("pinging Redis for issuer %s", keyHash))
+			issuerClients[keyHash] = issuerClient
+		}
+
 		liveSigningPeriod := c.OCSPResponder.LiveSigningPeriod.Duration
 		if liveSigningPeriod == 0 {
 			liveSigningPeriod = 60 * time.Hour
@@ -178,23 +962,48 @@ as generated by Boulder's ceremony command.
 		tlsConfig, err := c.OCSPResponder.TLS.Load(scope)
 		cmd.FailOnError(err, "TLS config")
 
-		raConn, err := bgrpc.ClientSetup(c.OCSPResponder.RAService, tlsConfig, scope, clk)
-		cmd.FailOnError(err, "Failed to load credentials and create gRPC connection to RA")
-		rac := rapb.NewRegistrationAuthorityClient(raConn)
+		var liveSource responder.Source = readOnlySigner{}
+		if !readOnly {
+			raConn, err := bgrpc.ClientSetup(c.OCSPResponder.RAService, tlsConfig, scope, clk)
+			cmd.FailOnError(err, "Failed to load credentials and create gRPC connection to RA")
+			rac := rapb.NewRegistrationAuthorityClient(raConn)
 
-		maxInflight := c.OCSPResponder.MaxInflightSignings
-		if maxInflight == 0 {
-			maxInflight = 1000
+			maxInflight := c.OCSPResponder.MaxInflightSignings
+			if maxInflight == 0 {
+				maxInflight = 1000
+			}
+			liveSource = live.New(rac, int64(maxInflight), c.OCSPResponder.MaxSigningWaiters)
 		}
-		liveSource := live.New(rac, int64(maxInflight), c.OCSPResponder.MaxSigningWaiters)
 
-		rocspSource, err := redis_responder.NewRedisSource(rocspRWClient, liveSource, liveSigningPeriod, clk, scope, logger, c.OCSPResponder.LogSampleRate)
+		budget := redis_responder.NewGoroutineBudget(c.OCSPResponder.MaxGoroutines, scope)
+		rocspSource, err := redis_responder.NewRedisSource(rocspRWClient, liveSource, redis_responder.RedisSourceConfig{
+			Fallbacks:         fallbackClients,
+			IssuerClients:     issuerClients,
+			LiveSigningPeriod: liveSigningPeriod,
+			Breaker:           c.OCSPResponder.RedisBreaker,
+			SerialCase:        c.OCSPResponder.RedisSerialCase,
+			Budget:            budget,
+			LogSampleRate:     c.OCSPResponder.LogSampleRate,
+		}, clk, scope, logger)
 		cmd.FailOnError(err, "Could not create redis source")
 
-		var dbMap *db.WrappedMap
+		if c.OCSPResponder.RedisPrefetch.Period.Duration > 0 && !readOnly {
+			runPrefetch = redis_responder.NewPrefetcher(rocspRWClient, rocspSource, c.OCSPResponder.RedisPrefetch, scope, logger).Run
+		}
+
+		var dbMap db.DatabaseMap
 		if c.OCSPResponder.DB != (cmd.DBConfig{}) {
-			dbMap, err = sa.InitWrappedDb(c.OCSPResponder.DB, scope, logger)
+			wrappedMap, err := sa.InitWrappedDb(c.OCSPResponder.DB, scope, logger)
 			cmd.FailOnError(err, "While initializing dbMap")
+			dbMap = wrappedMap
+			if c.OCSPResponder.ReadOnlyDB {
+				err = verifyReadOnlyDB(context.Background(), wrappedMap)
+				cmd.FailOnError(err, "Database is not read-only")
+				dbMap = newReadOnlyDB(wrappedMap, scope)
+				logger.Info("Verified database is read-only")
+			} else if readOnly {
+				dbMap = newReadOnlyDB(wrappedMap, scope)
+			}
 		}
 
 		var sac sapb.StorageAuthorityReadOnlyClient
@@ -204,63 +1013,321 @@ as generated by Boulder's ceremony command.
 			sac = sapb.NewStorageAuthorityReadOnlyClient(saConn)
 		}
 
-		source, err = redis_responder.NewCheckedRedisSource(rocspSource, dbMap, sac, scope, logger)
+		source, err = redis_responder.NewCheckedRedisSource(rocspSource, dbMap, sac, redis_responder.CheckedRedisConfig{
+			AnnotateQueries: c.OCSPResponder.AnnotateDBQueries,
+			Missing:         c.OCSPResponder.MissingStatus,
+			Duplicates:      c.OCSPResponder.DuplicateStatus,
+			MaxDivergence:   c.OCSPResponder.MaxThisUpdateDivergence.Duration,
+			Retries:         c.OCSPResponder.LookupRetries,
+			Negative:        c.OCSPResponder.NegativeCache,
+			MaxRedisLookups: c.OCSPResponder.MaxRedisLookups,
+			DBBreaker:       c.OCSPResponder.DBBreaker,
+		}, scope, logger)
 		cmd.FailOnError(err, "Could not create checkedRedis source")
 	}
 
-	// Load the certificate from the file path.
-	issuerCerts := make([]*issuance.Certificate, len(c.OCSPResponder.IssuerCerts))
-	for i, issuerFile := range c.OCSPResponder.IssuerCerts {
-		issuerCert, err := issuance.LoadCertificate(issuerFile)
-		cmd.FailOnError(err, "Could not load issuer cert")
-		issuerCerts[i] = issuerCert
+	if c.OCSPResponder.StagingSource != "" {
+		stagingSource, err := fileSource(c.OCSPResponder.StagingSource, scope, logger)
+		cmd.FailOnError(err, "Couldn't load StagingSource")
+		source, err = responder.NewStagingSource(c.OCSPResponder.StagingSerials, stagingSource, source, scope)
+		cmd.FailOnError(err, "Could not create staging source")
 	}
+	return source, runPrefetch, saveStatusCache
+}
+
+// filteredSource is the filter source built by newFilteredSource. The
+// responder package doesn't export its type, so its methods used here are
+// listed instead.
+type filteredSource interface {
+	responder.Source
+	issuerReloader
+	IssuerCertificates() []*issuance.Certificate
+	HashAlgorithm() crypto.Hash
+}
 
-	source, err = responder.NewFilterSource(
-		issuerCerts,
-		c.OCSPResponder.RequiredSerialPrefixes,
-		source,
-		scope,
-		logger,
-		clk,
-	)
+// newFilteredSource wraps source in the blocklist source, if one is
+// configured, and then in the filter source for the issuers provided by
+// resolver, as configured by c. If c names an issuer serial prefixes file, its
+// prefixes replace c's RequiredSerialPrefixes, and are also returned, so that
+// reloaded issuers can be checked against them. If readOnly is set, the
+// blocklist, which signs synthetic responses, is left out. Failures are
+// fatal.
+func newFilteredSource(c *Config, readOnly bool, source responder.Source, resolver responder.IssuerResolver, scope prometheus.Registerer, logger blog.Logger, clk clock.Clock) (filteredSource, responder.IssuerSerialPrefixes) {
+	var err error
+	if c.OCSPResponder.BlocklistFile != "" && readOnly {
+		logger.Info("Not applying the blocklist, as lookups are read-only")
+	} else if c.OCSPResponder.BlocklistFile != "" {
+		entries, err := responder.LoadBlocklist(c.OCSPResponder.BlocklistFile)
+		cmd.FailOnError(err, "Could not load blocklist")
+
+		var signers []*issuance.Issuer
+		for _, issuerConfig := range c.OCSPResponder.BlocklistSigners {
+			issuer, err := issuance.LoadIssuer(issuerConfig, clk)
+			cmd.FailOnError(err, "Could not load blocklist signer")
+			signers = append(signers, issuer)
+		}
+
+		source, err = responder.NewBlocklistSource(entries, signers, source, c.OCSPResponder.ProducedAtOffset.Duration, scope, logger, clk)
+		cmd.FailOnError(err, "Could not create blocklist source")
+		logger.Infof("Loaded %d blocklisted serials", len(entries))
+	}
+
+	var issuerPrefixes responder.IssuerSerialPrefixes
+	if c.OCSPResponder.IssuerSerialPrefixesFile != "" {
+		issuerPrefixes, err = responder.LoadIssuerSerialPrefixes(c.OCSPResponder.IssuerSerialPrefixesFile)
+		cmd.FailOnError(err, "Could not load issuer serial prefixes")
+		c.OCSPResponder.RequiredSerialPrefixes = issuerPrefixes.Prefixes()
+	}
+
+	filter, err := responder.NewFilterSource(resolver, responder.FilterConfig{
+		AllowDuplicates:            c.OCSPResponder.AllowDuplicateIssuers,
+		ReloadPolicy:               c.OCSPResponder.IssuerReloadFailurePolicy,
+		SerialPrefixes:             c.OCSPResponder.RequiredSerialPrefixes,
+		VerifySignatures:           c.OCSPResponder.VerifyResponseSignatures,
+		ReportDeprecatedSignatures: c.OCSPResponder.ReportDeprecatedSignatures,
+		MaxResponseAge:             c.OCSPResponder.MaxResponseAge.Duration,
+		RequireNextUpdate:          c.OCSPResponder.RequireNextUpdate,
+		MinValidity:                c.OCSPResponder.MinValidity.Duration,
+		MaxValidity:                c.OCSPResponder.MaxValidity.Duration,
+		ThisUpdateSkewTolerance:    c.OCSPResponder.ThisUpdateSkewTolerance.Duration,
+	}, source, scope, logger, clk)
 	cmd.FailOnError(err, "Could not create filtered source")
+	if issuerPrefixes != nil {
+		err = issuerPrefixes.Check(filter.IssuerCertificates())
+		cmd.FailOnError(err, "Issuer serial prefixes don't match the loaded issuers")
+	}
+	return filter, issuerPrefixes
+}
 
-	m := mux(c.OCSPResponder.Path, source, c.OCSPResponder.Timeout.Duration, scope, c.OpenTelemetryHTTPConfig.Options(), logger, c.OCSPResponder.LogSampleRate)
+// fileSource returns an in-memory Source containing the responses in the file
+// named by sourceURL, which must be a file: URL.
+func fileSource(sourceURL string, stats prometheus.Registerer, logger blog.Logger) (responder.Source, error) {
+	url, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("source was not a URL: %w", err)
+	}
+	if url.Scheme != "file" {
+		return nil, fmt.Errorf("source %q is not a file: URL", sourceURL)
+	}
+	filename := url.Path
+	// Go interprets cwd-relative file urls (file:test/foo.txt) as having the
+	// relative part of the path in the 'Opaque' field.
+	if filename == "" {
+		filename = url.Opaque
+	}
+	source, err := responder.NewMemorySourceFromFile(filename, stats, logger)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read file %s: %w", filename, err)
+	}
+	return source, nil
+}
 
-	if c.OCSPResponder.ListenAddress == "" {
-		cmd.Fail("HTTP listen address is not configured")
+// errReadOnlyLookup is returned by readOnlySigner.
+var errReadOnlyLookup = errors.New("not signing a fresh response, as lookups are read-only")
+
+// readOnlySigner stands in for the live signer when looking up responses with
+// -lookup or -watch, so that a missing or stale response in Redis is reported
+// rather than being signed by the RA and written back.
+type readOnlySigner struct{}
+
+// Response implements the responder.Source interface.
+func (readOnlySigner) Response(context.Context, *ocsp.Request) (*responder.Response, error) {
+	return nil, errReadOnlyLookup
+}
+
+// lookupRequest builds a request for the given hex-encoded serial, issued by
+// issuer, using hash for the issuer name and key hashes, as -lookup and -watch
+// send to the configured source.
+func lookupRequest(serial string, issuer *x509.Certificate, hash crypto.Hash) (*ocsp.Request, error) {
+	serialNum, err := core.StringToSerial(serial)
+	if err != nil {
+		return nil, err
+	}
+	der, err := createRequest(serialNum, issuer, hash)
+	if err != nil {
+		return nil, err
 	}
+	return ocsp.ParseRequest(der)
+}
 
-	logger.Infof("HTTP server listening on %s", c.OCSPResponder.ListenAddress)
+// lookup fetches the response to req from source and pretty-prints it
+// to out.
+func lookup(ctx context.Context, source responder.Source, req *ocsp.Request, out io.Writer) error {
+	resp, err := source.Response(ctx, req)
+	if err != nil {
+		return fmt.Errorf("looking up response for serial %s: %w", core.SerialToString(req.SerialNumber), err)
+	}
+	fmt.Fprint(out, helper.PrettyResponse(resp.Response))
+	return nil
+}
 
-	srv := &http.Server{
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 120 * time.Second,
-		IdleTimeout:  120 * time.Second,
-		Addr:         c.OCSPResponder.ListenAddress,
-		Handler:      m,
+// requestHashes are the hashes which generated requests may use for the
+// issuer name and key.
+var requestHashes = map[string]crypto.Hash{
+	"SHA1":   crypto.SHA1,
+	"SHA256": crypto.SHA256,
+}
+
+// generateRequest builds a DER-encoded OCSP request for the certificate in
+// certFile, issued by the certificate in issuerFile, using hash for the
+// issuer name and key hashes.
+func generateRequest(certFile, issuerFile string, hash crypto.Hash) ([]byte, error) {
+	cert, err := core.LoadCert(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading certificate: %w", err)
+	}
+	issuer, err := core.LoadCert(issuerFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading issuer: %w", err)
 	}
+	return createRequest(cert.SerialNumber, issuer, hash)
+}
 
-	err = srv.ListenAndServe()
-	if err != nil && err != http.ErrServerClosed {
-		cmd.FailOnError(err, "Running HTTP server")
+// createRequest builds a DER-encoded OCSP request for serial, issued by
+// issuer, using hash for the issuer name and key hashes.
+func createRequest(serial *big.Int, issuer *x509.Certificate, hash crypto.Hash) ([]byte, error) {
+	return ocsp.CreateRequest(&x509.Certificate{SerialNumber: serial}, issuer, &ocsp.RequestOptions{Hash: hash})
+}
+
+// writeRequest writes the DER-encoded OCSP request to out, either as raw DER,
+// suitable for a POST body, or as URL-escaped base64 followed by a newline,
+// suitable for appending to the responder path in a GET request.
+func writeRequest(req []byte, der bool, out io.Writer) error {
+	if der {
+		_, err := out.Write(req)
+		return err
 	}
+	_, err := fmt.Fprintln(out, url.PathEscape(base64.StdEncoding.EncodeToString(req)))
+	return err
+}
 
-	// When main is ready to exit (because it has received a shutdown signal),
-	// gracefully shutdown the servers. Calling these shutdown functions causes
-	// ListenAndServe() to immediately return, cleaning up the server goroutines
-	// as well, then waits for any lingering connection-handing goroutines to
-	// finish and clean themselves up.
-	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(),
-			c.OCSPResponder.ShutdownStopTimeout.Duration)
-		defer cancel()
-		_ = srv.Shutdown(ctx)
-		oTelShutdown(ctx)
-	}()
+// startupSummary describes the responder's effective routing. It is logged
+// once at startup, so that a deploy can be checked against intent from logs
+// alone. It must not contain secrets, so it only records which backends are
+// configured, not how to connect to them.
+type startupSummary struct {
+	Sources           []string
+	RedisFallbacks    int
+	IssuerCount       int
+	SerialPrefixes    []string
+	Timeout           string
+	LiveSigningPeriod string
+	MaxResponseAge    string
+	Features          features.Config
+}
 
-	cmd.WaitForSignal()
+// summarizeConfig builds the startupSummary for c, given the number of issuer
+// certificates which were loaded.
+func summarizeConfig(c *Config, issuerCount int) startupSummary {
+	var sources []string
+	if strings.HasPrefix(c.OCSPResponder.Source, "file:") {
+		sources = append(sources, "file")
+	} else if c.OCSPResponder.Source == revinfoSourceURL {
+		sources = append(sources, "revinfo")
+	} else {
+		sources = append(sources, "redis")
+		if c.OCSPResponder.DB != (cmd.DBConfig{}) {
+			sources = append(sources, "mysql")
+		}
+		if c.OCSPResponder.SAService != nil {
+			sources = append(sources, "sa")
+		}
+	}
+	if c.OCSPResponder.StagingSource != "" {
+		sources = append(sources, "staging")
+	}
+	if c.OCSPResponder.BlocklistFile != "" {
+		sources = append(sources, "blocklist")
+	}
+
+	return startupSummary{
+		Sources:           sources,
+		RedisFallbacks:    len(c.OCSPResponder.RedisFallbacks),
+		IssuerCount:       issuerCount,
+		SerialPrefixes:    c.OCSPResponder.RequiredSerialPrefixes,
+		Timeout:           c.OCSPResponder.Timeout.Duration.String(),
+		LiveSigningPeriod: c.OCSPResponder.LiveSigningPeriod.Duration.String(),
+		MaxResponseAge:    c.OCSPResponder.MaxResponseAge.Duration.String(),
+		Features:          c.OCSPResponder.Features,
+	}
+}
+
+// discardResponseWriter is an http.ResponseWriter which throws away
+// everything written to it.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d *discardResponseWriter) Header() http.Header {
+	if d.header == nil {
+		d.header = make(http.Header)
+	}
+	return d.header
+}
+
+func (d *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+
+func (d *discardResponseWriter) WriteHeader(int) {}
+
+// syntheticLookups sends n POST requests for random serials through handler,
+// spread evenly across issuerCerts, so that the resulting metrics reflect how
+// the responder handles real traffic.
+func syntheticLookups(handler http.Handler, responderPath string, issuerCerts []*issuance.Certificate, n int) error {
+	if len(issuerCerts) == 0 {
+		return fmt.Errorf("no issuer certificates to make requests for")
+	}
+	if responderPath == "" {
+		responderPath = "/"
+	}
+	for i := range n {
+		serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+		if err != nil {
+			return err
+		}
+		issuer := issuerCerts[i%len(issuerCerts)]
+		reqBytes, err := ocsp.CreateRequest(&x509.Certificate{SerialNumber: serial}, issuer.Certificate, nil)
+		if err != nil {
+			return fmt.Errorf("creating request for issuer %q: %w", issuer.Subject.CommonName, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, responderPath, bytes.NewReader(reqBytes))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/ocsp-request")
+		handler.ServeHTTP(&discardResponseWriter{}, req)
+	}
+	return nil
+}
+
+// metricsPrefixRE matches the prefixes which keep metric names valid.
+var metricsPrefixRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// prefixedScope returns a Registerer which prepends prefix to the names of
+// all metrics registered through it, or stats itself if prefix is empty.
+func prefixedScope(stats prometheus.Registerer, prefix string) (prometheus.Registerer, error) {
+	if prefix == "" {
+		return stats, nil
+	}
+	if !metricsPrefixRE.MatchString(prefix) {
+		return nil, fmt.Errorf("metrics prefix %q is not a valid metric name prefix", prefix)
+	}
+	return prometheus.WrapRegistererWithPrefix(prefix, stats), nil
+}
+
+// writeMetrics writes every metric in gatherer to out, in the Prometheus text
+// exposition format.
+func writeMetrics(gatherer prometheus.Gatherer, out io.Writer) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		_, err = expfmt.MetricFamilyToText(out, family)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // ocspMux partially implements the interface defined for http.ServeMux but doesn't implement
@@ -276,17 +1343,137 @@ func (om *ocspMux) Handler(_ *http.Request) (http.Handler, string) {
 	return om.handler, "/"
 }
 
-func mux(responderPath string, source responder.Source, timeout time.Duration, stats prometheus.Registerer, oTelHTTPOptions []otelhttp.Option, logger blog.Logger, sampleRate int) http.Handler {
-	stripPrefix := http.StripPrefix(responderPath, responder.NewResponder(source, timeout, stats, logger, sampleRate))
-	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" && r.URL.Path == "/" {
-			w.Header().Set("Cache-Control", "max-age=43200") // Cache for 12 hours
-			w.WriteHeader(200)
+// statusRecorder wraps an http.ResponseWriter and records the status code
+// sent, and the first error writing the body, so that they can be counted
+// once the response is complete.
+type statusRecorder struct {
+	http.ResponseWriter
+	code     int
+	writeErr error
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	n, err := sr.ResponseWriter.Write(b)
+	if err != nil && sr.writeErr == nil {
+		sr.writeErr = err
+	}
+	return n, err
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	if sr.code == 0 {
+		sr.code = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// status returns the status code sent to the client. If the handler never
+// called WriteHeader, net/http will have sent a 200.
+func (sr *statusRecorder) status() int {
+	if sr.code == 0 {
+		return http.StatusOK
+	}
+	return sr.code
+}
+
+// isClientDisconnect returns true if err, returned when writing a response to
+// r, was caused by the client going away rather than by anything on our side.
+func isClientDisconnect(r *http.Request, err error) bool {
+	return errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, net.ErrClosed) ||
+		r.Context().Err() != nil
+}
+
+// muxConfig configures the handler built by mux: the responder itself, and
+// the handling of requests in front of it. Nil fields disable the
+// corresponding behaviour.
+type muxConfig struct {
+	// responderPath is the path prefix under which OCSP requests are served.
+	responderPath   string
+	responder       responder.Options
+	deniedAgents    *userAgentDenylist
+	allowlist       *clientAllowlist
+	responseHeaders http.Header
+	health          HealthConfig
+	lameDuck        *lameDuck
+	expiry          *issuerExpiry
+	caps            *capabilities
+	oTelHTTPOptions []otelhttp.Option
+}
+
+func mux(source responder.Source, conf muxConfig, stats prometheus.Registerer, logger blog.Logger) http.Handler {
+	httpResponses := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocsp_http_responses",
+		Help: "Count of HTTP responses sent by the OCSP responder, by status code, or client_disconnect if the client went away mid-response",
+	}, []string{"code"})
+	stats.MustRegister(httpResponses)
+
+	deniedRequests := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ocsp_denied_user_agent_requests",
+		Help: "Count of requests refused because their user agent is on the denylist",
+	})
+	stats.MustRegister(deniedRequests)
+
+	allowlistedRequests := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ocsp_allowlisted_requests",
+		Help: "Count of requests from allowlisted clients, which are exempt from load shedding",
+	})
+	stats.MustRegister(allowlistedRequests)
+
+	rs := responder.NewResponder(source, conf.responder, stats, logger)
+	stripPrefix := http.StripPrefix(conf.responderPath, rs)
+	var staplingPrefix http.Handler
+	if conf.responder.Stapling.Path != "" {
+		staplingPrefix = http.StripPrefix(conf.responder.Stapling.Path, responder.StaplingHandler(rs))
+	}
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		w := &statusRecorder{ResponseWriter: rw}
+		defer func() {
+			if w.writeErr != nil {
+				if isClientDisconnect(r, w.writeErr) {
+					// Nothing went wrong on our side, so don't count it
+					// against the status code or log it.
+					httpResponses.WithLabelValues("client_disconnect").Inc()
+					return
+				}
+				logger.Warningf("Writing response for %s %s: %s", r.Method, r.URL.Path, w.writeErr)
+			}
+			httpResponses.WithLabelValues(strconv.Itoa(w.status())).Inc()
+		}()
+		exempt := conf.allowlist.allows(r.RemoteAddr)
+		if exempt {
+			allowlistedRequests.Inc()
+			r = r.WithContext(responder.WithShedExempt(r.Context()))
+		}
+		if !exempt && conf.deniedAgents.denies(r.UserAgent()) {
+			deniedRequests.Inc()
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if status, ok := conf.health.healthStatus(r); ok {
+			status = conf.health.degradedStatus(status, conf.expiry)
+			status = conf.lameDuck.healthStatus(status)
+			if status == http.StatusOK {
+				w.Header().Set("Cache-Control", "max-age=43200") // Cache for 12 hours
+			}
+			w.WriteHeader(status)
+			return
+		}
+		if conf.caps.serves(r) {
+			conf.caps.ServeHTTP(w, r)
+			return
+		}
+		for name, values := range conf.responseHeaders {
+			w.Header()[name] = append([]string(nil), values...)
+		}
+		if staplingPrefix != nil && strings.HasPrefix(r.URL.Path, conf.responder.Stapling.Path) {
+			staplingPrefix.ServeHTTP(w, r)
 			return
 		}
 		stripPrefix.ServeHTTP(w, r)
 	})
-	return measured_http.New(&ocspMux{h}, cmd.Clock(), stats, oTelHTTPOptions...)
+	return measured_http.New(&ocspMux{h}, cmd.Clock(), stats, conf.oTelHTTPOptions...)
 }
 
 func init() {
@@ -2,19 +2,44 @@ package notmain
 
 import (
 	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/crypto/ocsp"
 
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/config"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/issuance"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/ocsp/responder"
+	rocsp_config "github.com/letsencrypt/boulder/rocsp/config"
 	"github.com/letsencrypt/boulder/test"
 )
 
@@ -41,7 +66,7 @@ func TestMux(t *testing.T) {
 	src, err := responder.NewMemorySource(responses, blog.NewMock())
 	test.AssertNotError(t, err, "failed to create inMemorySource")
 
-	h := mux("/foobar/", src, time.Second, metrics.NoopRegisterer, []otelhttp.Option{}, blog.NewMock(), 1000)
+	h := mux(src, muxConfig{responderPath: "/foobar/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}}, metrics.NoopRegisterer, blog.NewMock())
 
 	type muxTest struct {
 		method   string
@@ -53,6 +78,12 @@ func TestMux(t *testing.T) {
 		{"POST", "/foobar/", reqBytes, respBytes},
 		{"GET", "/", nil, nil},
 		{"GET", "/foobar/MFMwUTBPME0wSzAJBgUrDgMCGgUABBR+5mrncpqz/PiiIGRsFqEtYHEIXQQUqEpqYwR93brm0Tm3pkVl7/Oo7KECEgO/AC2R1FW8hePAj4xp//8Jhw==", nil, respBytes},
+		// Some clients append a trailing slash, or escape the slashes.
+		{"GET", "/foobar/MFMwUTBPME0wSzAJBgUrDgMCGgUABBR+5mrncpqz/PiiIGRsFqEtYHEIXQQUqEpqYwR93brm0Tm3pkVl7/Oo7KECEgO/AC2R1FW8hePAj4xp//8Jhw==/", nil, respBytes},
+		{"GET", "/foobar/MFMwUTBPME0wSzAJBgUrDgMCGgUABBR+5mrncpqz%2FPiiIGRsFqEtYHEIXQQUqEpqYwR93brm0Tm3pkVl7%2FOo7KECEgO%2FAC2R1FW8hePAj4xp%2F%2F8Jhw%3D%3D%2F", nil, respBytes},
+		// A client which naively joins the responder URL and the request
+		// adds a slash at each end.
+		{"GET", "/foobar//MFMwUTBPME0wSzAJBgUrDgMCGgUABBR+5mrncpqz/PiiIGRsFqEtYHEIXQQUqEpqYwR93brm0Tm3pkVl7/Oo7KECEgO/AC2R1FW8hePAj4xp//8Jhw==/", nil, respBytes},
 	}
 	for i, mt := range mts {
 		w := httptest.NewRecorder()
@@ -69,3 +100,635 @@ func TestMux(t *testing.T) {
 		}
 	}
 }
+
+func TestLookup(t *testing.T) {
+	respBytes, err := os.ReadFile("../../ocsp/responder/testdata/ocsp.resp")
+	test.AssertNotError(t, err, "failed to read OCSP response")
+	resp, err := ocsp.ParseResponse(respBytes, nil)
+	test.AssertNotError(t, err, "failed to parse OCSP response")
+	issuer, err := issuance.LoadCertificate("../../ocsp/responder/testdata/test-ca.der.pem")
+	test.AssertNotError(t, err, "loading issuer cert")
+
+	responses := map[string]*responder.Response{
+		resp.SerialNumber.String(): {Response: resp, Raw: respBytes},
+	}
+	src, err := responder.NewMemorySource(responses, blog.NewMock())
+	test.AssertNotError(t, err, "failed to create inMemorySource")
+	filter, err := responder.NewFilterSource(responder.StaticIssuers{issuer}, responder.FilterConfig{}, src, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	test.AssertNotError(t, err, "creating filter source")
+
+	// The request carries the issuer's hashes, so it passes the filter.
+	req, err := lookupRequest(core.SerialToString(resp.SerialNumber), issuer.Certificate, crypto.SHA1)
+	test.AssertNotError(t, err, "building request")
+	test.Assert(t, len(req.IssuerKeyHash) > 0, "request has no issuer key hash")
+	var out bytes.Buffer
+	err = lookup(context.Background(), filter, req, &out)
+	test.AssertNotError(t, err, "looking up known serial")
+	test.AssertContains(t, out.String(), fmt.Sprintf("SerialNumber %036x", resp.SerialNumber))
+	test.AssertContains(t, out.String(), fmt.Sprintf("ThisUpdate %s", resp.ThisUpdate))
+	test.AssertContains(t, out.String(), fmt.Sprintf("NextUpdate %s", resp.NextUpdate))
+
+	out.Reset()
+	req, err = lookupRequest("0000000000000000000000000000000000ff", issuer.Certificate, crypto.SHA1)
+	test.AssertNotError(t, err, "building request")
+	err = lookup(context.Background(), filter, req, &out)
+	test.AssertErrorIs(t, err, responder.ErrNotFound)
+	test.AssertEquals(t, out.Len(), 0)
+
+	// A request for another issuer is refused by the filter.
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "generating issuer key")
+	other, _ := writeTestCert(t, t.TempDir(), "other issuer", 2, otherKey, nil, nil)
+	req, err = lookupRequest(core.SerialToString(resp.SerialNumber), other, crypto.SHA1)
+	test.AssertNotError(t, err, "building request")
+	err = lookup(context.Background(), filter, req, &out)
+	test.AssertErrorIs(t, err, responder.ErrNotFound)
+	test.AssertEquals(t, out.Len(), 0)
+
+	_, err = lookupRequest("not-a-serial", issuer.Certificate, crypto.SHA1)
+	test.AssertError(t, err, "building request for malformed serial")
+}
+
+func TestReadOnlySigner(t *testing.T) {
+	// Lookups of missing or stale responses fail, rather than reporting the
+	// serial as not found or signing a fresh response.
+	_, err := readOnlySigner{}.Response(context.Background(), &ocsp.Request{SerialNumber: big.NewInt(1)})
+	test.AssertErrorIs(t, err, errReadOnlyLookup)
+	test.Assert(t, !errors.Is(err, responder.ErrNotFound), "read-only lookup reported as not found")
+}
+
+// countHTTPResponses returns the value of the ocsp_http_responses counter for
+// the given status code in reg.
+func countHTTPResponses(t *testing.T, reg prometheus.Gatherer, code int) float64 {
+	t.Helper()
+	return countHTTPResponsesLabeled(t, reg, strconv.Itoa(code))
+}
+
+func countHTTPResponsesLabeled(t *testing.T, reg prometheus.Gatherer, code string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	test.AssertNotError(t, err, "gathering metrics")
+	for _, family := range families {
+		if family.GetName() != "ocsp_http_responses" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == "code" && lp.GetValue() == code {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestMuxStatusCodeCounter(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+
+	respBytes, err := os.ReadFile("./testdata/ocsp.resp")
+	test.AssertNotError(t, err, "failed to read OCSP response")
+	resp, err := ocsp.ParseResponse(respBytes, nil)
+	test.AssertNotError(t, err, "failed to parse OCSP response")
+
+	responses := map[string]*responder.Response{
+		req.SerialNumber.String(): {Response: resp, Raw: respBytes},
+	}
+	src, err := responder.NewMemorySource(responses, blog.NewMock())
+	test.AssertNotError(t, err, "failed to create inMemorySource")
+
+	reg := prometheus.NewRegistry()
+	h := mux(src, muxConfig{responderPath: "/foobar/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}}, reg, blog.NewMock())
+
+	for _, mt := range []struct {
+		method string
+		path   string
+		body   []byte
+	}{
+		{"GET", "/", nil},
+		{"POST", "/foobar/", reqBytes},
+		{"GET", "/foobar/not-base64!", nil},
+		{"POST", "/foobar/", []byte("not an OCSP request")},
+		{"PUT", "/foobar/", nil},
+	} {
+		r, err := http.NewRequest(mt.method, mt.path, bytes.NewReader(mt.body))
+		test.AssertNotError(t, err, "creating request")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	test.AssertEquals(t, countHTTPResponses(t, reg, http.StatusOK), 2.0)
+	test.AssertEquals(t, countHTTPResponses(t, reg, http.StatusBadRequest), 2.0)
+	test.AssertEquals(t, countHTTPResponses(t, reg, http.StatusMethodNotAllowed), 1.0)
+	test.AssertEquals(t, countHTTPResponses(t, reg, http.StatusInternalServerError), 0.0)
+}
+
+func TestMuxHealth(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+
+	testCases := []struct {
+		name   string
+		health HealthConfig
+		method string
+		path   string
+		want   int
+	}{
+		{"default root", HealthConfig{}, "GET", "/", http.StatusOK},
+		{"default root HEAD", HealthConfig{}, "HEAD", "/", http.StatusOK},
+		{"default unknown path", HealthConfig{}, "GET", "/healthz", http.StatusBadRequest},
+		{"root 200", HealthConfig{RootStatus: 200}, "GET", "/", http.StatusOK},
+		{"root 404", HealthConfig{RootStatus: 404}, "GET", "/", http.StatusNotFound},
+		{"root 404 HEAD", HealthConfig{RootStatus: 404}, "HEAD", "/", http.StatusNotFound},
+		{"health path", HealthConfig{RootStatus: 404, Paths: []string{"/healthz"}}, "GET", "/healthz", http.StatusOK},
+		{"health path HEAD", HealthConfig{RootStatus: 404, Paths: []string{"/healthz"}}, "HEAD", "/healthz", http.StatusOK},
+		{"health path POST", HealthConfig{Paths: []string{"/healthz"}}, "POST", "/healthz", http.StatusOK},
+		{"health path prefix", HealthConfig{Paths: []string{"/healthz"}}, "GET", "/healthz/more", http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &countingSource{}
+			h := mux(src, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}, health: tc.health}, metrics.NoopRegisterer, blog.NewMock())
+			var body []byte
+			if tc.method == "POST" {
+				body = reqBytes
+			}
+			r, err := http.NewRequest(tc.method, tc.path, bytes.NewReader(body))
+			test.AssertNotError(t, err, "creating request")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			test.AssertEquals(t, w.Code, tc.want)
+			test.AssertEquals(t, w.Header().Get("Cache-Control") == "max-age=43200", tc.want == http.StatusOK && src.lookups == 0)
+		})
+	}
+}
+
+func TestMuxRootDisabled(t *testing.T) {
+	testCases := []struct {
+		name          string
+		responderPath string
+		health        HealthConfig
+		want          int
+	}{
+		{"enabled", "/ocsp/", HealthConfig{}, http.StatusOK},
+		{"disabled", "/ocsp/", HealthConfig{RootStatus: http.StatusNotFound}, http.StatusNotFound},
+		{"disabled at OCSP path", "/", HealthConfig{RootStatus: http.StatusNotFound}, http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := mux(&countingSource{}, muxConfig{responderPath: tc.responderPath, responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}, health: tc.health}, metrics.NoopRegisterer, blog.NewMock())
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			test.AssertEquals(t, w.Code, tc.want)
+			test.AssertEquals(t, w.Header().Get("Cache-Control") == "max-age=43200", tc.want == http.StatusOK)
+		})
+	}
+}
+
+func TestMuxLameDuck(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+
+	src := &countingSource{}
+	ld := &lameDuck{}
+	h := mux(src, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}, health: HealthConfig{Paths: []string{"/healthz"}}, lameDuck: ld}, metrics.NoopRegisterer, blog.NewMock())
+
+	serve := func(method, path string, body []byte) int {
+		t.Helper()
+		r, err := http.NewRequest(method, path, bytes.NewReader(body))
+		test.AssertNotError(t, err, "creating request")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	test.AssertEquals(t, serve("GET", "/healthz", nil), http.StatusOK)
+	test.AssertEquals(t, serve("GET", "/", nil), http.StatusOK)
+
+	// In lame-duck mode, health checks fail but OCSP requests are still
+	// looked up and answered.
+	ld.enter()
+	test.AssertEquals(t, serve("GET", "/healthz", nil), http.StatusServiceUnavailable)
+	test.AssertEquals(t, serve("HEAD", "/", nil), http.StatusServiceUnavailable)
+	before := src.lookups
+	test.AssertEquals(t, serve("POST", "/", reqBytes), http.StatusOK)
+	test.AssertEquals(t, src.lookups, before+1)
+}
+
+// failingWriter is an http.ResponseWriter whose body writes fail with err, as
+// if the connection had broken.
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	err error
+}
+
+func (fw failingWriter) Write([]byte) (int, error) {
+	return 0, fw.err
+}
+
+func TestMuxClientDisconnect(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+	respBytes, err := os.ReadFile("./testdata/ocsp.resp")
+	test.AssertNotError(t, err, "failed to read OCSP response")
+	resp, err := ocsp.ParseResponse(respBytes, nil)
+	test.AssertNotError(t, err, "failed to parse OCSP response")
+
+	src, err := responder.NewMemorySource(map[string]*responder.Response{
+		req.SerialNumber.String(): {Response: resp, Raw: respBytes},
+	}, blog.NewMock())
+	test.AssertNotError(t, err, "failed to create inMemorySource")
+
+	reg := prometheus.NewRegistry()
+	log := blog.NewMock()
+	h := mux(src, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}}, reg, log)
+
+	serve := func(writeErr error) {
+		t.Helper()
+		r, err := http.NewRequest("POST", "/", bytes.NewReader(reqBytes))
+		test.AssertNotError(t, err, "creating request")
+		h.ServeHTTP(failingWriter{httptest.NewRecorder(), writeErr}, r)
+	}
+
+	// The client closing the connection mid-write is counted separately from
+	// the status code, and not logged.
+	serve(&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)})
+	serve(&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.ECONNRESET)})
+	test.AssertEquals(t, countHTTPResponsesLabeled(t, reg, "client_disconnect"), 2.0)
+	test.AssertEquals(t, countHTTPResponses(t, reg, http.StatusOK), 0.0)
+	test.AssertEquals(t, len(log.GetAllMatching("Writing response")), 0)
+
+	// Any other write error is logged, and counted by status code as usual.
+	serve(errors.New("something else"))
+	test.AssertEquals(t, countHTTPResponsesLabeled(t, reg, "client_disconnect"), 2.0)
+	test.AssertEquals(t, countHTTPResponses(t, reg, http.StatusOK), 1.0)
+	test.AssertEquals(t, len(log.GetAllMatching("Writing response .*something else")), 1)
+}
+
+// countingSource is a responder.Source which counts its lookups and always
+// returns responder.ErrNotFound.
+type countingSource struct {
+	lookups int
+}
+
+func (cs *countingSource) Response(context.Context, *ocsp.Request) (*responder.Response, error) {
+	cs.lookups++
+	return nil, responder.ErrNotFound
+}
+
+// errorSource fails every lookup with err.
+type errorSource struct {
+	err error
+}
+
+func (es errorSource) Response(context.Context, *ocsp.Request) (*responder.Response, error) {
+	return nil, es.err
+}
+
+func TestMuxStatusCodes(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+
+	configured := responder.StatusCodeConfig{
+		NotFound:      404,
+		Malformed:     422,
+		Expired:       410,
+		TryLater:      429,
+		InternalError: 502,
+	}
+	testCases := []struct {
+		name        string
+		err         error
+		body        []byte
+		defaultCode int
+		want        int
+	}{
+		{"not found", responder.ErrNotFound, reqBytes, http.StatusOK, 404},
+		{"malformed", nil, []byte("not an OCSP request"), http.StatusBadRequest, 422},
+		{"expired", responder.ErrExpired, reqBytes, 533, 410},
+		{"try later", responder.ErrTryLater, reqBytes, http.StatusServiceUnavailable, 429},
+		{"internal error", errors.New("oops"), reqBytes, http.StatusInternalServerError, 502},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			serve := func(statusCodes responder.StatusCodeConfig) int {
+				t.Helper()
+				h := mux(errorSource{tc.err}, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, StatusCodes: statusCodes, LogSampleRate: 1000}}, metrics.NoopRegisterer, blog.NewMock())
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest("POST", "/", bytes.NewReader(tc.body)))
+				return w.Code
+			}
+			test.AssertEquals(t, serve(responder.StatusCodeConfig{}), tc.defaultCode)
+			test.AssertEquals(t, serve(configured), tc.want)
+		})
+	}
+}
+
+func TestMuxUserAgentDenylist(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+
+	_, err = newUserAgentDenylist(UserAgentDenylistConfig{Patterns: []string{"("}})
+	test.AssertError(t, err, "accepted invalid user agent pattern")
+	empty, err := newUserAgentDenylist(UserAgentDenylistConfig{})
+	test.AssertNotError(t, err, "creating empty denylist")
+	test.Assert(t, empty == nil, "empty denylist should be nil")
+	test.Assert(t, !empty.denies("anything"), "empty denylist denied a user agent")
+
+	denied, err := newUserAgentDenylist(UserAgentDenylistConfig{
+		Exact:    []string{"BadScanner/1.0"},
+		Patterns: []string{`^evil-bot/\d+$`},
+	})
+	test.AssertNotError(t, err, "creating denylist")
+
+	src := &countingSource{}
+	reg := prometheus.NewRegistry()
+	h := mux(src, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}, deniedAgents: denied}, reg, blog.NewMock())
+
+	for _, tc := range []struct {
+		ua      string
+		allowed bool
+	}{
+		{"BadScanner/1.0", false},
+		{"evil-bot/42", false},
+		{"BadScanner/1.0 (compatible)", true},
+		{"not-evil-bot/42", true},
+		{"Mozilla/5.0", true},
+		{"", true},
+	} {
+		t.Run(tc.ua, func(t *testing.T) {
+			lookups := src.lookups
+			r, err := http.NewRequest("POST", "/", bytes.NewReader(reqBytes))
+			test.AssertNotError(t, err, "creating request")
+			r.Header.Set("User-Agent", tc.ua)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if tc.allowed {
+				test.AssertEquals(t, w.Code, http.StatusOK)
+				test.AssertEquals(t, src.lookups, lookups+1)
+			} else {
+				test.AssertEquals(t, w.Code, http.StatusForbidden)
+				test.AssertEquals(t, src.lookups, lookups)
+			}
+		})
+	}
+	test.AssertEquals(t, countHTTPResponses(t, reg, http.StatusForbidden), 2.0)
+}
+
+func TestMuxStapling(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+	respBytes, err := os.ReadFile("./testdata/ocsp.resp")
+	test.AssertNotError(t, err, "failed to read OCSP response")
+	resp, err := ocsp.ParseResponse(respBytes, nil)
+	test.AssertNotError(t, err, "failed to parse OCSP response")
+
+	src, err := responder.NewMemorySource(map[string]*responder.Response{
+		req.SerialNumber.String(): {Response: resp, Raw: respBytes},
+	}, blog.NewMock())
+	test.AssertNotError(t, err, "failed to create inMemorySource")
+
+	stapling := responder.StaplingConfig{Path: "/stapling/", MaxAge: config.Duration{Duration: time.Hour}}
+	h := mux(src, muxConfig{responderPath: "/foobar/", responder: responder.Options{Timeout: time.Second, Stapling: stapling, LogSampleRate: 1000}}, metrics.NoopRegisterer, blog.NewMock())
+
+	// Both paths serve the same response.
+	for _, path := range []string{"/foobar/", "/stapling/"} {
+		r, err := http.NewRequest("POST", path, bytes.NewReader(reqBytes))
+		test.AssertNotError(t, err, "creating request")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		test.AssertEquals(t, w.Code, http.StatusOK)
+		test.AssertByteEquals(t, w.Body.Bytes(), respBytes)
+	}
+}
+
+func TestDumpMetrics(t *testing.T) {
+	issuer, err := issuance.LoadCertificate("../../ocsp/responder/testdata/test-ca.der.pem")
+	test.AssertNotError(t, err, "loading issuer cert")
+
+	src, err := responder.NewMemorySource(map[string]*responder.Response{}, blog.NewMock())
+	test.AssertNotError(t, err, "failed to create inMemorySource")
+
+	reg := prometheus.NewRegistry()
+	filtered, err := responder.NewFilterSource(responder.StaticIssuers{issuer}, responder.FilterConfig{}, src, reg, blog.NewMock(), clock.NewFake())
+	test.AssertNotError(t, err, "creating filter source")
+	h := mux(filtered, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}}, reg, blog.NewMock())
+
+	err = syntheticLookups(h, "/", []*issuance.Certificate{issuer}, 3)
+	test.AssertNotError(t, err, "performing synthetic lookups")
+
+	var out bytes.Buffer
+	err = writeMetrics(reg, &out)
+	test.AssertNotError(t, err, "writing metrics")
+	// None of the random serials are in the source, so each lookup should
+	// have reached the filter's wrapped source and been answered with an
+	// OCSP unauthorized response.
+	test.AssertContains(t, out.String(), `ocsp_http_responses{code="200"} 3`)
+	test.AssertContains(t, out.String(), `ocsp_filter_responses{issuer="happy hacker fake CA",result="wrapped_error"} 3`)
+	test.AssertContains(t, out.String(), `ocsp_responses{type="Unauthorized"} 3`)
+
+	err = syntheticLookups(h, "/", nil, 1)
+	test.AssertError(t, err, "synthetic lookups with no issuers")
+}
+
+func TestPrefixedScope(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	scope, err := prefixedScope(reg, "")
+	test.AssertNotError(t, err, "empty prefix")
+	test.AssertEquals(t, scope, prometheus.Registerer(reg))
+
+	_, err = prefixedScope(reg, "pki-a")
+	test.AssertError(t, err, "accepted invalid metrics prefix")
+
+	issuer, err := issuance.LoadCertificate("../../ocsp/responder/testdata/test-ca.der.pem")
+	test.AssertNotError(t, err, "loading issuer cert")
+
+	// Two responders, for different PKIs, share one registry. Without the
+	// prefixes, registering the second would panic.
+	for _, prefix := range []string{"pki_a_", "pki_b_"} {
+		scope, err := prefixedScope(reg, prefix)
+		test.AssertNotError(t, err, "making prefixed scope")
+		src, err := responder.NewMemorySource(map[string]*responder.Response{}, blog.NewMock())
+		test.AssertNotError(t, err, "failed to create inMemorySource")
+		filtered, err := responder.NewFilterSource(responder.StaticIssuers{issuer}, responder.FilterConfig{}, src, scope, blog.NewMock(), clock.NewFake())
+		test.AssertNotError(t, err, "creating filter source")
+		h := mux(filtered, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}}, scope, blog.NewMock())
+		err = syntheticLookups(h, "/", []*issuance.Certificate{issuer}, 1)
+		test.AssertNotError(t, err, "performing synthetic lookups")
+	}
+
+	var out bytes.Buffer
+	err = writeMetrics(reg, &out)
+	test.AssertNotError(t, err, "writing metrics")
+	test.AssertContains(t, out.String(), `pki_a_ocsp_http_responses{code="200"} 1`)
+	test.AssertContains(t, out.String(), `pki_b_ocsp_http_responses{code="200"} 1`)
+	test.AssertContains(t, out.String(), `pki_a_ocsp_filter_responses{issuer="happy hacker fake CA",result="wrapped_error"} 1`)
+
+	families, err := reg.Gather()
+	test.AssertNotError(t, err, "gathering metrics")
+	for _, family := range families {
+		name := family.GetName()
+		test.Assert(t, strings.HasPrefix(name, "pki_a_") || strings.HasPrefix(name, "pki_b_"), fmt.Sprintf("metric %s has no prefix", name))
+	}
+}
+
+func TestMuxETag(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+
+	respBytes, err := os.ReadFile("./testdata/ocsp.resp")
+	test.AssertNotError(t, err, "failed to read OCSP response")
+	resp, err := ocsp.ParseResponse(respBytes, nil)
+	test.AssertNotError(t, err, "failed to parse OCSP response")
+
+	responses := map[string]*responder.Response{
+		req.SerialNumber.String(): {Response: resp, Raw: respBytes},
+	}
+	src, err := responder.NewMemorySource(responses, blog.NewMock())
+	test.AssertNotError(t, err, "failed to create inMemorySource")
+	h := mux(src, muxConfig{responderPath: "/foobar/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}}, metrics.NoopRegisterer, blog.NewMock())
+
+	serve := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest("POST", "/foobar/", bytes.NewReader(reqBytes))
+		test.AssertNotError(t, err, "creating request")
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("")
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	etag := w.Header().Get("ETag")
+	test.AssertEquals(t, etag, fmt.Sprintf("\"%X\"", sha256.Sum256(respBytes)))
+
+	w = serve(etag)
+	test.AssertEquals(t, w.Code, http.StatusNotModified)
+	test.AssertEquals(t, w.Body.Len(), 0)
+	test.AssertEquals(t, w.Header().Get("ETag"), etag)
+
+	w = serve("\"0123456789ABCDEF\"")
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertByteEquals(t, w.Body.Bytes(), respBytes)
+}
+
+func TestStartupSummary(t *testing.T) {
+	var c Config
+	c.OCSPResponder.DB = cmd.DBConfig{DBConnectFile: "/secret/db-connect"}
+	c.OCSPResponder.Redis = &rocsp_config.RedisConfig{PasswordConfig: cmd.PasswordConfig{PasswordFile: "/secret/redis-password"}}
+	c.OCSPResponder.RedisFallbacks = []*rocsp_config.RedisConfig{{}}
+	c.OCSPResponder.RequiredSerialPrefixes = []string{"7f", "ff"}
+	c.OCSPResponder.Timeout = config.Duration{Duration: 4 * time.Second}
+	c.OCSPResponder.MaxResponseAge = config.Duration{Duration: 96 * time.Hour}
+	c.OCSPResponder.BlocklistFile = "/etc/blocklist.yaml"
+	c.OCSPResponder.Features.ServeRenewalInfo = true
+
+	log := blog.NewMock()
+	log.InfoObject("Effective OCSP responder configuration", summarizeConfig(&c, 3))
+	lines := log.GetAllMatching("Effective OCSP responder configuration")
+	test.AssertEquals(t, len(lines), 1)
+	line := lines[0]
+
+	test.AssertContains(t, line, `"Sources":["redis","mysql","blocklist"]`)
+	test.AssertContains(t, line, `"RedisFallbacks":1`)
+	test.AssertContains(t, line, `"IssuerCount":3`)
+	test.AssertContains(t, line, `"SerialPrefixes":["7f","ff"]`)
+	test.AssertContains(t, line, `"Timeout":"4s"`)
+	test.AssertContains(t, line, `"MaxResponseAge":"96h0m0s"`)
+	test.AssertContains(t, line, `"ServeRenewalInfo":true`)
+	test.AssertNotContains(t, line, "/secret/")
+
+	c = Config{}
+	c.OCSPResponder.Source = "file:/etc/responses.b64"
+	summary := summarizeConfig(&c, 1)
+	test.AssertDeepEquals(t, summary.Sources, []string{"file"})
+
+	c = Config{}
+	c.OCSPResponder.Source = revinfoSourceURL
+	summary = summarizeConfig(&c, 1)
+	test.AssertDeepEquals(t, summary.Sources, []string{"revinfo"})
+}
+
+// writeTestCert creates a certificate for key, signed by parent and
+// parentKey (or self-signed if parent is nil), and writes it to a PEM file
+// in dir.
+func writeTestCert(t *testing.T, dir, name string, serial int64, key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, string) {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	test.AssertNotError(t, err, "creating certificate")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "parsing certificate")
+	path := filepath.Join(dir, name+".pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	test.AssertNotError(t, err, "writing certificate")
+	return cert, path
+}
+
+func TestGenerateRequest(t *testing.T) {
+	dir := t.TempDir()
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "generating issuer key")
+	issuer, issuerFile := writeTestCert(t, dir, "issuer", 1, issuerKey, nil, nil)
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "generating leaf key")
+	leaf, leafFile := writeTestCert(t, dir, "leaf", 1234567, leafKey, issuer, issuerKey)
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	_, err = asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki)
+	test.AssertNotError(t, err, "parsing issuer public key")
+
+	for name, hash := range requestHashes {
+		t.Run(name, func(t *testing.T) {
+			der, err := generateRequest(leafFile, issuerFile, hash)
+			test.AssertNotError(t, err, "generating request")
+
+			var get, post bytes.Buffer
+			test.AssertNotError(t, writeRequest(der, false, &get), "writing GET request")
+			test.AssertNotError(t, writeRequest(der, true, &post), "writing POST request")
+			test.AssertByteEquals(t, post.Bytes(), der)
+			unescaped, err := url.PathUnescape(strings.TrimSuffix(get.String(), "\n"))
+			test.AssertNotError(t, err, "unescaping GET request")
+			decoded, err := base64.StdEncoding.DecodeString(unescaped)
+			test.AssertNotError(t, err, "decoding GET request")
+			test.AssertByteEquals(t, decoded, der)
+
+			req, err := ocsp.ParseRequest(der)
+			test.AssertNotError(t, err, "parsing generated request")
+			test.AssertEquals(t, req.HashAlgorithm, hash)
+			test.AssertEquals(t, req.SerialNumber.Cmp(leaf.SerialNumber), 0)
+			h := hash.New()
+			h.Write(issuer.RawSubject)
+			test.AssertByteEquals(t, req.IssuerNameHash, h.Sum(nil))
+			h.Reset()
+			h.Write(spki.PublicKey.RightAlign())
+			test.AssertByteEquals(t, req.IssuerKeyHash, h.Sum(nil))
+		})
+	}
+
+	_, err = generateRequest(filepath.Join(dir, "missing.pem"), issuerFile, crypto.SHA1)
+	test.AssertError(t, err, "generated request for missing certificate")
+}
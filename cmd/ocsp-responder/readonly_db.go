@@ -0,0 +1,95 @@
+package notmain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/letsencrypt/boulder/db"
+)
+
+// errReadOnlyDB is returned for writes attempted through a readOnlyDB.
+var errReadOnlyDB = errors.New("write attempted against read-only database")
+
+// readOnlyProbe is a write which changes nothing even if it is permitted. A
+// read-only DB user or server refuses it outright.
+const readOnlyProbe = "UPDATE certificateStatus SET ocspLastUpdated = ocspLastUpdated WHERE 1 = 0"
+
+// readOnlyErrors are the MySQL error numbers which mean a write was refused
+// because the user or server is read-only.
+var readOnlyErrors = map[uint16]bool{
+	1142: true, // ER_TABLEACCESS_DENIED_ERROR
+	1290: true, // ER_OPTION_PREVENTS_STATEMENT, e.g. --read-only
+	1792: true, // ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION
+	1836: true, // ER_READ_ONLY_MODE
+}
+
+// verifyReadOnlyDB attempts a harmless write with execer, returning nil only
+// if the database refuses it for being read-only. It's used at startup in
+// read-only mode, to confirm that the configured DB user can't write before
+// serving anything.
+func verifyReadOnlyDB(ctx context.Context, execer db.Execer) error {
+	_, err := execer.ExecContext(ctx, readOnlyProbe)
+	if err == nil {
+		return errors.New("database accepted a write, but ReadOnlyDB requires a user which can only read")
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && readOnlyErrors[mysqlErr.Number] {
+		return nil
+	}
+	return fmt.Errorf("checking that the database is read-only: %w", err)
+}
+
+// readOnlyDB wraps a *db.WrappedMap, refusing every write attempted through
+// it and counting the attempts. Reads are passed through. The responder never
+// writes to the DB, so any refused write is a bug.
+type readOnlyDB struct {
+	*db.WrappedMap
+	refused prometheus.Counter
+}
+
+// newReadOnlyDB returns a readOnlyDB wrapping dbMap, which should already have
+// passed verifyReadOnlyDB. Read-only enforcement is exported as a gauge.
+func newReadOnlyDB(dbMap *db.WrappedMap, stats prometheus.Registerer) *readOnlyDB {
+	enforced := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ocsp_db_read_only",
+		Help: "Set to 1 when the DB has been verified read-only and writes through it are refused",
+	})
+	stats.MustRegister(enforced)
+	enforced.Set(1)
+	refused := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ocsp_db_writes_refused",
+		Help: "Count of writes refused because the DB is in read-only mode",
+	})
+	stats.MustRegister(refused)
+	return &readOnlyDB{WrappedMap: dbMap, refused: refused}
+}
+
+func (r *readOnlyDB) refuse() error {
+	r.refused.Inc()
+	return errReadOnlyDB
+}
+
+func (r *readOnlyDB) Insert(context.Context, ...interface{}) error {
+	return r.refuse()
+}
+
+func (r *readOnlyDB) Update(context.Context, ...interface{}) (int64, error) {
+	return 0, r.refuse()
+}
+
+func (r *readOnlyDB) Delete(context.Context, ...interface{}) (int64, error) {
+	return 0, r.refuse()
+}
+
+func (r *readOnlyDB) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, r.refuse()
+}
+
+func (r *readOnlyDB) BeginTx(context.Context) (db.Transaction, error) {
+	return nil, r.refuse()
+}
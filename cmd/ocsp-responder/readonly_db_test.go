@@ -0,0 +1,69 @@
+package notmain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/letsencrypt/boulder/db"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// errExecer returns err from every ExecContext.
+type errExecer struct {
+	err error
+}
+
+func (e errExecer) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, e.err
+}
+
+func TestVerifyReadOnlyDB(t *testing.T) {
+	for _, number := range []uint16{1142, 1290, 1792, 1836} {
+		err := verifyReadOnlyDB(context.Background(), errExecer{fmt.Errorf("wrapped: %w", &mysql.MySQLError{Number: number})})
+		test.AssertNotError(t, err, fmt.Sprintf("MySQL error %d should mean read-only", number))
+	}
+
+	err := verifyReadOnlyDB(context.Background(), errExecer{nil})
+	test.AssertError(t, err, "accepted a writable database")
+
+	err = verifyReadOnlyDB(context.Background(), errExecer{&mysql.MySQLError{Number: 2006}})
+	test.AssertError(t, err, "accepted an unrelated MySQL error")
+	err = verifyReadOnlyDB(context.Background(), errExecer{errors.New("connection refused")})
+	test.AssertError(t, err, "accepted a connection error")
+}
+
+func TestReadOnlyDBRefusesWrites(t *testing.T) {
+	stats := prometheus.NewRegistry()
+	// The wrapped map is never reached by writes, so it needn't be usable.
+	ro := newReadOnlyDB(&db.WrappedMap{}, stats)
+	ctx := context.Background()
+
+	err := ro.Insert(ctx, struct{}{})
+	test.AssertErrorIs(t, err, errReadOnlyDB)
+	_, err = ro.Update(ctx, struct{}{})
+	test.AssertErrorIs(t, err, errReadOnlyDB)
+	_, err = ro.Delete(ctx, struct{}{})
+	test.AssertErrorIs(t, err, errReadOnlyDB)
+	_, err = ro.ExecContext(ctx, "DELETE FROM certificateStatus")
+	test.AssertErrorIs(t, err, errReadOnlyDB)
+	_, err = ro.BeginTx(ctx)
+	test.AssertErrorIs(t, err, errReadOnlyDB)
+
+	test.AssertMetricWithLabelsEquals(t, ro.refused, prometheus.Labels{}, 5)
+
+	metrics, err := stats.Gather()
+	test.AssertNotError(t, err, "gathering metrics")
+	var enforced float64
+	for _, mf := range metrics {
+		if mf.GetName() == "ocsp_db_read_only" {
+			enforced = mf.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	test.AssertEquals(t, enforced, float64(1))
+}
@@ -0,0 +1,47 @@
+package notmain
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// debugPathsPath is the path on the admin server which shows the prefixes
+// stripped from OCSP request paths.
+const debugPathsPath = "/debug/paths"
+
+// validateResponderPath returns an error if path can't match the paths of
+// incoming requests, so that stripping it as a prefix would turn every request
+// away with a 404. An empty path strips nothing, and is allowed.
+func validateResponderPath(path string) error {
+	if path == "" {
+		return nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("path %q must begin with \"/\"", path)
+	}
+	if strings.ContainsAny(path, "?#") {
+		return fmt.Errorf("path %q must not contain a query or fragment", path)
+	}
+	if strings.Contains(path, "%") {
+		// Prefixes are matched against the unescaped request path.
+		return fmt.Errorf("path %q must not be percent-encoded", path)
+	}
+	if strings.IndexFunc(path, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("path %q must not contain whitespace", path)
+	}
+	return nil
+}
+
+// debugPathsHandler returns a handler which shows the prefixes stripped from
+// the paths of OCSP requests, and of those from stapling clients, so that a
+// misconfiguration can be spotted without reading the config.
+func debugPathsHandler(path, staplingPath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Path %q\n", path)
+		fmt.Fprintf(w, "StaplingPath %q\n", staplingPath)
+		fmt.Fprintf(w, "GET requests are expected at %s<base64 OCSP request>\n", path)
+	})
+}
@@ -0,0 +1,48 @@
+package notmain
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestValidateResponderPath(t *testing.T) {
+	testCases := []struct {
+		path  string
+		valid bool
+	}{
+		{"", true},
+		{"/", true},
+		{"/ocsp", true},
+		{"/ocsp/", true},
+		{"ocsp/", false},
+		{"http://ocsp.example.com/", false},
+		{"/ocsp?x=1", false},
+		{"/ocsp#frag", false},
+		{"/oc%73p/", false},
+		{"/ocsp /", false},
+		{"/ocsp/\n", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			err := validateResponderPath(tc.path)
+			if tc.valid {
+				test.AssertNotError(t, err, "valid path refused")
+			} else {
+				test.AssertError(t, err, "invalid path accepted")
+			}
+		})
+	}
+}
+
+func TestDebugPathsHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	debugPathsHandler("/ocsp/", "/staple/").ServeHTTP(w, httptest.NewRequest("GET", debugPathsPath, nil))
+	body, err := io.ReadAll(w.Body)
+	test.AssertNotError(t, err, "reading body")
+	test.AssertContains(t, string(body), `Path "/ocsp/"`)
+	test.AssertContains(t, string(body), `StaplingPath "/staple/"`)
+	test.AssertContains(t, string(body), "GET requests are expected at /ocsp/<base64 OCSP request>")
+}
@@ -0,0 +1,42 @@
+package notmain
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// protectedResponseHeaders are set by the responder itself, so configured
+// response headers may not override them.
+var protectedResponseHeaders = []string{
+	"Allow",
+	"Cache-Control",
+	"Content-Length",
+	"Content-Type",
+	"Edge-Cache-Tag",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+}
+
+// newResponseHeaders returns the configured headers to add to every OCSP
+// response, or an error if any would override one the responder sets.
+func newResponseHeaders(conf map[string]string) (http.Header, error) {
+	if len(conf) == 0 {
+		return nil, nil
+	}
+	headers := make(http.Header, len(conf))
+	for name, value := range conf {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if name == "" {
+			return nil, fmt.Errorf("response header with value %q has no name", value)
+		}
+		for _, protected := range protectedResponseHeaders {
+			if name == http.CanonicalHeaderKey(protected) {
+				return nil, fmt.Errorf("response header %q is set by the responder and can't be configured", name)
+			}
+		}
+		headers.Set(name, value)
+	}
+	return headers, nil
+}
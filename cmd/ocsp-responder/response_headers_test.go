@@ -0,0 +1,67 @@
+package notmain
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestNewResponseHeaders(t *testing.T) {
+	headers, err := newResponseHeaders(nil)
+	test.AssertNotError(t, err, "no headers configured")
+	test.AssertEquals(t, len(headers), 0)
+
+	headers, err = newResponseHeaders(map[string]string{"x-content-type-options": "nosniff"})
+	test.AssertNotError(t, err, "valid header")
+	test.AssertEquals(t, headers.Get("X-Content-Type-Options"), "nosniff")
+
+	for _, name := range []string{"Content-Type", "cache-control", "ETag", " Expires", ""} {
+		_, err = newResponseHeaders(map[string]string{name: "x"})
+		test.AssertError(t, err, "configured header "+name)
+	}
+}
+
+func TestMuxResponseHeaders(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+	respBytes, err := os.ReadFile("./testdata/ocsp.resp")
+	test.AssertNotError(t, err, "failed to read OCSP response")
+	resp, err := ocsp.ParseResponse(respBytes, nil)
+	test.AssertNotError(t, err, "failed to parse OCSP response")
+	src, err := responder.NewMemorySource(map[string]*responder.Response{
+		req.SerialNumber.String(): {Response: resp, Raw: respBytes},
+	}, blog.NewMock())
+	test.AssertNotError(t, err, "failed to create inMemorySource")
+
+	headers, err := newResponseHeaders(map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"Vary":                   "Accept-Encoding",
+	})
+	test.AssertNotError(t, err, "configuring headers")
+	h := mux(src, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}, responseHeaders: headers}, metrics.NoopRegisterer, blog.NewMock())
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/", bytes.NewReader(reqBytes)))
+		test.AssertEquals(t, w.Code, http.StatusOK)
+		test.AssertDeepEquals(t, w.Header().Values("X-Content-Type-Options"), []string{"nosniff"})
+		test.AssertDeepEquals(t, w.Header().Values("Vary"), []string{"Accept-Encoding"})
+		// The responder's own headers are unaffected.
+		test.AssertDeepEquals(t, w.Header().Values("Content-Type"), []string{"application/ocsp-response"})
+		test.AssertEquals(t, len(w.Header().Values("Cache-Control")), 1)
+		test.Assert(t, strings.HasPrefix(w.Header().Get("Cache-Control"), "max-age="), "unexpected Cache-Control "+w.Header().Get("Cache-Control"))
+	}
+}
@@ -0,0 +1,52 @@
+package notmain
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/letsencrypt/boulder/config"
+)
+
+// ServerTimeoutConfig bounds how long the HTTP server waits on a client
+// connection, so that clients which stall while sending a request or reading
+// a response are dropped rather than holding a connection open. These are
+// separate from Timeout, which bounds only the backend lookup. Zero fields
+// keep the defaults.
+type ServerTimeoutConfig struct {
+	// ReadHeaderTimeout is how long a client may take to send a request's
+	// headers. Defaults to 10 seconds.
+	ReadHeaderTimeout config.Duration `validate:"-"`
+
+	// ReadTimeout is how long a client may take to send a whole request,
+	// including its body. Defaults to 30 seconds.
+	ReadTimeout config.Duration `validate:"-"`
+
+	// WriteTimeout is how long, from the end of the request's headers, the
+	// server may take to write its response. Defaults to 120 seconds.
+	WriteTimeout config.Duration `validate:"-"`
+
+	// IdleTimeout is how long a kept-alive connection may wait for its next
+	// request. Defaults to 120 seconds.
+	IdleTimeout config.Duration `validate:"-"`
+}
+
+// newServer returns an http.Server serving handler on addr, with its timeouts
+// set as configured by conf.
+func newServer(addr string, handler http.Handler, conf ServerTimeoutConfig) *http.Server {
+	return &http.Server{
+		ReadHeaderTimeout: durationOrDefault(conf.ReadHeaderTimeout, 10*time.Second),
+		ReadTimeout:       durationOrDefault(conf.ReadTimeout, 30*time.Second),
+		WriteTimeout:      durationOrDefault(conf.WriteTimeout, 120*time.Second),
+		IdleTimeout:       durationOrDefault(conf.IdleTimeout, 120*time.Second),
+		Addr:              addr,
+		Handler:           handler,
+	}
+}
+
+// durationOrDefault returns d, or def if d is unset.
+func durationOrDefault(d config.Duration, def time.Duration) time.Duration {
+	if d.Duration == 0 {
+		return def
+	}
+	return d.Duration
+}
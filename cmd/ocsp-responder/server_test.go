@@ -0,0 +1,81 @@
+package notmain
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/config"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestNewServerDefaults(t *testing.T) {
+	srv := newServer(":80", http.NotFoundHandler(), ServerTimeoutConfig{})
+	test.AssertEquals(t, srv.ReadHeaderTimeout, 10*time.Second)
+	test.AssertEquals(t, srv.ReadTimeout, 30*time.Second)
+	test.AssertEquals(t, srv.WriteTimeout, 120*time.Second)
+	test.AssertEquals(t, srv.IdleTimeout, 120*time.Second)
+
+	srv = newServer(":80", http.NotFoundHandler(), ServerTimeoutConfig{ReadHeaderTimeout: config.Duration{Duration: time.Second}})
+	test.AssertEquals(t, srv.ReadHeaderTimeout, time.Second)
+	test.AssertEquals(t, srv.ReadTimeout, 30*time.Second)
+}
+
+// readUntilClosed reads from conn until the server closes it, and returns
+// what was read. It fails the test if the server hasn't closed conn within
+// a few seconds.
+func readUntilClosed(t *testing.T, conn net.Conn) []byte {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	read, err := io.ReadAll(conn)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		t.Fatalf("server didn't drop the stalled connection")
+	}
+	return read
+}
+
+func TestServerTimeoutsDropStalledRequests(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	test.AssertNotError(t, err, "listening")
+	srv := newServer("", mux(errorSource{errors.New("source consulted")}, muxConfig{responderPath: "/", responder: responder.Options{Timeout: time.Second, LogSampleRate: 1000}}, metrics.NoopRegisterer, blog.NewMock()), ServerTimeoutConfig{
+		ReadHeaderTimeout: config.Duration{Duration: 100 * time.Millisecond},
+		ReadTimeout:       config.Duration{Duration: 300 * time.Millisecond},
+	})
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	// A client which stops part way through its headers is dropped without
+	// a response.
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	test.AssertNotError(t, err, "dialing")
+	defer conn.Close()
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: ocsp\r\n"))
+	test.AssertNotError(t, err, "writing partial headers")
+	test.AssertEquals(t, len(readUntilClosed(t, conn)), 0)
+
+	// A client which sends its headers promptly, but stops part way through
+	// its body, is dropped once the read timeout passes. The source is never
+	// consulted.
+	conn, err = net.Dial("tcp", ln.Addr().String())
+	test.AssertNotError(t, err, "dialing")
+	defer conn.Close()
+	start := time.Now()
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: ocsp\r\nContent-Type: application/ocsp-request\r\nContent-Length: 1000\r\n\r\n"))
+	test.AssertNotError(t, err, "writing headers")
+	_, err = conn.Write(reqBytes[:10])
+	test.AssertNotError(t, err, "writing partial body")
+	read := readUntilClosed(t, conn)
+	test.Assert(t, time.Since(start) >= 300*time.Millisecond, "connection dropped before the read timeout")
+	test.AssertContains(t, string(read), "HTTP/1.1 400")
+}
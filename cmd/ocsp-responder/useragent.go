@@ -0,0 +1,62 @@
+package notmain
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// UserAgentDenylistConfig lists user agents whose requests are refused with
+// an HTTP 403 before any lookup is performed. It's intended for cheaply
+// shedding abusive scanners which send a fixed user agent. The zero value
+// denies nothing.
+type UserAgentDenylistConfig struct {
+	// Exact lists user agents which are denied when matched exactly.
+	Exact []string `validate:"dive,required"`
+
+	// Patterns lists regular expressions; user agents matching any of them
+	// are denied. Patterns are unanchored, so use ^ and $ as needed.
+	Patterns []string `validate:"dive,required"`
+}
+
+// userAgentDenylist decides whether to deny a request based on its user
+// agent. A nil *userAgentDenylist denies nothing.
+type userAgentDenylist struct {
+	exact    map[string]struct{}
+	patterns []*regexp.Regexp
+}
+
+// newUserAgentDenylist returns a userAgentDenylist as configured by conf, or
+// nil if conf lists nothing.
+func newUserAgentDenylist(conf UserAgentDenylistConfig) (*userAgentDenylist, error) {
+	if len(conf.Exact) == 0 && len(conf.Patterns) == 0 {
+		return nil, nil
+	}
+	d := &userAgentDenylist{exact: make(map[string]struct{}, len(conf.Exact))}
+	for _, ua := range conf.Exact {
+		d.exact[ua] = struct{}{}
+	}
+	for _, pattern := range conf.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling user agent pattern %q: %w", pattern, err)
+		}
+		d.patterns = append(d.patterns, re)
+	}
+	return d, nil
+}
+
+// denies returns true if requests from the given user agent should be denied.
+func (d *userAgentDenylist) denies(ua string) bool {
+	if d == nil {
+		return false
+	}
+	if _, ok := d.exact[ua]; ok {
+		return true
+	}
+	for _, re := range d.patterns {
+		if re.MatchString(ua) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package notmain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+)
+
+// errStatusChanged is returned by watch when the watched serial's status
+// changes, so that the process exits non-zero and alerts whoever runs it.
+var errStatusChanged = errors.New("status changed")
+
+// watchedStatus describes the status of a response, or "not found" if err
+// is responder.ErrNotFound.
+func watchedStatus(resp *responder.Response, err error) string {
+	if errors.Is(err, responder.ErrNotFound) {
+		return "not found"
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return fmt.Sprintf("revoked (reason %d)", resp.RevocationReason)
+	case ocsp.Unknown:
+		return "unknown"
+	}
+	return fmt.Sprintf("status %d", resp.Status)
+}
+
+// watch looks up the response to req in source every interval, logging its
+// status, until the status changes, when it returns errStatusChanged, or ctx
+// is done. Failed lookups are logged and retried at the next interval; they
+// aren't changes.
+func watch(ctx context.Context, source responder.Source, req *ocsp.Request, interval, timeout time.Duration, clk clock.Clock, logger blog.Logger) error {
+	serial := core.SerialToString(req.SerialNumber)
+
+	lookupOnce := func() (*responder.Response, error) {
+		ctx := ctx
+		if timeout != 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return source.Response(ctx, req)
+	}
+
+	var last string
+	for {
+		resp, err := lookupOnce()
+		if err != nil && !errors.Is(err, responder.ErrNotFound) {
+			logger.Warningf("Watching serial %s: lookup failed: %s", serial, err)
+		} else {
+			status := watchedStatus(resp, err)
+			if last == "" {
+				logger.Infof("Watching serial %s: status is %s", serial, status)
+			} else if status != last {
+				logger.Errf("Watching serial %s: status changed from %s to %s", serial, last, status)
+				return fmt.Errorf("serial %s: %w from %s to %s", serial, errStatusChanged, last, status)
+			}
+			last = status
+		}
+
+		// Checked first, since select picks at random if both are ready.
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clk.After(interval):
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package notmain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"golang.org/x/crypto/ocsp"
+
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// scriptedSource answers each lookup with the next of its results, repeating
+// the last one once they run out.
+type scriptedSource struct {
+	results []scriptedResult
+	lookups int
+}
+
+type scriptedResult struct {
+	status int
+	err    error
+}
+
+func (ss *scriptedSource) Response(context.Context, *ocsp.Request) (*responder.Response, error) {
+	result := ss.results[min(ss.lookups, len(ss.results)-1)]
+	ss.lookups++
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &responder.Response{Response: &ocsp.Response{Status: result.status, RevocationReason: ocsp.KeyCompromise}}, nil
+}
+
+func TestWatch(t *testing.T) {
+	req := &ocsp.Request{SerialNumber: big.NewInt(1234)}
+	good := scriptedResult{status: ocsp.Good}
+	revoked := scriptedResult{status: ocsp.Revoked}
+	failed := scriptedResult{err: errors.New("connection refused")}
+	notFound := scriptedResult{err: responder.ErrNotFound}
+
+	t.Run("good to revoked", func(t *testing.T) {
+		src := &scriptedSource{results: []scriptedResult{good, good, failed, good, revoked}}
+		clk := advancingClock{clock.NewFake()}
+		start := clk.Now()
+		logger := blog.NewMock()
+		err := watch(context.Background(), src, req, time.Minute, time.Second, clk, logger)
+		test.AssertErrorIs(t, err, errStatusChanged)
+		test.AssertEquals(t, src.lookups, 5)
+		test.AssertEquals(t, clk.Since(start), 4*time.Minute)
+		test.AssertEquals(t, len(logger.GetAllMatching("status is good")), 1)
+		test.AssertEquals(t, len(logger.GetAllMatching("lookup failed: connection refused")), 1)
+		test.AssertEquals(t, len(logger.GetAllMatching("status changed from good to revoked \\(reason 1\\)")), 1)
+	})
+
+	t.Run("good to not found", func(t *testing.T) {
+		src := &scriptedSource{results: []scriptedResult{good, notFound}}
+		err := watch(context.Background(), src, req, time.Minute, 0, advancingClock{clock.NewFake()}, blog.NewMock())
+		test.AssertErrorIs(t, err, errStatusChanged)
+		test.AssertContains(t, err.Error(), "from good to not found")
+	})
+
+	t.Run("unchanged until cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		src := &cancellingSource{scriptedSource{results: []scriptedResult{good}}, 3, cancel}
+		err := watch(ctx, src, req, time.Minute, 0, advancingClock{clock.NewFake()}, blog.NewMock())
+		test.AssertErrorIs(t, err, context.Canceled)
+		test.AssertEquals(t, src.lookups, 3)
+	})
+
+	t.Run("cancelled between lookups", func(t *testing.T) {
+		// Watching stops when ctx is done, without waiting out the interval.
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		src := &scriptedSource{results: []scriptedResult{good}}
+		err := watch(ctx, src, req, time.Hour, 0, clock.New(), blog.NewMock())
+		test.AssertErrorIs(t, err, context.DeadlineExceeded)
+		test.AssertEquals(t, src.lookups, 1)
+	})
+}
+
+// advancingClock is a fake clock whose After advances it by the given
+// duration and fires at once, so that watch never waits.
+type advancingClock struct {
+	clock.FakeClock
+}
+
+func (ac advancingClock) After(d time.Duration) <-chan time.Time {
+	ac.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- ac.Now()
+	return ch
+}
+
+// cancellingSource is a scriptedSource which cancels a context after a given
+// number of lookups.
+type cancellingSource struct {
+	scriptedSource
+	after  int
+	cancel context.CancelFunc
+}
+
+func (cs *cancellingSource) Response(ctx context.Context, req *ocsp.Request) (*responder.Response, error) {
+	resp, err := cs.scriptedSource.Response(ctx, req)
+	if cs.lookups == cs.after {
+		cs.cancel()
+	}
+	return resp, err
+}
@@ -0,0 +1,105 @@
+package responder
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// behaviorsKey is the context key under which the optional behaviours
+// affecting a request are collected.
+type behaviorsKey struct{}
+
+// Behaviors collects the names of the optional behaviours which affected the
+// handling of one request, for debugging. Sources add to it with
+// NoteBehavior. It also holds the name of the backend which served the
+// response, noted with NoteSource, and the functions which sources have asked,
+// with AfterRequest, to be called once the request has been answered.
+type Behaviors struct {
+	mu     sync.Mutex
+	names  []string
+	source string
+	after  []func(time.Duration)
+}
+
+// WithBehaviors returns a context in which NoteBehavior records into the
+// returned Behaviors.
+func WithBehaviors(ctx context.Context) (context.Context, *Behaviors) {
+	b := &Behaviors{}
+	return context.WithValue(ctx, behaviorsKey{}, b), b
+}
+
+// NoteBehavior records that the optional behaviour called name affected the
+// handling of the request whose context is ctx. Behaviours are named after the
+// config option which enables them, such as "RedisBreaker". If ctx doesn't
+// come from WithBehaviors, it does nothing.
+func NoteBehavior(ctx context.Context, name string) {
+	b, ok := ctx.Value(behaviorsKey{}).(*Behaviors)
+	if !ok {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !slices.Contains(b.names, name) {
+		b.names = append(b.names, name)
+	}
+}
+
+// NoteSource records that the response to the request whose context is ctx was
+// served by the backend called name, such as "redis" or "live". It's called by
+// Sources which produce a response themselves, rather than passing on one from
+// a wrapped Source. The last call wins, so that a Source which looks at its
+// wrapped Source's response but serves something else instead is credited
+// with it. If ctx doesn't come from WithBehaviors, it does nothing.
+func NoteSource(ctx context.Context, name string) {
+	b, ok := ctx.Value(behaviorsKey{}).(*Behaviors)
+	if !ok {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.source = name
+}
+
+// Source returns the backend last noted with NoteSource, or "" if none was.
+func (b *Behaviors) Source() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.source
+}
+
+// AfterRequest arranges for f to be called with the total time taken to handle
+// the request whose context is ctx, once it has been answered. This lets a
+// Source observe latency beyond its own lookup, such as that of writing the
+// response. If ctx doesn't come from WithBehaviors, f is never called.
+func AfterRequest(ctx context.Context, f func(took time.Duration)) {
+	b, ok := ctx.Value(behaviorsKey{}).(*Behaviors)
+	if !ok {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.after = append(b.after, f)
+}
+
+// finish calls the functions passed to AfterRequest, in the order they were
+// added, with the total time taken to handle the request.
+func (b *Behaviors) finish(took time.Duration) {
+	b.mu.Lock()
+	after := b.after
+	b.after = nil
+	b.mu.Unlock()
+	for _, f := range after {
+		f(took)
+	}
+}
+
+// List returns the behaviours noted so far, sorted.
+func (b *Behaviors) List() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	names := slices.Clone(b.names)
+	slices.Sort(names)
+	return names
+}
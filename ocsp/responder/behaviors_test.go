@@ -0,0 +1,102 @@
+package responder
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestNoteBehavior(t *testing.T) {
+	// Outside of a request, noting a behaviour does nothing.
+	NoteBehavior(context.Background(), "RedisBreaker")
+
+	ctx, behaviors := WithBehaviors(context.Background())
+	test.AssertEquals(t, len(behaviors.List()), 0)
+	NoteBehavior(ctx, "RedisBreaker")
+	NoteBehavior(ctx, "LiveSigningPeriod")
+	NoteBehavior(ctx, "RedisBreaker")
+	test.AssertDeepEquals(t, behaviors.List(), []string{"LiveSigningPeriod", "RedisBreaker"})
+}
+
+// notingSource notes the given behaviours before answering like testSource.
+type notingSource struct {
+	behaviors []string
+}
+
+func (ns notingSource) Response(ctx context.Context, req *ocsp.Request) (*Response, error) {
+	for _, name := range ns.behaviors {
+		NoteBehavior(ctx, name)
+	}
+	return testSource{}.Response(ctx, req)
+}
+
+func TestResponderLogsBehaviors(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+
+	for _, tc := range []struct {
+		noted []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"StagingSource", "BlocklistFile"}, `"behaviors":["BlocklistFile","StagingSource"]`},
+	} {
+		log := blog.NewMock()
+		responder := NewResponder(notingSource{tc.noted}, Options{Timeout: time.Second, LogSampleRate: 1}, metrics.NoopRegisterer, log)
+		responder.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", bytes.NewReader(reqBytes)))
+
+		logged := log.GetAllMatching("Received request")
+		test.AssertEquals(t, len(logged), 1)
+		if tc.want == "" {
+			test.AssertNotContains(t, logged[0], `"behaviors"`)
+		} else {
+			test.AssertContains(t, logged[0], tc.want)
+		}
+	}
+}
+
+// waitingSource answers like testSource after a delay, and asks to be told
+// how long the whole request took, and whether its response had been written
+// by then.
+type waitingSource struct {
+	delay   time.Duration
+	rw      *httptest.ResponseRecorder
+	took    time.Duration
+	written bool
+}
+
+func (ws *waitingSource) Response(ctx context.Context, req *ocsp.Request) (*Response, error) {
+	AfterRequest(ctx, func(took time.Duration) {
+		ws.took = took
+		ws.written = ws.rw.Body.Len() > 0
+	})
+	time.Sleep(ws.delay)
+	return testSource{}.Response(ctx, req)
+}
+
+func TestAfterRequest(t *testing.T) {
+	// Outside of a request, the function is never called.
+	AfterRequest(context.Background(), func(time.Duration) {
+		t.Error("called outside of a request")
+	})
+
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+
+	rw := httptest.NewRecorder()
+	source := &waitingSource{delay: 50 * time.Millisecond, rw: rw}
+	responder := NewResponder(source, Options{Timeout: time.Second, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+	responder.ServeHTTP(rw, httptest.NewRequest("POST", "/", bytes.NewReader(reqBytes)))
+	test.AssertEquals(t, rw.Code, 200)
+	test.Assert(t, source.written, "called before the response was written")
+	test.Assert(t, source.took >= source.delay, "total shorter than the lookup")
+}
@@ -0,0 +1,218 @@
+package responder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/issuance"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/revocation"
+	"github.com/letsencrypt/boulder/strictyaml"
+)
+
+const (
+	// blocklistForceUnknown causes a signed response with status unknown to
+	// be served for the serial.
+	blocklistForceUnknown = "force-unknown"
+	// blocklistForceRevoked causes a signed response with status revoked, and
+	// the entry's revocation reason, to be served for the serial.
+	blocklistForceRevoked = "force-revoked"
+
+	// blocklistResponseLifetime is the validity period of synthetic responses.
+	// It is kept short so that removing a serial from the blocklist takes
+	// effect quickly.
+	blocklistResponseLifetime = time.Hour
+)
+
+// BlocklistEntry is a single entry in the blocklist file.
+type BlocklistEntry struct {
+	Serial string `yaml:"serial"`
+	// Action is either "force-unknown" or "force-revoked".
+	Action string `yaml:"action"`
+	// Reason is the revocation reason code used for "force-revoked" entries.
+	// It must be one of the reasons an admin is allowed to revoke for.
+	Reason int `yaml:"reason"`
+}
+
+// localSigner is an issuer which can sign responses in-process, along with
+// its precomputed responder ID for matching against requests.
+type localSigner struct {
+	issuer *issuance.Issuer
+	id     responderID
+}
+
+// newLocalSigners computes the responder IDs of the given issuers.
+func newLocalSigners(issuers []*issuance.Issuer) ([]localSigner, error) {
+	signers := make([]localSigner, 0, len(issuers))
+	for _, issuer := range issuers {
+		rid, err := computeLightweightResponderID(issuer.Cert)
+		if err != nil {
+			return nil, fmt.Errorf("computing lightweight OCSP responder ID: %w", err)
+		}
+		signers = append(signers, localSigner{issuer, rid})
+	}
+	return signers, nil
+}
+
+// findLocalSigner returns the signer for the issuer named in req, or nil if
+// there is none.
+func findLocalSigner(signers []localSigner, req *ocsp.Request) *localSigner {
+	for i := range signers {
+		if bytes.Equal(req.IssuerNameHash, signers[i].id.nameHash) && bytes.Equal(req.IssuerKeyHash, signers[i].id.keyHash) {
+			return &signers[i]
+		}
+	}
+	return nil
+}
+
+// blocklistSource overrides the wrapped Source for a fixed set of serials,
+// serving a freshly signed unknown or revoked response for them no matter
+// what the wrapped Source would have said. It's intended for use during
+// incidents, and should be wrapped in a filterSource so that only requests
+// for our own issuers reach it.
+type blocklistSource struct {
+	wrapped   Source
+	entries   map[string]BlocklistEntry
+	signers   []localSigner
+	revokedAt time.Time
+	// producedAtOffset is added to the current time to give the producedAt
+	// of synthetic responses.
+	producedAtOffset time.Duration
+	counter          *prometheus.CounterVec
+	log              blog.Logger
+	clk              clock.Clock
+}
+
+// LoadBlocklist reads a YAML list of BlocklistEntry from the named file,
+// keyed by serial.
+func LoadBlocklist(filename string) (map[string]BlocklistEntry, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var list []BlocklistEntry
+	err = strictyaml.Unmarshal(contents, &list)
+	if err != nil {
+		return nil, fmt.Errorf("parsing blocklist %q: %w", filename, err)
+	}
+
+	entries := make(map[string]BlocklistEntry, len(list))
+	for _, entry := range list {
+		if !core.ValidSerial(entry.Serial) {
+			return nil, fmt.Errorf("invalid serial %q in blocklist", entry.Serial)
+		}
+		switch entry.Action {
+		case blocklistForceUnknown:
+		case blocklistForceRevoked:
+			if _, ok := revocation.AdminAllowedReasons[revocation.Reason(entry.Reason)]; !ok {
+				return nil, fmt.Errorf("invalid revocation reason %d for serial %q in blocklist", entry.Reason, entry.Serial)
+			}
+		default:
+			return nil, fmt.Errorf("unrecognized action %q for serial %q in blocklist", entry.Action, entry.Serial)
+		}
+		// Normalize serials so they match core.SerialToString.
+		serial, err := core.StringToSerial(entry.Serial)
+		if err != nil {
+			return nil, err
+		}
+		entries[core.SerialToString(serial)] = entry
+	}
+	return entries, nil
+}
+
+// NewBlocklistSource returns a blocklistSource which serves synthetic
+// responses, signed by the given issuers, for the serials in entries and
+// defers to the wrapped Source for everything else. The producedAt of each
+// synthetic response is offset from the current time by producedAtOffset.
+func NewBlocklistSource(entries map[string]BlocklistEntry, issuers []*issuance.Issuer, wrapped Source, producedAtOffset time.Duration, stats prometheus.Registerer, log blog.Logger, clk clock.Clock) (*blocklistSource, error) {
+	if len(entries) > 0 && len(issuers) == 0 {
+		return nil, errors.New("blocklist requires at least one signer")
+	}
+
+	signers, err := newLocalSigners(issuers)
+	if err != nil {
+		return nil, err
+	}
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocsp_blocklist_responses",
+		Help: "Count of synthetic OCSP responses served for blocklisted serials, by action and result",
+	}, []string{"action", "result"})
+	stats.MustRegister(counter)
+
+	return &blocklistSource{
+		wrapped:          wrapped,
+		entries:          entries,
+		signers:          signers,
+		revokedAt:        clk.Now().Truncate(time.Minute),
+		producedAtOffset: producedAtOffset,
+		counter:          counter,
+		log:              log,
+		clk:              clk,
+	}, nil
+}
+
+// Response implements the Source interface. If the requested serial is on
+// the blocklist it signs and returns a synthetic response without consulting
+// the wrapped Source.
+func (src *blocklistSource) Response(ctx context.Context, req *ocsp.Request) (*Response, error) {
+	serial := core.SerialToString(req.SerialNumber)
+	entry, ok := src.entries[serial]
+	if !ok {
+		return src.wrapped.Response(ctx, req)
+	}
+
+	src.log.AuditObject("Serving synthetic OCSP response for blocklisted serial", entry)
+
+	signer := findLocalSigner(src.signers, req)
+	if signer == nil {
+		src.counter.WithLabelValues(entry.Action, "no_signer").Inc()
+		return nil, fmt.Errorf("no signer for blocklisted serial %s", serial)
+	}
+
+	now := src.clk.Now().Truncate(time.Minute)
+	template := ocsp.Response{
+		Status:       ocsp.Unknown,
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(blocklistResponseLifetime),
+	}
+	if entry.Action == blocklistForceRevoked {
+		template.Status = ocsp.Revoked
+		template.RevokedAt = src.revokedAt
+		template.RevocationReason = entry.Reason
+	}
+
+	cert := signer.issuer.Cert.Certificate
+	der, err := ocsp.CreateResponse(cert, cert, template, signer.issuer.Signer)
+	if err != nil {
+		src.counter.WithLabelValues(entry.Action, "signing_error").Inc()
+		return nil, fmt.Errorf("signing response for blocklisted serial %s: %w", serial, err)
+	}
+	if src.producedAtOffset != 0 {
+		der, err = setProducedAt(der, src.clk.Now().Add(src.producedAtOffset).Truncate(time.Minute), signer.issuer.Signer)
+		if err != nil {
+			src.counter.WithLabelValues(entry.Action, "signing_error").Inc()
+			return nil, fmt.Errorf("signing response for blocklisted serial %s: %w", serial, err)
+		}
+	}
+	parsed, err := ocsp.ParseResponse(der, nil)
+	if err != nil {
+		src.counter.WithLabelValues(entry.Action, "signing_error").Inc()
+		return nil, err
+	}
+
+	src.counter.WithLabelValues(entry.Action, "success").Inc()
+	NoteBehavior(ctx, "BlocklistFile")
+	NoteSource(ctx, "blocklist")
+	return &Response{Response: parsed, Raw: der}, nil
+}
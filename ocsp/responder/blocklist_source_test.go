@@ -0,0 +1,147 @@
+package responder
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/issuance"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// makeTestIssuer returns a self-signed issuer capable of signing OCSP
+// responses.
+func makeTestIssuer(t *testing.T) *issuance.Issuer {
+	t.Helper()
+	return makeNamedTestIssuer(t, "blocklist test CA")
+}
+
+// makeNamedTestIssuer is like makeTestIssuer, but with the given common name.
+func makeNamedTestIssuer(t *testing.T, commonName string) *issuance.Issuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "generating key")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1337),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		Subject:               pkix.Name{CommonName: commonName},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	test.AssertNotError(t, err, "creating issuer cert")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "parsing issuer cert")
+	ic, err := issuance.NewCertificate(cert)
+	test.AssertNotError(t, err, "wrapping issuer cert")
+	return &issuance.Issuer{Cert: ic, Signer: key}
+}
+
+// requestFor builds an OCSP request for the given serial issued by issuer.
+func requestFor(t *testing.T, issuer *issuance.Issuer, serial int64) *ocsp.Request {
+	t.Helper()
+	rid, err := computeLightweightResponderID(issuer.Cert)
+	test.AssertNotError(t, err, "computing responder ID")
+	return &ocsp.Request{
+		HashAlgorithm:  crypto.SHA1,
+		IssuerNameHash: rid.nameHash,
+		IssuerKeyHash:  rid.keyHash,
+		SerialNumber:   big.NewInt(serial),
+	}
+}
+
+func TestLoadBlocklist(t *testing.T) {
+	entries, err := LoadBlocklist("./testdata/blocklist.yaml")
+	test.AssertNotError(t, err, "loading blocklist")
+	test.AssertEquals(t, len(entries), 2)
+
+	_, err = LoadBlocklist("./testdata/nonexistent.yaml")
+	test.AssertError(t, err, "loaded nonexistent blocklist")
+
+	for name, contents := range map[string]string{
+		"bad serial": "- serial: \"zz\"\n  action: force-unknown\n",
+		"bad action": "- serial: \"000000000000000000000000000000000001\"\n  action: force-good\n",
+		"bad reason": "- serial: \"000000000000000000000000000000000001\"\n  action: force-revoked\n  reason: 7\n",
+	} {
+		filename := path.Join(t.TempDir(), "blocklist.yaml")
+		err = os.WriteFile(filename, []byte(contents), 0600)
+		test.AssertNotError(t, err, "writing blocklist")
+		_, err = LoadBlocklist(filename)
+		test.AssertError(t, err, name)
+	}
+}
+
+func TestBlocklistSource(t *testing.T) {
+	entries, err := LoadBlocklist("./testdata/blocklist.yaml")
+	test.AssertNotError(t, err, "loading blocklist")
+
+	_, err = NewBlocklistSource(entries, nil, nil, 0, metrics.NoopRegisterer, blog.NewMock(), clock.NewFake())
+	test.AssertError(t, err, "created blocklist source without a signer")
+
+	issuer := makeTestIssuer(t)
+	wrappedResp := &Response{Response: &ocsp.Response{Status: ocsp.Good}}
+	log := blog.NewMock()
+	src, err := NewBlocklistSource(entries, []*issuance.Issuer{issuer}, &echoSource{wrappedResp}, 0, metrics.NoopRegisterer, log, clock.NewFake())
+	test.AssertNotError(t, err, "creating blocklist source")
+
+	// force-unknown
+	resp, err := src.Response(context.Background(), requestFor(t, issuer, 1))
+	test.AssertNotError(t, err, "getting force-unknown response")
+	test.AssertEquals(t, resp.Status, ocsp.Unknown)
+	_, err = ocsp.ParseResponse(resp.Raw, issuer.Cert.Certificate)
+	test.AssertNotError(t, err, "verifying force-unknown response")
+	test.AssertEquals(t, issuance.ResponderNameID(resp.Response), issuer.NameID())
+
+	// force-revoked
+	resp, err = src.Response(context.Background(), requestFor(t, issuer, 2))
+	test.AssertNotError(t, err, "getting force-revoked response")
+	test.AssertEquals(t, resp.Status, ocsp.Revoked)
+	test.AssertEquals(t, resp.RevocationReason, ocsp.KeyCompromise)
+	_, err = ocsp.ParseResponse(resp.Raw, issuer.Cert.Certificate)
+	test.AssertNotError(t, err, "verifying force-revoked response")
+
+	test.AssertEquals(t, len(log.GetAllMatching("blocklisted serial")), 2)
+
+	// Serials not on the blocklist are passed through.
+	resp, err = src.Response(context.Background(), requestFor(t, issuer, 3))
+	test.AssertNotError(t, err, "getting wrapped response")
+	test.AssertEquals(t, resp, wrappedResp)
+	test.AssertEquals(t, len(log.GetAllMatching("blocklisted serial")), 2)
+}
+
+func TestBlocklistSourceProducedAtOffset(t *testing.T) {
+	entries, err := LoadBlocklist("./testdata/blocklist.yaml")
+	test.AssertNotError(t, err, "loading blocklist")
+	issuer := makeTestIssuer(t)
+	clk := clock.NewFake()
+	clk.Set(time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC))
+
+	for _, offset := range []time.Duration{-2 * time.Hour, 90 * time.Minute} {
+		src, err := NewBlocklistSource(entries, []*issuance.Issuer{issuer}, nil, offset, metrics.NoopRegisterer, blog.NewMock(), clk)
+		test.AssertNotError(t, err, "creating blocklist source")
+
+		resp, err := src.Response(context.Background(), requestFor(t, issuer, 2))
+		test.AssertNotError(t, err, "getting blocklisted response")
+		test.AssertEquals(t, resp.ProducedAt, clk.Now().Add(offset).Truncate(time.Minute))
+
+		parsed, err := ocsp.ParseResponse(resp.Raw, issuer.Cert.Certificate)
+		test.AssertNotError(t, err, "verifying re-signed response")
+		test.AssertEquals(t, parsed.ProducedAt, resp.ProducedAt)
+		test.AssertEquals(t, parsed.Status, ocsp.Revoked)
+		test.AssertEquals(t, parsed.RevocationReason, ocsp.KeyCompromise)
+		test.AssertEquals(t, parsed.ThisUpdate, clk.Now().Truncate(time.Minute))
+	}
+}
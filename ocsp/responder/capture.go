@@ -0,0 +1,143 @@
+package responder
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/jmhodges/clock"
+)
+
+// CaptureConfig configures capturing of complete request and response bytes
+// for requests whose serial matches a pattern, for debugging a particular
+// relying party's problems. The zero value disables capturing.
+type CaptureConfig struct {
+	// SerialPattern is a regular expression matched against the hex-encoded
+	// serial of each request.
+	SerialPattern string
+
+	// File is the path to which captures are appended, one JSON object per
+	// line. It's kept separate from the regular logs because captures may be
+	// large and are only of interest while debugging.
+	File string `validate:"required_with=SerialPattern"`
+
+	// MaxBytes caps the size of each captured request and response; longer
+	// ones are truncated. This defaults to 4096.
+	MaxBytes int `validate:"min=0"`
+}
+
+// captureRecord is a single capture, as written to the capture file.
+type captureRecord struct {
+	Time      time.Time `json:"time"`
+	Serial    string    `json:"serial"`
+	Status    int       `json:"status"`
+	Request   string    `json:"request"`
+	Response  string    `json:"response"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// Capturer writes the complete request and response for requests whose serial
+// matches its pattern. A nil *Capturer captures nothing.
+type Capturer struct {
+	pattern  *regexp.Regexp
+	maxBytes int
+	clk      clock.Clock
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewCapturer returns a Capturer as configured by conf, or nil if conf has no
+// SerialPattern.
+func NewCapturer(conf CaptureConfig, clk clock.Clock) (*Capturer, error) {
+	if conf.SerialPattern == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(conf.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening capture file: %w", err)
+	}
+	return newCapturer(conf.SerialPattern, conf.MaxBytes, f, clk)
+}
+
+func newCapturer(pattern string, maxBytes int, out io.Writer, clk clock.Clock) (*Capturer, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("compiling capture serial pattern: %w", err)
+	}
+	if maxBytes == 0 {
+		maxBytes = 4096
+	}
+	return &Capturer{
+		pattern:  re,
+		maxBytes: maxBytes,
+		clk:      clk,
+		out:      out,
+	}, nil
+}
+
+// matches returns true if requests for serial should be captured.
+func (c *Capturer) matches(serial string) bool {
+	return c != nil && c.pattern.MatchString(serial)
+}
+
+// write records a single request/response pair.
+func (c *Capturer) write(serial string, status int, request, response []byte) error {
+	record := captureRecord{
+		Time:   c.clk.Now(),
+		Serial: serial,
+		Status: status,
+	}
+	if len(request) > c.maxBytes {
+		request = request[:c.maxBytes]
+		record.Truncated = true
+	}
+	if len(response) > c.maxBytes {
+		response = response[:c.maxBytes]
+		record.Truncated = true
+	}
+	record.Request = base64.StdEncoding.EncodeToString(request)
+	record.Response = base64.StdEncoding.EncodeToString(response)
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.out.Write(append(line, '\n'))
+	return err
+}
+
+// captureWriter wraps an http.ResponseWriter, keeping a copy of the status
+// and up to max bytes of the body written through it.
+type captureWriter struct {
+	http.ResponseWriter
+	max    int
+	status int
+	body   []byte
+}
+
+func (cw *captureWriter) WriteHeader(code int) {
+	if cw.status == 0 {
+		cw.status = code
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	// Keep one byte more than the cap, so that truncation can be detected.
+	if room := cw.max + 1 - len(cw.body); room > 0 {
+		cw.body = append(cw.body, b[:min(room, len(b))]...)
+	}
+	return cw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,95 @@
+package responder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/jmhodges/clock"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// readCaptures parses every capture record written to buf.
+func readCaptures(t *testing.T, buf *bytes.Buffer) []captureRecord {
+	t.Helper()
+	var records []captureRecord
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var record captureRecord
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		test.AssertNotError(t, err, "parsing capture record")
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestCapture(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+	serial := core.SerialToString(req.SerialNumber)
+
+	respBytes, err := os.ReadFile("./testdata/ocsp.resp")
+	test.AssertNotError(t, err, "failed to read OCSP response")
+	resp, err := ocsp.ParseResponse(respBytes, nil)
+	test.AssertNotError(t, err, "failed to parse OCSP response")
+
+	src, err := NewMemorySource(map[string]*Response{
+		req.SerialNumber.String(): {Response: resp, Raw: respBytes},
+	}, blog.NewMock())
+	test.AssertNotError(t, err, "failed to create inMemorySource")
+
+	serve := func(capture *Capturer) {
+		rs := NewResponder(src, Options{Capture: capture, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+		r, err := http.NewRequest("POST", "/", bytes.NewReader(reqBytes))
+		test.AssertNotError(t, err, "creating request")
+		rs.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	// A pattern matching the serial captures the full exchange.
+	var buf bytes.Buffer
+	capture, err := newCapturer("^"+serial[:6], 0, &buf, clock.NewFake())
+	test.AssertNotError(t, err, "creating capturer")
+	serve(capture)
+	records := readCaptures(t, &buf)
+	test.AssertEquals(t, len(records), 1)
+	test.AssertEquals(t, records[0].Serial, serial)
+	test.AssertEquals(t, records[0].Status, http.StatusOK)
+	test.AssertEquals(t, records[0].Request, base64.StdEncoding.EncodeToString(reqBytes))
+	test.AssertEquals(t, records[0].Response, base64.StdEncoding.EncodeToString(respBytes))
+	test.Assert(t, !records[0].Truncated, "capture should not be truncated")
+
+	// A pattern not matching the serial captures nothing.
+	buf.Reset()
+	capture, err = newCapturer("^ffff", 0, &buf, clock.NewFake())
+	test.AssertNotError(t, err, "creating capturer")
+	serve(capture)
+	test.AssertEquals(t, buf.Len(), 0)
+
+	// Captures are truncated to the size cap.
+	capture, err = newCapturer(serial, 10, &buf, clock.NewFake())
+	test.AssertNotError(t, err, "creating capturer")
+	serve(capture)
+	records = readCaptures(t, &buf)
+	test.AssertEquals(t, len(records), 1)
+	test.Assert(t, records[0].Truncated, "capture should be truncated")
+	test.AssertEquals(t, records[0].Request, base64.StdEncoding.EncodeToString(reqBytes[:10]))
+	test.AssertEquals(t, records[0].Response, base64.StdEncoding.EncodeToString(respBytes[:10]))
+
+	// No capturer means no capture, and doesn't crash.
+	serve(nil)
+
+	_, err = newCapturer("(", 0, &buf, clock.NewFake())
+	test.AssertError(t, err, "accepted invalid pattern")
+}
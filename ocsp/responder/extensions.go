@@ -0,0 +1,129 @@
+package responder
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RequestExtensionConfig configures counting of the extensions present in OCSP
+// requests, to show which of them clients actually send. The zero value
+// disables counting.
+type RequestExtensionConfig struct {
+	// Record enables counting.
+	Record bool
+
+	// MaxOIDs is the number of distinct extension OIDs counted individually.
+	// Extensions with other OIDs are counted as "other", so that clients
+	// sending arbitrary OIDs can't blow up the metric's cardinality. This
+	// defaults to 20.
+	MaxOIDs int `validate:"min=0"`
+}
+
+// singleRequest mirrors a single entry of an OCSP request's requestList, as
+// far as is needed to reach its extensions.
+type singleRequest struct {
+	ReqCert    asn1.RawValue
+	Extensions []pkix.Extension `asn1:"explicit,tag:0,optional"`
+}
+
+// RequestExtensions counts OCSP requests by the OIDs of the extensions they
+// carry, both request extensions, such as the nonce, and single request
+// extensions, such as the service locator. A nil *RequestExtensions counts
+// nothing.
+type RequestExtensions struct {
+	maxOIDs int
+	counter *prometheus.CounterVec
+
+	mu   sync.Mutex
+	oids map[string]bool
+}
+
+// NewRequestExtensions returns a RequestExtensions as configured by conf, or
+// nil if conf doesn't enable recording.
+func NewRequestExtensions(conf RequestExtensionConfig, stats prometheus.Registerer) *RequestExtensions {
+	if !conf.Record {
+		return nil
+	}
+	maxOIDs := conf.MaxOIDs
+	if maxOIDs == 0 {
+		maxOIDs = 20
+	}
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocsp_request_extensions",
+		Help: "Count of OCSP requests carrying each extension, by OID, or other once the maximum number of distinct OIDs is reached",
+	}, []string{"oid"})
+	stats.MustRegister(counter)
+	return &RequestExtensions{
+		maxOIDs: maxOIDs,
+		counter: counter,
+		oids:    make(map[string]bool),
+	}
+}
+
+// observe counts the extensions in a DER-encoded OCSP request. Each OID is
+// counted at most once per request, however often it appears. Requests which
+// can't be parsed are ignored, as ocsp.ParseRequest rejects them anyway.
+func (re *RequestExtensions) observe(der []byte) {
+	if re == nil {
+		return
+	}
+	oids, err := requestExtensionOIDs(der)
+	if err != nil {
+		return
+	}
+	for _, oid := range oids {
+		re.counter.WithLabelValues(re.label(oid)).Inc()
+	}
+}
+
+// label returns the label to count oid under: the OID itself, unless the
+// maximum number of distinct OIDs has already been reached without it.
+func (re *RequestExtensions) label(oid string) string {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	if !re.oids[oid] {
+		if len(re.oids) >= re.maxOIDs {
+			return "other"
+		}
+		re.oids[oid] = true
+	}
+	return oid
+}
+
+// requestExtensionOIDs returns the distinct OIDs of the request and single
+// request extensions in a DER-encoded OCSP request, in the order in which
+// they first appear.
+func requestExtensionOIDs(der []byte) ([]string, error) {
+	var req ocspRequestExtensions
+	_, err := asn1.Unmarshal(der, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	var oids []string
+	seen := make(map[string]bool)
+	add := func(exts []pkix.Extension) {
+		for _, ext := range exts {
+			oid := ext.Id.String()
+			if !seen[oid] {
+				seen[oid] = true
+				oids = append(oids, oid)
+			}
+		}
+	}
+	add(req.TBSRequest.Extensions)
+
+	rest := req.TBSRequest.RequestList.Bytes
+	for len(rest) > 0 {
+		var single singleRequest
+		rest, err = asn1.Unmarshal(rest, &single)
+		if err != nil {
+			return nil, err
+		}
+		add(single.Extensions)
+	}
+	return oids, nil
+}
@@ -0,0 +1,96 @@
+package responder
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/test"
+)
+
+var (
+	oidNonce          = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+	oidServiceLocator = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 7}
+)
+
+// requestWithExtensions returns testdata/ocsp.req with empty extensions of
+// the given OIDs added to the request, and to its single request.
+func requestWithExtensions(t *testing.T, requestOIDs, singleOIDs []asn1.ObjectIdentifier) []byte {
+	t.Helper()
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+
+	var req ocspRequestExtensions
+	_, err = asn1.Unmarshal(reqBytes, &req)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+	for _, oid := range requestOIDs {
+		req.TBSRequest.Extensions = append(req.TBSRequest.Extensions, pkix.Extension{Id: oid, Value: []byte{0x05, 0x00}})
+	}
+
+	var single singleRequest
+	_, err = asn1.Unmarshal(req.TBSRequest.RequestList.Bytes, &single)
+	test.AssertNotError(t, err, "failed to parse single request")
+	for _, oid := range singleOIDs {
+		single.Extensions = append(single.Extensions, pkix.Extension{Id: oid, Value: []byte{0x05, 0x00}})
+	}
+	singleDER, err := asn1.Marshal(single)
+	test.AssertNotError(t, err, "failed to marshal single request")
+	req.TBSRequest.RequestList = asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: singleDER}
+
+	der, err := asn1.Marshal(req)
+	test.AssertNotError(t, err, "failed to marshal OCSP request")
+	return der
+}
+
+func TestRequestExtensionOIDs(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	oids, err := requestExtensionOIDs(reqBytes)
+	test.AssertNotError(t, err, "getting OIDs of request without extensions")
+	test.AssertEquals(t, len(oids), 0)
+
+	der := requestWithExtensions(t,
+		[]asn1.ObjectIdentifier{oidNonce, oidPreferredSignatureAlgorithms, oidNonce},
+		[]asn1.ObjectIdentifier{oidServiceLocator, oidNonce})
+	oids, err = requestExtensionOIDs(der)
+	test.AssertNotError(t, err, "getting OIDs of request with extensions")
+	test.AssertDeepEquals(t, oids, []string{oidNonce.String(), oidPreferredSignatureAlgorithms.String(), oidServiceLocator.String()})
+
+	_, err = requestExtensionOIDs([]byte{0x30, 0x03, 0x01})
+	test.AssertError(t, err, "got OIDs of a malformed request")
+}
+
+func TestRequestExtensions(t *testing.T) {
+	test.AssertEquals(t, NewRequestExtensions(RequestExtensionConfig{}, metrics.NoopRegisterer), (*RequestExtensions)(nil))
+
+	extensions := NewRequestExtensions(RequestExtensionConfig{Record: true, MaxOIDs: 2}, metrics.NoopRegisterer)
+	responder := NewResponder(testSource{}, Options{Timeout: time.Second, Extensions: extensions, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+	serve := func(der []byte) {
+		t.Helper()
+		rw := httptest.NewRecorder()
+		responder.ServeHTTP(rw, httptest.NewRequest("POST", "/", bytes.NewReader(der)))
+		test.AssertEquals(t, rw.Code, http.StatusOK)
+	}
+
+	serve(requestWithExtensions(t, []asn1.ObjectIdentifier{oidNonce}, []asn1.ObjectIdentifier{oidServiceLocator}))
+	serve(requestWithExtensions(t, []asn1.ObjectIdentifier{oidNonce}, nil))
+	serve(requestWithExtensions(t, nil, nil))
+	test.AssertMetricWithLabelsEquals(t, extensions.counter, prometheus.Labels{"oid": oidNonce.String()}, 2)
+	test.AssertMetricWithLabelsEquals(t, extensions.counter, prometheus.Labels{"oid": oidServiceLocator.String()}, 1)
+
+	// Beyond the maximum number of distinct OIDs, new ones are counted as
+	// other, while those already seen are still counted individually.
+	serve(requestWithExtensions(t, []asn1.ObjectIdentifier{oidPreferredSignatureAlgorithms, oidNonce}, nil))
+	test.AssertMetricWithLabelsEquals(t, extensions.counter, prometheus.Labels{"oid": oidPreferredSignatureAlgorithms.String()}, 0)
+	test.AssertMetricWithLabelsEquals(t, extensions.counter, prometheus.Labels{"oid": "other"}, 1)
+	test.AssertMetricWithLabelsEquals(t, extensions.counter, prometheus.Labels{"oid": oidNonce.String()}, 3)
+}
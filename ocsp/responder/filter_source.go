@@ -5,12 +5,16 @@ import (
 	"context"
 	"crypto"
 	"crypto/sha1"
+	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math/big"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/jmhodges/clock"
 	"github.com/prometheus/client_golang/prometheus"
@@ -56,31 +60,284 @@ func computeLightweightResponderID(ic *issuance.Certificate) (responderID, error
 	return responderID{nameHash[:], keyHash[:], ic.Subject.CommonName}, nil
 }
 
+// filterIssuer is an issuer whose requests the filterSource will answer. Its
+// hashes, NameID and certificate are kept together in one entry, rather than in
+// parallel maps, so that they can't fall out of step: replacing the issuers
+// slice as a whole replaces every mapping at once.
+type filterIssuer struct {
+	responderID
+	nameID issuance.NameID
+	cert   *issuance.Certificate
+}
+
+// The following mirror the structures in golang.org/x/crypto/ocsp, which
+// doesn't expose the CertID of a parsed response. Only the fields needed to
+// reach the CertID are included.
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspSingleResponse struct {
+	CertID ocspCertID
+}
+
+type ocspResponseData struct {
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []ocspSingleResponse
+}
+
+// oidSHA1 is the algorithm identifier for SHA-1 used in OCSP CertIDs.
+var oidSHA1 = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+
+// responseIssuerKeyHash returns the SHA-1 issuerKeyHash from the CertID of
+// the response's single response.
+func responseIssuerKeyHash(resp *Response) ([]byte, error) {
+	var data ocspResponseData
+	_, err := asn1.Unmarshal(resp.TBSResponseData, &data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing response data: %w", err)
+	}
+	if len(data.Responses) != 1 {
+		return nil, fmt.Errorf("expected 1 single response, got %d", len(data.Responses))
+	}
+	certID := data.Responses[0].CertID
+	if !certID.HashAlgorithm.Algorithm.Equal(oidSHA1) {
+		return nil, fmt.Errorf("unsupported CertID hash algorithm %s", certID.HashAlgorithm.Algorithm)
+	}
+	return certID.IssuerKeyHash, nil
+}
+
+// The following errors describe why a filterSource declined to handle a
+// request. They wrap ErrNotFound, so that such requests are answered as if we
+// had no response for them.
+var (
+	// ErrWrongHashAlgorithm indicates that the request's issuer name and key
+	// were hashed with an algorithm we don't support.
+	ErrWrongHashAlgorithm = fmt.Errorf("unsupported issuer key/name hash algorithm: %w", ErrNotFound)
+
+	// ErrWrongPrefix indicates that the requested serial doesn't have any of
+	// the configured prefixes.
+	ErrWrongPrefix = fmt.Errorf("unrecognized serial prefix: %w", ErrNotFound)
+
+	// ErrWrongIssuer indicates that the request's issuer hashes don't match
+	// any of the configured issuers.
+	ErrWrongIssuer = fmt.Errorf("unrecognized issuer: %w", ErrNotFound)
+)
+
+// ErrInvalidSerial indicates that the requested serial is zero or negative.
+// Certificate serials are positive, so no such serial can be ours. It wraps
+// ErrMalformed rather than ErrNotFound, since the request itself is bad.
+var ErrInvalidSerial = fmt.Errorf("serial is zero or negative: %w", ErrMalformed)
+
+// RejectedRequestError is returned by the filterSource for a request it
+// declines to handle, so that the reason can be counted where the error is
+// handled. It wraps the error describing the rejection, such as
+// ErrWrongIssuer.
+type RejectedRequestError struct {
+	// Reason is a short, fixed description of why the request was rejected,
+	// suitable for use as a metric label.
+	Reason string
+	Err    error
+}
+
+func (e *RejectedRequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RejectedRequestError) Unwrap() error {
+	return e.Err
+}
+
+// Reasons for which the filterSource rejects requests, as found in
+// RejectedRequestError.
+const (
+	rejectedInvalidSerial      = "invalid_serial"
+	rejectedWrongHashAlgorithm = "wrong_hash_algorithm"
+	rejectedWrongPrefix        = "wrong_prefix"
+	rejectedWrongIssuer        = "wrong_issuer"
+)
+
+// ErrResponseIssuerMismatch indicates that the wrapped Source returned a
+// response from a different issuer than the one requested.
+var ErrResponseIssuerMismatch = errors.New("response issuer does not match requested issuer")
+
+// errSignatureInvalid indicates that a response's signature did not verify
+// against the certificate of the issuer it claims to be from.
+var errSignatureInvalid = errors.New("response signature is invalid")
+
+// errNextUpdateMissing indicates that a response has no nextUpdate. RFC 6960
+// allows this, but our policy requires one, so its absence indicates a bug in
+// the signing pipeline.
+var errNextUpdateMissing = errors.New("response has no nextUpdate")
+
+// errValidityTooShort and errValidityTooLong indicate that a response's
+// validity interval, nextUpdate minus thisUpdate, is outside the configured
+// bounds. Like errNextUpdateMissing, they indicate a bug in the signing
+// pipeline.
+var (
+	errValidityTooShort = errors.New("response validity interval is too short")
+	errValidityTooLong  = errors.New("response validity interval is too long")
+)
+
+// errResponseTooOld indicates that a response's thisUpdate is further in the
+// past than the configured maximum response age. It wraps ErrNotFound so that
+// such responses are treated as if we had none at all.
+var errResponseTooOld = fmt.Errorf("response exceeds maximum age: %w", ErrNotFound)
+
+// errThisUpdateInFuture indicates that a response's thisUpdate is further in
+// the future than the configured skew tolerance allows.
+var errThisUpdateInFuture = errors.New("response thisUpdate is in the future")
+
+// deprecatedSignatureAlgorithms are the signature algorithms whose hashes are
+// no longer considered secure, and which responses shouldn't be signed with.
+var deprecatedSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+	x509.MD2WithRSA:    true,
+	x509.MD5WithRSA:    true,
+	x509.SHA1WithRSA:   true,
+	x509.DSAWithSHA1:   true,
+	x509.ECDSAWithSHA1: true,
+}
+
 type filterSource struct {
-	wrapped        Source
-	hashAlgorithm  crypto.Hash
-	issuers        map[issuance.NameID]responderID
-	serialPrefixes []string
-	counter        *prometheus.CounterVec
-	log            blog.Logger
-	clk            clock.Clock
-}
-
-// NewFilterSource returns a filterSource which performs various checks on the
-// OCSP requests sent to the wrapped Source, and the OCSP responses returned
-// by it.
-func NewFilterSource(issuerCerts []*issuance.Certificate, serialPrefixes []string, wrapped Source, stats prometheus.Registerer, log blog.Logger, clk clock.Clock) (*filterSource, error) {
-	if len(issuerCerts) < 1 {
-		return nil, errors.New("filter must include at least 1 issuer cert")
-	}
-
-	issuersByNameId := make(map[issuance.NameID]responderID)
-	for _, issuerCert := range issuerCerts {
-		rid, err := computeLightweightResponderID(issuerCert)
-		if err != nil {
-			return nil, fmt.Errorf("computing lightweight OCSP responder ID: %w", err)
+	wrapped       Source
+	hashAlgorithm crypto.Hash
+	// issuers is replaced, never modified, by ReloadIssuers, so callers may
+	// keep using the slice returned by currentIssuers.
+	issuersMu        sync.RWMutex
+	issuers          []filterIssuer
+	allowDuplicates  bool
+	reloadPolicy     ReloadPolicy
+	emptyReloads     prometheus.Counter
+	serialPrefixes   []string
+	verifySignatures bool
+	maxResponseAge   time.Duration
+	// reportDeprecated causes served responses signed with one of
+	// deprecatedSignatureAlgorithms to be counted by deprecatedSigs, and
+	// logged the first time for each issuer and algorithm.
+	reportDeprecated bool
+	deprecatedSigs   *prometheus.CounterVec
+	deprecatedLogged sync.Map
+	// requireNextUpdate causes responses without a nextUpdate to be refused
+	// with errNextUpdateMissing. Otherwise they're served.
+	requireNextUpdate bool
+	minValidity       time.Duration
+	maxValidity       time.Duration
+	// thisUpdateSkew is how far in the future a response's thisUpdate may
+	// be. If zero, thisUpdate isn't checked against the current time.
+	thisUpdateSkew time.Duration
+	// prefixLatency observes, per matched serial prefix, how long the
+	// Responder takes to handle requests in total.
+	prefixLatency *prometheus.HistogramVec
+	// remainingValidity observes, per issuer, how long the responses we
+	// serve have left before their nextUpdate.
+	remainingValidity *prometheus.HistogramVec
+	counter           *prometheus.CounterVec
+	log               blog.Logger
+	clk               clock.Clock
+}
+
+// IssuerCertificates returns the certificates of the issuers for which the
+// filter answers requests, in the order they were resolved.
+func (src *filterSource) IssuerCertificates() []*issuance.Certificate {
+	return issuerCertificates(src.currentIssuers())
+}
+
+// issuerCertificates returns the certificates of issuers, in order.
+func issuerCertificates(issuers []filterIssuer) []*issuance.Certificate {
+	certs := make([]*issuance.Certificate, 0, len(issuers))
+	for _, issuer := range issuers {
+		certs = append(certs, issuer.cert)
+	}
+	return certs
+}
+
+// IssuerCommonName implements IssuerNamer. An issuer is only known if both of
+// the request's issuer hashes match it, just as checkRequest requires.
+func (src *filterSource) IssuerCommonName(req *ocsp.Request) string {
+	if req.HashAlgorithm != src.hashAlgorithm {
+		return ""
+	}
+	for _, iss := range src.currentIssuers() {
+		if bytes.Equal(req.IssuerNameHash, iss.nameHash) && bytes.Equal(req.IssuerKeyHash, iss.keyHash) {
+			return iss.commonName
 		}
-		issuersByNameId[issuerCert.NameID()] = rid
+	}
+	return ""
+}
+
+// HashAlgorithm returns the hash algorithm which requests' CertIDs must use.
+func (src *filterSource) HashAlgorithm() crypto.Hash {
+	return src.hashAlgorithm
+}
+
+// ReloadPolicy is what a filterSource does with its issuers when reloading
+// them fails.
+type ReloadPolicy string
+
+const (
+	// ReloadFailOpen keeps serving for the previously loaded issuers, and is
+	// the default.
+	ReloadFailOpen ReloadPolicy = "fail-open"
+	// ReloadFailClosed drops the previously loaded issuers, so that every
+	// request is refused until a reload succeeds.
+	ReloadFailClosed ReloadPolicy = "fail-closed"
+)
+
+// FilterConfig configures the checks performed by a filterSource. The zero
+// value of each field leaves the corresponding check disabled.
+type FilterConfig struct {
+	// AllowDuplicates accepts issuer certificates with the same subject and
+	// key, such as cross-signed variants of one intermediate, which are
+	// indistinguishable in a request. A response is then accepted if it
+	// matches any of them. Otherwise, such issuers are an error.
+	AllowDuplicates bool
+
+	// ReloadPolicy is what ReloadIssuers does when it fails. If empty, it's
+	// ReloadFailOpen.
+	ReloadPolicy ReloadPolicy
+
+	// SerialPrefixes, if non-empty, are the hex prefixes of which a
+	// requested serial must have one.
+	SerialPrefixes []string
+
+	// VerifySignatures checks each response's signature against its issuer's
+	// certificate before it is served.
+	VerifySignatures bool
+
+	// ReportDeprecatedSignatures counts and logs served responses signed with
+	// a deprecated algorithm, such as SHA-1.
+	ReportDeprecatedSignatures bool
+
+	// MaxResponseAge refuses responses whose thisUpdate is older than that,
+	// even if their nextUpdate is still in the future.
+	MaxResponseAge time.Duration
+
+	// RequireNextUpdate refuses responses without a nextUpdate, counting them
+	// separately. Otherwise such responses are served, since they never expire.
+	RequireNextUpdate bool
+
+	// MinValidity and MaxValidity refuse responses whose validity interval is
+	// outside those bounds.
+	MinValidity time.Duration
+	MaxValidity time.Duration
+
+	// ThisUpdateSkewTolerance refuses responses whose thisUpdate is further
+	// than that in the future.
+	ThisUpdateSkewTolerance time.Duration
+}
+
+// NewFilterSource returns a filterSource which performs various checks, as
+// configured by conf, on the OCSP requests sent to the wrapped Source, and
+// the OCSP responses returned by it, for the issuers provided by resolver.
+func NewFilterSource(resolver IssuerResolver, conf FilterConfig, wrapped Source, stats prometheus.Registerer, log blog.Logger, clk clock.Clock) (*filterSource, error) {
+	issuers, err := resolveFilterIssuers(resolver, conf.AllowDuplicates)
+	if err != nil {
+		return nil, err
 	}
 
 	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
@@ -89,29 +346,184 @@ func NewFilterSource(issuerCerts []*issuance.Certificate, serialPrefixes []strin
 	}, []string{"result", "issuer"})
 	stats.MustRegister(counter)
 
+	// Set up 12-hour-wide buckets, measured in seconds, covering ten days.
+	buckets := make([]float64, 21)
+	for i := range buckets {
+		buckets[i] = 43200 * float64(i)
+	}
+	remainingValidity := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ocsp_response_remaining_validity_seconds",
+		Help:    "How long the OCSP responses we serve have left until their nextUpdate, by issuer",
+		Buckets: buckets,
+	}, []string{"issuer"})
+	stats.MustRegister(remainingValidity)
+
+	// Serial prefixes distinguish issuance profiles, whose responses may be
+	// kept in different storage, so latency is broken down by prefix. Only
+	// configured prefixes are used as labels, or "none" if there are none.
+	// The time observed is the Responder's total for the request, not just
+	// that of the lookup.
+	prefixLatency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ocsp_request_latency_by_prefix_seconds",
+		Help:    "Total time taken to handle requests which pass the filter, by matched serial prefix",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"prefix"})
+	stats.MustRegister(prefixLatency)
+
+	deprecatedSignatures := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocsp_deprecated_signature_responses",
+		Help: "Count of responses served which were signed with a deprecated signature algorithm, by issuer and algorithm",
+	}, []string{"issuer", "algorithm"})
+	stats.MustRegister(deprecatedSignatures)
+
+	reloadPolicy := conf.ReloadPolicy
+	switch reloadPolicy {
+	case "":
+		reloadPolicy = ReloadFailOpen
+	case ReloadFailOpen, ReloadFailClosed:
+	default:
+		return nil, fmt.Errorf("unknown issuer reload policy %q", reloadPolicy)
+	}
+
+	emptyReloads := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ocsp_filter_empty_issuer_reloads",
+		Help: "Count of issuer reloads which found no issuers",
+	})
+	stats.MustRegister(emptyReloads)
+
 	return &filterSource{
-		wrapped:        wrapped,
-		hashAlgorithm:  crypto.SHA1,
-		issuers:        issuersByNameId,
-		serialPrefixes: serialPrefixes,
-		counter:        counter,
-		log:            log,
-		clk:            clk,
+		wrapped:           wrapped,
+		hashAlgorithm:     crypto.SHA1,
+		issuers:           issuers,
+		allowDuplicates:   conf.AllowDuplicates,
+		reloadPolicy:      reloadPolicy,
+		emptyReloads:      emptyReloads,
+		serialPrefixes:    conf.SerialPrefixes,
+		verifySignatures:  conf.VerifySignatures,
+		reportDeprecated:  conf.ReportDeprecatedSignatures,
+		deprecatedSigs:    deprecatedSignatures,
+		maxResponseAge:    conf.MaxResponseAge,
+		requireNextUpdate: conf.RequireNextUpdate,
+		minValidity:       conf.MinValidity,
+		maxValidity:       conf.MaxValidity,
+		thisUpdateSkew:    conf.ThisUpdateSkewTolerance,
+		remainingValidity: remainingValidity,
+		prefixLatency:     prefixLatency,
+		counter:           counter,
+		log:               log,
+		clk:               clk,
 	}, nil
 }
 
+// resolveFilterIssuers resolves the issuers provided by resolver. It returns
+// an error wrapping errNoIssuers if there are none.
+func resolveFilterIssuers(resolver IssuerResolver, allowDuplicates bool) ([]filterIssuer, error) {
+	resolved, err := resolver.Issuers()
+	if err != nil {
+		return nil, fmt.Errorf("resolving issuers: %w", err)
+	}
+	if len(resolved) < 1 {
+		return nil, fmt.Errorf("filter must include at least 1 issuer cert: %w", errNoIssuers)
+	}
+
+	// Issuers are kept in a slice rather than keyed by NameID because, during
+	// a key rotation, two issuers may share a Subject (and thus a NameID)
+	// while having different keys.
+	issuers := make([]filterIssuer, 0, len(resolved))
+	for _, issuer := range resolved {
+		err := checkResolvedIssuer(issuer)
+		if err != nil {
+			return nil, err
+		}
+		rid := responderID{issuer.NameHash, issuer.KeyHash, issuer.Cert.Subject.CommonName}
+		for _, other := range issuers {
+			if !allowDuplicates && bytes.Equal(rid.nameHash, other.nameHash) && bytes.Equal(rid.keyHash, other.keyHash) {
+				return nil, fmt.Errorf("issuer certificates %q and %q share issuer key hash %x", other.commonName, rid.commonName, rid.keyHash)
+			}
+		}
+		issuers = append(issuers, filterIssuer{rid, issuer.Cert.NameID(), issuer.Cert})
+	}
+	return issuers, nil
+}
+
+// ReloadIssuers replaces the filter's issuers with those now provided by
+// resolver, and returns the certificates of the previous and the new issuers.
+// If check is non-nil, it's given the new certificates first, and may refuse
+// them by returning an error, so that state derived from the issuers
+// elsewhere can be kept consistent with the filter.
+//
+// If the reload fails, for example because the configured files have been
+// removed, an error is returned, and the failure is audit logged. The
+// filter's reload policy then decides whether the previous issuers are kept,
+// or dropped so that every request is refused until a reload succeeds. A
+// reload which finds no issuers at all is also counted.
+func (src *filterSource) ReloadIssuers(resolver IssuerResolver, check func([]*issuance.Certificate) error) ([]*issuance.Certificate, []*issuance.Certificate, error) {
+	issuers, err := resolveFilterIssuers(resolver, src.allowDuplicates)
+	if errors.Is(err, errNoIssuers) {
+		src.emptyReloads.Inc()
+	}
+	if err != nil {
+		return src.reloadFailed(err)
+	}
+	newCerts := issuerCertificates(issuers)
+	if check != nil {
+		err = check(newCerts)
+		if err != nil {
+			return src.reloadFailed(err)
+		}
+	}
+	src.issuersMu.Lock()
+	old := src.issuers
+	src.issuers = issuers
+	src.issuersMu.Unlock()
+	return issuerCertificates(old), newCerts, nil
+}
+
+// reloadFailed applies the reload policy after a failed reload, audit logging
+// it, and returns the results of ReloadIssuers: the certificates of the
+// previous issuers and of those now in use, and err.
+func (src *filterSource) reloadFailed(err error) ([]*issuance.Certificate, []*issuance.Certificate, error) {
+	src.issuersMu.Lock()
+	defer src.issuersMu.Unlock()
+	old := issuerCertificates(src.issuers)
+	if src.reloadPolicy == ReloadFailClosed {
+		src.log.AuditErrf("Issuer reload failed, dropping the %d previously loaded issuers and refusing all requests: %s", len(src.issuers), err)
+		src.issuers = nil
+		return old, nil, err
+	}
+	src.log.AuditErrf("Issuer reload failed, keeping the %d previously loaded issuers: %s", len(src.issuers), err)
+	return old, old, err
+}
+
+// currentIssuers returns the filter's issuers. The slice must not be modified.
+func (src *filterSource) currentIssuers() []filterIssuer {
+	src.issuersMu.RLock()
+	defer src.issuersMu.RUnlock()
+	return src.issuers
+}
+
 // Response implements the Source interface. It checks the incoming request
 // to ensure that we want to handle it, fetches the response from the wrapped
 // Source, and checks that the response matches the request.
 func (src *filterSource) Response(ctx context.Context, req *ocsp.Request) (*Response, error) {
-	iss, err := src.checkRequest(req)
+	candidates, err := src.checkRequest(req)
 	if err != nil {
 		src.log.Debugf("Not responding to filtered OCSP request: %s", err.Error())
-		src.counter.WithLabelValues("request_filtered", "none").Inc()
+		if errors.Is(err, ErrInvalidSerial) {
+			src.counter.WithLabelValues("invalid_serial", "none").Inc()
+		} else {
+			src.counter.WithLabelValues("request_filtered", "none").Inc()
+		}
 		return nil, err
 	}
 
-	counter := src.counter.MustCurryWith(prometheus.Labels{"issuer": src.issuers[iss].commonName})
+	prefix, _ := src.serialPrefix(req.SerialNumber)
+	AfterRequest(ctx, func(took time.Duration) {
+		src.prefixLatency.WithLabelValues(prefix).Observe(took.Seconds())
+	})
+
+	// All candidates share a subject, and so a common name.
+	counter := src.counter.MustCurryWith(prometheus.Labels{"issuer": candidates[0].commonName})
 
 	resp, err := src.wrapped.Response(ctx, req)
 	if err != nil {
@@ -119,79 +531,236 @@ func (src *filterSource) Response(ctx context.Context, req *ocsp.Request) (*Resp
 		return nil, err
 	}
 
-	err = src.checkResponse(iss, resp)
+	err = src.checkResponse(candidates, resp)
 	if err != nil {
 		src.log.Warningf("OCSP Response not sent for CA=%s, Serial=%s, err: %s", hex.EncodeToString(req.IssuerKeyHash), core.SerialToString(req.SerialNumber), err)
-		counter.WithLabelValues("response_filtered").Inc()
+		if errors.Is(err, errSignatureInvalid) {
+			counter.WithLabelValues("signature_invalid").Inc()
+		} else if errors.Is(err, errResponseTooOld) {
+			counter.WithLabelValues("too_old").Inc()
+		} else if errors.Is(err, errNextUpdateMissing) {
+			counter.WithLabelValues("next_update_missing").Inc()
+		} else if errors.Is(err, errValidityTooShort) {
+			counter.WithLabelValues("validity_too_short").Inc()
+		} else if errors.Is(err, errValidityTooLong) {
+			counter.WithLabelValues("validity_too_long").Inc()
+		} else if errors.Is(err, errThisUpdateInFuture) {
+			counter.WithLabelValues("this_update_in_future").Inc()
+		} else {
+			counter.WithLabelValues("response_filtered").Inc()
+		}
 		return nil, err
 	}
 
+	if src.reportDeprecated {
+		src.checkSignatureAlgorithm(candidates[0].commonName, resp)
+	}
+
 	counter.WithLabelValues("success").Inc()
+	if !resp.NextUpdate.IsZero() {
+		src.remainingValidity.WithLabelValues(candidates[0].commonName).Observe(resp.NextUpdate.Sub(src.clk.Now()).Seconds())
+	}
 	return resp, nil
 }
 
 // checkNextUpdate evaluates whether the nextUpdate field of the requested OCSP
-// response is in the past. If so, `errOCSPResponseExpired` will be returned.
+// response is in the past. If so, `ErrExpired` will be returned.
+// If the response has no nextUpdate, `errNextUpdateMissing` is returned if
+// requireNextUpdate is set, and nil otherwise.
 func (src *filterSource) checkNextUpdate(resp *Response) error {
+	if resp.NextUpdate.IsZero() {
+		if src.requireNextUpdate {
+			return errNextUpdateMissing
+		}
+		return nil
+	}
 	if src.clk.Now().Before(resp.NextUpdate) {
 		return nil
 	}
-	return errOCSPResponseExpired
+	return ErrExpired
+}
+
+// checkResponseAge evaluates whether the thisUpdate field of the requested
+// OCSP response is older than the configured maximum response age. If so,
+// `errResponseTooOld` will be returned.
+func (src *filterSource) checkResponseAge(resp *Response) error {
+	if src.maxResponseAge == 0 {
+		return nil
+	}
+	age := src.clk.Since(resp.ThisUpdate)
+	if age > src.maxResponseAge {
+		return fmt.Errorf("thisUpdate is %s old: %w", age, errResponseTooOld)
+	}
+	return nil
+}
+
+// checkThisUpdate evaluates whether the thisUpdate field of the requested OCSP
+// response is further in the future than the configured skew tolerance. If
+// so, `errThisUpdateInFuture` will be returned.
+func (src *filterSource) checkThisUpdate(resp *Response) error {
+	if src.thisUpdateSkew == 0 {
+		return nil
+	}
+	ahead := resp.ThisUpdate.Sub(src.clk.Now())
+	if ahead > src.thisUpdateSkew {
+		return fmt.Errorf("%w: %s ahead, tolerance %s", errThisUpdateInFuture, ahead, src.thisUpdateSkew)
+	}
+	return nil
+}
+
+// checkValidity evaluates whether the validity interval of the requested OCSP
+// response, nextUpdate minus thisUpdate, is within the configured bounds. If
+// not, `errValidityTooShort` or `errValidityTooLong` will be returned.
+// Responses without a nextUpdate are left to checkNextUpdate.
+func (src *filterSource) checkValidity(resp *Response) error {
+	if resp.NextUpdate.IsZero() {
+		return nil
+	}
+	validity := resp.NextUpdate.Sub(resp.ThisUpdate)
+	if src.minValidity != 0 && validity < src.minValidity {
+		return fmt.Errorf("%w: %s < %s", errValidityTooShort, validity, src.minValidity)
+	}
+	if src.maxValidity != 0 && validity > src.maxValidity {
+		return fmt.Errorf("%w: %s > %s", errValidityTooLong, validity, src.maxValidity)
+	}
+	return nil
 }
 
-// checkRequest returns a descriptive error if the request does not satisfy any of
-// the requirements of an OCSP request, or nil if the request should be handled.
-// If the request passes all checks, then checkRequest returns the unique id of
-// the issuer cert specified in the request.
-func (src *filterSource) checkRequest(req *ocsp.Request) (issuance.NameID, error) {
+// checkRequest returns a descriptive *RejectedRequestError if the request does
+// not satisfy any of the requirements of an OCSP request, or nil if the request
+// should be handled.
+// If the request passes all checks, then checkRequest returns the issuers
+// matching the request: usually one, but more if duplicates are allowed or
+// other variants of the issuer share its key.
+func (src *filterSource) checkRequest(req *ocsp.Request) ([]*filterIssuer, error) {
+	if req.SerialNumber.Sign() <= 0 {
+		return nil, &RejectedRequestError{rejectedInvalidSerial, ErrInvalidSerial}
+	}
+
 	if req.HashAlgorithm != src.hashAlgorithm {
-		return 0, fmt.Errorf("unsupported issuer key/name hash algorithm %s: %w", req.HashAlgorithm, ErrNotFound)
+		return nil, &RejectedRequestError{rejectedWrongHashAlgorithm, fmt.Errorf("%w: %s", ErrWrongHashAlgorithm, req.HashAlgorithm)}
 	}
 
-	if len(src.serialPrefixes) > 0 {
-		serialString := core.SerialToString(req.SerialNumber)
-		match := false
-		for _, prefix := range src.serialPrefixes {
-			if strings.HasPrefix(serialString, prefix) {
-				match = true
-				break
-			}
+	_, ok := src.serialPrefix(req.SerialNumber)
+	if !ok {
+		return nil, &RejectedRequestError{rejectedWrongPrefix, ErrWrongPrefix}
+	}
+
+	issuers := src.currentIssuers()
+	var candidates []*filterIssuer
+	for i, iss := range issuers {
+		if bytes.Equal(req.IssuerNameHash, iss.nameHash) && bytes.Equal(req.IssuerKeyHash, iss.keyHash) {
+			candidates = append(candidates, &issuers[i])
 		}
-		if !match {
-			return 0, fmt.Errorf("unrecognized serial prefix: %w", ErrNotFound)
+	}
+	if len(candidates) == 0 {
+		return nil, &RejectedRequestError{rejectedWrongIssuer, fmt.Errorf("%w: key hash %s", ErrWrongIssuer, hex.EncodeToString(req.IssuerKeyHash))}
+	}
+
+	// Every issuer certificate with the requested key is a variant of the
+	// same logical issuer, such as a cross-sign whose subject is encoded
+	// differently and so has a different name hash. Responses signed as any
+	// of them are equally valid, so the other variants are candidates too,
+	// after the exact matches.
+	for i, iss := range issuers {
+		if !bytes.Equal(req.IssuerNameHash, iss.nameHash) && bytes.Equal(req.IssuerKeyHash, iss.keyHash) {
+			candidates = append(candidates, &issuers[i])
 		}
 	}
+	return candidates, nil
+}
+
+// checkSignatureAlgorithm counts resp if it was signed with a deprecated
+// algorithm, and logs the first such response for each issuer and algorithm.
+func (src *filterSource) checkSignatureAlgorithm(issuer string, resp *Response) {
+	if !deprecatedSignatureAlgorithms[resp.SignatureAlgorithm] {
+		return
+	}
+	algorithm := resp.SignatureAlgorithm.String()
+	src.deprecatedSigs.WithLabelValues(issuer, algorithm).Inc()
+	_, logged := src.deprecatedLogged.LoadOrStore(issuer+"/"+algorithm, true)
+	if !logged {
+		src.log.Warningf("Serving response signed with deprecated algorithm %s: issuer %q, serial %s", algorithm, issuer, core.SerialToString(resp.SerialNumber))
+	}
+}
 
-	for nameID, rid := range src.issuers {
-		if bytes.Equal(req.IssuerNameHash, rid.nameHash) && bytes.Equal(req.IssuerKeyHash, rid.keyHash) {
-			return nameID, nil
+// serialPrefix returns the first of the configured serial prefixes which
+// serial has, and false if it has none of them. If no prefixes are configured,
+// every serial matches, and the prefix returned is "none".
+func (src *filterSource) serialPrefix(serial *big.Int) (string, bool) {
+	if len(src.serialPrefixes) == 0 {
+		return "none", true
+	}
+	serialString := core.SerialToString(serial)
+	for _, prefix := range src.serialPrefixes {
+		if strings.HasPrefix(serialString, prefix) {
+			return prefix, true
 		}
 	}
-	return 0, fmt.Errorf("unrecognized issuer key hash %s: %w", hex.EncodeToString(req.IssuerKeyHash), ErrNotFound)
+	return "", false
 }
 
-// checkResponse returns nil if the ocsp response was generated by the same
-// issuer as was identified in the request, or an error otherwise. This filters
-// out, for example, responses which are for a serial that we issued, but from a
-// different issuer than that contained in the request.
-func (src *filterSource) checkResponse(reqIssuerID issuance.NameID, resp *Response) error {
+// checkResponse returns nil if the ocsp response was generated by one of the
+// candidate issuers identified in the request, and is otherwise fit to serve,
+// or an error otherwise. This filters out, for example, responses which are
+// for a serial that we issued, but from a different issuer than that
+// contained in the request.
+func (src *filterSource) checkResponse(candidates []*filterIssuer, resp *Response) error {
+	var err error
+	for _, iss := range candidates {
+		err = src.checkResponseIssuer(iss, resp)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = src.checkNextUpdate(resp)
+	if err != nil {
+		return err
+	}
+
+	err = src.checkResponseAge(resp)
+	if err != nil {
+		return err
+	}
+
+	err = src.checkThisUpdate(resp)
+	if err != nil {
+		return err
+	}
+
+	return src.checkValidity(resp)
+}
+
+// checkResponseIssuer returns nil if the ocsp response was generated by
+// reqIssuer, or an error otherwise.
+func (src *filterSource) checkResponseIssuer(reqIssuer *filterIssuer, resp *Response) error {
 	respIssuerID := issuance.ResponderNameID(resp.Response)
-	if reqIssuerID != respIssuerID {
+	if reqIssuer.nameID != respIssuerID {
 		// This would be allowed if we used delegated responders, but we don't.
-		return fmt.Errorf("responder name does not match requested issuer name")
+		return fmt.Errorf("%w: responder name does not match requested issuer name", ErrResponseIssuerMismatch)
 	}
 
-	err := src.checkNextUpdate(resp)
+	// The responder name can't distinguish between issuers which share a
+	// Subject but not a key, as happens during a key rotation, so also check
+	// that the response's CertID is for the requested issuer's key.
+	respKeyHash, err := responseIssuerKeyHash(resp)
 	if err != nil {
 		return err
 	}
+	if !bytes.Equal(respKeyHash, reqIssuer.keyHash) {
+		return fmt.Errorf("%w: response issuer key hash %x does not match requested issuer key hash %x", ErrResponseIssuerMismatch, respKeyHash, reqIssuer.keyHash)
+	}
 
-	// In an ideal world, we'd also compare the Issuer Key Hash from the request's
-	// CertID (equivalent to looking up the key hash in src.issuers) against the
-	// Issuer Key Hash contained in the response's CertID. However, the Go OCSP
-	// library does not provide access to the response's CertID, so we can't.
-	// Specifically, we want to compare `src.issuers[reqIssuerID].keyHash` against
-	// something like resp.CertID.IssuerKeyHash, but the latter does not exist.
+	if src.verifySignatures {
+		err = reqIssuer.cert.CheckSignature(resp.SignatureAlgorithm, resp.TBSResponseData, resp.Signature)
+		if err != nil {
+			return fmt.Errorf("%w: %s", errSignatureInvalid, err)
+		}
+	}
 
 	return nil
 }
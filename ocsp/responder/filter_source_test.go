@@ -1,10 +1,21 @@
 package responder
 
 import (
+	"bytes"
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,29 +25,31 @@ import (
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/test"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
 	"golang.org/x/crypto/ocsp"
 )
 
 func TestNewFilter(t *testing.T) {
-	_, err := NewFilterSource([]*issuance.Certificate{}, []string{}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	_, err := NewFilterSource(StaticIssuers{}, FilterConfig{}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.New())
 	test.AssertError(t, err, "didn't error when creating empty filter")
 
 	issuer, err := issuance.LoadCertificate("./testdata/test-ca.der.pem")
 	test.AssertNotError(t, err, "failed to load issuer cert")
-	issuerNameId := issuer.NameID()
 
-	f, err := NewFilterSource([]*issuance.Certificate{issuer}, []string{"00"}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	f, err := NewFilterSource(StaticIssuers{issuer}, FilterConfig{SerialPrefixes: []string{"00"}}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.New())
 	test.AssertNotError(t, err, "errored when creating good filter")
 	test.AssertEquals(t, len(f.issuers), 1)
 	test.AssertEquals(t, len(f.serialPrefixes), 1)
-	test.AssertEquals(t, hex.EncodeToString(f.issuers[issuerNameId].keyHash), "fb784f12f96015832c9f177f3419b32e36ea4189")
+	test.AssertEquals(t, f.issuers[0].nameID, issuer.NameID())
+	test.AssertEquals(t, hex.EncodeToString(f.issuers[0].keyHash), "fb784f12f96015832c9f177f3419b32e36ea4189")
 }
 
 func TestCheckNextUpdate(t *testing.T) {
 	issuer, err := issuance.LoadCertificate("./testdata/test-ca.der.pem")
 	test.AssertNotError(t, err, "failed to load issuer cert")
 
-	f, err := NewFilterSource([]*issuance.Certificate{issuer}, []string{"00"}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	f, err := NewFilterSource(StaticIssuers{issuer}, FilterConfig{SerialPrefixes: []string{"00"}}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.New())
 	test.AssertNotError(t, err, "errored when creating good filter")
 
 	resp := &Response{
@@ -47,14 +60,14 @@ func TestCheckNextUpdate(t *testing.T) {
 	test.AssertNotError(t, f.checkNextUpdate(resp), "error during valid check")
 
 	resp.NextUpdate = time.Now().Add(-time.Hour)
-	test.AssertErrorIs(t, f.checkNextUpdate(resp), errOCSPResponseExpired)
+	test.AssertErrorIs(t, f.checkNextUpdate(resp), ErrExpired)
 }
 
 func TestCheckRequest(t *testing.T) {
 	issuer, err := issuance.LoadCertificate("./testdata/test-ca.der.pem")
 	test.AssertNotError(t, err, "failed to load issuer cert")
 
-	f, err := NewFilterSource([]*issuance.Certificate{issuer}, []string{"00"}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	f, err := NewFilterSource(StaticIssuers{issuer}, FilterConfig{SerialPrefixes: []string{"00"}}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.New())
 	test.AssertNotError(t, err, "errored when creating good filter")
 
 	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
@@ -65,14 +78,16 @@ func TestCheckRequest(t *testing.T) {
 	test.AssertNotError(t, err, "failed to prepare fake ocsp request")
 	ocspReq.HashAlgorithm = crypto.MD5
 	_, err = f.Response(context.Background(), ocspReq)
-	test.AssertError(t, err, "accepted ocsp request with bad hash algorithm")
+	test.AssertErrorIs(t, err, ErrWrongHashAlgorithm)
+	test.AssertErrorIs(t, err, ErrNotFound)
 
 	// Make the hash invalid.
 	ocspReq, err = ocsp.ParseRequest(reqBytes)
 	test.AssertNotError(t, err, "failed to prepare fake ocsp request")
 	ocspReq.IssuerKeyHash[0]++
 	_, err = f.Response(context.Background(), ocspReq)
-	test.AssertError(t, err, "accepted ocsp request with bad issuer key hash")
+	test.AssertErrorIs(t, err, ErrWrongIssuer)
+	test.AssertErrorIs(t, err, ErrNotFound)
 
 	// Make the serial prefix wrong by incrementing the first byte by 1.
 	ocspReq, err = ocsp.ParseRequest(reqBytes)
@@ -81,7 +96,33 @@ func TestCheckRequest(t *testing.T) {
 	serialStr[0] = serialStr[0] + 1
 	ocspReq.SerialNumber.SetString(string(serialStr), 16)
 	_, err = f.Response(context.Background(), ocspReq)
-	test.AssertError(t, err, "accepted ocsp request with bad serial prefix")
+	test.AssertErrorIs(t, err, ErrWrongPrefix)
+	test.AssertErrorIs(t, err, ErrNotFound)
+}
+
+func TestCheckRequestInvalidSerial(t *testing.T) {
+	issuer, err := issuance.LoadCertificate("./testdata/test-ca.der.pem")
+	test.AssertNotError(t, err, "failed to load issuer cert")
+
+	// With no prefixes configured, any serial would otherwise be accepted. The
+	// wrapped source panics, so it mustn't be consulted.
+	f, err := NewFilterSource(StaticIssuers{issuer}, FilterConfig{}, panicSource{}, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	test.AssertNotError(t, err, "errored when creating good filter")
+
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+
+	for _, serial := range []int64{0, -1, -12345} {
+		ocspReq, err := ocsp.ParseRequest(reqBytes)
+		test.AssertNotError(t, err, "failed to prepare fake ocsp request")
+		ocspReq.SerialNumber.SetInt64(serial)
+		_, err = f.Response(context.Background(), ocspReq)
+		test.AssertErrorIs(t, err, ErrInvalidSerial)
+		test.AssertErrorIs(t, err, ErrMalformed)
+		test.Assert(t, !errors.Is(err, ErrNotFound), "invalid serial error wraps ErrNotFound")
+	}
+	test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": "invalid_serial"}, 3)
+	test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": "request_filtered"}, 0)
 }
 
 type echoSource struct {
@@ -107,7 +148,7 @@ func TestCheckResponse(t *testing.T) {
 	test.AssertNotError(t, err, "failed to parse OCSP response")
 
 	source := &echoSource{&Response{resp, respBytes}}
-	f, err := NewFilterSource([]*issuance.Certificate{issuer}, []string{"00"}, source, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	f, err := NewFilterSource(StaticIssuers{issuer}, FilterConfig{SerialPrefixes: []string{"00"}}, source, metrics.NoopRegisterer, blog.NewMock(), clock.New())
 	test.AssertNotError(t, err, "errored when creating good filter")
 
 	actual, err := f.Response(context.Background(), req)
@@ -117,22 +158,559 @@ func TestCheckResponse(t *testing.T) {
 	// test expired source
 	expiredResp, err := ocsp.ParseResponse(respBytes, nil)
 	test.AssertNotError(t, err, "failed to parse OCSP response")
-	expiredResp.NextUpdate = time.Time{}
+	expiredResp.NextUpdate = time.Now().Add(-time.Hour)
 
 	sourceExpired := &echoSource{&Response{expiredResp, nil}}
-	fExpired, err := NewFilterSource([]*issuance.Certificate{issuer}, []string{"00"}, sourceExpired, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	fExpired, err := NewFilterSource(StaticIssuers{issuer}, FilterConfig{SerialPrefixes: []string{"00"}}, sourceExpired, metrics.NoopRegisterer, blog.NewMock(), clock.New())
 	test.AssertNotError(t, err, "errored when creating good filter")
 
 	_, err = fExpired.Response(context.Background(), req)
 	test.AssertError(t, err, "missing error")
-	test.AssertErrorIs(t, err, errOCSPResponseExpired)
+	test.AssertErrorIs(t, err, ErrExpired)
 
 	// Overwrite the Responder Name in the stored response to cause a diagreement.
 	resp.RawResponderName = []byte("C = US, O = Foo, DN = Bar")
 	source = &echoSource{&Response{resp, respBytes}}
-	f, err = NewFilterSource([]*issuance.Certificate{issuer}, []string{"00"}, source, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	f, err = NewFilterSource(StaticIssuers{issuer}, FilterConfig{SerialPrefixes: []string{"00"}}, source, metrics.NoopRegisterer, blog.NewMock(), clock.New())
 	test.AssertNotError(t, err, "errored when creating good filter")
 
 	_, err = f.Response(context.Background(), req)
 	test.AssertError(t, err, "expected error")
 }
+
+func TestCheckResponseSignature(t *testing.T) {
+	issuer, err := issuance.LoadCertificate("./testdata/test-ca.der.pem")
+	test.AssertNotError(t, err, "failed to load issuer cert")
+
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to prepare fake ocsp request")
+
+	respBytes, err := os.ReadFile("./testdata/ocsp.resp")
+	test.AssertNotError(t, err, "failed to read OCSP response")
+	resp, err := ocsp.ParseResponse(respBytes, nil)
+	test.AssertNotError(t, err, "failed to parse OCSP response")
+
+	// An untampered response verifies.
+	f, err := NewFilterSource(StaticIssuers{issuer}, FilterConfig{SerialPrefixes: []string{"00"}, VerifySignatures: true}, &echoSource{&Response{resp, respBytes}}, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	test.AssertNotError(t, err, "errored when creating good filter")
+	_, err = f.Response(context.Background(), req)
+	test.AssertNotError(t, err, "unexpected error verifying good response")
+
+	// Tamper with the response's status, as if someone had edited storage.
+	tampered, err := ocsp.ParseResponse(respBytes, nil)
+	test.AssertNotError(t, err, "failed to parse OCSP response")
+	tampered.TBSResponseData = append([]byte{}, tampered.TBSResponseData...)
+	tampered.TBSResponseData[len(tampered.TBSResponseData)-1]++
+
+	f, err = NewFilterSource(StaticIssuers{issuer}, FilterConfig{SerialPrefixes: []string{"00"}, VerifySignatures: true}, &echoSource{&Response{tampered, respBytes}}, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	test.AssertNotError(t, err, "errored when creating good filter")
+	_, err = f.Response(context.Background(), req)
+	test.AssertErrorIs(t, err, errSignatureInvalid)
+	test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": "signature_invalid", "issuer": issuer.Subject.CommonName}, 1)
+	test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": "response_filtered", "issuer": issuer.Subject.CommonName}, 0)
+
+	// Without verification enabled, the tampered response is served.
+	f, err = NewFilterSource(StaticIssuers{issuer}, FilterConfig{SerialPrefixes: []string{"00"}}, &echoSource{&Response{tampered, respBytes}}, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	test.AssertNotError(t, err, "errored when creating good filter")
+	_, err = f.Response(context.Background(), req)
+	test.AssertNotError(t, err, "unexpected error without verification")
+}
+
+func TestCheckResponseAge(t *testing.T) {
+	issuer, err := issuance.LoadCertificate("./testdata/test-ca.der.pem")
+	test.AssertNotError(t, err, "failed to load issuer cert")
+
+	clk := clock.NewFake()
+	f, err := NewFilterSource(StaticIssuers{issuer}, FilterConfig{SerialPrefixes: []string{"00"}, MaxResponseAge: 7 * 24 * time.Hour}, nil, metrics.NoopRegisterer, blog.NewMock(), clk)
+	test.AssertNotError(t, err, "errored when creating good filter")
+
+	resp := &Response{
+		Response: &ocsp.Response{
+			ThisUpdate: clk.Now().Add(-7 * 24 * time.Hour),
+		},
+	}
+	test.AssertNotError(t, f.checkResponseAge(resp), "response at exactly the max age was rejected")
+
+	resp.ThisUpdate = clk.Now().Add(-7*24*time.Hour + time.Second)
+	test.AssertNotError(t, f.checkResponseAge(resp), "response just within the max age was rejected")
+
+	resp.ThisUpdate = clk.Now().Add(-7*24*time.Hour - time.Second)
+	err = f.checkResponseAge(resp)
+	test.AssertErrorIs(t, err, errResponseTooOld)
+	test.AssertErrorIs(t, err, ErrNotFound)
+
+	// With no max age configured, any age is accepted.
+	f, err = NewFilterSource(StaticIssuers{issuer}, FilterConfig{SerialPrefixes: []string{"00"}}, nil, metrics.NoopRegisterer, blog.NewMock(), clk)
+	test.AssertNotError(t, err, "errored when creating good filter")
+	resp.ThisUpdate = clk.Now().Add(-365 * 24 * time.Hour)
+	test.AssertNotError(t, f.checkResponseAge(resp), "response rejected with no max age")
+}
+
+func TestResponseTooOldMetric(t *testing.T) {
+	issuer, err := issuance.LoadCertificate("./testdata/test-ca.der.pem")
+	test.AssertNotError(t, err, "failed to load issuer cert")
+
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to prepare fake ocsp request")
+
+	respBytes, err := os.ReadFile("./testdata/ocsp.resp")
+	test.AssertNotError(t, err, "failed to read OCSP response")
+	resp, err := ocsp.ParseResponse(respBytes, nil)
+	test.AssertNotError(t, err, "failed to parse OCSP response")
+
+	// The test response's thisUpdate is in 2015, so a fake clock set well
+	// before its nextUpdate still finds it too old.
+	clk := clock.NewFake()
+	clk.Set(resp.ThisUpdate.Add(8 * 24 * time.Hour))
+	f, err := NewFilterSource(StaticIssuers{issuer}, FilterConfig{SerialPrefixes: []string{"00"}, MaxResponseAge: 7 * 24 * time.Hour}, &echoSource{&Response{resp, respBytes}}, metrics.NoopRegisterer, blog.NewMock(), clk)
+	test.AssertNotError(t, err, "errored when creating good filter")
+
+	_, err = f.Response(context.Background(), req)
+	test.AssertErrorIs(t, err, ErrNotFound)
+	test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": "too_old", "issuer": issuer.Subject.CommonName}, 1)
+}
+
+// signedResponse returns a good response for serial, signed by issuer.
+func signedResponse(t *testing.T, issuer *issuance.Issuer, serial int64, now time.Time) *Response {
+	t.Helper()
+	cert := issuer.Cert.Certificate
+	der, err := ocsp.CreateResponse(cert, cert, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: big.NewInt(serial),
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(time.Hour),
+	}, issuer.Signer)
+	test.AssertNotError(t, err, "signing response")
+	resp, err := ocsp.ParseResponse(der, nil)
+	test.AssertNotError(t, err, "parsing response")
+	return &Response{resp, der}
+}
+
+func TestShadowIssuer(t *testing.T) {
+	// Two issuers sharing a Subject, but with distinct keys, as during an
+	// intermediate key rotation.
+	oldIssuer := makeTestIssuer(t)
+	newIssuer := makeTestIssuer(t)
+	test.AssertEquals(t, oldIssuer.Cert.NameID(), newIssuer.Cert.NameID())
+
+	clk := clock.NewFake()
+	oldResp := signedResponse(t, oldIssuer, 1, clk.Now())
+	newResp := signedResponse(t, newIssuer, 1, clk.Now())
+
+	source := &echoSource{}
+	f, err := NewFilterSource(StaticIssuers{oldIssuer.Cert, newIssuer.Cert}, FilterConfig{VerifySignatures: true}, source, metrics.NoopRegisterer, blog.NewMock(), clk)
+	test.AssertNotError(t, err, "creating filter")
+	test.AssertEquals(t, len(f.issuers), 2)
+
+	// Requests for either issuer are accepted, and served the response
+	// for that issuer's key.
+	source.resp = oldResp
+	resp, err := f.Response(context.Background(), requestFor(t, oldIssuer, 1))
+	test.AssertNotError(t, err, "request for old issuer")
+	test.AssertByteEquals(t, resp.Raw, oldResp.Raw)
+
+	source.resp = newResp
+	resp, err = f.Response(context.Background(), requestFor(t, newIssuer, 1))
+	test.AssertNotError(t, err, "request for new issuer")
+	test.AssertByteEquals(t, resp.Raw, newResp.Raw)
+
+	// A response from the other key is rejected, even though the responder
+	// names match.
+	source.resp = oldResp
+	_, err = f.Response(context.Background(), requestFor(t, newIssuer, 1))
+	test.AssertErrorIs(t, err, ErrResponseIssuerMismatch)
+	test.AssertContains(t, err.Error(), "issuer key hash")
+
+	source.resp = newResp
+	_, err = f.Response(context.Background(), requestFor(t, oldIssuer, 1))
+	test.AssertErrorIs(t, err, ErrResponseIssuerMismatch)
+}
+
+func TestRequireNextUpdate(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	clk := clock.NewFake()
+	cert := issuer.Cert.Certificate
+	der, err := ocsp.CreateResponse(cert, cert, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: big.NewInt(1),
+		ThisUpdate:   clk.Now(),
+	}, issuer.Signer)
+	test.AssertNotError(t, err, "signing response")
+	resp, err := ocsp.ParseResponse(der, nil)
+	test.AssertNotError(t, err, "parsing response")
+	test.Assert(t, resp.NextUpdate.IsZero(), "response should have no nextUpdate")
+	source := &echoSource{&Response{resp, der}}
+
+	// By default, a response without a nextUpdate is served, however far the
+	// clock has moved on since its thisUpdate.
+	f, err := NewFilterSource(StaticIssuers{issuer.Cert}, FilterConfig{}, source, metrics.NoopRegisterer, blog.NewMock(), clk)
+	test.AssertNotError(t, err, "creating lenient filter")
+	clk.Add(48 * time.Hour)
+	_, err = f.Response(context.Background(), requestFor(t, issuer, 1))
+	test.AssertNotError(t, err, "lenient filter refused response without nextUpdate")
+	test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": "success"}, 1)
+	test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": "response_filtered"}, 0)
+	test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": "next_update_missing"}, 0)
+
+	// In strict mode, it's refused and counted separately.
+	f, err = NewFilterSource(StaticIssuers{issuer.Cert}, FilterConfig{RequireNextUpdate: true}, source, metrics.NoopRegisterer, blog.NewMock(), clk)
+	test.AssertNotError(t, err, "creating strict filter")
+	_, err = f.Response(context.Background(), requestFor(t, issuer, 1))
+	test.AssertErrorIs(t, err, errNextUpdateMissing)
+	test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": "next_update_missing"}, 1)
+	test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": "response_filtered"}, 0)
+
+	// Responses with a nextUpdate are unaffected by strict mode.
+	source.resp = signedResponse(t, issuer, 1, clk.Now())
+	_, err = f.Response(context.Background(), requestFor(t, issuer, 1))
+	test.AssertNotError(t, err, "strict filter refused response with nextUpdate")
+}
+
+func TestValidityBounds(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	clk := clock.NewFake()
+	// signedResponse produces responses valid for one hour.
+	source := &echoSource{signedResponse(t, issuer, 1, clk.Now())}
+
+	testCases := []struct {
+		name        string
+		min, max    time.Duration
+		expectedErr error
+		result      string
+	}{
+		{"too short", 2 * time.Hour, 0, errValidityTooShort, "validity_too_short"},
+		{"too long", 0, 30 * time.Minute, errValidityTooLong, "validity_too_long"},
+		{"in range", 30 * time.Minute, 2 * time.Hour, nil, "success"},
+		{"exactly at bounds", time.Hour, time.Hour, nil, "success"},
+		{"unbounded", 0, 0, nil, "success"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := NewFilterSource(StaticIssuers{issuer.Cert}, FilterConfig{MinValidity: tc.min, MaxValidity: tc.max}, source, metrics.NoopRegisterer, blog.NewMock(), clk)
+			test.AssertNotError(t, err, "creating filter")
+			_, err = f.Response(context.Background(), requestFor(t, issuer, 1))
+			if tc.expectedErr != nil {
+				test.AssertErrorIs(t, err, tc.expectedErr)
+			} else {
+				test.AssertNotError(t, err, "in-range response was refused")
+			}
+			test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": tc.result}, 1)
+		})
+	}
+}
+
+func TestThisUpdateSkewTolerance(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	clk := clock.NewFake()
+	clk.Set(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	testCases := []struct {
+		name        string
+		ahead       time.Duration
+		tolerance   time.Duration
+		expectedErr error
+		result      string
+	}{
+		{"within tolerance", time.Minute, 5 * time.Minute, nil, "success"},
+		{"exactly at tolerance", 5 * time.Minute, 5 * time.Minute, nil, "success"},
+		{"beyond tolerance", 10 * time.Minute, 5 * time.Minute, errThisUpdateInFuture, "this_update_in_future"},
+		{"in the past", -time.Minute, 5 * time.Minute, nil, "success"},
+		{"unchecked", 10 * time.Minute, 0, nil, "success"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := &echoSource{signedResponse(t, issuer, 1, clk.Now().Add(tc.ahead))}
+			f, err := NewFilterSource(StaticIssuers{issuer.Cert}, FilterConfig{ThisUpdateSkewTolerance: tc.tolerance}, source, metrics.NoopRegisterer, blog.NewMock(), clk)
+			test.AssertNotError(t, err, "creating filter")
+			_, err = f.Response(context.Background(), requestFor(t, issuer, 1))
+			if tc.expectedErr != nil {
+				test.AssertErrorIs(t, err, tc.expectedErr)
+			} else {
+				test.AssertNotError(t, err, "response within tolerance was refused")
+			}
+			test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": tc.result}, 1)
+		})
+	}
+}
+
+// crossSign returns a certificate with the same subject and key as issuer's,
+// but signed by a different CA, as a cross-signed variant would be.
+func crossSign(t *testing.T, issuer *issuance.Issuer) *issuance.Certificate {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "generating root key")
+	root := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		Subject:               pkix.Name{CommonName: "cross-signing root"},
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1338),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		Subject:               issuer.Cert.Subject,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, root, issuer.Cert.PublicKey, rootKey)
+	test.AssertNotError(t, err, "creating cross-signed cert")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "parsing cross-signed cert")
+	ic, err := issuance.NewCertificate(cert)
+	test.AssertNotError(t, err, "wrapping cross-signed cert")
+	return ic
+}
+
+func TestDuplicateIssuers(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	crossSigned := crossSign(t, issuer)
+	certs := []*issuance.Certificate{issuer.Cert, crossSigned}
+	clk := clock.NewFake()
+	source := &echoSource{signedResponse(t, issuer, 1, clk.Now())}
+
+	// By default, the collision is reported.
+	_, err := NewFilterSource(StaticIssuers(certs), FilterConfig{VerifySignatures: true}, source, metrics.NoopRegisterer, blog.NewMock(), clk)
+	test.AssertError(t, err, "created filter with duplicate issuers")
+	test.AssertContains(t, err.Error(), "share issuer key hash")
+
+	// When allowed, both certificates are kept and either may vouch for the
+	// response.
+	f, err := NewFilterSource(StaticIssuers(certs), FilterConfig{AllowDuplicates: true, VerifySignatures: true}, source, metrics.NoopRegisterer, blog.NewMock(), clk)
+	test.AssertNotError(t, err, "creating filter with duplicates allowed")
+	test.AssertEquals(t, len(f.issuers), 2)
+
+	candidates, err := f.checkRequest(requestFor(t, issuer, 1))
+	test.AssertNotError(t, err, "checking request")
+	test.AssertEquals(t, len(candidates), 2)
+	test.AssertEquals(t, candidates[0].cert, issuer.Cert)
+	test.AssertEquals(t, candidates[1].cert, crossSigned)
+
+	_, err = f.Response(context.Background(), requestFor(t, issuer, 1))
+	test.AssertNotError(t, err, "response refused with duplicate issuers")
+	test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": "success"}, 1)
+
+	// A response from an unrelated issuer with the same subject is still
+	// refused, whichever candidate it's checked against.
+	other := makeTestIssuer(t)
+	source.resp = signedResponse(t, other, 1, clk.Now())
+	_, err = f.Response(context.Background(), requestFor(t, issuer, 1))
+	test.AssertErrorIs(t, err, ErrResponseIssuerMismatch)
+	test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": "response_filtered"}, 1)
+}
+
+// crossSignReencoded is like crossSign, but the returned variant's subject
+// has its common name encoded as a UTF8String rather than a PrintableString,
+// as some cross-signing CAs do. It's the same logical issuer, with the same
+// key, but requests for it carry a different issuer name hash.
+func crossSignReencoded(t *testing.T, issuer *issuance.Issuer) *issuance.Issuer {
+	t.Helper()
+	rawSubject, err := asn1.Marshal(pkix.RDNSequence{{{
+		Type:  asn1.ObjectIdentifier{2, 5, 4, 3},
+		Value: asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(issuer.Cert.Subject.CommonName)},
+	}}})
+	test.AssertNotError(t, err, "encoding subject")
+	test.Assert(t, !bytes.Equal(rawSubject, issuer.Cert.RawSubject), "re-encoded subject should differ")
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "generating root key")
+	root := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		Subject:               pkix.Name{CommonName: "cross-signing root"},
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1339),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		RawSubject:            rawSubject,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, root, issuer.Cert.PublicKey, rootKey)
+	test.AssertNotError(t, err, "creating cross-signed cert")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "parsing cross-signed cert")
+	ic, err := issuance.NewCertificate(cert)
+	test.AssertNotError(t, err, "wrapping cross-signed cert")
+	return &issuance.Issuer{Cert: ic, Signer: issuer.Signer}
+}
+
+func TestCrossSignedVariants(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	variant := crossSignReencoded(t, issuer)
+	test.Assert(t, issuer.Cert.NameID() != variant.Cert.NameID(), "variants should have distinct NameIDs")
+	clk := clock.NewFake()
+	source := &echoSource{}
+
+	// The variants have different name hashes, so they aren't duplicates.
+	f, err := NewFilterSource(StaticIssuers{issuer.Cert, variant.Cert}, FilterConfig{VerifySignatures: true}, source, metrics.NoopRegisterer, blog.NewMock(), clk)
+	test.AssertNotError(t, err, "creating filter with cross-signed variants")
+
+	// The same stored response, signed as either variant, is served for
+	// requests naming either variant.
+	for _, signer := range []*issuance.Issuer{issuer, variant} {
+		source.resp = signedResponse(t, signer, 1, clk.Now())
+		for _, requested := range []*issuance.Issuer{issuer, variant} {
+			candidates, err := f.checkRequest(requestFor(t, requested, 1))
+			test.AssertNotError(t, err, "checking request")
+			test.AssertEquals(t, len(candidates), 2)
+			test.AssertEquals(t, candidates[0].cert, requested.Cert)
+
+			resp, err := f.Response(context.Background(), requestFor(t, requested, 1))
+			test.AssertNotError(t, err, "response refused for cross-signed variant")
+			test.AssertEquals(t, resp, source.resp)
+		}
+	}
+	test.AssertMetricWithLabelsEquals(t, f.counter, prometheus.Labels{"result": "success"}, 4)
+
+	// An unrelated issuer with the same subject, but a different key, isn't a
+	// variant, so its responses are still refused.
+	other := makeTestIssuer(t)
+	source.resp = signedResponse(t, other, 1, clk.Now())
+	_, err = f.Response(context.Background(), requestFor(t, variant, 1))
+	test.AssertErrorIs(t, err, ErrResponseIssuerMismatch)
+	_, err = f.checkRequest(requestFor(t, other, 1))
+	test.AssertErrorIs(t, err, ErrWrongIssuer)
+}
+
+func TestRemainingValidityByIssuer(t *testing.T) {
+	issuerA := makeNamedTestIssuer(t, "issuer A")
+	issuerB := makeNamedTestIssuer(t, "issuer B")
+	clk := clock.NewFake()
+	// signedResponse produces responses valid for one hour.
+	source := &echoSource{}
+	f, err := NewFilterSource(StaticIssuers{issuerA.Cert, issuerB.Cert}, FilterConfig{}, source, metrics.NoopRegisterer, blog.NewMock(), clk)
+	test.AssertNotError(t, err, "creating filter")
+
+	// Two responses from issuer A, served 15 and 45 minutes after signing.
+	source.resp = signedResponse(t, issuerA, 1, clk.Now())
+	clk.Add(15 * time.Minute)
+	_, err = f.Response(context.Background(), requestFor(t, issuerA, 1))
+	test.AssertNotError(t, err, "serving response from issuer A")
+	clk.Add(30 * time.Minute)
+	_, err = f.Response(context.Background(), requestFor(t, issuerA, 1))
+	test.AssertNotError(t, err, "serving response from issuer A")
+
+	// One from issuer B, served as soon as it's signed.
+	source.resp = signedResponse(t, issuerB, 2, clk.Now())
+	_, err = f.Response(context.Background(), requestFor(t, issuerB, 2))
+	test.AssertNotError(t, err, "serving response from issuer B")
+
+	// Refused responses aren't observed.
+	clk.Add(2 * time.Hour)
+	_, err = f.Response(context.Background(), requestFor(t, issuerB, 2))
+	test.AssertError(t, err, "served expired response")
+
+	test.AssertMetricWithLabelsEquals(t, f.remainingValidity, prometheus.Labels{"issuer": "issuer A"}, 2)
+	test.AssertMetricWithLabelsEquals(t, f.remainingValidity, prometheus.Labels{"issuer": "issuer B"}, 1)
+
+	sampleSum := func(issuer string) float64 {
+		var m io_prometheus_client.Metric
+		err := f.remainingValidity.WithLabelValues(issuer).(prometheus.Metric).Write(&m)
+		test.AssertNotError(t, err, "reading histogram")
+		return m.Histogram.GetSampleSum()
+	}
+	test.AssertEquals(t, sampleSum("issuer A"), (45*time.Minute).Seconds()+(15*time.Minute).Seconds())
+	test.AssertEquals(t, sampleSum("issuer B"), time.Hour.Seconds())
+}
+
+func TestLatencyByPrefix(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	clk := clock.NewFake()
+	source := &echoSource{}
+	// Serials are formatted as 36 hex digits, so these match serials 0x1000
+	// to 0x1fff and 0x2000 to 0x2fff respectively.
+	prefixA := strings.Repeat("0", 32) + "1"
+	prefixB := strings.Repeat("0", 32) + "2"
+	f, err := NewFilterSource(StaticIssuers{issuer.Cert}, FilterConfig{SerialPrefixes: []string{prefixA, prefixB}}, source, metrics.NoopRegisterer, blog.NewMock(), clk)
+	test.AssertNotError(t, err, "creating filter")
+
+	// serve looks up a response as the Responder would, then finishes the
+	// request as if handling it had taken took in total.
+	serve := func(serial int64, took time.Duration) {
+		t.Helper()
+		source.resp = signedResponse(t, issuer, serial, clk.Now())
+		ctx, behaviors := WithBehaviors(context.Background())
+		_, err := f.Response(ctx, requestFor(t, issuer, serial))
+		test.AssertNotError(t, err, "serving response")
+		behaviors.finish(took)
+	}
+	serve(0x1001, 100*time.Millisecond)
+	serve(0x1002, 300*time.Millisecond)
+	serve(0x2001, 2*time.Second)
+
+	// Requests refused for their prefix aren't observed at all.
+	ctx, behaviors := WithBehaviors(context.Background())
+	_, err = f.Response(ctx, requestFor(t, issuer, 0x3001))
+	test.AssertErrorIs(t, err, ErrWrongPrefix)
+	behaviors.finish(time.Second)
+
+	// Nor are lookups made outside of a request.
+	source.resp = signedResponse(t, issuer, 0x1003, clk.Now())
+	_, err = f.Response(context.Background(), requestFor(t, issuer, 0x1003))
+	test.AssertNotError(t, err, "serving response")
+
+	test.AssertMetricWithLabelsEquals(t, f.prefixLatency, prometheus.Labels{"prefix": prefixA}, 2)
+	test.AssertMetricWithLabelsEquals(t, f.prefixLatency, prometheus.Labels{"prefix": prefixB}, 1)
+
+	sampleSum := func(prefix string) float64 {
+		var m io_prometheus_client.Metric
+		err := f.prefixLatency.WithLabelValues(prefix).(prometheus.Metric).Write(&m)
+		test.AssertNotError(t, err, "reading histogram")
+		return m.Histogram.GetSampleSum()
+	}
+	test.AssertEquals(t, sampleSum(prefixA), (400 * time.Millisecond).Seconds())
+	test.AssertEquals(t, sampleSum(prefixB), (2 * time.Second).Seconds())
+}
+
+func TestReportDeprecatedSignatures(t *testing.T) {
+	issuer := makeNamedTestIssuer(t, "deprecated test CA")
+	clk := clock.NewFake()
+	signedWith := func(alg x509.SignatureAlgorithm) *Response {
+		t.Helper()
+		cert := issuer.Cert.Certificate
+		der, err := ocsp.CreateResponse(cert, cert, ocsp.Response{
+			Status:             ocsp.Good,
+			SerialNumber:       big.NewInt(1),
+			ThisUpdate:         clk.Now(),
+			NextUpdate:         clk.Now().Add(time.Hour),
+			SignatureAlgorithm: alg,
+		}, issuer.Signer)
+		test.AssertNotError(t, err, "signing response")
+		resp, err := ocsp.ParseResponse(der, nil)
+		test.AssertNotError(t, err, "parsing response")
+		test.AssertEquals(t, resp.SignatureAlgorithm, alg)
+		return &Response{resp, der}
+	}
+	sha1Resp := signedWith(x509.ECDSAWithSHA1)
+	sha256Resp := signedWith(x509.ECDSAWithSHA256)
+
+	for _, report := range []bool{true, false} {
+		t.Run(fmt.Sprintf("report %t", report), func(t *testing.T) {
+			source := &echoSource{}
+			logger := blog.NewMock()
+			f, err := NewFilterSource(StaticIssuers{issuer.Cert}, FilterConfig{ReportDeprecatedSignatures: report}, source, metrics.NoopRegisterer, logger, clk)
+			test.AssertNotError(t, err, "creating filter")
+
+			// Deprecated signatures are reported, but still served.
+			for range 2 {
+				source.resp = sha1Resp
+				_, err = f.Response(context.Background(), requestFor(t, issuer, 1))
+				test.AssertNotError(t, err, "serving SHA-1 signed response")
+			}
+			source.resp = sha256Resp
+			_, err = f.Response(context.Background(), requestFor(t, issuer, 1))
+			test.AssertNotError(t, err, "serving SHA-256 signed response")
+
+			want, wantLogs := 0, 0
+			if report {
+				want, wantLogs = 2, 1
+			}
+			test.AssertMetricWithLabelsEquals(t, f.deprecatedSigs, prometheus.Labels{"issuer": "deprecated test CA", "algorithm": "ECDSA-SHA1"}, float64(want))
+			test.AssertMetricWithLabelsEquals(t, f.deprecatedSigs, prometheus.Labels{"issuer": "deprecated test CA", "algorithm": "ECDSA-SHA256"}, 0)
+			test.AssertEquals(t, len(logger.GetAllMatching(`deprecated algorithm ECDSA-SHA1: issuer "deprecated test CA"`)), wantLogs)
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package responder
+
+import (
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MemoryLimitConfig configures shedding of requests as the process's memory
+// usage approaches the Go runtime's soft memory limit, so that the responder
+// answers tryLater rather than being killed for running out of memory. The
+// zero value disables shedding.
+type MemoryLimitConfig struct {
+	// Limit, if non-zero, is the soft memory limit in bytes which the
+	// responder sets with runtime/debug.SetMemoryLimit at startup, overriding
+	// GOMEMLIMIT.
+	Limit int64 `validate:"min=0"`
+
+	// ShedFraction is the fraction of the memory limit above which new
+	// requests are shed, such as 0.9. The memory limit is the one set by
+	// GOMEMLIMIT or runtime/debug.SetMemoryLimit, and there must be one.
+	ShedFraction float64 `validate:"min=0,max=1"`
+}
+
+// InFlightBytes accounts for the total size of the responses currently being
+// written, across all requests, and refuses to let it exceed a ceiling. When
+// the ceiling is reached, new requests are shed with a tryLater response
+// rather than risk running out of memory. It can also shed new requests while
+// the process's memory usage is near its limit. A nil *InFlightBytes accounts
+// for nothing and sheds nothing.
+type InFlightBytes struct {
+	max   int64
+	gauge prometheus.Gauge
+	shed  prometheus.Counter
+
+	// memoryThreshold is the memory usage, as returned by memoryUsage, above
+	// which requests are shed. If zero, memory usage isn't checked.
+	memoryThreshold uint64
+	memoryUsage     func() uint64
+	memoryShed      prometheus.Counter
+
+	mu    sync.Mutex
+	bytes int64
+}
+
+// NewInFlightBytes returns an InFlightBytes with a ceiling of max bytes, or
+// no ceiling if max is zero, which sheds requests under memory pressure as
+// configured by memory. It returns nil if neither is enabled.
+func NewInFlightBytes(max int64, memory MemoryLimitConfig, stats prometheus.Registerer) *InFlightBytes {
+	if max == 0 && memory.ShedFraction == 0 {
+		return nil
+	}
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ocsp_inflight_response_bytes",
+		Help: "Total size of the OCSP responses currently being written",
+	})
+	stats.MustRegister(gauge)
+	shed := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ocsp_inflight_bytes_shed",
+		Help: "Count of requests shed because the in-flight response bytes ceiling was reached",
+	})
+	stats.MustRegister(shed)
+	memoryShed := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ocsp_memory_pressure_shed",
+		Help: "Count of requests shed because memory usage was near the memory limit",
+	})
+	stats.MustRegister(memoryShed)
+
+	ifb := &InFlightBytes{
+		max:         max,
+		gauge:       gauge,
+		shed:        shed,
+		memoryUsage: readMemoryUsage,
+		memoryShed:  memoryShed,
+	}
+	if memory.ShedFraction > 0 {
+		ifb.memoryThreshold = uint64(float64(memoryLimit()) * memory.ShedFraction)
+	}
+	return ifb
+}
+
+// memoryLimit returns the Go runtime's soft memory limit, which is
+// math.MaxInt64 if none has been set.
+func memoryLimit() int64 {
+	// A negative input reads the limit without changing it.
+	return debug.SetMemoryLimit(-1)
+}
+
+// readMemoryUsage returns the memory mapped by the Go runtime and not
+// released back to the OS, which is what the runtime compares with its memory
+// limit.
+func readMemoryUsage() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// underMemoryPressure returns true, and counts a shed request, if memory
+// usage is above the configured fraction of the memory limit. Like full, it's
+// checked before the lookup.
+func (ifb *InFlightBytes) underMemoryPressure() bool {
+	if ifb == nil || ifb.memoryThreshold == 0 {
+		return false
+	}
+	if ifb.memoryUsage() < ifb.memoryThreshold {
+		return false
+	}
+	ifb.memoryShed.Inc()
+	return true
+}
+
+// full returns true, and counts a shed request, if the ceiling has been
+// reached. It's checked before the lookup, so that no work is done for
+// requests which would be shed anyway.
+func (ifb *InFlightBytes) full() bool {
+	if ifb == nil || ifb.max == 0 {
+		return false
+	}
+	ifb.mu.Lock()
+	defer ifb.mu.Unlock()
+	if ifb.bytes < ifb.max {
+		return false
+	}
+	ifb.shed.Inc()
+	return true
+}
+
+// reserve accounts for a response of n bytes, returning false, and counting a
+// shed request, if that would exceed the ceiling. Every successful reserve
+// must be followed by a release of the same n.
+func (ifb *InFlightBytes) reserve(n int) bool {
+	if ifb == nil {
+		return true
+	}
+	ifb.mu.Lock()
+	defer ifb.mu.Unlock()
+	if ifb.max != 0 && ifb.bytes+int64(n) > ifb.max {
+		ifb.shed.Inc()
+		return false
+	}
+	ifb.bytes += int64(n)
+	ifb.gauge.Set(float64(ifb.bytes))
+	return true
+}
+
+// release ends the accounting for a response of n bytes.
+func (ifb *InFlightBytes) release(n int) {
+	if ifb == nil {
+		return
+	}
+	ifb.mu.Lock()
+	defer ifb.mu.Unlock()
+	ifb.bytes -= int64(n)
+	ifb.gauge.Set(float64(ifb.bytes))
+}
@@ -0,0 +1,124 @@
+package responder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime/debug"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// blockingWriter is an http.ResponseWriter whose body writes signal started
+// and then block until release is closed, holding the response in flight.
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	started chan struct{}
+	release chan struct{}
+}
+
+func (bw *blockingWriter) Write(b []byte) (int, error) {
+	close(bw.started)
+	<-bw.release
+	return bw.ResponseRecorder.Write(b)
+}
+
+func TestInFlightBytes(t *testing.T) {
+	resp, err := testSource{}.Response(context.Background(), nil)
+	test.AssertNotError(t, err, "getting test response")
+	size := int64(len(resp.Raw))
+
+	// There's room for exactly one response at a time.
+	inFlight := NewInFlightBytes(size, MemoryLimitConfig{}, metrics.NoopRegisterer)
+	rs := NewResponder(testSource{}, Options{InFlight: inFlight, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+	serve := func(w http.ResponseWriter) {
+		r := httptest.NewRequest("GET", "/MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", nil)
+		rs.ServeHTTP(w, r)
+	}
+
+	blocked := &blockingWriter{httptest.NewRecorder(), make(chan struct{}), make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		serve(blocked)
+		close(done)
+	}()
+	<-blocked.started
+	test.AssertEquals(t, inFlight.bytes, size)
+
+	// While the first response is being written, the ceiling is reached and
+	// further requests are shed.
+	for range 3 {
+		w := httptest.NewRecorder()
+		serve(w)
+		test.AssertEquals(t, w.Code, http.StatusServiceUnavailable)
+		test.AssertByteEquals(t, w.Body.Bytes(), ocsp.TryLaterErrorResponse)
+	}
+	test.AssertMetricWithLabelsEquals(t, inFlight.shed, prometheus.Labels{}, 3)
+	test.AssertMetricWithLabelsEquals(t, rs.responseTypes, prometheus.Labels{"type": "TryLater"}, 3)
+
+	// Once it's written, the bytes are released and requests are served again.
+	close(blocked.release)
+	<-done
+	test.AssertEquals(t, blocked.Code, http.StatusOK)
+	test.AssertEquals(t, inFlight.bytes, int64(0))
+	w := httptest.NewRecorder()
+	serve(w)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, inFlight.bytes, int64(0))
+
+	// A response larger than the ceiling is never served.
+	inFlight = NewInFlightBytes(size-1, MemoryLimitConfig{}, metrics.NoopRegisterer)
+	rs = NewResponder(testSource{}, Options{InFlight: inFlight, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+	w = httptest.NewRecorder()
+	serve(w)
+	test.AssertEquals(t, w.Code, http.StatusServiceUnavailable)
+	test.AssertEquals(t, inFlight.bytes, int64(0))
+	test.AssertMetricWithLabelsEquals(t, inFlight.shed, prometheus.Labels{}, 1)
+
+	// A nil InFlightBytes, as returned when disabled, sheds nothing.
+	test.Assert(t, NewInFlightBytes(0, MemoryLimitConfig{}, metrics.NoopRegisterer) == nil, "expected disabled InFlightBytes to be nil")
+}
+
+func TestInFlightBytesMemoryPressure(t *testing.T) {
+	// The limit is far above any real usage, so that setting it doesn't
+	// affect the garbage collector.
+	const limit = 1000 << 30
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(limit))
+
+	// Without a byte ceiling, memory pressure alone enables shedding.
+	inFlight := NewInFlightBytes(0, MemoryLimitConfig{ShedFraction: 0.9}, metrics.NoopRegisterer)
+	test.AssertEquals(t, inFlight.memoryThreshold, uint64(limit*0.9))
+	var usage uint64
+	inFlight.memoryUsage = func() uint64 { return usage }
+	rs := NewResponder(testSource{}, Options{InFlight: inFlight, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+	serve := func() int {
+		w := httptest.NewRecorder()
+		rs.ServeHTTP(w, httptest.NewRequest("GET", "/MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", nil))
+		return w.Code
+	}
+
+	// Well below the limit, requests are served.
+	usage = limit / 2
+	test.AssertEquals(t, serve(), http.StatusOK)
+
+	// Near the limit, they're shed.
+	usage = limit * 0.95
+	test.AssertEquals(t, serve(), http.StatusServiceUnavailable)
+	test.AssertEquals(t, serve(), http.StatusServiceUnavailable)
+	test.AssertMetricWithLabelsEquals(t, inFlight.memoryShed, prometheus.Labels{}, 2)
+	test.AssertMetricWithLabelsEquals(t, inFlight.shed, prometheus.Labels{}, 0)
+
+	// Once the pressure eases, they're served again.
+	usage = limit * 0.8
+	test.AssertEquals(t, serve(), http.StatusOK)
+	test.AssertMetricWithLabelsEquals(t, inFlight.memoryShed, prometheus.Labels{}, 2)
+
+	// The real memory usage is non-zero.
+	test.Assert(t, readMemoryUsage() > 0, "expected non-zero memory usage")
+}
@@ -1,13 +1,21 @@
 package responder
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"os"
 	"regexp"
+	"time"
 
-	blog "github.com/letsencrypt/boulder/log"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/crypto/ocsp"
+
+	blog "github.com/letsencrypt/boulder/log"
 )
 
 // inMemorySource wraps a map from serialNumber to Response and just looks up
@@ -27,32 +35,49 @@ func NewMemorySource(responses map[string]*Response, logger blog.Logger) (*inMem
 }
 
 // NewMemorySourceFromFile reads the named file into an InMemorySource.
-// The file read by this function must contain whitespace-separated OCSP
-// responses. Each OCSP response must be in base64-encoded DER form (i.e.,
-// PEM without headers or whitespace).  Invalid responses are ignored.
-// This function pulls the entire file into an InMemorySource.
-func NewMemorySourceFromFile(responseFile string, logger blog.Logger) (*inMemorySource, error) {
+// The file read by this function must contain OCSP responses in one of the
+// following formats, which is detected automatically:
+//   - whitespace-separated base64-encoded DER (i.e., PEM without headers or
+//     whitespace), as produced by ceremony;
+//   - PEM blocks of type "OCSP RESPONSE"; or
+//   - a JSON array of base64-encoded DER strings.
+//
+// Invalid responses are ignored. This function pulls the entire file into an
+// InMemorySource. The file's modification time and the newest thisUpdate of
+// its responses are recorded as gauges, labeled by file, so that a stale file
+// can be alerted on.
+func NewMemorySourceFromFile(responseFile string, stats prometheus.Registerer, logger blog.Logger) (*inMemorySource, error) {
 	fileContents, err := os.ReadFile(responseFile)
 	if err != nil {
 		return nil, err
 	}
+	info, err := os.Stat(responseFile)
+	if err != nil {
+		return nil, err
+	}
 
-	responsesB64 := regexp.MustCompile(`\s`).Split(string(fileContents), -1)
-	responses := make(map[string]*Response, len(responsesB64))
-	for _, b64 := range responsesB64 {
-		// if the line/space is empty just skip
-		if b64 == "" {
-			continue
-		}
-		der, tmpErr := base64.StdEncoding.DecodeString(b64)
-		if tmpErr != nil {
-			logger.Errf("Base64 decode error %s on: %s", tmpErr, b64)
-			continue
+	var ders [][]byte
+	trimmed := bytes.TrimSpace(fileContents)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN")):
+		ders = pemResponses(trimmed, logger)
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var responsesB64 []string
+		err = json.Unmarshal(trimmed, &responsesB64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing JSON response file: %w", err)
 		}
+		ders = base64Responses(responsesB64, logger)
+	default:
+		ders = base64Responses(regexp.MustCompile(`\s`).Split(string(fileContents), -1), logger)
+	}
 
+	responses := make(map[string]*Response, len(ders))
+	var newestThisUpdate time.Time
+	for _, der := range ders {
 		response, tmpErr := ocsp.ParseResponse(der, nil)
 		if tmpErr != nil {
-			logger.Errf("OCSP decode error %s on: %s", tmpErr, b64)
+			logger.Errf("OCSP decode error %s on: %s", tmpErr, base64.StdEncoding.EncodeToString(der))
 			continue
 		}
 
@@ -60,19 +85,92 @@ func NewMemorySourceFromFile(responseFile string, logger blog.Logger) (*inMemory
 			Response: response,
 			Raw:      der,
 		}
+		if response.ThisUpdate.After(newestThisUpdate) {
+			newestThisUpdate = response.ThisUpdate
+		}
+	}
+
+	modified, err := registerFileGauge(stats, "ocsp_static_file_modified_seconds",
+		"Modification time of the static OCSP response file, expressed as Unix epoch time")
+	if err != nil {
+		return nil, err
+	}
+	modified.WithLabelValues(responseFile).Set(float64(info.ModTime().Unix()))
+	newest, err := registerFileGauge(stats, "ocsp_static_file_newest_thisupdate_seconds",
+		"Newest thisUpdate of the responses in the static OCSP response file, expressed as Unix epoch time")
+	if err != nil {
+		return nil, err
 	}
+	newest.WithLabelValues(responseFile).Set(float64(newestThisUpdate.Unix()))
 
 	logger.Infof("Read %d OCSP responses", len(responses))
 	return NewMemorySource(responses, logger)
 }
 
+// registerFileGauge registers a gauge labeled by file with stats, or returns
+// the existing one if several files are loaded.
+func registerFileGauge(stats prometheus.Registerer, name, help string) (*prometheus.GaugeVec, error) {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: name,
+		Help: help,
+	}, []string{"file"})
+	err := stats.Register(gauge)
+	if err != nil {
+		are := prometheus.AlreadyRegisteredError{}
+		if errors.As(err, &are) {
+			return are.ExistingCollector.(*prometheus.GaugeVec), nil
+		}
+		return nil, err
+	}
+	return gauge, nil
+}
+
+// base64Responses decodes each of the given base64-encoded responses,
+// skipping empty and invalid entries.
+func base64Responses(responsesB64 []string, logger blog.Logger) [][]byte {
+	var ders [][]byte
+	for _, b64 := range responsesB64 {
+		// if the line/space is empty just skip
+		if b64 == "" {
+			continue
+		}
+		der, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			logger.Errf("Base64 decode error %s on: %s", err, b64)
+			continue
+		}
+		ders = append(ders, der)
+	}
+	return ders
+}
+
+// pemResponses returns the contents of each "OCSP RESPONSE" PEM block in
+// data, skipping blocks of any other type.
+func pemResponses(data []byte, logger blog.Logger) [][]byte {
+	var ders [][]byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "OCSP RESPONSE" {
+			logger.Errf("Skipping PEM block of unexpected type %q", block.Type)
+			continue
+		}
+		ders = append(ders, block.Bytes)
+	}
+	return ders
+}
+
 // Response looks up an OCSP response to provide for a given request.
 // InMemorySource looks up a response purely based on serial number,
 // without regard to what issuer the request is asking for.
-func (src inMemorySource) Response(_ context.Context, request *ocsp.Request) (*Response, error) {
+func (src inMemorySource) Response(ctx context.Context, request *ocsp.Request) (*Response, error) {
 	response, present := src.responses[request.SerialNumber.String()]
 	if !present {
 		return nil, ErrNotFound
 	}
+	NoteSource(ctx, "memory")
 	return response, nil
 }
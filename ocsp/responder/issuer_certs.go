@@ -0,0 +1,167 @@
+package responder
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/letsencrypt/boulder/issuance"
+	blog "github.com/letsencrypt/boulder/log"
+)
+
+// defaultMaxIssuers is the number of issuer certificates loaded if no maximum
+// is configured. It's far more than any real deployment needs, but small
+// enough that a runaway glob fails fast rather than exhausting memory.
+const defaultMaxIssuers = 1000
+
+// oidSignedData is the PKCS#7 content type used by certs-only (.p7b) bundles.
+var oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+// pkcs7ContentInfo is the outer ContentInfo structure of a PKCS#7 message, as
+// defined in RFC 2315, Section 7.
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// pkcs7SignedData is the SignedData structure defined in RFC 2315, Section 9.1.
+// We only care about the certificates, so everything else is left unparsed.
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// LoadIssuerCertificates loads the issuer certificates named by paths. Each
+// path may contain either a single PEM-encoded certificate, or a PKCS#7 bundle
+// (PEM or DER encoded) in which case every certificate in the bundle is
+// returned. If allowPartial is true, files which fail to load are audit logged
+// and skipped, so long as at least one issuer certificate loads successfully.
+// The number of skipped files is exported as a gauge. Loading fails once more
+// than maxIssuers certificates have been loaded; if maxIssuers is zero, a
+// default of 1000 is used.
+func LoadIssuerCertificates(paths []string, allowPartial bool, maxIssuers int, stats prometheus.Registerer, log blog.Logger) ([]*issuance.Certificate, error) {
+	skippedGauge := newSkippedIssuersGauge(stats)
+	issuerCerts, skipped, err := loadIssuerCertificates(paths, allowPartial, maxIssuers, log)
+	if err != nil {
+		return nil, err
+	}
+	skippedGauge.Set(float64(skipped))
+	return issuerCerts, nil
+}
+
+// newSkippedIssuersGauge registers and returns the gauge counting skipped
+// issuer certificate files.
+func newSkippedIssuersGauge(stats prometheus.Registerer) prometheus.Gauge {
+	skippedGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ocsp_skipped_issuer_certs",
+		Help: "Number of configured issuer certificate files which failed to load and were skipped",
+	})
+	stats.MustRegister(skippedGauge)
+	return skippedGauge
+}
+
+// loadIssuerCertificates implements LoadIssuerCertificates, additionally
+// returning the number of files skipped.
+func loadIssuerCertificates(paths []string, allowPartial bool, maxIssuers int, log blog.Logger) ([]*issuance.Certificate, int, error) {
+	if maxIssuers == 0 {
+		maxIssuers = defaultMaxIssuers
+	}
+	var issuerCerts []*issuance.Certificate
+	var skipped int
+	for i, path := range paths {
+		certs, err := loadIssuerFile(path)
+		if err != nil {
+			if !allowPartial {
+				return nil, 0, err
+			}
+			log.AuditErrf("Skipping issuer certificate file %q: %s", path, err)
+			skipped++
+			continue
+		}
+		issuerCerts = append(issuerCerts, certs...)
+		if len(issuerCerts) > maxIssuers {
+			return nil, 0, fmt.Errorf("loaded more than the maximum of %d issuer certificates, from %d of %d files; check the configured paths or raise the maximum", maxIssuers, i+1, len(paths))
+		}
+	}
+	if len(issuerCerts) == 0 {
+		return nil, 0, fmt.Errorf("no issuer certificates could be loaded: %w", errNoIssuers)
+	}
+	return issuerCerts, skipped, nil
+}
+
+// loadIssuerFile returns all of the issuer certificates contained in the file
+// at path, which may be a PEM certificate or a PKCS#7 bundle.
+func loadIssuerFile(path string) ([]*issuance.Certificate, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading issuer certificate file: %w", err)
+	}
+
+	der := contents
+	block, _ := pem.Decode(contents)
+	if block != nil {
+		if block.Type != "PKCS7" {
+			ic, err := issuance.LoadCertificate(path)
+			if err != nil {
+				return nil, err
+			}
+			return []*issuance.Certificate{ic}, nil
+		}
+		der = block.Bytes
+	}
+
+	certs, err := parsePKCS7Certificates(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing PKCS#7 bundle %q: %w", path, err)
+	}
+
+	issuerCerts := make([]*issuance.Certificate, 0, len(certs))
+	for _, cert := range certs {
+		ic, err := issuance.NewCertificate(cert)
+		if err != nil {
+			return nil, fmt.Errorf("loading issuer certificate %q from %q: %w", cert.Subject, path, err)
+		}
+		issuerCerts = append(issuerCerts, ic)
+	}
+	return issuerCerts, nil
+}
+
+// parsePKCS7Certificates extracts the certificates from a DER-encoded PKCS#7
+// SignedData message. Signatures, if any, are not checked.
+func parsePKCS7Certificates(der []byte) ([]*x509.Certificate, error) {
+	var ci pkcs7ContentInfo
+	rest, err := asn1.Unmarshal(der, &ci)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after PKCS#7 content")
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("unsupported PKCS#7 content type %s", ci.ContentType)
+	}
+
+	var sd pkcs7SignedData
+	_, err = asn1.Unmarshal(ci.Content.Bytes, &sd)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("bundle contains no certificates")
+	}
+	return certs, nil
+}
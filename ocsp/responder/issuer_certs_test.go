@@ -0,0 +1,86 @@
+package responder
+
+import (
+	"testing"
+
+	"github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/issuance"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestLoadIssuerCertificates(t *testing.T) {
+	pemIssuer, err := issuance.LoadCertificate("./testdata/test-ca.der.pem")
+	test.AssertNotError(t, err, "failed to load issuer cert")
+
+	certs, err := LoadIssuerCertificates([]string{"./testdata/test-ca.der.pem"}, false, 0, metrics.NoopRegisterer, blog.NewMock())
+	test.AssertNotError(t, err, "loading single PEM cert")
+	test.AssertEquals(t, len(certs), 1)
+	test.AssertEquals(t, certs[0].NameID(), pemIssuer.NameID())
+
+	for _, bundle := range []string{"./testdata/issuers.p7b", "./testdata/issuers.p7b.der"} {
+		certs, err = LoadIssuerCertificates([]string{bundle}, false, 0, metrics.NoopRegisterer, blog.NewMock())
+		test.AssertNotError(t, err, "loading PKCS#7 bundle")
+		test.AssertEquals(t, len(certs), 3)
+
+		f, err := NewFilterSource(StaticIssuers(certs), FilterConfig{}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+		test.AssertNotError(t, err, "creating filter from bundle")
+		test.AssertEquals(t, len(f.issuers), 3)
+		for i, cert := range certs {
+			test.AssertEquals(t, f.issuers[i].nameID, cert.NameID())
+		}
+	}
+
+	// A bundle and an individual PEM path can be mixed.
+	certs, err = LoadIssuerCertificates([]string{"./testdata/issuers.p7b", "./testdata/test-ca.der.pem"}, false, 0, metrics.NoopRegisterer, blog.NewMock())
+	test.AssertNotError(t, err, "loading bundle and PEM cert")
+	test.AssertEquals(t, len(certs), 4)
+
+	_, err = LoadIssuerCertificates([]string{"./testdata/ocsp.resp"}, false, 0, metrics.NoopRegisterer, blog.NewMock())
+	test.AssertError(t, err, "loaded issuer certs from an OCSP response")
+
+	_, err = LoadIssuerCertificates([]string{"./testdata/nonexistent.p7b"}, false, 0, metrics.NoopRegisterer, blog.NewMock())
+	test.AssertError(t, err, "loaded issuer certs from nonexistent file")
+}
+
+func TestLoadIssuerCertificatesPartial(t *testing.T) {
+	paths := []string{"./testdata/nonexistent.pem", "./testdata/test-ca.der.pem"}
+
+	// By default, one bad issuer cert prevents loading.
+	_, _, err := loadIssuerCertificates(paths, false, 0, blog.NewMock())
+	test.AssertError(t, err, "loaded issuer certs despite an unreadable file")
+
+	// With partial loading allowed, the bad cert is skipped and audit logged.
+	log := blog.NewMock()
+	certs, skipped, err := loadIssuerCertificates(paths, true, 0, log)
+	test.AssertNotError(t, err, "loading issuer certs with partial loading allowed")
+	test.AssertEquals(t, len(certs), 1)
+	test.AssertEquals(t, skipped, 1)
+	test.AssertEquals(t, len(log.GetAllMatching(`\[AUDIT\] Skipping issuer certificate file "./testdata/nonexistent.pem"`)), 1)
+
+	// At least one issuer must still load.
+	_, _, err = loadIssuerCertificates([]string{"./testdata/nonexistent.pem"}, true, 0, blog.NewMock())
+	test.AssertError(t, err, "loaded issuer certs when none were readable")
+}
+
+func TestLoadIssuerCertificatesMax(t *testing.T) {
+	paths := []string{"./testdata/test-ca.der.pem", "./testdata/issuers.p7b"}
+
+	certs, _, err := loadIssuerCertificates(paths, false, 4, blog.NewMock())
+	test.AssertNotError(t, err, "loading issuer certs at the maximum")
+	test.AssertEquals(t, len(certs), 4)
+
+	_, _, err = loadIssuerCertificates(paths, false, 3, blog.NewMock())
+	test.AssertError(t, err, "loaded more issuer certs than the maximum")
+	test.AssertContains(t, err.Error(), "maximum of 3 issuer certificates")
+
+	// The default is applied when no maximum is configured.
+	many := make([]string, defaultMaxIssuers+1)
+	for i := range many {
+		many[i] = "./testdata/test-ca.der.pem"
+	}
+	_, _, err = loadIssuerCertificates(many, false, 0, blog.NewMock())
+	test.AssertError(t, err, "loaded more issuer certs than the default maximum")
+}
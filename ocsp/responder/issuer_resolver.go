@@ -0,0 +1,103 @@
+package responder
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/letsencrypt/boulder/issuance"
+	blog "github.com/letsencrypt/boulder/log"
+)
+
+// ResolvedIssuer is an issuer certificate along with the SHA-1 hashes of its
+// name and key, by which OCSP requests identify it.
+type ResolvedIssuer struct {
+	Cert     *issuance.Certificate
+	NameHash []byte
+	KeyHash  []byte
+}
+
+// NewResolvedIssuer computes the hashes identifying ic in OCSP requests, as
+// specified by RFC 5019.
+func NewResolvedIssuer(ic *issuance.Certificate) (ResolvedIssuer, error) {
+	rid, err := computeLightweightResponderID(ic)
+	if err != nil {
+		return ResolvedIssuer{}, fmt.Errorf("computing lightweight OCSP responder ID: %w", err)
+	}
+	return ResolvedIssuer{Cert: ic, NameHash: rid.nameHash, KeyHash: rid.keyHash}, nil
+}
+
+// errNoIssuers indicates that no issuers at all could be resolved.
+var errNoIssuers = errors.New("no issuers")
+
+// IssuerResolver provides the set of issuers for which the filterSource
+// answers requests. The default, FileIssuerResolver, loads them from local
+// files; other implementations may fetch them from elsewhere, such as a
+// central service.
+type IssuerResolver interface {
+	Issuers() ([]ResolvedIssuer, error)
+}
+
+// StaticIssuers is an IssuerResolver which resolves a fixed set of issuer
+// certificates.
+type StaticIssuers []*issuance.Certificate
+
+// Issuers implements IssuerResolver.
+func (si StaticIssuers) Issuers() ([]ResolvedIssuer, error) {
+	issuers := make([]ResolvedIssuer, 0, len(si))
+	for _, ic := range si {
+		issuer, err := NewResolvedIssuer(ic)
+		if err != nil {
+			return nil, err
+		}
+		issuers = append(issuers, issuer)
+	}
+	return issuers, nil
+}
+
+// FileIssuerResolver is an IssuerResolver which loads issuer certificates
+// from files, as described by LoadIssuerCertificates.
+type FileIssuerResolver struct {
+	paths        []string
+	allowPartial bool
+	maxIssuers   int
+	skipped      prometheus.Gauge
+	log          blog.Logger
+}
+
+// NewFileIssuerResolver returns a FileIssuerResolver for the given paths. The
+// remaining arguments are as for LoadIssuerCertificates.
+func NewFileIssuerResolver(paths []string, allowPartial bool, maxIssuers int, stats prometheus.Registerer, log blog.Logger) *FileIssuerResolver {
+	return &FileIssuerResolver{
+		paths:        paths,
+		allowPartial: allowPartial,
+		maxIssuers:   maxIssuers,
+		skipped:      newSkippedIssuersGauge(stats),
+		log:          log,
+	}
+}
+
+// Issuers implements IssuerResolver. The files are read again on each call,
+// so it can be used to reload the issuers.
+func (fr *FileIssuerResolver) Issuers() ([]ResolvedIssuer, error) {
+	certs, skipped, err := loadIssuerCertificates(fr.paths, fr.allowPartial, fr.maxIssuers, fr.log)
+	if err != nil {
+		return nil, err
+	}
+	fr.skipped.Set(float64(skipped))
+	return StaticIssuers(certs).Issuers()
+}
+
+// checkResolvedIssuer returns an error if issuer's hashes aren't the length
+// of a SHA-1 hash, as a resolver other than our own might supply them.
+func checkResolvedIssuer(issuer ResolvedIssuer) error {
+	if issuer.Cert == nil {
+		return fmt.Errorf("resolved issuer has no certificate")
+	}
+	if len(issuer.NameHash) != sha1.Size || len(issuer.KeyHash) != sha1.Size {
+		return fmt.Errorf("resolved issuer %q has hashes of %d and %d bytes, want %d", issuer.Cert.Subject.CommonName, len(issuer.NameHash), len(issuer.KeyHash), sha1.Size)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package responder
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/issuance"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// fakeResolver is an IssuerResolver returning fixed issuers, or an error.
+type fakeResolver struct {
+	issuers []ResolvedIssuer
+	err     error
+	calls   int
+}
+
+func (fr *fakeResolver) Issuers() ([]ResolvedIssuer, error) {
+	fr.calls++
+	return fr.issuers, fr.err
+}
+
+func TestFilterIssuerResolver(t *testing.T) {
+	issuer, err := issuance.LoadCertificate("./testdata/test-ca.der.pem")
+	test.AssertNotError(t, err, "failed to load issuer cert")
+	resolved, err := NewResolvedIssuer(issuer)
+	test.AssertNotError(t, err, "resolving issuer")
+
+	resolver := &fakeResolver{issuers: []ResolvedIssuer{resolved}}
+	f, err := NewFilterSource(resolver, FilterConfig{}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.NewFake())
+	test.AssertNotError(t, err, "creating filter from resolver")
+	test.AssertEquals(t, resolver.calls, 1)
+	test.AssertEquals(t, len(f.IssuerCertificates()), 1)
+	test.AssertEquals(t, f.IssuerCertificates()[0], issuer)
+
+	// Requests carrying the resolved hashes are accepted.
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+	candidates, err := f.checkRequest(req)
+	test.AssertNotError(t, err, "checking request for resolved issuer")
+	test.AssertEquals(t, candidates[0].cert, issuer)
+
+	// The filter uses the hashes the resolver supplies, rather than
+	// recomputing them.
+	other := resolved
+	other.KeyHash = make([]byte, len(resolved.KeyHash))
+	f, err = NewFilterSource(&fakeResolver{issuers: []ResolvedIssuer{other}}, FilterConfig{}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.NewFake())
+	test.AssertNotError(t, err, "creating filter from resolver")
+	_, err = f.checkRequest(req)
+	test.AssertErrorIs(t, err, ErrWrongIssuer)
+
+	// Resolver errors and malformed issuers prevent creating the filter.
+	_, err = NewFilterSource(&fakeResolver{err: errors.New("service unavailable")}, FilterConfig{}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.NewFake())
+	test.AssertError(t, err, "created filter despite resolver error")
+	test.AssertContains(t, err.Error(), "service unavailable")
+
+	short := resolved
+	short.NameHash = short.NameHash[:4]
+	_, err = NewFilterSource(&fakeResolver{issuers: []ResolvedIssuer{short}}, FilterConfig{}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.NewFake())
+	test.AssertError(t, err, "created filter with a truncated name hash")
+
+	_, err = NewFilterSource(&fakeResolver{issuers: []ResolvedIssuer{{NameHash: resolved.NameHash, KeyHash: resolved.KeyHash}}}, FilterConfig{}, nil, metrics.NoopRegisterer, blog.NewMock(), clock.NewFake())
+	test.AssertError(t, err, "created filter with no issuer certificate")
+}
+
+func TestFileIssuerResolver(t *testing.T) {
+	resolver := NewFileIssuerResolver([]string{"./testdata/issuers.p7b", "./testdata/test-ca.der.pem"}, false, 0, metrics.NoopRegisterer, blog.NewMock())
+	issuers, err := resolver.Issuers()
+	test.AssertNotError(t, err, "resolving issuers from files")
+	test.AssertEquals(t, len(issuers), 4)
+	for _, issuer := range issuers {
+		want, err := NewResolvedIssuer(issuer.Cert)
+		test.AssertNotError(t, err, "resolving issuer")
+		test.AssertDeepEquals(t, issuer, want)
+	}
+
+	_, err = NewFileIssuerResolver([]string{"./testdata/nonexistent.pem"}, false, 0, metrics.NoopRegisterer, blog.NewMock()).Issuers()
+	test.AssertError(t, err, "resolved issuers from a nonexistent file")
+}
+
+func TestReloadIssuers(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+
+	// The issuer file is copied, so that it can be removed later.
+	contents, err := os.ReadFile("./testdata/test-ca.der.pem")
+	test.AssertNotError(t, err, "reading issuer cert")
+	issuerPath := path.Join(t.TempDir(), "issuer.pem")
+	err = os.WriteFile(issuerPath, contents, 0600)
+	test.AssertNotError(t, err, "writing issuer cert")
+
+	log := blog.NewMock()
+	resolver := NewFileIssuerResolver([]string{issuerPath}, true, 0, metrics.NoopRegisterer, log)
+	f, err := NewFilterSource(resolver, FilterConfig{}, nil, metrics.NoopRegisterer, log, clock.NewFake())
+	test.AssertNotError(t, err, "creating filter")
+	_, err = f.checkRequest(req)
+	test.AssertNotError(t, err, "checking request before reload")
+
+	// Reloading the same files is harmless.
+	old, loaded, err := f.ReloadIssuers(resolver, nil)
+	test.AssertNotError(t, err, "reloading issuers")
+	test.AssertEquals(t, len(f.IssuerCertificates()), 1)
+	test.AssertEquals(t, len(old), 1)
+	test.AssertEquals(t, len(loaded), 1)
+
+	// Reloading to different issuers replaces them.
+	other := resolveIssuerFile(t, "./testdata/test-ca.der.pem")
+	other.KeyHash = make([]byte, len(other.KeyHash))
+	_, _, err = f.ReloadIssuers(&fakeResolver{issuers: []ResolvedIssuer{other}}, nil)
+	test.AssertNotError(t, err, "reloading to other issuers")
+	_, err = f.checkRequest(req)
+	test.AssertErrorIs(t, err, ErrWrongIssuer)
+
+	// A reload refused by its check keeps the previous issuers.
+	_, _, err = f.ReloadIssuers(resolver, func([]*issuance.Certificate) error {
+		return errors.New("prefixes don't match")
+	})
+	test.AssertError(t, err, "reloaded issuers refused by check")
+	_, err = f.checkRequest(req)
+	test.AssertErrorIs(t, err, ErrWrongIssuer)
+	_, _, err = f.ReloadIssuers(resolver, nil)
+	test.AssertNotError(t, err, "reloading issuers")
+
+	// Once the file is gone, the reload resolves no issuers. By default, the
+	// previous issuers are kept, and the failed reload counted and audit
+	// logged.
+	err = os.Remove(issuerPath)
+	test.AssertNotError(t, err, "removing issuer cert")
+	old, loaded, err = f.ReloadIssuers(resolver, nil)
+	test.AssertErrorIs(t, err, errNoIssuers)
+	test.AssertMetricWithLabelsEquals(t, f.emptyReloads, prometheus.Labels{}, 1)
+	test.AssertEquals(t, len(log.GetAllMatching(`\[AUDIT\] Issuer reload failed, keeping the 1 previously loaded issuers: .*no issuer certificates could be loaded`)), 1)
+	test.AssertEquals(t, len(f.IssuerCertificates()), 1)
+	test.AssertDeepEquals(t, loaded, old)
+	_, err = f.checkRequest(req)
+	test.AssertNotError(t, err, "checking request after empty reload")
+
+	// So they are if a resolver returns no issuers without an error.
+	_, _, err = f.ReloadIssuers(&fakeResolver{}, nil)
+	test.AssertErrorIs(t, err, errNoIssuers)
+	test.AssertMetricWithLabelsEquals(t, f.emptyReloads, prometheus.Labels{}, 2)
+
+	// Other failures also keep the previous issuers, but aren't counted as
+	// empty reloads.
+	_, _, err = f.ReloadIssuers(&fakeResolver{err: errors.New("service unavailable")}, nil)
+	test.AssertError(t, err, "reloaded issuers despite resolver error")
+	test.AssertMetricWithLabelsEquals(t, f.emptyReloads, prometheus.Labels{}, 2)
+	_, err = f.checkRequest(req)
+	test.AssertNotError(t, err, "checking request after failed reload")
+}
+
+func TestReloadIssuersFailClosed(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+
+	issuer := resolveIssuerFile(t, "./testdata/test-ca.der.pem")
+	resolver := &fakeResolver{issuers: []ResolvedIssuer{issuer}}
+	log := blog.NewMock()
+	f, err := NewFilterSource(resolver, FilterConfig{ReloadPolicy: ReloadFailClosed}, nil, metrics.NoopRegisterer, log, clock.NewFake())
+	test.AssertNotError(t, err, "creating filter")
+
+	// A failed reload drops the previous issuers, so every request is
+	// refused, and is audit logged.
+	old, loaded, err := f.ReloadIssuers(&fakeResolver{err: errors.New("service unavailable")}, nil)
+	test.AssertError(t, err, "reloaded issuers despite resolver error")
+	test.AssertEquals(t, len(old), 1)
+	test.AssertEquals(t, len(loaded), 0)
+	test.AssertEquals(t, len(f.IssuerCertificates()), 0)
+	test.AssertEquals(t, len(log.GetAllMatching(`\[AUDIT\] Issuer reload failed, dropping the 1 previously loaded issuers and refusing all requests: .*service unavailable`)), 1)
+	_, err = f.checkRequest(req)
+	test.AssertErrorIs(t, err, ErrWrongIssuer)
+
+	// So does one refused by its check.
+	_, _, err = f.ReloadIssuers(resolver, nil)
+	test.AssertNotError(t, err, "reloading issuers")
+	_, _, err = f.ReloadIssuers(resolver, func([]*issuance.Certificate) error {
+		return errors.New("prefixes don't match")
+	})
+	test.AssertError(t, err, "reloaded issuers refused by check")
+	_, err = f.checkRequest(req)
+	test.AssertErrorIs(t, err, ErrWrongIssuer)
+
+	// A successful reload serves the issuers again.
+	_, _, err = f.ReloadIssuers(resolver, nil)
+	test.AssertNotError(t, err, "reloading issuers")
+	_, err = f.checkRequest(req)
+	test.AssertNotError(t, err, "checking request after reload")
+
+	_, err = NewFilterSource(resolver, FilterConfig{ReloadPolicy: "fail-sideways"}, nil, metrics.NoopRegisterer, log, clock.NewFake())
+	test.AssertError(t, err, "created filter with unknown reload policy")
+}
+
+// resolveIssuerFile returns the ResolvedIssuer for the certificate at filename.
+func resolveIssuerFile(t *testing.T, filename string) ResolvedIssuer {
+	t.Helper()
+	issuer, err := issuance.LoadCertificate(filename)
+	test.AssertNotError(t, err, "failed to load issuer cert")
+	ri, err := NewResolvedIssuer(issuer)
+	test.AssertNotError(t, err, "resolving issuer")
+	return ri
+}
@@ -53,6 +53,7 @@ func (s *Source) Response(ctx context.Context, req *ocsp.Request) (*responder.Re
 	if err != nil {
 		return nil, err
 	}
+	responder.NoteSource(ctx, "live")
 	return &responder.Response{
 		Raw:      resp.Response,
 		Response: parsed,
@@ -67,3 +67,21 @@ func TestNotFound(t *testing.T) {
 		t.Errorf("expected responder.ErrNotFound, got %#v", err)
 	}
 }
+
+// errorOCSPGenerator always returns an error other than berrors.NotFound.
+type errorOCSPGenerator struct{}
+
+func (e errorOCSPGenerator) GenerateOCSP(ctx context.Context, in *rapb.GenerateOCSPRequest, opts ...grpc.CallOption) (*capb.OCSPResponse, error) {
+	return nil, berrors.InternalServerError("backend unavailable")
+}
+
+func TestError(t *testing.T) {
+	source := New(errorOCSPGenerator{}, 1, 0)
+	_, err := source.Response(context.Background(), &ocsp.Request{
+		SerialNumber: big.NewInt(1),
+	})
+	test.AssertError(t, err, "expected error from backend")
+	if errors.Is(err, responder.ErrNotFound) {
+		t.Errorf("expected backend error to be passed through, got %#v", err)
+	}
+}
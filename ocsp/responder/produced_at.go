@@ -0,0 +1,98 @@
+package responder
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The following types mirror the structure of a successful OCSP response
+// (RFC 6960, Section 4.2.1) in just enough detail to change its producedAt
+// and re-sign it. golang.org/x/crypto/ocsp always sets producedAt to the
+// current time and offers no way to override it.
+type ocspResponseASN1 struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspTBSResponseData struct {
+	Version            int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID     asn1.RawValue
+	ProducedAt         time.Time `asn1:"generalized"`
+	Responses          []asn1.RawValue
+	ResponseExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+// ocspSignatureHashes maps the signature algorithms which
+// golang.org/x/crypto/ocsp signs responses with to their hash functions.
+var ocspSignatureHashes = map[string]crypto.Hash{
+	"1.2.840.113549.1.1.11": crypto.SHA256, // sha256WithRSAEncryption
+	"1.2.840.10045.4.3.2":   crypto.SHA256, // ecdsa-with-SHA256
+	"1.2.840.10045.4.3.3":   crypto.SHA384, // ecdsa-with-SHA384
+	"1.2.840.10045.4.3.4":   crypto.SHA512, // ecdsa-with-SHA512
+}
+
+// setProducedAt returns a copy of the DER-encoded OCSP response der with its
+// producedAt replaced and re-signed by signer, which must be the key that
+// signed der.
+func setProducedAt(der []byte, producedAt time.Time, signer crypto.Signer) ([]byte, error) {
+	var resp ocspResponseASN1
+	_, err := asn1.Unmarshal(der, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("parsing OCSP response: %w", err)
+	}
+	if len(resp.Response.Response) == 0 {
+		return nil, errors.New("OCSP response has no response bytes")
+	}
+	var basic ocspBasicResponse
+	_, err = asn1.Unmarshal(resp.Response.Response, &basic)
+	if err != nil {
+		return nil, fmt.Errorf("parsing basic OCSP response: %w", err)
+	}
+	var tbs ocspTBSResponseData
+	_, err = asn1.Unmarshal(basic.TBSResponseData.FullBytes, &tbs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing OCSP response data: %w", err)
+	}
+
+	hash, ok := ocspSignatureHashes[basic.SignatureAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported OCSP signature algorithm %s", basic.SignatureAlgorithm.Algorithm)
+	}
+
+	tbs.ProducedAt = producedAt.UTC()
+	tbsDER, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(tbsDER)
+	signature, err := signer.Sign(rand.Reader, h.Sum(nil), hash)
+	if err != nil {
+		return nil, fmt.Errorf("signing OCSP response: %w", err)
+	}
+
+	basic.TBSResponseData = asn1.RawValue{FullBytes: tbsDER}
+	basic.Signature = asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)}
+	resp.Response.Response, err = asn1.Marshal(basic)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(resp)
+}
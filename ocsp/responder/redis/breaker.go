@@ -0,0 +1,180 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/config"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/rocsp"
+)
+
+// errBreakerOpen is returned by breakerClient instead of contacting Redis
+// while the circuit breaker is open.
+var errBreakerOpen = errors.New("redis circuit breaker is open")
+
+// BreakerConfig configures a circuit breaker around the primary Redis client.
+// While the breaker is open, the primary Redis is not contacted at all and
+// responses are served from any fallback Redis, or else from the live signer.
+// The zero value disables the breaker.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive Redis errors after which
+	// the breaker opens. Zero disables the breaker.
+	FailureThreshold int `validate:"min=0"`
+
+	// MinBackoff is how long the breaker stays open after first tripping,
+	// before a single probe request is allowed through to Redis. Each
+	// consecutive failed probe grows the backoff exponentially, up to
+	// MaxBackoff. These default to 1s and 1m, respectively.
+	MinBackoff config.Duration `validate:"-"`
+	MaxBackoff config.Duration `validate:"-"`
+}
+
+// circuitBreaker counts consecutive failures of some backend. After
+// FailureThreshold of them it opens, and tells callers not to contact the
+// backend at all. Once the backoff has elapsed, a single probe request is let
+// through; if it succeeds the breaker closes, otherwise it reopens with a
+// longer backoff. A nil *circuitBreaker is always closed.
+type circuitBreaker struct {
+	threshold  int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	clk        clock.Clock
+	state      prometheus.Gauge
+
+	mu sync.Mutex
+	// failures is the number of consecutive errors seen while closed.
+	failures int
+	// trips is the number of consecutive times the breaker has opened
+	// without a successful request in between. It determines the backoff.
+	trips int
+	// openUntil is the time at which the breaker will allow a probe. If it is
+	// the zero value, the breaker is closed.
+	openUntil time.Time
+	// probing is true while a probe request is in flight.
+	probing bool
+}
+
+// newCircuitBreaker returns a circuitBreaker configured by conf, which
+// reports whether it is open through state. If conf disables the breaker, it
+// returns nil.
+func newCircuitBreaker(conf BreakerConfig, clk clock.Clock, state prometheus.Gauge) *circuitBreaker {
+	if conf.FailureThreshold == 0 {
+		return nil
+	}
+	minBackoff := conf.MinBackoff.Duration
+	if minBackoff == 0 {
+		minBackoff = time.Second
+	}
+	maxBackoff := conf.MaxBackoff.Duration
+	if maxBackoff == 0 {
+		maxBackoff = time.Minute
+	}
+
+	return &circuitBreaker{
+		threshold:  conf.FailureThreshold,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		clk:        clk,
+		state:      state,
+	}
+}
+
+// allow returns true if a request may be sent to the backend.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if b.probing || b.clk.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record updates the breaker state based on whether a request to the backend
+// failed.
+func (b *circuitBreaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.failures = 0
+		b.trips = 0
+		b.openUntil = time.Time{}
+		b.probing = false
+		b.state.Set(0)
+		return
+	}
+
+	if !b.openUntil.IsZero() && !b.probing {
+		// This request was sent before the breaker opened; its failure is
+		// already accounted for.
+		return
+	}
+
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		b.trips++
+		b.openUntil = b.clk.Now().Add(core.RetryBackoff(b.trips, b.minBackoff, b.maxBackoff, 2))
+		b.probing = false
+		b.state.Set(1)
+	}
+}
+
+// breakerClient wraps a rocspClient with a circuit breaker. While the breaker
+// is open, it fails fast with errBreakerOpen instead of contacting Redis.
+type breakerClient struct {
+	*circuitBreaker
+	client rocspClient
+}
+
+func newBreakerClient(client rocspClient, conf BreakerConfig, clk clock.Clock, stats prometheus.Registerer) *breakerClient {
+	state := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ocsp_redis_breaker_open",
+		Help: "Whether the circuit breaker around Redis is open (1) or closed (0)",
+	})
+	stats.MustRegister(state)
+
+	return &breakerClient{
+		circuitBreaker: newCircuitBreaker(conf, clk, state),
+		client:         client,
+	}
+}
+
+// record updates the breaker state based on the result of a Redis request.
+// A "not found" result means Redis is healthy, so it counts as a success.
+func (b *breakerClient) record(err error) {
+	b.circuitBreaker.record(err != nil && !errors.Is(err, rocsp.ErrRedisNotFound))
+}
+
+func (b *breakerClient) GetResponse(ctx context.Context, serial string) ([]byte, error) {
+	if !b.allow() {
+		return nil, errBreakerOpen
+	}
+	resp, err := b.client.GetResponse(ctx, serial)
+	b.record(err)
+	return resp, err
+}
+
+func (b *breakerClient) StoreResponse(ctx context.Context, resp *ocsp.Response) error {
+	if !b.allow() {
+		return errBreakerOpen
+	}
+	err := b.client.StoreResponse(ctx, resp)
+	b.record(err)
+	return err
+}
@@ -0,0 +1,126 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/config"
+	"github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	ocsp_test "github.com/letsencrypt/boulder/ocsp/test"
+	"github.com/letsencrypt/boulder/rocsp"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// flakyRedis is a mock rocspClient which returns an error for all requests
+// while down is true, and "not found" otherwise. It counts the GetResponse
+// calls that reach it.
+type flakyRedis struct {
+	down  bool
+	calls int
+}
+
+func (fr *flakyRedis) GetResponse(ctx context.Context, serial string) ([]byte, error) {
+	fr.calls++
+	if fr.down {
+		return nil, errors.New("connection refused")
+	}
+	return nil, rocsp.ErrRedisNotFound
+}
+
+func (fr *flakyRedis) StoreResponse(ctx context.Context, resp *ocsp.Response) error {
+	if fr.down {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestBreakerDownThenUp(t *testing.T) {
+	clk := clock.NewFake()
+	redis := &flakyRedis{down: true}
+	b := newBreakerClient(redis, BreakerConfig{
+		FailureThreshold: 2,
+		MinBackoff:       config.Duration{Duration: time.Second},
+		MaxBackoff:       config.Duration{Duration: time.Minute},
+	}, clk, metrics.NoopRegisterer)
+
+	// Failures below the threshold leave the breaker closed.
+	_, err := b.GetResponse(context.Background(), "serial")
+	test.AssertError(t, err, "expected error while Redis is down")
+	test.AssertMetricWithLabelsEquals(t, b.state, prometheus.Labels{}, 0)
+
+	// Reaching the threshold opens the breaker.
+	_, err = b.GetResponse(context.Background(), "serial")
+	test.AssertError(t, err, "expected error while Redis is down")
+	test.AssertMetricWithLabelsEquals(t, b.state, prometheus.Labels{}, 1)
+	test.AssertEquals(t, redis.calls, 2)
+
+	// While open, requests fail fast without reaching Redis.
+	_, err = b.GetResponse(context.Background(), "serial")
+	test.AssertErrorIs(t, err, errBreakerOpen)
+	err = b.StoreResponse(context.Background(), &ocsp.Response{})
+	test.AssertErrorIs(t, err, errBreakerOpen)
+	test.AssertEquals(t, redis.calls, 2)
+
+	// After the backoff, a probe is let through. Redis is still down, so the
+	// breaker reopens.
+	clk.Add(2 * time.Second)
+	_, err = b.GetResponse(context.Background(), "serial")
+	test.AssertError(t, err, "expected error while Redis is down")
+	test.AssertEquals(t, redis.calls, 3)
+	test.AssertMetricWithLabelsEquals(t, b.state, prometheus.Labels{}, 1)
+	_, err = b.GetResponse(context.Background(), "serial")
+	test.AssertErrorIs(t, err, errBreakerOpen)
+
+	// The second backoff (at least 1.6s, with jitter) is longer than the
+	// first could have been (at most 1.2s).
+	clk.Add(1500 * time.Millisecond)
+	b.mu.Lock()
+	stillOpen := clk.Now().Before(b.openUntil)
+	b.mu.Unlock()
+	test.Assert(t, stillOpen, "expected backoff to grow after a failed probe")
+
+	// Once Redis comes back, the next probe succeeds and closes the breaker.
+	redis.down = false
+	clk.Add(time.Minute)
+	_, err = b.GetResponse(context.Background(), "serial")
+	test.AssertErrorIs(t, err, rocsp.ErrRedisNotFound)
+	test.AssertMetricWithLabelsEquals(t, b.state, prometheus.Labels{}, 0)
+	_, err = b.GetResponse(context.Background(), "serial")
+	test.AssertErrorIs(t, err, rocsp.ErrRedisNotFound)
+	test.AssertEquals(t, redis.calls, 5)
+}
+
+func TestRedisSourceBreakerOpen(t *testing.T) {
+	serial := big.NewInt(314159)
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   time.Now().Truncate(time.Second).UTC(),
+	})
+	test.AssertNotError(t, err, "making fake response")
+
+	clk := clock.NewFake()
+	src, err := NewRedisSource(nil, echoSource{resp: resp}, RedisSourceConfig{LiveSigningPeriod: time.Second, LogSampleRate: 1}, clk, metrics.NoopRegisterer, log.NewMock())
+	test.AssertNotError(t, err, "making source")
+	redis := &flakyRedis{down: true}
+	src.client = newBreakerClient(redis, BreakerConfig{FailureThreshold: 1}, clk, metrics.NoopRegisterer)
+
+	// The first lookup fails and opens the breaker; the second never reaches
+	// Redis. Both are served by live signing.
+	for range 2 {
+		receivedResp, err := src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+		test.AssertNotError(t, err, "expected live signing while Redis is down")
+		test.AssertDeepEquals(t, resp.Raw, receivedResp.Raw)
+	}
+	test.AssertEquals(t, redis.calls, 1)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "lookup_error"}, 1)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "breaker_open"}, 1)
+}
@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// goroutineBudget is a process-wide cap on the number of goroutines the Redis
+// sources may have running on behalf of requests at once. It's a coarse safety
+// net: under pathological load, per-request goroutines could otherwise exhaust
+// memory before any downstream concurrency limit engages. A nil
+// *goroutineBudget imposes no limit.
+type goroutineBudget struct {
+	limit int64
+	inUse atomic.Int64
+}
+
+// NewGoroutineBudget returns a goroutineBudget allowing at most limit
+// goroutines, and exports the number currently in use as a gauge. If limit is
+// zero, it returns nil, meaning no limit.
+func NewGoroutineBudget(limit int, stats prometheus.Registerer) *goroutineBudget {
+	if limit == 0 {
+		return nil
+	}
+	b := &goroutineBudget{limit: int64(limit)}
+	stats.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ocsp_redis_goroutines_in_use",
+		Help: "Number of goroutines currently spawned by the Redis sources, out of the configured budget",
+	}, func() float64 {
+		return float64(b.inUse.Load())
+	}))
+	return b
+}
+
+// acquire reserves n goroutines from the budget, returning false if that would
+// exceed the limit. Each successful acquire must be paired with a release.
+func (b *goroutineBudget) acquire(n int64) bool {
+	if b == nil {
+		return true
+	}
+	if b.inUse.Add(n) > b.limit {
+		b.inUse.Add(-n)
+		return false
+	}
+	return true
+}
+
+// release returns n goroutines to the budget.
+func (b *goroutineBudget) release(n int64) {
+	if b == nil {
+		return
+	}
+	b.inUse.Add(-n)
+}
@@ -0,0 +1,63 @@
+package redis
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	ocsp_test "github.com/letsencrypt/boulder/ocsp/test"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestGoroutineBudget(t *testing.T) {
+	var unlimited *goroutineBudget
+	test.Assert(t, unlimited.acquire(1000), "nil budget should never be exhausted")
+	unlimited.release(1000)
+
+	test.Assert(t, NewGoroutineBudget(0, metrics.NoopRegisterer) == nil, "zero limit should mean no budget")
+
+	b := NewGoroutineBudget(3, metrics.NoopRegisterer)
+	test.Assert(t, b.acquire(2), "acquiring within budget")
+	test.Assert(t, !b.acquire(2), "acquiring beyond budget should fail")
+	test.AssertEquals(t, b.inUse.Load(), int64(2))
+	test.Assert(t, b.acquire(1), "acquiring the remainder of the budget")
+	b.release(3)
+	test.AssertEquals(t, b.inUse.Load(), int64(0))
+}
+
+func TestCheckedRedisSourceBudgetExhausted(t *testing.T) {
+	serial := big.NewInt(17777)
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   time.Now().Truncate(time.Second).UTC(),
+	})
+	test.AssertNotError(t, err, "making fake response")
+	status := statusModel{
+		Status: core.OCSPStatusGood,
+	}
+
+	src := newCheckedRedisSource(echoSource{resp: resp}, echoSelector{status: status}, nil, metrics.NoopRegisterer, blog.NewMock())
+	src.budget = NewGoroutineBudget(3, metrics.NoopRegisterer)
+
+	// Simulate another in-flight request holding part of the budget.
+	test.Assert(t, src.budget.acquire(2), "acquiring budget")
+
+	_, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+	test.AssertErrorIs(t, err, responder.ErrTryLater)
+	test.AssertMetricWithLabelsEquals(t, src.counter, map[string]string{"result": "goroutine_budget_exhausted"}, 1)
+
+	// Once the budget is released, requests are served again and don't leak
+	// budget.
+	src.budget.release(2)
+	_, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+	test.AssertNotError(t, err, "getting response after budget released")
+	test.AssertEquals(t, src.budget.inUse.Load(), int64(0))
+}
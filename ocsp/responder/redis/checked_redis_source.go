@@ -3,10 +3,14 @@ package redis
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
 	"sync"
+	"time"
 
+	"github.com/jmhodges/clock"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/ocsp"
 
 	"github.com/letsencrypt/boulder/core"
@@ -14,7 +18,6 @@ import (
 	berrors "github.com/letsencrypt/boulder/errors"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/ocsp/responder"
-	"github.com/letsencrypt/boulder/sa"
 	sapb "github.com/letsencrypt/boulder/sa/proto"
 )
 
@@ -22,6 +25,77 @@ import (
 // easier mocking of mysql operations in tests.
 type dbSelector interface {
 	SelectOne(ctx context.Context, holder interface{}, query string, args ...interface{}) error
+	Select(ctx context.Context, holder interface{}, query string, args ...interface{}) ([]interface{}, error)
+}
+
+// traceCommentSelector wraps a dbSelector, prepending a SQL comment containing
+// the request's trace ID to each query. This lets entries in the MySQL slow
+// query log be tied back to the OCSP request which caused them.
+type traceCommentSelector struct {
+	dbSelector
+}
+
+func (s traceCommentSelector) SelectOne(ctx context.Context, holder interface{}, query string, args ...interface{}) error {
+	return s.dbSelector.SelectOne(ctx, holder, traceComment(ctx, query), args...)
+}
+
+func (s traceCommentSelector) Select(ctx context.Context, holder interface{}, query string, args ...interface{}) ([]interface{}, error) {
+	return s.dbSelector.Select(ctx, holder, traceComment(ctx, query), args...)
+}
+
+// traceComment prepends a comment containing ctx's trace ID, if any, to query.
+func traceComment(ctx context.Context, query string) string {
+	spanCtx := trace.SpanContextFromContext(ctx)
+	if spanCtx.HasTraceID() {
+		query = fmt.Sprintf("/* req=%s */ %s", spanCtx.TraceID(), query)
+	}
+	return query
+}
+
+// MissingStatusConfig configures how checkedRedisSource handles serials for
+// which the DB has no certificateStatus row.
+type MissingStatusConfig struct {
+	// CheckIssued enables an extra lookup of the serials table when there is
+	// no certificateStatus row, to tell apart serials we never issued from
+	// certificates we did issue but which have no status, e.g. because the
+	// OCSP updater never ran for them. The two cases are counted separately.
+	CheckIssued bool
+
+	// TryLaterIfIssued causes unexpired certificates with no status row to be
+	// served an OCSP tryLater response (HTTP 503) instead of unauthorized, so
+	// that clients retry rather than concluding the certificate isn't ours.
+	// It has no effect unless CheckIssued is set.
+	TryLaterIfIssued bool
+}
+
+// DuplicateStatusConfig configures how checkedRedisSource handles serials with
+// more than one certificateStatus row, which should never happen and points to
+// a data integrity problem.
+type DuplicateStatusConfig struct {
+	// Check enables detecting such serials, which are then counted, audit
+	// logged and served Response, rather than whichever row the DB returned
+	// first. It only applies when querying the DB directly, as the SA returns
+	// a single status regardless.
+	Check bool
+
+	// Response is the OCSP response served for such serials: "internalError"
+	// (the default), "tryLater" or "unauthorized".
+	Response string `validate:"omitempty,oneof=internalError tryLater unauthorized"`
+}
+
+// DBBreakerConfig configures a circuit breaker around the DB (or SA) status
+// lookups of checkedRedisSource. While it is open, the DB is not contacted and
+// requests are answered with tryLater, since without the DB there is nothing
+// to check Redis responses against. The zero value disables the breaker.
+type DBBreakerConfig struct {
+	BreakerConfig
+
+	// ServeRedisUnchecked causes Redis responses to be served without
+	// checking them against the DB while the breaker is open, rather than
+	// answering with tryLater. This trades correctness for availability: a
+	// certificate revoked since its response was stored in Redis is then
+	// served as good.
+	ServeRedisUnchecked bool
 }
 
 // rocspSourceInterface expands on responder.Source by adding a private signAndSave method.
@@ -39,16 +113,84 @@ type rocspSourceInterface interface {
 // TODO(#6285): Inline the rocspSourceInterface into this type.
 // TODO(#6295): Remove the dbMap after all deployments use the SA instead.
 type checkedRedisSource struct {
-	base    rocspSourceInterface
-	dbMap   dbSelector
-	sac     sapb.StorageAuthorityReadOnlyClient
-	counter *prometheus.CounterVec
-	log     blog.Logger
+	base       rocspSourceInterface
+	dbMap      dbSelector
+	sac        sapb.StorageAuthorityReadOnlyClient
+	budget     *goroutineBudget
+	missing    MissingStatusConfig
+	duplicates DuplicateStatusConfig
+	counter    *prometheus.CounterVec
+	// dbRatio and redisRatio track the recent success ratios of the DB and
+	// Redis lookups respectively. "Not found" counts as success.
+	dbRatio    *successRatio
+	redisRatio *successRatio
+	// thisUpdateDivergence observes how far the DB's ocspLastUpdated and the
+	// served Redis response's thisUpdate are apart, when both are known.
+	// Gaps above maxDivergence, if set, are also counted by
+	// divergenceExceeded.
+	thisUpdateDivergence prometheus.Histogram
+	divergenceExceeded   prometheus.Counter
+	maxDivergence        time.Duration
+	negativeHits         prometheus.Counter
+	// bytesServed counts the bytes of the responses served, by whether they
+	// came from Redis or were freshly signed for the status found in MySQL.
+	bytesServed *prometheus.CounterVec
+	// redisLookups bounds the Redis lookups in flight. Requests beyond it
+	// are answered from the DB's status alone.
+	redisLookups *lookupLimiter
+	// dbBreaker stops DB lookups after repeated failures. While it is open,
+	// requests are answered with tryLater, or from Redis alone if
+	// serveUnchecked is set.
+	dbBreaker      *circuitBreaker
+	serveUnchecked bool
+	// retries is the number of retries allowed per request, shared between
+	// the DB and Redis lookups.
+	retries int
+	// negative remembers serials recently found to have no status, so that
+	// repeated requests for them skip the lookups.
+	negative *negativeCache
+	log      blog.Logger
+	clk      clock.Clock
+}
+
+// CheckedRedisConfig configures the checks and limits of a
+// checkedRedisSource. The zero value of each field leaves the corresponding
+// check or limit disabled.
+type CheckedRedisConfig struct {
+	// AnnotateQueries prefixes the queries sent directly to the DB with a
+	// comment containing the trace ID.
+	AnnotateQueries bool
+
+	// Missing configures how serials with no status row are handled.
+	Missing MissingStatusConfig
+
+	// Duplicates configures how serials with more than one status row are
+	// handled.
+	Duplicates DuplicateStatusConfig
+
+	// MaxDivergence causes responses whose thisUpdate is further than this
+	// from the DB's ocspLastUpdated to be counted, as a sign of a stale cache.
+	MaxDivergence time.Duration
+
+	// Retries is the number of retries of failed DB and Redis lookups
+	// allowed per request, shared between them.
+	Retries int
+
+	// Negative configures remembering serials with no status, so that
+	// repeated requests for them skip the lookups.
+	Negative NegativeCacheConfig
+
+	// MaxRedisLookups bounds the Redis lookups in flight. Requests beyond it
+	// are served by signing a fresh response for the DB's status.
+	MaxRedisLookups int
+
+	// DBBreaker configures a circuit breaker around the DB lookups.
+	DBBreaker DBBreakerConfig
 }
 
 // NewCheckedRedisSource builds a source that queries both the DB and Redis, and confirms
 // the value in Redis matches the DB.
-func NewCheckedRedisSource(base *redisSource, dbMap dbSelector, sac sapb.StorageAuthorityReadOnlyClient, stats prometheus.Registerer, log blog.Logger) (*checkedRedisSource, error) {
+func NewCheckedRedisSource(base *redisSource, dbMap dbSelector, sac sapb.StorageAuthorityReadOnlyClient, conf CheckedRedisConfig, stats prometheus.Registerer, log blog.Logger) (*checkedRedisSource, error) {
 	if base == nil {
 		return nil, errors.New("base was nil")
 	}
@@ -63,7 +205,33 @@ func NewCheckedRedisSource(base *redisSource, dbMap dbSelector, sac sapb.Storage
 		return nil, errors.New("either SA gRPC or direct DB connection must be provided")
 	}
 
-	return newCheckedRedisSource(base, dbMap, sac, stats, log), nil
+	if conf.AnnotateQueries && reflect.TypeOf(dbMap) != nil && !reflect.ValueOf(dbMap).IsNil() {
+		dbMap = traceCommentSelector{dbMap}
+	}
+
+	src := newCheckedRedisSource(base, dbMap, sac, stats, log)
+	// Share the base's budget, so that the goroutines spawned here and in the
+	// base count against the same limit.
+	src.budget = base.budget
+	src.missing = conf.Missing
+	src.duplicates = conf.Duplicates
+	src.maxDivergence = conf.MaxDivergence
+	src.retries = conf.Retries
+	src.redisLookups = newLookupLimiter(conf.MaxRedisLookups, stats)
+	src.clk = base.clk
+	dbBreakerState := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ocsp_db_breaker_open",
+		Help: "Whether the circuit breaker around the DB is open (1) or closed (0)",
+	})
+	stats.MustRegister(dbBreakerState)
+	src.dbBreaker = newCircuitBreaker(conf.DBBreaker.BreakerConfig, src.clk, dbBreakerState)
+	src.serveUnchecked = conf.DBBreaker.ServeRedisUnchecked
+	var err error
+	src.negative, err = newNegativeCache(conf.Negative, src.clk, src.negativeHits)
+	if err != nil {
+		return nil, err
+	}
+	return src, nil
 }
 
 // newCheckedRedisSource is an internal-only constructor that takes a private interface as a parameter.
@@ -75,52 +243,211 @@ func newCheckedRedisSource(base rocspSourceInterface, dbMap dbSelector, sac sapb
 	}, []string{"result"})
 	stats.MustRegister(counter)
 
+	successRatios := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ocsp_lookup_success_ratio",
+		Help: "Fraction of the most recent lookups which succeeded, by backend",
+	}, []string{"source"})
+	stats.MustRegister(successRatios)
+
+	thisUpdateDivergence := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "ocsp_thisupdate_divergence_seconds",
+		Help: "Absolute difference between the DB's ocspLastUpdated and the thisUpdate of the response served from Redis",
+		// 10 buckets, ranging from 1 minute to 10 days
+		Buckets: prometheus.ExponentialBucketsRange(60, 864000, 10),
+	})
+	stats.MustRegister(thisUpdateDivergence)
+
+	divergenceExceeded := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ocsp_thisupdate_divergence_exceeded",
+		Help: "Count of responses served from Redis whose thisUpdate diverged from the DB's ocspLastUpdated by more than the configured threshold",
+	})
+	stats.MustRegister(divergenceExceeded)
+
+	negativeHits := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ocsp_negative_cache_hits",
+		Help: "Count of requests answered as not found from the cache of serials recently found to have no status",
+	})
+	stats.MustRegister(negativeHits)
+
+	bytesServed := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocsp_response_bytes_served",
+		Help: "Count of bytes of OCSP responses served by checkedRedisSource, by source (redis or mysql)",
+	}, []string{"source"})
+	stats.MustRegister(bytesServed)
+
 	return &checkedRedisSource{
-		base:    base,
-		dbMap:   dbMap,
-		sac:     sac,
-		counter: counter,
-		log:     log,
+		base:                 base,
+		dbMap:                dbMap,
+		sac:                  sac,
+		counter:              counter,
+		dbRatio:              newSuccessRatio(successRatioWindow, successRatios.WithLabelValues("mysql")),
+		redisRatio:           newSuccessRatio(successRatioWindow, successRatios.WithLabelValues("redis")),
+		thisUpdateDivergence: thisUpdateDivergence,
+		divergenceExceeded:   divergenceExceeded,
+		negativeHits:         negativeHits,
+		bytesServed:          bytesServed,
+		log:                  log,
 	}
 }
 
 // Response implements the responder.Source interface. It looks up the requested OCSP
 // response in the redis cluster and looks up the corresponding status in the DB. If
 // the status disagrees with what redis says, it signs a fresh response and serves it.
+// The DB is authoritative: a Good response from Redis is only served once the
+// DB confirms the certificate isn't revoked, and a Revoked status is only ever
+// served if the DB has it. While the DB circuit breaker is open, requests are
+// answered with tryLater, unless the source is configured to serve Redis
+// responses unchecked.
 func (src *checkedRedisSource) Response(ctx context.Context, req *ocsp.Request) (*responder.Response, error) {
 	serialString := core.SerialToString(req.SerialNumber)
 
+	// Requests exempt from shedding, such as those from our own monitoring,
+	// are never answered from the negative cache, nor refused for lack of
+	// budget or Redis lookups.
+	exempt := responder.ShedExempt(ctx)
+
+	if !exempt && src.negative.contains(serialString) {
+		src.counter.WithLabelValues("negative_cache_hit").Inc()
+		responder.NoteBehavior(ctx, "NegativeCache")
+		return nil, responder.ErrNotFound
+	}
+
+	budgeted := src.budget.acquire(2)
+	if !budgeted && !exempt {
+		src.counter.WithLabelValues("goroutine_budget_exhausted").Inc()
+		responder.NoteBehavior(ctx, "MaxGoroutines")
+		return nil, responder.ErrTryLater
+	}
+	if budgeted {
+		defer src.budget.release(2)
+	}
+
+	if src.retries > 0 {
+		ctx = withRetryBudget(ctx, src.retries)
+	}
+
+	// If the DB has been failing, skip it. Without the DB there is nothing to
+	// check Redis against, so unless configured otherwise, don't serve at all.
+	dbAllowed := src.dbBreaker.allow()
+	if !dbAllowed && !src.serveUnchecked {
+		src.counter.WithLabelValues("db_breaker_open").Inc()
+		responder.NoteBehavior(ctx, "DBBreaker")
+		return nil, fmt.Errorf("DB circuit breaker is open: %w", responder.ErrTryLater)
+	}
+
+	// If Redis lookups are saturated, skip Redis and serve from the DB's
+	// status alone.
+	redisAcquired := src.redisLookups.acquire()
+	redisAllowed := redisAcquired || exempt
+
 	var wg sync.WaitGroup
-	wg.Add(2)
 	var dbStatus *sapb.RevocationStatus
+	// dbLastUpdated is only available from direct DB lookups; the SA doesn't
+	// return it.
+	var dbLastUpdated time.Time
 	var redisResult *responder.Response
 	var redisErr, dbErr error
-	go func() {
-		defer wg.Done()
-		if src.sac != nil {
-			dbStatus, dbErr = src.sac.GetRevocationStatus(ctx, &sapb.Serial{Serial: serialString})
-		} else {
-			dbStatus, dbErr = sa.SelectRevocationStatus(ctx, src.dbMap, serialString)
-		}
-	}()
-	go func() {
-		defer wg.Done()
-		redisResult, redisErr = src.base.Response(ctx, req)
-	}()
+	if dbAllowed {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dbErr = withRetries(ctx, func() error {
+				var err error
+				if src.sac != nil {
+					dbStatus, err = src.sac.GetRevocationStatus(ctx, &sapb.Serial{Serial: serialString})
+				} else if src.duplicates.Check {
+					dbStatus, dbLastUpdated, err = selectUniqueStatus(ctx, src.dbMap, serialString)
+				} else {
+					dbStatus, dbLastUpdated, err = selectStatus(ctx, src.dbMap, serialString)
+				}
+				return err
+			}, func(err error) bool {
+				return !db.IsNoRows(err) && !errors.Is(err, berrors.NotFound) && !errors.Is(err, errMultipleStatusRows)
+			})
+		}()
+	}
+	if redisAllowed {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if redisAcquired {
+				defer src.redisLookups.release()
+			}
+			redisResult, redisErr = src.base.Response(ctx, req)
+		}()
+	}
 	wg.Wait()
 
+	if dbAllowed {
+		dbOK := dbErr == nil || db.IsNoRows(dbErr) || errors.Is(dbErr, berrors.NotFound) || errors.Is(dbErr, errMultipleStatusRows)
+		src.dbRatio.record(dbOK)
+		src.dbBreaker.record(!dbOK)
+	}
+	if redisAllowed {
+		src.redisRatio.record(redisErr == nil || errors.Is(redisErr, responder.ErrNotFound))
+	}
+
+	if !redisAllowed {
+		responder.NoteBehavior(ctx, "MaxRedisLookups")
+	}
+	if !dbAllowed {
+		responder.NoteBehavior(ctx, "DBBreaker")
+		if !redisAllowed {
+			src.counter.WithLabelValues("db_breaker_open_redis_shed").Inc()
+			return nil, responder.ErrTryLater
+		}
+		if redisErr != nil {
+			src.counter.WithLabelValues("db_breaker_open_redis_error").Inc()
+			return nil, redisErr
+		}
+		src.counter.WithLabelValues("db_breaker_open_unchecked").Inc()
+		return src.served(ctx, "redis", redisResult), nil
+	}
+
 	if dbErr != nil {
 		// If the DB says "not found", the certificate either doesn't exist or has
 		// expired and been removed from the DB. We don't need to check the Redis error.
 		if db.IsNoRows(dbErr) || errors.Is(dbErr, berrors.NotFound) {
-			src.counter.WithLabelValues("not_found").Inc()
-			return nil, responder.ErrNotFound
+			err := src.missingStatus(ctx, serialString)
+			// Only a definite not found is cached, never a failure to find
+			// out.
+			if err == responder.ErrNotFound && !exempt {
+				src.negative.add(serialString)
+			}
+			return nil, err
+		}
+
+		if errors.Is(dbErr, errMultipleStatusRows) {
+			return nil, src.duplicateStatus(ctx, serialString)
+		}
+
+		// If Redis failed too, we have nothing to serve from at all.
+		if redisAllowed && redisErr != nil && !errors.Is(redisErr, responder.ErrNotFound) {
+			src.counter.WithLabelValues("db_and_redis_error").Inc()
+			src.log.AuditErrf("Both DB and Redis lookups failed for serial %s: DB: %s, Redis: %s", serialString, dbErr, redisErr)
+			// Only the DB error is wrapped, so that the Redis error can't change
+			// how the failure is classified.
+			return nil, fmt.Errorf("looking up %s: DB: %w, Redis: %v", serialString, dbErr, redisErr)
 		}
 
 		src.counter.WithLabelValues("db_error").Inc()
 		return nil, dbErr
 	}
 
+	if !redisAllowed {
+		freshResult, err := src.base.signAndSave(ctx, req, causeRedisShed)
+		if err != nil {
+			src.counter.WithLabelValues("redis_lookup_shed_sign_error").Inc()
+			return nil, err
+		}
+		if !agree(dbStatus, freshResult.Response) {
+			src.counter.WithLabelValues("redis_lookup_shed_mismatch").Inc()
+			return nil, errors.New("freshly signed status did not match DB")
+		}
+		src.counter.WithLabelValues("redis_lookup_shed").Inc()
+		return src.served(ctx, "mysql", freshResult), nil
+	}
+
 	if redisErr != nil {
 		src.counter.WithLabelValues("redis_error").Inc()
 		return nil, redisErr
@@ -129,7 +456,10 @@ func (src *checkedRedisSource) Response(ctx context.Context, req *ocsp.Request)
 	// If the DB status matches the status returned from the Redis pipeline, all is good.
 	if agree(dbStatus, redisResult.Response) {
 		src.counter.WithLabelValues("success").Inc()
-		return redisResult, nil
+		if !dbLastUpdated.IsZero() {
+			src.observeDivergence(dbLastUpdated, redisResult.ThisUpdate)
+		}
+		return src.served(ctx, "redis", redisResult), nil
 	}
 
 	// Otherwise, the DB is authoritative. Trigger a fresh signing.
@@ -141,7 +471,7 @@ func (src *checkedRedisSource) Response(ctx context.Context, req *ocsp.Request)
 
 	if agree(dbStatus, freshResult.Response) {
 		src.counter.WithLabelValues("revocation_re_sign_success").Inc()
-		return freshResult, nil
+		return src.served(ctx, "mysql", freshResult), nil
 	}
 
 	// This could happen for instance with replication lag, or if the
@@ -151,6 +481,91 @@ func (src *checkedRedisSource) Response(ctx context.Context, req *ocsp.Request)
 
 }
 
+// served counts the bytes of resp, served from source, notes source as the
+// request's backend, and returns it.
+// Responses freshly signed because Redis was skipped or disagreed with the DB
+// are attributed to mysql, as it's the DB's status that they carry.
+func (src *checkedRedisSource) served(ctx context.Context, source string, resp *responder.Response) *responder.Response {
+	src.bytesServed.WithLabelValues(source).Add(float64(len(resp.Raw)))
+	responder.NoteSource(ctx, source)
+	return resp
+}
+
+// observeDivergence records how far apart the DB's ocspLastUpdated and the
+// thisUpdate of the response served from Redis are.
+func (src *checkedRedisSource) observeDivergence(dbLastUpdated, thisUpdate time.Time) {
+	delta := dbLastUpdated.Sub(thisUpdate).Abs()
+	src.thisUpdateDivergence.Observe(delta.Seconds())
+	if src.maxDivergence > 0 && delta > src.maxDivergence {
+		src.divergenceExceeded.Inc()
+	}
+}
+
+// missingStatus counts and returns the error to serve for a serial with no
+// certificateStatus row. If configured, it first checks whether the serial was
+// ever issued.
+func (src *checkedRedisSource) missingStatus(ctx context.Context, serial string) error {
+	if !src.missing.CheckIssued {
+		src.counter.WithLabelValues("not_found").Inc()
+		return responder.ErrNotFound
+	}
+
+	expires, err := src.serialExpiry(ctx, serial)
+	if db.IsNoRows(err) || errors.Is(err, berrors.NotFound) {
+		src.counter.WithLabelValues("not_found_never_issued").Inc()
+		return responder.ErrNotFound
+	} else if err != nil {
+		// The serial may well be valid, so this mustn't be served, or
+		// cached, as not found.
+		src.counter.WithLabelValues("not_found_issued_check_error").Inc()
+		return fmt.Errorf("checking whether serial %s was issued: %w", serial, err)
+	}
+
+	if !src.clk.Now().Before(expires) {
+		src.counter.WithLabelValues("not_found_expired").Inc()
+		return responder.ErrNotFound
+	}
+
+	src.counter.WithLabelValues("not_found_issued").Inc()
+	src.log.Warningf("serial %s was issued but has no certificateStatus", serial)
+	if src.missing.TryLaterIfIssued {
+		responder.NoteBehavior(ctx, "MissingStatus")
+		return fmt.Errorf("serial %s has no status: %w", serial, responder.ErrTryLater)
+	}
+	return responder.ErrNotFound
+}
+
+// duplicateStatus counts, audit logs and returns the error to serve for a
+// serial with more than one certificateStatus row.
+func (src *checkedRedisSource) duplicateStatus(ctx context.Context, serial string) error {
+	src.counter.WithLabelValues("duplicate_status").Inc()
+	src.log.AuditErrf("Multiple certificateStatus rows for serial %s", serial)
+	responder.NoteBehavior(ctx, "DuplicateStatus")
+	switch src.duplicates.Response {
+	case "tryLater":
+		return fmt.Errorf("serial %s has multiple statuses: %w", serial, responder.ErrTryLater)
+	case "unauthorized":
+		return fmt.Errorf("serial %s has multiple statuses: %w", serial, responder.ErrNotFound)
+	default:
+		return fmt.Errorf("serial %s: %w", serial, errMultipleStatusRows)
+	}
+}
+
+// serialExpiry returns the expiry of the certificate with the given serial,
+// according to the serials table.
+func (src *checkedRedisSource) serialExpiry(ctx context.Context, serial string) (time.Time, error) {
+	if src.sac != nil {
+		metadata, err := src.sac.GetSerialMetadata(ctx, &sapb.Serial{Serial: serial})
+		if err != nil {
+			return time.Time{}, err
+		}
+		return metadata.Expires.AsTime(), nil
+	}
+	var expires time.Time
+	err := src.dbMap.SelectOne(ctx, &expires, "SELECT expires FROM serials WHERE serial = ?", serial)
+	return expires, err
+}
+
 // agree returns true if the contents of the redisResult ocsp.Response agree with what's in the DB.
 func agree(dbStatus *sapb.RevocationStatus, redisResult *ocsp.Response) bool {
 	return dbStatus.Status == int64(redisResult.Status) &&
@@ -1,18 +1,28 @@
 package redis
 
 import (
+	"bytes"
 	"context"
+	"crypto"
 	"database/sql"
 	"errors"
 	"fmt"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/ocsp"
 	"google.golang.org/grpc"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/letsencrypt/boulder/config"
 	"github.com/letsencrypt/boulder/core"
 	"github.com/letsencrypt/boulder/db"
 	berrors "github.com/letsencrypt/boulder/errors"
@@ -20,7 +30,6 @@ import (
 	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/ocsp/responder"
 	ocsp_test "github.com/letsencrypt/boulder/ocsp/test"
-	"github.com/letsencrypt/boulder/sa"
 	sapb "github.com/letsencrypt/boulder/sa/proto"
 	"github.com/letsencrypt/boulder/test"
 )
@@ -63,14 +72,37 @@ func (es errorSource) signAndSave(ctx context.Context, req *ocsp.Request, cause
 	panic("should not happen")
 }
 
+// tryLaterSource implements rocspSourceInterface, and always asks for the
+// request to be retried.
+type tryLaterSource struct{}
+
+func (tls tryLaterSource) Response(ctx context.Context, req *ocsp.Request) (*responder.Response, error) {
+	return nil, responder.ErrTryLater
+}
+
+func (tls tryLaterSource) signAndSave(ctx context.Context, req *ocsp.Request, cause signAndSaveCause) (*responder.Response, error) {
+	panic("should not happen")
+}
+
+// notFoundSource implements rocspSourceInterface, and never has a response.
+type notFoundSource struct{}
+
+func (nfs notFoundSource) Response(ctx context.Context, req *ocsp.Request) (*responder.Response, error) {
+	return nil, responder.ErrNotFound
+}
+
+func (nfs notFoundSource) signAndSave(ctx context.Context, req *ocsp.Request, cause signAndSaveCause) (*responder.Response, error) {
+	panic("should not happen")
+}
+
 // echoSelector always returns the given certificateStatus.
 type echoSelector struct {
 	db.MockSqlExecutor
-	status sa.RevocationStatusModel
+	status statusModel
 }
 
 func (s echoSelector) SelectOne(_ context.Context, output interface{}, _ string, _ ...interface{}) error {
-	outputPtr, ok := output.(*sa.RevocationStatusModel)
+	outputPtr, ok := output.(*statusModel)
 	if !ok {
 		return fmt.Errorf("incorrect output type %T", output)
 	}
@@ -135,7 +167,7 @@ func TestCheckedRedisSourceSuccess(t *testing.T) {
 	})
 	test.AssertNotError(t, err, "making fake response")
 
-	status := sa.RevocationStatusModel{
+	status := statusModel{
 		Status: core.OCSPStatusGood,
 	}
 	src := newCheckedRedisSource(echoSource{resp: resp}, echoSelector{status: status}, nil, metrics.NoopRegisterer, blog.NewMock())
@@ -201,7 +233,7 @@ func TestCheckedRedisSourceSAError(t *testing.T) {
 func TestCheckedRedisSourceRedisError(t *testing.T) {
 	serial := big.NewInt(314159262)
 
-	status := sa.RevocationStatusModel{
+	status := statusModel{
 		Status: core.OCSPStatusGood,
 	}
 	src := newCheckedRedisSource(errorSource{}, echoSelector{status: status}, nil, metrics.NoopRegisterer, blog.NewMock())
@@ -211,6 +243,54 @@ func TestCheckedRedisSourceRedisError(t *testing.T) {
 	test.AssertError(t, err, "getting response")
 }
 
+func TestCheckedRedisSourceBothError(t *testing.T) {
+	serial := big.NewInt(500500)
+	log := blog.NewMock()
+	src := newCheckedRedisSource(errorSource{}, errorSelector{}, nil, metrics.NoopRegisterer, log)
+	_, err := src.Response(context.Background(), &ocsp.Request{
+		SerialNumber: serial,
+	})
+	test.AssertError(t, err, "getting response")
+	test.AssertContains(t, err.Error(), "oops")
+	test.AssertContains(t, err.Error(), "sad trombone")
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "db_and_redis_error"}, 1)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "db_error"}, 0)
+	test.AssertEquals(t, len(log.GetAllMatching("ERR: \\[AUDIT\\] Both DB and Redis lookups failed for serial "+core.SerialToString(serial))), 1)
+
+	// A DB error alongside a Redis miss is only a DB error.
+	src = newCheckedRedisSource(notFoundSource{}, errorSelector{}, nil, metrics.NoopRegisterer, blog.NewMock())
+	_, err = src.Response(context.Background(), &ocsp.Request{
+		SerialNumber: serial,
+	})
+	test.AssertError(t, err, "getting response")
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "db_error"}, 1)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "db_and_redis_error"}, 0)
+
+	// Either way, the failure is served as a DB error. Neither a Redis miss
+	// nor a Redis tryLater turns it into an unauthorized or tryLater
+	// response.
+	ocspReq := &ocsp.Request{
+		HashAlgorithm:  crypto.SHA1,
+		IssuerNameHash: make([]byte, 20),
+		IssuerKeyHash:  make([]byte, 20),
+		SerialNumber:   serial,
+	}
+	der, err := ocspReq.Marshal()
+	test.AssertNotError(t, err, "marshaling OCSP request")
+	for _, base := range []rocspSourceInterface{notFoundSource{}, tryLaterSource{}} {
+		src = newCheckedRedisSource(base, errorSelector{}, nil, metrics.NoopRegisterer, blog.NewMock())
+		_, err = src.Response(context.Background(), ocspReq)
+		test.Assert(t, !errors.Is(err, responder.ErrNotFound), "DB error classified as not found")
+		test.Assert(t, !errors.Is(err, responder.ErrTryLater), "DB error classified as tryLater")
+
+		rs := responder.NewResponder(src, responder.Options{}, metrics.NoopRegisterer, blog.NewMock())
+		rw := httptest.NewRecorder()
+		rs.ServeHTTP(rw, httptest.NewRequest("POST", "/", bytes.NewReader(der)))
+		test.AssertEquals(t, rw.Code, http.StatusInternalServerError)
+		test.AssertByteEquals(t, rw.Body.Bytes(), ocsp.InternalErrorErrorResponse)
+	}
+}
+
 func TestCheckedRedisStatusDisagreement(t *testing.T) {
 	serial := big.NewInt(2718)
 	thisUpdate := time.Now().Truncate(time.Second).UTC()
@@ -230,7 +310,7 @@ func TestCheckedRedisStatusDisagreement(t *testing.T) {
 		ThisUpdate:       thisUpdate,
 	})
 	test.AssertNotError(t, err, "making fake response")
-	status := sa.RevocationStatusModel{
+	status := statusModel{
 		Status:        core.OCSPStatusRevoked,
 		RevokedDate:   thisUpdate,
 		RevokedReason: ocsp.KeyCompromise,
@@ -292,3 +372,538 @@ func TestCheckedRedisStatusSADisagreement(t *testing.T) {
 	test.AssertEquals(t, fetchedResponse.RevocationReason, ocsp.KeyCompromise)
 	test.AssertEquals(t, fetchedResponse.ThisUpdate, thisUpdate)
 }
+
+// recordingSelector acts like echoSelector, but also records the query it
+// was called with.
+type recordingSelector struct {
+	echoSelector
+	query *string
+}
+
+func (s recordingSelector) SelectOne(ctx context.Context, output interface{}, query string, args ...interface{}) error {
+	*s.query = query
+	return s.echoSelector.SelectOne(ctx, output, query, args...)
+}
+
+func TestCheckedRedisSourceTraceComment(t *testing.T) {
+	serial := big.NewInt(17777)
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   time.Now().Truncate(time.Second).UTC(),
+	})
+	test.AssertNotError(t, err, "making fake response")
+
+	var query string
+	selector := recordingSelector{
+		echoSelector: echoSelector{status: statusModel{Status: core.OCSPStatusGood}},
+		query:        &query,
+	}
+
+	traceID, err := trace.TraceIDFromHex("0123456789abcdef0123456789abcdef")
+	test.AssertNotError(t, err, "parsing trace ID")
+	spanID, err := trace.SpanIDFromHex("0123456789abcdef")
+	test.AssertNotError(t, err, "parsing span ID")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+
+	// With annotation enabled, the query carries the trace ID.
+	src := newCheckedRedisSource(echoSource{resp: resp}, traceCommentSelector{selector}, nil, metrics.NoopRegisterer, blog.NewMock())
+	_, err = src.Response(ctx, &ocsp.Request{SerialNumber: serial})
+	test.AssertNotError(t, err, "getting response")
+	test.Assert(t, strings.HasPrefix(query, "/* req=0123456789abcdef0123456789abcdef */ SELECT"), "query missing trace comment: "+query)
+
+	// Without a trace in the context, the query is unchanged.
+	_, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+	test.AssertNotError(t, err, "getting response")
+	test.Assert(t, strings.HasPrefix(query, "SELECT"), "unexpected query prefix: "+query)
+
+	// With annotation disabled, the query is unchanged.
+	src = newCheckedRedisSource(echoSource{resp: resp}, selector, nil, metrics.NoopRegisterer, blog.NewMock())
+	_, err = src.Response(ctx, &ocsp.Request{SerialNumber: serial})
+	test.AssertNotError(t, err, "getting response")
+	test.Assert(t, strings.HasPrefix(query, "SELECT"), "unexpected query prefix: "+query)
+}
+
+// serialsSA has no revocation status for any serial, and returns metadata
+// with the given expiry from GetSerialMetadata. If expires is nil, the serial
+// was never issued.
+type serialsSA struct {
+	notFoundSA
+	expires *time.Time
+}
+
+func (s *serialsSA) GetSerialMetadata(_ context.Context, req *sapb.Serial, _ ...grpc.CallOption) (*sapb.SerialMetadata, error) {
+	if s.expires == nil {
+		return nil, berrors.NotFoundError("serial %q not found", req.Serial)
+	}
+	return &sapb.SerialMetadata{Serial: req.Serial, Expires: timestamppb.New(*s.expires)}, nil
+}
+
+// serialsSelector has no certificateStatus row for any serial, and returns
+// the given expiry from the serials table. If expires is nil, the serial was
+// never issued.
+type serialsSelector struct {
+	db.MockSqlExecutor
+	expires *time.Time
+}
+
+func (s serialsSelector) SelectOne(_ context.Context, output interface{}, _ string, _ ...interface{}) error {
+	outputPtr, ok := output.(*time.Time)
+	if !ok || s.expires == nil {
+		return db.ErrDatabaseOp{Err: sql.ErrNoRows}
+	}
+	*outputPtr = *s.expires
+	return nil
+}
+
+func TestCheckedRedisSourceMissingStatus(t *testing.T) {
+	serial := big.NewInt(404040)
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   time.Now().Truncate(time.Second).UTC(),
+	})
+	test.AssertNotError(t, err, "making fake response")
+
+	clk := clock.NewFake()
+	future := clk.Now().Add(time.Hour)
+	past := clk.Now().Add(-time.Hour)
+
+	testCases := []struct {
+		name     string
+		expires  *time.Time
+		tryLater bool
+		result   string
+		wantErr  error
+	}{
+		{"never issued", nil, false, "not_found_never_issued", responder.ErrNotFound},
+		{"never issued, try later", nil, true, "not_found_never_issued", responder.ErrNotFound},
+		{"expired", &past, true, "not_found_expired", responder.ErrNotFound},
+		{"issued", &future, false, "not_found_issued", responder.ErrNotFound},
+		{"issued, try later", &future, true, "not_found_issued", responder.ErrTryLater},
+	}
+	for _, tc := range testCases {
+		sources := map[string]*checkedRedisSource{
+			"SA": newCheckedRedisSource(echoSource{resp: resp}, nil, &serialsSA{expires: tc.expires}, metrics.NoopRegisterer, blog.NewMock()),
+			"DB": newCheckedRedisSource(echoSource{resp: resp}, serialsSelector{expires: tc.expires}, nil, metrics.NoopRegisterer, blog.NewMock()),
+		}
+		for backend, src := range sources {
+			t.Run(tc.name+" via "+backend, func(t *testing.T) {
+				src.missing = MissingStatusConfig{CheckIssued: true, TryLaterIfIssued: tc.tryLater}
+				src.clk = clk
+				_, err := src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+				test.AssertErrorIs(t, err, tc.wantErr)
+				test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": tc.result}, 1)
+				test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "not_found"}, 0)
+			})
+		}
+	}
+
+	// Without CheckIssued, the serials table is never consulted.
+	src := newCheckedRedisSource(echoSource{resp: resp}, nil, &notFoundSA{}, metrics.NoopRegisterer, blog.NewMock())
+	_, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+	test.AssertErrorIs(t, err, responder.ErrNotFound)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "not_found"}, 1)
+}
+
+func TestCheckedRedisSourceThisUpdateDivergence(t *testing.T) {
+	serial := big.NewInt(17777)
+	thisUpdate := time.Now().Truncate(time.Second).UTC()
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   thisUpdate,
+	})
+	test.AssertNotError(t, err, "making fake response")
+
+	testCases := []struct {
+		name            string
+		dbLastUpdated   time.Time
+		wantSample      float64
+		wantObservation int
+		wantExceeded    int
+	}{
+		{"small divergence", thisUpdate.Add(time.Minute), 60, 1, 0},
+		{"large divergence", thisUpdate.Add(-48 * time.Hour), 48 * 3600, 1, 1},
+		{"unknown last update", time.Time{}, 0, 0, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status := statusModel{
+				Status:          core.OCSPStatusGood,
+				OCSPLastUpdated: tc.dbLastUpdated,
+			}
+			src := newCheckedRedisSource(echoSource{resp: resp}, echoSelector{status: status}, nil, metrics.NoopRegisterer, blog.NewMock())
+			src.maxDivergence = 24 * time.Hour
+			_, err := src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+			test.AssertNotError(t, err, "getting response")
+
+			test.AssertMetricWithLabelsEquals(t, src.thisUpdateDivergence, prometheus.Labels{}, float64(tc.wantObservation))
+			var m io_prometheus_client.Metric
+			err = src.thisUpdateDivergence.Write(&m)
+			test.AssertNotError(t, err, "reading histogram")
+			test.AssertEquals(t, m.GetHistogram().GetSampleSum(), tc.wantSample)
+			test.AssertMetricWithLabelsEquals(t, src.divergenceExceeded, prometheus.Labels{}, float64(tc.wantExceeded))
+		})
+	}
+
+	// Via the SA, ocspLastUpdated isn't known, so nothing is observed.
+	src := newCheckedRedisSource(echoSource{resp: resp}, nil, &echoSA{status: &sapb.RevocationStatus{RevokedDate: timestamppb.New(time.Time{})}}, metrics.NoopRegisterer, blog.NewMock())
+	_, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+	test.AssertNotError(t, err, "getting response")
+	test.AssertMetricWithLabelsEquals(t, src.thisUpdateDivergence, prometheus.Labels{}, 0)
+}
+
+// TestCheckedRedisSourceDBAuthoritative covers each combination of Redis and
+// DB status: a Redis response is only served when the DB agrees with it, and
+// otherwise a response is freshly signed with the DB's status.
+func TestCheckedRedisSourceDBAuthoritative(t *testing.T) {
+	serial := big.NewInt(31337)
+	thisUpdate := time.Now().Truncate(time.Second).UTC()
+	revokedAt := thisUpdate.Add(-time.Hour)
+
+	makeResp := func(status int) *ocsp.Response {
+		template := ocsp.Response{SerialNumber: serial, Status: status, ThisUpdate: thisUpdate}
+		if status == ocsp.Revoked {
+			template.RevokedAt = revokedAt
+			template.RevocationReason = ocsp.KeyCompromise
+		}
+		resp, _, err := ocsp_test.FakeResponse(template)
+		test.AssertNotError(t, err, "making fake response")
+		return resp
+	}
+	makeStatus := func(status int) statusModel {
+		if status == ocsp.Revoked {
+			return statusModel{Status: core.OCSPStatusRevoked, RevokedDate: revokedAt, RevokedReason: ocsp.KeyCompromise}
+		}
+		return statusModel{Status: core.OCSPStatusGood}
+	}
+
+	testCases := []struct {
+		name     string
+		redis    int
+		db       int
+		resigned bool
+	}{
+		{"redis good, db good", ocsp.Good, ocsp.Good, false},
+		{"redis good, db revoked", ocsp.Good, ocsp.Revoked, true},
+		{"redis revoked, db revoked", ocsp.Revoked, ocsp.Revoked, false},
+		{"redis revoked, db good", ocsp.Revoked, ocsp.Good, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fresh := makeResp(tc.db)
+			base := recordingEchoSource{
+				echoSource: echoSource{resp: makeResp(tc.redis)},
+				secondResp: &responder.Response{Response: fresh, Raw: fresh.Raw},
+				ch:         make(chan string, 1),
+			}
+			src := newCheckedRedisSource(base, echoSelector{status: makeStatus(tc.db)}, nil, metrics.NoopRegisterer, blog.NewMock())
+			resp, err := src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+			test.AssertNotError(t, err, "getting response")
+			// Whatever Redis had, the status served is the DB's.
+			test.AssertEquals(t, resp.Status, tc.db)
+			test.AssertEquals(t, len(base.ch) == 1, tc.resigned)
+			if tc.resigned {
+				test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "revocation_re_sign_success"}, 1)
+			} else {
+				test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "success"}, 1)
+			}
+		})
+	}
+}
+
+// flakySelector returns an error while down is true, and the given
+// certificateStatus otherwise. It counts the calls that reach it.
+type flakySelector struct {
+	db.MockSqlExecutor
+	status statusModel
+	down   bool
+	calls  int
+}
+
+func (s *flakySelector) SelectOne(_ context.Context, output interface{}, _ string, _ ...interface{}) error {
+	s.calls++
+	if s.down {
+		return errors.New("too many connections")
+	}
+	outputPtr, ok := output.(*statusModel)
+	if !ok {
+		return fmt.Errorf("incorrect output type %T", output)
+	}
+	*outputPtr = s.status
+	return nil
+}
+
+func TestCheckedRedisSourceDBBreaker(t *testing.T) {
+	serial := big.NewInt(5150)
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   time.Now().Truncate(time.Second).UTC(),
+	})
+	test.AssertNotError(t, err, "making fake response")
+
+	// The certificate has been revoked, but Redis still has a Good response
+	// for it.
+	clk := clock.NewFake()
+	revoked := statusModel{Status: core.OCSPStatusRevoked, RevokedReason: 1}
+	selector := &flakySelector{status: revoked, down: true}
+	src := newCheckedRedisSource(echoSource{resp: resp}, selector, nil, metrics.NoopRegisterer, blog.NewMock())
+	state := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test"})
+	src.dbBreaker = newCircuitBreaker(BreakerConfig{
+		FailureThreshold: 2,
+		MinBackoff:       config.Duration{Duration: time.Second},
+		MaxBackoff:       config.Duration{Duration: time.Minute},
+	}, clk, state)
+	req := &ocsp.Request{SerialNumber: serial}
+
+	// DB errors below the threshold are served as errors.
+	for range 2 {
+		_, err = src.Response(context.Background(), req)
+		test.AssertError(t, err, "expected error while the DB is down")
+	}
+	test.AssertMetricWithLabelsEquals(t, state, prometheus.Labels{}, 1)
+	test.AssertEquals(t, selector.calls, 2)
+
+	// While open, the DB isn't asked, and the Good response in Redis isn't
+	// served, since it can't be checked.
+	got, err := src.Response(context.Background(), req)
+	test.AssertErrorIs(t, err, responder.ErrTryLater)
+	test.Assert(t, got == nil, "served a response with the breaker open")
+	test.AssertEquals(t, selector.calls, 2)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "db_breaker_open"}, 1)
+
+	// Only when explicitly configured are Redis responses served unchecked,
+	// even though this one is stale.
+	src.serveUnchecked = true
+	got, err = src.Response(context.Background(), req)
+	test.AssertNotError(t, err, "getting unchecked response with the breaker open")
+	test.AssertEquals(t, got.Status, ocsp.Good)
+	test.AssertEquals(t, selector.calls, 2)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "db_breaker_open_unchecked"}, 1)
+
+	// If Redis can't answer either, the request fails rather than being
+	// served without any check.
+	failing := newCheckedRedisSource(errorSource{}, selector, nil, metrics.NoopRegisterer, blog.NewMock())
+	failing.dbBreaker = src.dbBreaker
+	failing.serveUnchecked = true
+	_, err = failing.Response(context.Background(), req)
+	test.AssertError(t, err, "expected error with the breaker open and Redis down")
+	test.AssertMetricWithLabelsEquals(t, failing.counter, prometheus.Labels{"result": "db_breaker_open_redis_error"}, 1)
+
+	// After the backoff, a probe reaches the DB. Once it succeeds, the
+	// breaker closes and the DB is consulted again.
+	src.serveUnchecked = false
+	selector.status = statusModel{Status: core.OCSPStatusGood}
+	selector.down = false
+	clk.Add(2 * time.Second)
+	_, err = src.Response(context.Background(), req)
+	test.AssertNotError(t, err, "getting response from probe")
+	test.AssertEquals(t, selector.calls, 3)
+	test.AssertMetricWithLabelsEquals(t, state, prometheus.Labels{}, 0)
+	_, err = src.Response(context.Background(), req)
+	test.AssertNotError(t, err, "getting response with the breaker closed")
+	test.AssertEquals(t, selector.calls, 4)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "success"}, 2)
+}
+
+func TestCheckedRedisSourceShedExempt(t *testing.T) {
+	serial := big.NewInt(8675309)
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   time.Now().Truncate(time.Second).UTC(),
+	})
+	test.AssertNotError(t, err, "making fake response")
+
+	src := newCheckedRedisSource(echoSource{resp: resp}, echoSelector{status: statusModel{Status: core.OCSPStatusGood}}, nil, metrics.NoopRegisterer, blog.NewMock())
+	src.budget = NewGoroutineBudget(1, metrics.NoopRegisterer)
+	src.redisLookups = newLookupLimiter(1, metrics.NoopRegisterer)
+	src.negative, err = newNegativeCache(NegativeCacheConfig{TTL: config.Duration{Duration: time.Minute}}, clock.NewFake(), src.negativeHits)
+	test.AssertNotError(t, err, "creating negative cache")
+
+	// Saturate the budget and the Redis lookups, and mark the serial as
+	// not found.
+	test.Assert(t, src.budget.acquire(1), "acquiring budget")
+	test.Assert(t, src.redisLookups.acquire(), "acquiring lookup")
+	src.negative.add(core.SerialToString(serial))
+	req := &ocsp.Request{SerialNumber: serial}
+
+	// Ordinary requests are refused.
+	_, err = src.Response(context.Background(), req)
+	test.AssertErrorIs(t, err, responder.ErrNotFound)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "negative_cache_hit"}, 1)
+
+	// Exempt requests skip the negative cache, and are served from Redis
+	// despite the saturation, without taking from or releasing what others
+	// hold.
+	got, err := src.Response(responder.WithShedExempt(context.Background()), req)
+	test.AssertNotError(t, err, "getting exempt response")
+	test.AssertByteEquals(t, got.Raw, resp.Raw)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "success"}, 1)
+	test.AssertEquals(t, src.budget.inUse.Load(), int64(1))
+	test.AssertEquals(t, src.redisLookups.inFlight.Load(), int64(1))
+}
+
+// rowsSelector returns the given certificateStatus rows from Select, as
+// though they all matched the serial.
+type rowsSelector struct {
+	db.MockSqlExecutor
+	rows []statusModel
+}
+
+func (s rowsSelector) Select(_ context.Context, output interface{}, _ string, _ ...interface{}) ([]interface{}, error) {
+	outputPtr, ok := output.(*[]statusModel)
+	if !ok {
+		return nil, fmt.Errorf("incorrect output type %T", output)
+	}
+	*outputPtr = s.rows
+	return nil, nil
+}
+
+func TestCheckedRedisSourceDuplicateStatus(t *testing.T) {
+	serial := big.NewInt(1212)
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   time.Now().Truncate(time.Second).UTC(),
+	})
+	test.AssertNotError(t, err, "making fake response")
+	req := &ocsp.Request{SerialNumber: serial}
+	good := statusModel{Status: core.OCSPStatusGood}
+	revoked := statusModel{Status: core.OCSPStatusRevoked, RevokedReason: 1}
+
+	// A single row is served as usual.
+	src := newCheckedRedisSource(echoSource{resp: resp}, rowsSelector{rows: []statusModel{good}}, nil, metrics.NoopRegisterer, blog.NewMock())
+	src.duplicates = DuplicateStatusConfig{Check: true}
+	_, err = src.Response(context.Background(), req)
+	test.AssertNotError(t, err, "getting response for a single row")
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "success"}, 1)
+
+	// So is the absence of any.
+	src = newCheckedRedisSource(echoSource{resp: resp}, rowsSelector{}, nil, metrics.NoopRegisterer, blog.NewMock())
+	src.duplicates = DuplicateStatusConfig{Check: true}
+	_, err = src.Response(context.Background(), req)
+	test.AssertErrorIs(t, err, responder.ErrNotFound)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "not_found"}, 1)
+
+	for _, tc := range []struct {
+		response string
+		want     error
+	}{
+		{"", errMultipleStatusRows},
+		{"internalError", errMultipleStatusRows},
+		{"tryLater", responder.ErrTryLater},
+		{"unauthorized", responder.ErrNotFound},
+	} {
+		t.Run(tc.response, func(t *testing.T) {
+			log := blog.NewMock()
+			selector := rowsSelector{rows: []statusModel{good, revoked}}
+			src := newCheckedRedisSource(echoSource{resp: resp}, selector, nil, metrics.NoopRegisterer, log)
+			src.duplicates = DuplicateStatusConfig{Check: true, Response: tc.response}
+
+			_, err := src.Response(context.Background(), req)
+			test.AssertErrorIs(t, err, tc.want)
+			test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "duplicate_status"}, 1)
+			test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "success"}, 0)
+			test.AssertEquals(t, len(log.GetAllMatching(`ERR: \[AUDIT\] Multiple certificateStatus rows for serial `+core.SerialToString(serial))), 1)
+		})
+	}
+}
+
+func TestCheckedRedisSourceBytesServed(t *testing.T) {
+	serial := big.NewInt(31337)
+	thisUpdate := time.Now().Truncate(time.Second).UTC()
+
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   thisUpdate,
+	})
+	test.AssertNotError(t, err, "making fake response")
+	revokedResp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber:     serial,
+		Status:           ocsp.Revoked,
+		RevokedAt:        thisUpdate,
+		RevocationReason: ocsp.KeyCompromise,
+		ThisUpdate:       thisUpdate,
+	})
+	test.AssertNotError(t, err, "making fake response")
+
+	good := statusModel{Status: core.OCSPStatusGood}
+	revoked := statusModel{
+		Status:        core.OCSPStatusRevoked,
+		RevokedDate:   thisUpdate,
+		RevokedReason: ocsp.KeyCompromise,
+	}
+	source := recordingEchoSource{
+		echoSource: echoSource{resp: resp},
+		secondResp: &responder.Response{Response: revokedResp, Raw: revokedResp.Raw},
+		ch:         make(chan string, 1),
+	}
+	src := newCheckedRedisSource(source, echoSelector{status: good}, nil, metrics.NoopRegisterer, blog.NewMock())
+
+	// Responses from Redis which agree with the DB are counted as redis.
+	for i := 0; i < 2; i++ {
+		_, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+		test.AssertNotError(t, err, "getting response")
+	}
+	test.AssertMetricWithLabelsEquals(t, src.bytesServed, prometheus.Labels{"source": "redis"}, float64(2*len(resp.Raw)))
+	test.AssertMetricWithLabelsEquals(t, src.bytesServed, prometheus.Labels{"source": "mysql"}, 0)
+
+	// Responses re-signed for the DB's status are counted as mysql.
+	src.dbMap = echoSelector{status: revoked}
+	_, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+	test.AssertNotError(t, err, "getting re-signed response")
+	test.AssertMetricWithLabelsEquals(t, src.bytesServed, prometheus.Labels{"source": "redis"}, float64(2*len(resp.Raw)))
+	test.AssertMetricWithLabelsEquals(t, src.bytesServed, prometheus.Labels{"source": "mysql"}, float64(len(revokedResp.Raw)))
+}
+
+func TestCheckedRedisSourceNotesSource(t *testing.T) {
+	serial := big.NewInt(31337)
+	thisUpdate := time.Now().Truncate(time.Second).UTC()
+
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   thisUpdate,
+	})
+	test.AssertNotError(t, err, "making fake response")
+	revokedResp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber:     serial,
+		Status:           ocsp.Revoked,
+		RevokedAt:        thisUpdate,
+		RevocationReason: ocsp.KeyCompromise,
+		ThisUpdate:       thisUpdate,
+	})
+	test.AssertNotError(t, err, "making fake response")
+
+	source := recordingEchoSource{
+		echoSource: echoSource{resp: resp},
+		secondResp: &responder.Response{Response: revokedResp, Raw: revokedResp.Raw},
+		ch:         make(chan string, 1),
+	}
+	src := newCheckedRedisSource(source, echoSelector{status: statusModel{Status: core.OCSPStatusGood}}, nil, metrics.NoopRegisterer, blog.NewMock())
+	servedBy := func() string {
+		t.Helper()
+		ctx, behaviors := responder.WithBehaviors(context.Background())
+		_, err := src.Response(ctx, &ocsp.Request{SerialNumber: serial})
+		test.AssertNotError(t, err, "getting response")
+		return behaviors.Source()
+	}
+
+	// A response from Redis which agrees with the DB is noted as from redis.
+	test.AssertEquals(t, servedBy(), "redis")
+
+	// One re-signed for the DB's status is noted as from mysql.
+	src.dbMap = echoSelector{status: statusModel{
+		Status:        core.OCSPStatusRevoked,
+		RevokedDate:   thisUpdate,
+		RevokedReason: ocsp.KeyCompromise,
+	}}
+	test.AssertEquals(t, servedBy(), "mysql")
+}
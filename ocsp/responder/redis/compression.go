@@ -0,0 +1,39 @@
+package redis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// maxDecompressedSize bounds the size of a decompressed stored response, so
+// that a corrupt or malicious entry can't exhaust memory. Real responses are a
+// few kilobytes.
+const maxDecompressedSize = 64 * 1024
+
+// gzipMagic begins every gzip stream. It can't begin a DER-encoded OCSP
+// response, which is a SEQUENCE and so starts with 0x30.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompressStored returns the DER encoding of a response as stored in Redis.
+// Responses are normally stored as raw DER, but may be gzip-compressed to save
+// space; compressed reports which was found.
+func decompressStored(stored []byte) (der []byte, compressed bool, err error) {
+	if !bytes.HasPrefix(stored, gzipMagic) {
+		return stored, false, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(stored))
+	if err != nil {
+		return nil, true, fmt.Errorf("decompressing stored response: %w", err)
+	}
+	defer zr.Close()
+	der, err = io.ReadAll(io.LimitReader(zr, maxDecompressedSize+1))
+	if err != nil {
+		return nil, true, fmt.Errorf("decompressing stored response: %w", err)
+	}
+	if len(der) > maxDecompressedSize {
+		return nil, true, fmt.Errorf("decompressed stored response exceeds %d bytes", maxDecompressedSize)
+	}
+	return der, true, nil
+}
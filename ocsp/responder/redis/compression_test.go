@@ -0,0 +1,70 @@
+package redis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	ocsp_test "github.com/letsencrypt/boulder/ocsp/test"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(b)
+	test.AssertNotError(t, err, "compressing")
+	test.AssertNotError(t, zw.Close(), "closing gzip writer")
+	return buf.Bytes()
+}
+
+func TestStoredFormats(t *testing.T) {
+	clk := clock.NewFake()
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: big.NewInt(1),
+		ThisUpdate:   clk.Now(),
+		NextUpdate:   clk.Now().Add(time.Hour),
+	})
+	test.AssertNotError(t, err, "making fake response")
+
+	src, err := NewRedisSource(nil, panicSource{}, RedisSourceConfig{LiveSigningPeriod: time.Hour, LogSampleRate: 1}, clk, metrics.NoopRegisterer, log.NewMock())
+	test.AssertNotError(t, err, "making source")
+	redis := &cannedRedis{}
+	src.client = redis
+
+	for _, tc := range []struct {
+		format string
+		body   []byte
+	}{
+		{"raw", resp.Raw},
+		{"gzip", gzipBytes(t, resp.Raw)},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			redis.body = tc.body
+			served, err := src.Response(context.Background(), &ocsp.Request{SerialNumber: big.NewInt(1)})
+			test.AssertNotError(t, err, "serving stored response")
+			// Either way, the DER is served.
+			test.AssertByteEquals(t, served.Raw, resp.Raw)
+			test.AssertMetricWithLabelsEquals(t, src.storedFormats, prometheus.Labels{"format": tc.format}, 1)
+		})
+	}
+
+	// Corrupt and oversized compressed entries are refused rather than served.
+	redis.body = append([]byte{}, gzipMagic...)
+	_, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: big.NewInt(1)})
+	test.AssertError(t, err, "served corrupt compressed response")
+	redis.body = gzipBytes(t, make([]byte, maxDecompressedSize+1))
+	_, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: big.NewInt(1)})
+	test.AssertError(t, err, "served oversized compressed response")
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "decompress_error"}, 2)
+}
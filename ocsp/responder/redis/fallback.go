@@ -0,0 +1,92 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	"github.com/letsencrypt/boulder/rocsp"
+)
+
+// fallbackClient is a rocspClient which consults an ordered list of
+// independent Redis clusters. Lookups try each cluster in turn until one has
+// the response, stopping early if the context is done. Stores go to every
+// cluster, so that the fallbacks stay warm.
+type fallbackClient struct {
+	clients []rocspClient
+	names   []string
+	counter *prometheus.CounterVec
+}
+
+func newFallbackClient(clients []rocspClient, stats prometheus.Registerer) *fallbackClient {
+	names := make([]string, len(clients))
+	for i := range clients {
+		if i == 0 {
+			names[i] = "primary"
+		} else {
+			names[i] = fmt.Sprintf("fallback%d", i)
+		}
+	}
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocsp_redis_fallback_lookups",
+		Help: "Count of Redis lookups by cluster consulted and result",
+	}, []string{"redis", "result"})
+	stats.MustRegister(counter)
+
+	return &fallbackClient{
+		clients: clients,
+		names:   names,
+		counter: counter,
+	}
+}
+
+// GetResponse returns the response from the first cluster which has it. If
+// none do, it returns rocsp.ErrRedisNotFound if every cluster that could be
+// reached reported "not found", or the last error otherwise.
+func (fc *fallbackClient) GetResponse(ctx context.Context, serial string) ([]byte, error) {
+	var lastErr error
+	allNotFound := true
+	for i, client := range fc.clients {
+		if ctx.Err() != nil {
+			fc.counter.WithLabelValues(fc.names[i], "deadline").Inc()
+			return nil, ctx.Err()
+		}
+		resp, err := client.GetResponse(ctx, serial)
+		if err == nil {
+			fc.counter.WithLabelValues(fc.names[i], "success").Inc()
+			if i > 0 {
+				responder.NoteBehavior(ctx, "RedisFallbacks")
+			}
+			return resp, nil
+		}
+		lastErr = err
+		if errors.Is(err, rocsp.ErrRedisNotFound) {
+			fc.counter.WithLabelValues(fc.names[i], "not_found").Inc()
+		} else {
+			allNotFound = false
+			fc.counter.WithLabelValues(fc.names[i], "error").Inc()
+		}
+	}
+	if allNotFound {
+		return nil, rocsp.ErrRedisNotFound
+	}
+	return nil, lastErr
+}
+
+// StoreResponse stores the response in every cluster, returning the first
+// error encountered, if any.
+func (fc *fallbackClient) StoreResponse(ctx context.Context, resp *ocsp.Response) error {
+	var firstErr error
+	for _, client := range fc.clients {
+		err := client.StoreResponse(ctx, resp)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	ocsp_test "github.com/letsencrypt/boulder/ocsp/test"
+	"github.com/letsencrypt/boulder/rocsp"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// cannedRedis is a mock rocspClient which returns the same response for
+// every lookup, and records the serials stored to it.
+type cannedRedis struct {
+	body   []byte
+	stored []*big.Int
+}
+
+func (cr *cannedRedis) GetResponse(ctx context.Context, serial string) ([]byte, error) {
+	return cr.body, nil
+}
+
+func (cr *cannedRedis) StoreResponse(ctx context.Context, resp *ocsp.Response) error {
+	cr.stored = append(cr.stored, resp.SerialNumber)
+	return nil
+}
+
+func TestFallbackFirstFailsSecondServes(t *testing.T) {
+	clk := clock.NewFake()
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: big.NewInt(1),
+		ThisUpdate:   clk.Now(),
+		NextUpdate:   clk.Now().Add(time.Hour),
+	})
+	test.AssertNotError(t, err, "making fake response")
+
+	primary := &flakyRedis{down: true}
+	fallback := &cannedRedis{body: resp.Raw}
+	fc := newFallbackClient([]rocspClient{primary, fallback}, metrics.NoopRegisterer)
+
+	src, err := NewRedisSource(nil, panicSource{}, RedisSourceConfig{LiveSigningPeriod: time.Hour, LogSampleRate: 1}, clk, metrics.NoopRegisterer, log.NewMock())
+	test.AssertNotError(t, err, "making source")
+	src.client = fc
+
+	served, err := src.Response(context.Background(), &ocsp.Request{SerialNumber: big.NewInt(1)})
+	test.AssertNotError(t, err, "getting response")
+	test.AssertByteEquals(t, served.Raw, resp.Raw)
+	test.AssertEquals(t, primary.calls, 1)
+
+	test.AssertMetricWithLabelsEquals(t, fc.counter, prometheus.Labels{"redis": "primary", "result": "error"}, 1)
+	test.AssertMetricWithLabelsEquals(t, fc.counter, prometheus.Labels{"redis": "fallback1", "result": "success"}, 1)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "success"}, 1)
+}
+
+func TestFallbackMisses(t *testing.T) {
+	ctx := context.Background()
+
+	// If every cluster misses, the lookup is a miss.
+	fc := newFallbackClient([]rocspClient{&flakyRedis{}, &flakyRedis{}}, metrics.NoopRegisterer)
+	_, err := fc.GetResponse(ctx, "00")
+	test.AssertErrorIs(t, err, rocsp.ErrRedisNotFound)
+	test.AssertMetricWithLabelsEquals(t, fc.counter, prometheus.Labels{"redis": "fallback1", "result": "not_found"}, 1)
+
+	// If any cluster errors and none have the response, the error is returned.
+	fc = newFallbackClient([]rocspClient{&flakyRedis{}, &flakyRedis{down: true}}, metrics.NoopRegisterer)
+	_, err = fc.GetResponse(ctx, "00")
+	test.AssertError(t, err, "expected error")
+	test.Assert(t, !errors.Is(err, rocsp.ErrRedisNotFound), "error should not be a miss")
+
+	// Once the context is done, no further clusters are tried.
+	second := &flakyRedis{}
+	fc = newFallbackClient([]rocspClient{&flakyRedis{down: true}, second}, metrics.NoopRegisterer)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = fc.GetResponse(cancelled, "00")
+	test.AssertErrorIs(t, err, context.Canceled)
+	test.AssertEquals(t, second.calls, 0)
+}
+
+func TestFallbackStoresToAll(t *testing.T) {
+	first := &cannedRedis{}
+	second := &cannedRedis{}
+	fc := newFallbackClient([]rocspClient{first, second}, metrics.NoopRegisterer)
+	err := fc.StoreResponse(context.Background(), &ocsp.Response{SerialNumber: big.NewInt(7)})
+	test.AssertNotError(t, err, "storing response")
+	test.AssertEquals(t, len(first.stored), 1)
+	test.AssertEquals(t, len(second.stored), 1)
+
+	fc = newFallbackClient([]rocspClient{&flakyRedis{down: true}, second}, metrics.NoopRegisterer)
+	err = fc.StoreResponse(context.Background(), &ocsp.Response{SerialNumber: big.NewInt(8)})
+	test.AssertError(t, err, "expected error from failing cluster")
+	test.AssertEquals(t, len(second.stored), 2)
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// lookupLimiter caps the number of Redis lookups the checkedRedisSource may
+// have in flight at once, independently of its DB lookups. When Redis is the
+// bottleneck, requests beyond the limit skip Redis and are answered from the
+// DB's status alone. A nil *lookupLimiter imposes no limit.
+type lookupLimiter struct {
+	limit    int64
+	inFlight atomic.Int64
+}
+
+// newLookupLimiter returns a lookupLimiter allowing at most limit lookups at
+// once, and exports the number in flight as a gauge. If limit is zero, it
+// returns nil, meaning no limit.
+func newLookupLimiter(limit int, stats prometheus.Registerer) *lookupLimiter {
+	if limit == 0 {
+		return nil
+	}
+	l := &lookupLimiter{limit: int64(limit)}
+	stats.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ocsp_redis_lookups_in_flight",
+		Help: "Number of Redis lookups currently in flight from the checked Redis source, out of the configured limit",
+	}, func() float64 {
+		return float64(l.inFlight.Load())
+	}))
+	return l
+}
+
+// acquire reserves a lookup, returning false if the limit has been reached.
+// Each successful acquire must be paired with a release.
+func (l *lookupLimiter) acquire() bool {
+	if l == nil {
+		return true
+	}
+	if l.inFlight.Add(1) > l.limit {
+		l.inFlight.Add(-1)
+		return false
+	}
+	return true
+}
+
+// release returns a lookup reserved by acquire.
+func (l *lookupLimiter) release() {
+	if l == nil {
+		return
+	}
+	l.inFlight.Add(-1)
+}
@@ -0,0 +1,70 @@
+package redis
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	ocsp_test "github.com/letsencrypt/boulder/ocsp/test"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestLookupLimiter(t *testing.T) {
+	var unlimited *lookupLimiter
+	test.Assert(t, unlimited.acquire(), "nil limiter should never be saturated")
+	unlimited.release()
+
+	test.Assert(t, newLookupLimiter(0, metrics.NoopRegisterer) == nil, "zero limit should mean no limiter")
+
+	l := newLookupLimiter(2, metrics.NoopRegisterer)
+	test.Assert(t, l.acquire(), "acquiring within limit")
+	test.Assert(t, l.acquire(), "acquiring up to limit")
+	test.Assert(t, !l.acquire(), "acquiring beyond limit should fail")
+	test.AssertEquals(t, l.inFlight.Load(), int64(2))
+	l.release()
+	l.release()
+	test.AssertEquals(t, l.inFlight.Load(), int64(0))
+}
+
+func TestCheckedRedisSourceRedisLookupsSaturated(t *testing.T) {
+	serial := big.NewInt(17778)
+	thisUpdate := time.Now().Truncate(time.Second).UTC()
+	redisResp, _, err := ocsp_test.FakeResponse(ocsp.Response{SerialNumber: serial, Status: ocsp.Good, ThisUpdate: thisUpdate})
+	test.AssertNotError(t, err, "making fake response")
+	freshResp, _, err := ocsp_test.FakeResponse(ocsp.Response{SerialNumber: serial, Status: ocsp.Good, ThisUpdate: thisUpdate})
+	test.AssertNotError(t, err, "making fake response")
+
+	base := recordingEchoSource{
+		echoSource: echoSource{resp: redisResp},
+		secondResp: &responder.Response{Response: freshResp, Raw: freshResp.Raw},
+		ch:         make(chan string, 1),
+	}
+	src := newCheckedRedisSource(base, echoSelector{status: statusModel{Status: core.OCSPStatusGood}}, nil, metrics.NoopRegisterer, blog.NewMock())
+	src.redisLookups = newLookupLimiter(1, metrics.NoopRegisterer)
+
+	// Simulate another request's Redis lookup holding the only slot. This
+	// request skips Redis, and is served a fresh response for the DB's status.
+	test.Assert(t, src.redisLookups.acquire(), "acquiring lookup")
+	resp, err := src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+	test.AssertNotError(t, err, "getting response while saturated")
+	test.AssertByteEquals(t, resp.Raw, freshResp.Raw)
+	test.AssertEquals(t, <-base.ch, serial.String())
+	test.AssertMetricWithLabelsEquals(t, src.counter, map[string]string{"result": "redis_lookup_shed"}, 1)
+
+	// Once the slot is released, responses come from Redis again, and the
+	// slot isn't leaked.
+	src.redisLookups.release()
+	resp, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+	test.AssertNotError(t, err, "getting response after release")
+	test.AssertByteEquals(t, resp.Raw, redisResp.Raw)
+	test.AssertEquals(t, len(base.ch), 0)
+	test.AssertMetricWithLabelsEquals(t, src.counter, map[string]string{"result": "success"}, 1)
+	test.AssertEquals(t, src.redisLookups.inFlight.Load(), int64(0))
+}
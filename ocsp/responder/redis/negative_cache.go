@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/letsencrypt/boulder/config"
+)
+
+// maxNegativeCacheTTL bounds NegativeCacheConfig.TTL. A serial can be looked
+// up before its certificateStatus row exists, so caching "not found" for any
+// longer risks hiding newly issued certificates.
+const maxNegativeCacheTTL = time.Minute
+
+// NegativeCacheConfig configures a cache of serials recently found to have no
+// certificateStatus row. Repeated requests for them, as sent by scanners, are
+// answered as not found without a DB or Redis lookup. The zero value disables
+// the cache.
+type NegativeCacheConfig struct {
+	// TTL is how long a serial is remembered as not found. Zero disables the
+	// cache. It may be at most one minute.
+	TTL config.Duration `validate:"-"`
+
+	// Size is the most serials remembered at once. When full, the oldest
+	// serial is forgotten first. This defaults to 10000.
+	Size int `validate:"min=0"`
+}
+
+// negativeCache remembers serials which were recently not found, for a fixed
+// TTL, in a bounded FIFO. A nil *negativeCache remembers nothing.
+type negativeCache struct {
+	ttl  time.Duration
+	clk  clock.Clock
+	hits prometheus.Counter
+
+	mu      sync.Mutex
+	expires map[string]time.Time
+	// order holds the cached serials in insertion order, as a ring buffer, so
+	// the oldest can be evicted when the cache is full.
+	order []string
+	next  int
+}
+
+// newNegativeCache returns a negativeCache as configured by conf, or nil if
+// conf has no TTL. Hits are counted by hits.
+func newNegativeCache(conf NegativeCacheConfig, clk clock.Clock, hits prometheus.Counter) (*negativeCache, error) {
+	if conf.TTL.Duration == 0 {
+		return nil, nil
+	}
+	if conf.TTL.Duration < 0 || conf.TTL.Duration > maxNegativeCacheTTL {
+		return nil, fmt.Errorf("negative cache TTL %s must be between 0 and %s", conf.TTL.Duration, maxNegativeCacheTTL)
+	}
+	size := conf.Size
+	if size == 0 {
+		size = 10000
+	}
+	return &negativeCache{
+		ttl:     conf.TTL.Duration,
+		clk:     clk,
+		hits:    hits,
+		expires: make(map[string]time.Time, size),
+		order:   make([]string, 0, size),
+	}, nil
+}
+
+// contains returns true, and counts a hit, if serial was added less than the
+// TTL ago.
+func (nc *negativeCache) contains(serial string) bool {
+	if nc == nil {
+		return false
+	}
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	expires, ok := nc.expires[serial]
+	if !ok || !nc.clk.Now().Before(expires) {
+		return false
+	}
+	nc.hits.Inc()
+	return true
+}
+
+// add remembers serial as not found for the TTL, evicting the oldest serial
+// if the cache is full.
+func (nc *negativeCache) add(serial string) {
+	if nc == nil {
+		return
+	}
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if _, ok := nc.expires[serial]; ok {
+		// Refresh the expiry, but leave its place in the eviction order.
+		nc.expires[serial] = nc.clk.Now().Add(nc.ttl)
+		return
+	}
+	if len(nc.order) < cap(nc.order) {
+		nc.order = append(nc.order, serial)
+	} else {
+		delete(nc.expires, nc.order[nc.next])
+		nc.order[nc.next] = serial
+		nc.next = (nc.next + 1) % len(nc.order)
+	}
+	nc.expires[serial] = nc.clk.Now().Add(nc.ttl)
+}
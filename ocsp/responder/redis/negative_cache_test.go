@@ -0,0 +1,145 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/config"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	ocsp_test "github.com/letsencrypt/boulder/ocsp/test"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// countingNotFoundSelector acts like notFoundSelector, counting the calls
+// made.
+type countingNotFoundSelector struct {
+	notFoundSelector
+	calls *atomic.Int64
+}
+
+func (s countingNotFoundSelector) SelectOne(ctx context.Context, output interface{}, query string, args ...interface{}) error {
+	s.calls.Add(1)
+	return s.notFoundSelector.SelectOne(ctx, output, query, args...)
+}
+
+// issuedCheckErrorSelector has no certificateStatus row for any serial, and
+// fails to look up the serials table, counting the calls made.
+type issuedCheckErrorSelector struct {
+	notFoundSelector
+	calls *atomic.Int64
+}
+
+func (s issuedCheckErrorSelector) SelectOne(ctx context.Context, output interface{}, query string, args ...interface{}) error {
+	s.calls.Add(1)
+	if _, ok := output.(*time.Time); ok {
+		return errors.New("connection reset")
+	}
+	return s.notFoundSelector.SelectOne(ctx, output, query, args...)
+}
+
+func TestNegativeCache(t *testing.T) {
+	clk := clock.NewFake()
+	hits := prometheus.NewCounter(prometheus.CounterOpts{Name: "hits"})
+	nc, err := newNegativeCache(NegativeCacheConfig{TTL: config.Duration{Duration: 10 * time.Second}, Size: 2}, clk, hits)
+	test.AssertNotError(t, err, "creating negative cache")
+
+	nc.add("a")
+	test.Assert(t, nc.contains("a"), "expected a to be cached")
+	test.Assert(t, !nc.contains("b"), "expected b not to be cached")
+
+	// Entries expire after the TTL.
+	clk.Add(10 * time.Second)
+	test.Assert(t, !nc.contains("a"), "expected a to have expired")
+
+	// The oldest entry is evicted when the cache is full.
+	nc.add("a")
+	nc.add("b")
+	nc.add("c")
+	test.Assert(t, !nc.contains("a"), "expected a to have been evicted")
+	test.Assert(t, nc.contains("b"), "expected b to be cached")
+	test.Assert(t, nc.contains("c"), "expected c to be cached")
+	test.AssertEquals(t, len(nc.expires), 2)
+	test.AssertMetricWithLabelsEquals(t, hits, prometheus.Labels{}, 3)
+
+	// A nil cache, as returned when disabled, remembers nothing.
+	nc, err = newNegativeCache(NegativeCacheConfig{}, clk, hits)
+	test.AssertNotError(t, err, "creating disabled negative cache")
+	test.Assert(t, nc == nil, "expected disabled negative cache to be nil")
+	nc.add("a")
+	test.Assert(t, !nc.contains("a"), "expected disabled cache to be empty")
+
+	_, err = newNegativeCache(NegativeCacheConfig{TTL: config.Duration{Duration: time.Hour}}, clk, hits)
+	test.AssertError(t, err, "created negative cache with a long TTL")
+}
+
+func TestCheckedRedisSourceNegativeCache(t *testing.T) {
+	serial := big.NewInt(404)
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   time.Now().Truncate(time.Second).UTC(),
+	})
+	test.AssertNotError(t, err, "making fake response")
+
+	var calls atomic.Int64
+	clk := clock.NewFake()
+	src := newCheckedRedisSource(echoSource{resp: resp}, countingNotFoundSelector{calls: &calls}, nil, metrics.NoopRegisterer, blog.NewMock())
+	src.negative, err = newNegativeCache(NegativeCacheConfig{TTL: config.Duration{Duration: 5 * time.Second}}, clk, src.negativeHits)
+	test.AssertNotError(t, err, "creating negative cache")
+
+	req := &ocsp.Request{SerialNumber: serial}
+	for range 3 {
+		_, err = src.Response(context.Background(), req)
+		test.AssertErrorIs(t, err, responder.ErrNotFound)
+	}
+	test.AssertEquals(t, calls.Load(), int64(1))
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "not_found"}, 1)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "negative_cache_hit"}, 2)
+	test.AssertMetricWithLabelsEquals(t, src.negativeHits, prometheus.Labels{}, 2)
+
+	// Once the TTL has passed, the DB is consulted again.
+	clk.Add(5 * time.Second)
+	_, err = src.Response(context.Background(), req)
+	test.AssertErrorIs(t, err, responder.ErrNotFound)
+	test.AssertEquals(t, calls.Load(), int64(2))
+	test.AssertMetricWithLabelsEquals(t, src.negativeHits, prometheus.Labels{}, 2)
+}
+
+func TestCheckedRedisSourceNegativeCacheIssuedCheckError(t *testing.T) {
+	serial := big.NewInt(405)
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   time.Now().Truncate(time.Second).UTC(),
+	})
+	test.AssertNotError(t, err, "making fake response")
+
+	var calls atomic.Int64
+	src := newCheckedRedisSource(echoSource{resp: resp}, issuedCheckErrorSelector{calls: &calls}, nil, metrics.NoopRegisterer, blog.NewMock())
+	src.missing = MissingStatusConfig{CheckIssued: true}
+	src.clk = clock.NewFake()
+	src.negative, err = newNegativeCache(NegativeCacheConfig{TTL: config.Duration{Duration: 5 * time.Second}}, src.clk, src.negativeHits)
+	test.AssertNotError(t, err, "creating negative cache")
+
+	// If we can't tell whether the serial was issued, the request fails
+	// rather than being answered as not found, and nothing is cached.
+	req := &ocsp.Request{SerialNumber: serial}
+	for range 2 {
+		_, err = src.Response(context.Background(), req)
+		test.AssertError(t, err, "expected error when the issued check fails")
+		test.Assert(t, !errors.Is(err, responder.ErrNotFound), "failed issued check answered as not found")
+	}
+	test.AssertEquals(t, calls.Load(), int64(4))
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "not_found_issued_check_error"}, 2)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "negative_cache_hit"}, 0)
+}
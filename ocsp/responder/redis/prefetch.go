@@ -0,0 +1,178 @@
+package redis
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/config"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/rocsp"
+)
+
+// PrefetchConfig configures a background job which periodically scans Redis
+// for responses that will soon need re-signing, and re-signs them ahead of
+// time so that clients don't have to wait for live signing.
+type PrefetchConfig struct {
+	// Period is how often Redis is scanned. Zero disables prefetching.
+	Period config.Duration `validate:"-"`
+
+	// Window is how far ahead to look: responses which will become stale (or
+	// reach their NextUpdate) within Window of the scan are refreshed.
+	Window config.Duration `validate:"-"`
+
+	// RefreshesPerSecond limits how fast responses are re-signed. Defaults to
+	// 10.
+	RefreshesPerSecond int `validate:"min=0"`
+
+	// Parallelism limits how many re-signings may be in flight at once.
+	// Defaults to 5.
+	Parallelism int `validate:"min=0"`
+}
+
+// responseScanner is the subset of *rocsp.ROClient used by the prefetcher.
+type responseScanner interface {
+	ScanResponses(ctx context.Context, serialPattern string) <-chan rocsp.ScanResponsesResult
+}
+
+type prefetcher struct {
+	scanner     responseScanner
+	src         *redisSource
+	period      time.Duration
+	window      time.Duration
+	frequency   time.Duration
+	parallelism int
+	counter     *prometheus.CounterVec
+	log         blog.Logger
+	clk         clock.Clock
+}
+
+// NewPrefetcher returns a prefetcher which scans client for responses nearing
+// staleness, and refreshes them using src's signer.
+func NewPrefetcher(client *rocsp.RWClient, src *redisSource, conf PrefetchConfig, stats prometheus.Registerer, log blog.Logger) *prefetcher {
+	return newPrefetcher(client, src, conf, stats, log)
+}
+
+func newPrefetcher(scanner responseScanner, src *redisSource, conf PrefetchConfig, stats prometheus.Registerer, log blog.Logger) *prefetcher {
+	refreshesPerSecond := conf.RefreshesPerSecond
+	if refreshesPerSecond == 0 {
+		refreshesPerSecond = 10
+	}
+	parallelism := conf.Parallelism
+	if parallelism == 0 {
+		parallelism = 5
+	}
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocsp_redis_prefetch",
+		Help: "Count of responses examined by the Redis prefetcher, by result",
+	}, []string{"result"})
+	stats.MustRegister(counter)
+
+	return &prefetcher{
+		scanner:     scanner,
+		src:         src,
+		period:      conf.Period.Duration,
+		window:      conf.Window.Duration,
+		frequency:   time.Second / time.Duration(refreshesPerSecond),
+		parallelism: parallelism,
+		counter:     counter,
+		log:         log,
+		clk:         src.clk,
+	}
+}
+
+// Run scans and refreshes once per period until ctx is cancelled.
+func (p *prefetcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.period)
+	defer ticker.Stop()
+	for {
+		refreshed := p.runOnce(ctx)
+		p.log.Infof("Prefetch pass refreshed %d responses", refreshed)
+
+		select {
+		case <-ticker.C:
+			continue
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// needsRefresh returns true if resp will be considered stale by the
+// redisSource, or will pass its NextUpdate, within the prefetch window.
+func (p *prefetcher) needsRefresh(resp *ocsp.Response) bool {
+	horizon := p.clk.Now().Add(p.window)
+	return horizon.Sub(resp.ThisUpdate) > p.src.liveSigningPeriod || !horizon.Before(resp.NextUpdate)
+}
+
+// runOnce performs a single scan of Redis, re-signing and storing every
+// response which needs a refresh. It returns the number of responses
+// successfully refreshed.
+func (p *prefetcher) runOnce(ctx context.Context) int {
+	serials := make(chan *big.Int)
+	go func() {
+		defer close(serials)
+		limiter := time.NewTicker(p.frequency)
+		defer limiter.Stop()
+		for result := range p.scanner.ScanResponses(ctx, "*") {
+			if result.Err != nil {
+				p.counter.WithLabelValues("scan_error").Inc()
+				p.log.Errf("scanning for responses to prefetch: %s", result.Err)
+				continue
+			}
+			der, _, err := decompressStored(result.Body)
+			if err != nil {
+				p.counter.WithLabelValues("parse_error").Inc()
+				continue
+			}
+			resp, err := ocsp.ParseResponse(der, nil)
+			if err != nil {
+				p.counter.WithLabelValues("parse_error").Inc()
+				continue
+			}
+			if !p.needsRefresh(resp) {
+				p.counter.WithLabelValues("fresh").Inc()
+				continue
+			}
+			select {
+			case <-limiter.C:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case serials <- resp.SerialNumber:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var refreshed int
+	for range p.parallelism {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for serial := range serials {
+				_, err := p.src.signAndSave(ctx, &ocsp.Request{SerialNumber: serial}, causePrefetch)
+				if err != nil {
+					p.counter.WithLabelValues("refresh_error").Inc()
+					continue
+				}
+				p.counter.WithLabelValues("refreshed").Inc()
+				mu.Lock()
+				refreshed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return refreshed
+}
@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/config"
+	"github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	ocsp_test "github.com/letsencrypt/boulder/ocsp/test"
+	"github.com/letsencrypt/boulder/rocsp"
+	"github.com/letsencrypt/boulder/test"
+	"golang.org/x/crypto/ocsp"
+)
+
+// fakeScanner emits a fixed set of responses from ScanResponses.
+type fakeScanner struct {
+	results []rocsp.ScanResponsesResult
+}
+
+func (fs *fakeScanner) ScanResponses(ctx context.Context, serialPattern string) <-chan rocsp.ScanResponsesResult {
+	results := make(chan rocsp.ScanResponsesResult)
+	go func() {
+		defer close(results)
+		for _, r := range fs.results {
+			results <- r
+		}
+	}()
+	return results
+}
+
+// multiSigner signs a fake response for any serial, and records every serial
+// it was asked to sign.
+type multiSigner struct {
+	sync.Mutex
+	requested []int64
+}
+
+func (ms *multiSigner) Response(ctx context.Context, req *ocsp.Request) (*responder.Response, error) {
+	ms.Lock()
+	defer ms.Unlock()
+	ms.requested = append(ms.requested, req.SerialNumber.Int64())
+	return &responder.Response{Response: &ocsp.Response{
+		SerialNumber: req.SerialNumber,
+	}}, nil
+}
+
+func TestPrefetchRefreshesNearExpiry(t *testing.T) {
+	clk := clock.NewFake()
+	now := clk.Now()
+	signer := &multiSigner{}
+	src, err := NewRedisSource(nil, signer, RedisSourceConfig{LiveSigningPeriod: 60 * time.Hour, LogSampleRate: 1}, clk, metrics.NoopRegisterer, log.NewMock())
+	test.AssertNotError(t, err, "making source")
+	stored := make(chan *big.Int, 10)
+	src.client = &notFoundRedis{stored}
+
+	scanResult := func(serial int64, thisUpdate, nextUpdate time.Time) rocsp.ScanResponsesResult {
+		resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+			SerialNumber: big.NewInt(serial),
+			Status:       ocsp.Good,
+			ThisUpdate:   thisUpdate,
+			NextUpdate:   nextUpdate,
+		})
+		test.AssertNotError(t, err, "making fake response")
+		return rocsp.ScanResponsesResult{Body: resp.Raw}
+	}
+	scanner := &fakeScanner{[]rocsp.ScanResponsesResult{
+		// Fresh: signed just now, valid for a week.
+		scanResult(1, now, now.Add(7*24*time.Hour)),
+		// Becomes stale within the window.
+		scanResult(2, now.Add(-58*time.Hour), now.Add(7*24*time.Hour)),
+		// Reaches NextUpdate within the window.
+		scanResult(3, now.Add(-time.Hour), now.Add(time.Hour)),
+		// Garbage.
+		{Body: []byte("not an OCSP response")},
+	}}
+
+	p := newPrefetcher(scanner, src, PrefetchConfig{
+		Period:             config.Duration{Duration: time.Hour},
+		Window:             config.Duration{Duration: 6 * time.Hour},
+		RefreshesPerSecond: 1000,
+		Parallelism:        2,
+	}, metrics.NoopRegisterer, log.NewMock())
+
+	refreshed := p.runOnce(context.Background())
+	test.AssertEquals(t, refreshed, 2)
+
+	sort.Slice(signer.requested, func(i, j int) bool { return signer.requested[i] < signer.requested[j] })
+	test.AssertDeepEquals(t, signer.requested, []int64{2, 3})
+
+	var storedSerials []int64
+	for range 2 {
+		storedSerials = append(storedSerials, (<-stored).Int64())
+	}
+	sort.Slice(storedSerials, func(i, j int) bool { return storedSerials[i] < storedSerials[j] })
+	test.AssertDeepEquals(t, storedSerials, []int64{2, 3})
+
+	test.AssertMetricWithLabelsEquals(t, p.counter, map[string]string{"result": "refreshed"}, 2)
+	test.AssertMetricWithLabelsEquals(t, p.counter, map[string]string{"result": "fresh"}, 1)
+	test.AssertMetricWithLabelsEquals(t, p.counter, map[string]string{"result": "parse_error"}, 1)
+}
@@ -0,0 +1,51 @@
+package redis
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// successRatioWindow is the number of most recent lookups over which success
+// ratios are computed.
+const successRatioWindow = 1000
+
+// successRatio tracks the fraction of the most recent lookups which succeeded,
+// and exports it as a gauge. Prometheus can compute the same thing from the
+// counters, but a gauge is easier to read from /metrics during an incident.
+type successRatio struct {
+	gauge prometheus.Gauge
+
+	mu        sync.Mutex
+	outcomes  []bool
+	next      int
+	filled    int
+	successes int
+}
+
+func newSuccessRatio(window int, gauge prometheus.Gauge) *successRatio {
+	return &successRatio{
+		gauge:    gauge,
+		outcomes: make([]bool, window),
+	}
+}
+
+// record adds the outcome of a lookup to the window, evicting the oldest
+// outcome if the window is full, and updates the gauge.
+func (r *successRatio) record(success bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.filled == len(r.outcomes) {
+		if r.outcomes[r.next] {
+			r.successes--
+		}
+	} else {
+		r.filled++
+	}
+	r.outcomes[r.next] = success
+	if success {
+		r.successes++
+	}
+	r.next = (r.next + 1) % len(r.outcomes)
+	r.gauge.Set(float64(r.successes) / float64(r.filled))
+}
@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	ocsp_test "github.com/letsencrypt/boulder/ocsp/test"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestSuccessRatioWindow(t *testing.T) {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_ratio"})
+	r := newSuccessRatio(4, gauge)
+
+	r.record(true)
+	test.AssertMetricWithLabelsEquals(t, gauge, nil, 1)
+	r.record(false)
+	test.AssertMetricWithLabelsEquals(t, gauge, nil, 0.5)
+	r.record(false)
+	r.record(true)
+	test.AssertMetricWithLabelsEquals(t, gauge, nil, 0.5)
+
+	// The window is full, so each new outcome evicts the oldest one.
+	r.record(false) // evicts true
+	test.AssertMetricWithLabelsEquals(t, gauge, nil, 0.25)
+	r.record(true) // evicts false
+	test.AssertMetricWithLabelsEquals(t, gauge, nil, 0.5)
+	r.record(true) // evicts false
+	r.record(true) // evicts true
+	test.AssertMetricWithLabelsEquals(t, gauge, nil, 0.75)
+}
+
+func TestCheckedRedisSourceSuccessRatios(t *testing.T) {
+	serial := big.NewInt(17777)
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   time.Now().Truncate(time.Second).UTC(),
+	})
+	test.AssertNotError(t, err, "making fake response")
+	good := echoSelector{status: statusModel{Status: core.OCSPStatusGood}}
+
+	src := newCheckedRedisSource(echoSource{resp: resp}, good, nil, metrics.NoopRegisterer, blog.NewMock())
+	lookup := func() {
+		_, _ = src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+	}
+
+	lookup()
+	lookup()
+	test.AssertMetricWithLabelsEquals(t, src.dbRatio.gauge, nil, 1)
+	test.AssertMetricWithLabelsEquals(t, src.redisRatio.gauge, nil, 1)
+
+	// A DB error lowers only the mysql ratio.
+	src.dbMap = errorSelector{}
+	lookup()
+	test.AssertMetricWithLabelsEquals(t, src.dbRatio.gauge, nil, 2.0/3)
+	test.AssertMetricWithLabelsEquals(t, src.redisRatio.gauge, nil, 1)
+
+	// A Redis error lowers only the redis ratio.
+	src.dbMap = good
+	src.base = errorSource{}
+	lookup()
+	test.AssertMetricWithLabelsEquals(t, src.dbRatio.gauge, nil, 0.75)
+	test.AssertMetricWithLabelsEquals(t, src.redisRatio.gauge, nil, 0.75)
+
+	// "Not found" from the DB is a successful lookup.
+	src.dbMap = notFoundSelector{}
+	src.base = echoSource{resp: resp}
+	lookup()
+	test.AssertMetricWithLabelsEquals(t, src.dbRatio.gauge, nil, 0.8)
+	test.AssertMetricWithLabelsEquals(t, src.redisRatio.gauge, nil, 0.8)
+}
@@ -16,7 +16,11 @@ package redis
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 	"time"
 
 	"github.com/jmhodges/clock"
@@ -30,38 +34,87 @@ import (
 	berrors "github.com/letsencrypt/boulder/errors"
 )
 
+// SerialCase is the hex casing of the serials in the Redis keys under which
+// responses are expected to be stored.
+type SerialCase string
+
+const (
+	// SerialCaseLower matches the keys written by rocsp, and is the default.
+	SerialCaseLower SerialCase = "lower"
+	// SerialCaseUpper is for keys written by other tools which use uppercase
+	// hex serials.
+	SerialCaseUpper SerialCase = "upper"
+)
+
 type rocspClient interface {
 	GetResponse(ctx context.Context, serial string) ([]byte, error)
 	StoreResponse(ctx context.Context, resp *ocsp.Response) error
 }
 
+// redisSource serves responses from Redis, signing fresh ones when they are
+// missing or stale. It doesn't check that a response is from the requested
+// issuer: the filterSource which wraps every source in ocsp-responder checks
+// that for each response it serves, however it was found.
 type redisSource struct {
-	client             rocspClient
+	client rocspClient
+	// issuerClients are the clients for issuers whose responses are kept
+	// apart, keyed by lowercase hex SHA-1 issuer key hash. Requests for
+	// other issuers use client.
+	issuerClients      map[string]rocspClient
 	signer             responder.Source
 	counter            *prometheus.CounterVec
 	signAndSaveCounter *prometheus.CounterVec
 	cachedResponseAges prometheus.Histogram
-	clk                clock.Clock
-	liveSigningPeriod  time.Duration
+	// storedFormats counts the responses found in Redis by whether they were
+	// stored compressed or as raw DER.
+	storedFormats     *prometheus.CounterVec
+	clk               clock.Clock
+	liveSigningPeriod time.Duration
+	serialCase        SerialCase
+	budget            *goroutineBudget
 	// Error logs will be emitted at a rate of 1 in logSampleRate.
 	// If logSampleRate is 0, no logs will be emitted.
 	logSampleRate int
-	// Note: this logger is not currently used, as all audit log events are from
-	// the dbSource right now, but it should and will be used in the future.
+	// log receives the sampled errors, such as failed Redis lookups and
+	// unknown serials.
 	log blog.Logger
 }
 
-// NewRedisSource returns a responder.Source which will look up OCSP responses in a
-// Redis table.
-func NewRedisSource(
-	client *rocsp.RWClient,
-	signer responder.Source,
-	liveSigningPeriod time.Duration,
-	clk clock.Clock,
-	stats prometheus.Registerer,
-	log blog.Logger,
-	logSampleRate int,
-) (*redisSource, error) {
+// RedisSourceConfig configures a redisSource beyond its primary client and
+// signer. The zero value of each field leaves the corresponding feature
+// disabled.
+type RedisSourceConfig struct {
+	// Fallbacks are tried in order for lookups which miss or fail in the
+	// primary client, and fresh responses are stored to all of them.
+	Fallbacks []*rocsp.RWClient
+
+	// IssuerClients, keyed by hex SHA-1 issuer key hash, route the lookups
+	// and stores for those issuers to their own client. They aren't guarded
+	// by the breaker, nor backed by the fallbacks.
+	IssuerClients map[string]*rocsp.RWClient
+
+	// LiveSigningPeriod is the age past which a stored response is stale and
+	// signed again.
+	LiveSigningPeriod time.Duration
+
+	// Breaker configures a circuit breaker around the primary client.
+	Breaker BreakerConfig
+
+	// SerialCase is the case of the serials which responses are looked up
+	// under first.
+	SerialCase SerialCase
+
+	// Budget, if non-nil, bounds the goroutines spawned to store responses.
+	Budget *goroutineBudget
+
+	// LogSampleRate causes 1 in LogSampleRate errors to be logged.
+	LogSampleRate int
+}
+
+// NewRedisSource returns a responder.Source which will look up OCSP responses
+// in Redis through client, signing fresh ones with signer when they are
+// missing or stale.
+func NewRedisSource(client *rocsp.RWClient, signer responder.Source, conf RedisSourceConfig, clk clock.Clock, stats prometheus.Registerer, log blog.Logger) (*redisSource, error) {
 	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "ocsp_redis_responses",
 		Help: "Count of OCSP requests/responses by action taken by the redisSource",
@@ -87,31 +140,71 @@ func NewRedisSource(
 	})
 	stats.MustRegister(cachedResponseAges)
 
+	storedFormats := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocsp_redis_stored_formats",
+		Help: "Count of responses retrieved from Redis, by stored format (raw or gzip)",
+	}, []string{"format"})
+	stats.MustRegister(storedFormats)
+
 	var rocspReader rocspClient
 	if client != nil {
 		rocspReader = client
 	}
+	if conf.Breaker.FailureThreshold > 0 {
+		rocspReader = newBreakerClient(rocspReader, conf.Breaker, clk, stats)
+	}
+	if len(conf.Fallbacks) > 0 {
+		clients := []rocspClient{rocspReader}
+		for _, fallback := range conf.Fallbacks {
+			clients = append(clients, fallback)
+		}
+		rocspReader = newFallbackClient(clients, stats)
+	}
+	var issuerReaders map[string]rocspClient
+	if len(conf.IssuerClients) > 0 {
+		issuerReaders = make(map[string]rocspClient, len(conf.IssuerClients))
+		for keyHash, issuerClient := range conf.IssuerClients {
+			issuerReaders[strings.ToLower(keyHash)] = issuerClient
+		}
+	}
 	return &redisSource{
 		client:             rocspReader,
+		issuerClients:      issuerReaders,
 		signer:             signer,
 		counter:            counter,
 		signAndSaveCounter: signAndSaveCounter,
 		cachedResponseAges: cachedResponseAges,
-		liveSigningPeriod:  liveSigningPeriod,
+		storedFormats:      storedFormats,
+		liveSigningPeriod:  conf.LiveSigningPeriod,
+		serialCase:         conf.SerialCase,
+		budget:             conf.Budget,
 		clk:                clk,
+		logSampleRate:      conf.LogSampleRate,
 		log:                log,
 	}, nil
 }
 
 // Response implements the responder.Source interface. It looks up the requested OCSP
-// response in the redis cluster.
+// response in the redis cluster. On a miss, or if the cached response is stale,
+// a fresh response is signed and written back to Redis asynchronously, so that
+// subsequent requests for the same serial are served from the cache.
 func (src *redisSource) Response(ctx context.Context, req *ocsp.Request) (*responder.Response, error) {
-	serialString := core.SerialToString(req.SerialNumber)
-
-	respBytes, err := src.client.GetResponse(ctx, serialString)
+	client := src.clientFor(req)
+	var respBytes []byte
+	err := withRetries(ctx, func() error {
+		var err error
+		respBytes, err = src.getResponse(ctx, client, req.SerialNumber)
+		return err
+	}, func(err error) bool {
+		return !errors.Is(err, rocsp.ErrRedisNotFound) && !errors.Is(err, errBreakerOpen)
+	})
 	if err != nil {
 		if errors.Is(err, rocsp.ErrRedisNotFound) {
 			src.counter.WithLabelValues("not_found").Inc()
+		} else if errors.Is(err, errBreakerOpen) {
+			// Don't log here: while the breaker is open every request would.
+			src.counter.WithLabelValues("breaker_open").Inc()
+			responder.NoteBehavior(ctx, "RedisBreaker")
 		} else {
 			src.counter.WithLabelValues("lookup_error").Inc()
 			responder.SampledError(src.log, src.logSampleRate, "looking for cached response: %s", err)
@@ -121,14 +214,34 @@ func (src *redisSource) Response(ctx context.Context, req *ocsp.Request) (*respo
 		return src.signAndSave(ctx, req, causeNotFound)
 	}
 
+	respBytes, compressed, err := decompressStored(respBytes)
+	if err != nil {
+		src.counter.WithLabelValues("decompress_error").Inc()
+		return nil, err
+	}
+	if compressed {
+		src.storedFormats.WithLabelValues("gzip").Inc()
+	} else {
+		src.storedFormats.WithLabelValues("raw").Inc()
+	}
+
 	resp, err := ocsp.ParseResponse(respBytes, nil)
 	if err != nil {
 		src.counter.WithLabelValues("parse_error").Inc()
 		return nil, err
 	}
 
+	// A response that parses but isn't for the requested serial points to a
+	// bug in how responses are keyed or routed, rather than to corruption, so
+	// it's counted apart from parse errors.
+	if resp.SerialNumber == nil || resp.SerialNumber.Cmp(req.SerialNumber) != 0 {
+		src.counter.WithLabelValues("validation_error").Inc()
+		return nil, fmt.Errorf("stored response for serial %s is for serial %x", core.SerialToString(req.SerialNumber), resp.SerialNumber)
+	}
+
 	if src.isStale(resp) {
 		src.counter.WithLabelValues("stale").Inc()
+		responder.NoteBehavior(ctx, "LiveSigningPeriod")
 		freshResp, err := src.signAndSave(ctx, req, causeStale)
 		// Note: we could choose to return the stale response (up to its actual
 		// NextUpdate date), but if we pass the BR/root program limits, that
@@ -143,9 +256,38 @@ func (src *redisSource) Response(ctx context.Context, req *ocsp.Request) (*respo
 	}
 
 	src.counter.WithLabelValues("success").Inc()
+	responder.NoteSource(ctx, "redis")
 	return &responder.Response{Response: resp, Raw: respBytes}, nil
 }
 
+// clientFor returns the client holding responses for the issuer of req: its
+// own, if it has one, or the default client otherwise.
+func (src *redisSource) clientFor(req *ocsp.Request) rocspClient {
+	if len(src.issuerClients) > 0 {
+		client, ok := src.issuerClients[hex.EncodeToString(req.IssuerKeyHash)]
+		if ok {
+			return client
+		}
+	}
+	return src.client
+}
+
+// getResponse looks up the stored response for serial in client, under a key
+// in the configured serial casing. Responses written back by this responder
+// are always stored under the lowercase serial, as produced by
+// core.SerialToString, so that's tried too if the configured casing misses.
+func (src *redisSource) getResponse(ctx context.Context, client rocspClient, serial *big.Int) ([]byte, error) {
+	serialString := core.SerialToString(serial)
+	if src.serialCase != SerialCaseUpper {
+		return client.GetResponse(ctx, serialString)
+	}
+	respBytes, err := client.GetResponse(ctx, strings.ToUpper(serialString))
+	if errors.Is(err, rocsp.ErrRedisNotFound) {
+		return client.GetResponse(ctx, serialString)
+	}
+	return respBytes, err
+}
+
 func (src *redisSource) isStale(resp *ocsp.Response) bool {
 	age := src.clk.Since(resp.ThisUpdate)
 	src.cachedResponseAges.Observe(age.Seconds())
@@ -158,6 +300,10 @@ const (
 	causeStale    signAndSaveCause = "stale"
 	causeNotFound signAndSaveCause = "not_found"
 	causeMismatch signAndSaveCause = "mismatch"
+	causePrefetch signAndSaveCause = "prefetch"
+	// causeRedisShed is used by the checkedRedisSource when it skips Redis
+	// because too many lookups are already in flight.
+	causeRedisShed signAndSaveCause = "redis_shed"
 )
 
 func (src *redisSource) signAndSave(ctx context.Context, req *ocsp.Request, cause signAndSaveCause) (*responder.Response, error) {
@@ -179,10 +325,18 @@ func (src *redisSource) signAndSave(ctx context.Context, req *ocsp.Request, caus
 		return nil, err
 	}
 	src.signAndSaveCounter.WithLabelValues(string(cause), "signing_success").Inc()
+	if !src.budget.acquire(1) {
+		// Skip caching this response rather than exceed the goroutine budget;
+		// it will be signed again on a later request.
+		src.counter.WithLabelValues("store_skipped_budget").Inc()
+		return resp, nil
+	}
+	client := src.clientFor(req)
 	go func() {
+		defer src.budget.release(1)
 		// We don't care about the error here, because if storing the response
 		// fails, we'll just generate a new one on the next request.
-		_ = src.client.StoreResponse(context.Background(), resp.Response)
+		_ = client.StoreResponse(context.Background(), resp.Response)
 	}()
 	return resp, nil
 }
@@ -1,14 +1,19 @@
 package redis
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"encoding/hex"
 	"errors"
 	"math/big"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/issuance"
 	"github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/ocsp/responder"
@@ -57,7 +62,7 @@ func (rs *recordingSigner) Response(ctx context.Context, req *ocsp.Request) (*re
 
 func TestNotFound(t *testing.T) {
 	recordingSigner := recordingSigner{}
-	src, err := NewRedisSource(nil, &recordingSigner, time.Second, clock.NewFake(), metrics.NoopRegisterer, log.NewMock(), 1)
+	src, err := NewRedisSource(nil, &recordingSigner, RedisSourceConfig{LiveSigningPeriod: time.Second, LogSampleRate: 1}, clock.NewFake(), metrics.NoopRegisterer, log.NewMock())
 	test.AssertNotError(t, err, "making source")
 	notFoundRedis := &notFoundRedis{make(chan *big.Int)}
 	src.client = notFoundRedis
@@ -108,7 +113,8 @@ func TestQueryError(t *testing.T) {
 	test.AssertNotError(t, err, "making fake response")
 	source := echoSource{resp: resp}
 
-	src, err := NewRedisSource(nil, source, time.Second, clock.NewFake(), metrics.NoopRegisterer, log.NewMock(), 1)
+	logger := log.NewMock()
+	src, err := NewRedisSource(nil, source, RedisSourceConfig{LiveSigningPeriod: time.Second, LogSampleRate: 1}, clock.NewFake(), metrics.NoopRegisterer, logger)
 	test.AssertNotError(t, err, "making source")
 	src.client = errorRedis{}
 
@@ -118,6 +124,7 @@ func TestQueryError(t *testing.T) {
 	test.AssertNotError(t, err, "expected no error when Redis errored")
 	test.AssertDeepEquals(t, resp.Raw, receivedResp.Raw)
 	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "lookup_error"}, 1)
+	test.AssertEquals(t, len(logger.GetAllMatching("looking for cached response")), 1)
 }
 
 type garbleRedis struct{}
@@ -131,7 +138,7 @@ func (er garbleRedis) StoreResponse(ctx context.Context, resp *ocsp.Response) er
 }
 
 func TestParseError(t *testing.T) {
-	src, err := NewRedisSource(nil, panicSource{}, time.Second, clock.NewFake(), metrics.NoopRegisterer, log.NewMock(), 1)
+	src, err := NewRedisSource(nil, panicSource{}, RedisSourceConfig{LiveSigningPeriod: time.Second, LogSampleRate: 1}, clock.NewFake(), metrics.NoopRegisterer, log.NewMock())
 	test.AssertNotError(t, err, "making source")
 	src.client = garbleRedis{}
 
@@ -142,10 +149,44 @@ func TestParseError(t *testing.T) {
 	if errors.Is(err, rocsp.ErrRedisNotFound) {
 		t.Errorf("incorrect error value ErrRedisNotFound; expected general error")
 	}
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "parse_error"}, 1)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "validation_error"}, 0)
+}
+
+// wrongSerialRedis is a mock *rocsp.WritingClient that returns a valid
+// response for a fixed serial, whatever serial is asked for.
+type wrongSerialRedis struct {
+	serial *big.Int
+}
+
+func (wr wrongSerialRedis) GetResponse(ctx context.Context, serial string) ([]byte, error) {
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{SerialNumber: wr.serial})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Raw, nil
+}
+
+func (wr wrongSerialRedis) StoreResponse(ctx context.Context, resp *ocsp.Response) error {
+	panic("shouldn't happen")
+}
+
+func TestValidationError(t *testing.T) {
+	src, err := NewRedisSource(nil, panicSource{}, RedisSourceConfig{LiveSigningPeriod: time.Second, LogSampleRate: 1}, clock.NewFake(), metrics.NoopRegisterer, log.NewMock())
+	test.AssertNotError(t, err, "making source")
+	src.client = wrongSerialRedis{big.NewInt(271828)}
+
+	_, err = src.Response(context.Background(), &ocsp.Request{
+		SerialNumber: big.NewInt(314159),
+	})
+	test.AssertError(t, err, "expected error when Redis returned another serial's response")
+	test.AssertContains(t, err.Error(), "is for serial")
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "validation_error"}, 1)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "parse_error"}, 0)
 }
 
 func TestSignError(t *testing.T) {
-	src, err := NewRedisSource(nil, errorSource{}, time.Second, clock.NewFake(), metrics.NoopRegisterer, log.NewMock(), 1)
+	src, err := NewRedisSource(nil, errorSource{}, RedisSourceConfig{LiveSigningPeriod: time.Second, LogSampleRate: 1}, clock.NewFake(), metrics.NoopRegisterer, log.NewMock())
 	test.AssertNotError(t, err, "making source")
 	src.client = &notFoundRedis{nil}
 
@@ -188,7 +229,7 @@ func (sr *staleRedis) StoreResponse(ctx context.Context, resp *ocsp.Response) er
 func TestStale(t *testing.T) {
 	recordingSigner := recordingSigner{}
 	clk := clock.NewFake()
-	src, err := NewRedisSource(nil, &recordingSigner, time.Second, clk, metrics.NoopRegisterer, log.NewMock(), 1)
+	src, err := NewRedisSource(nil, &recordingSigner, RedisSourceConfig{LiveSigningPeriod: time.Second, LogSampleRate: 1}, clk, metrics.NoopRegisterer, log.NewMock())
 	test.AssertNotError(t, err, "making source")
 	staleRedis := &staleRedis{
 		serialStored: make(chan *big.Int),
@@ -197,10 +238,12 @@ func TestStale(t *testing.T) {
 	src.client = staleRedis
 
 	serial := big.NewInt(8675309)
-	_, err = src.Response(context.Background(), &ocsp.Request{
+	ctx, behaviors := responder.WithBehaviors(context.Background())
+	_, err = src.Response(ctx, &ocsp.Request{
 		SerialNumber: serial,
 	})
 	test.AssertNotError(t, err, "signing response when not found")
+	test.AssertDeepEquals(t, behaviors.List(), []string{"LiveSigningPeriod"})
 	if recordingSigner.serialRequested == nil {
 		t.Fatalf("signing source was never called")
 	}
@@ -216,6 +259,28 @@ func TestStale(t *testing.T) {
 	}
 }
 
+// A fresh response found in Redis is served as-is, without re-signing it or
+// writing it back.
+func TestFreshNotStored(t *testing.T) {
+	clk := clock.NewFake()
+	src, err := NewRedisSource(nil, panicSource{}, RedisSourceConfig{LiveSigningPeriod: time.Hour, LogSampleRate: 1}, clk, metrics.NoopRegisterer, log.NewMock())
+	test.AssertNotError(t, err, "making source")
+	freshRedis := &staleRedis{
+		serialStored: make(chan *big.Int, 1),
+		thisUpdate:   clk.Now().Add(-time.Minute),
+	}
+	src.client = freshRedis
+
+	serial := big.NewInt(8675309)
+	resp, err := src.Response(context.Background(), &ocsp.Request{
+		SerialNumber: serial,
+	})
+	test.AssertNotError(t, err, "serving fresh response")
+	test.AssertEquals(t, resp.SerialNumber.Cmp(serial), 0)
+	test.AssertEquals(t, len(freshRedis.serialStored), 0)
+	test.AssertMetricWithLabelsEquals(t, src.signAndSaveCounter, prometheus.Labels{}, 0)
+}
+
 // notFoundSigner is a Source that always returns NotFound.
 type notFoundSigner struct{}
 
@@ -224,7 +289,7 @@ func (nfs notFoundSigner) Response(ctx context.Context, req *ocsp.Request) (*res
 }
 
 func TestCertificateNotFound(t *testing.T) {
-	src, err := NewRedisSource(nil, notFoundSigner{}, time.Second, clock.NewFake(), metrics.NoopRegisterer, log.NewMock(), 1)
+	src, err := NewRedisSource(nil, notFoundSigner{}, RedisSourceConfig{LiveSigningPeriod: time.Second, LogSampleRate: 1}, clock.NewFake(), metrics.NoopRegisterer, log.NewMock())
 	test.AssertNotError(t, err, "making source")
 	notFoundRedis := &notFoundRedis{nil}
 	src.client = notFoundRedis
@@ -239,7 +304,7 @@ func TestCertificateNotFound(t *testing.T) {
 
 func TestNoServeStale(t *testing.T) {
 	clk := clock.NewFake()
-	src, err := NewRedisSource(nil, errorSource{}, time.Second, clk, metrics.NoopRegisterer, log.NewMock(), 1)
+	src, err := NewRedisSource(nil, errorSource{}, RedisSourceConfig{LiveSigningPeriod: time.Second, LogSampleRate: 1}, clk, metrics.NoopRegisterer, log.NewMock())
 	test.AssertNotError(t, err, "making source")
 	staleRedis := &staleRedis{
 		serialStored: nil,
@@ -253,3 +318,164 @@ func TestNoServeStale(t *testing.T) {
 	})
 	test.AssertError(t, err, "expected to error when signer was down")
 }
+
+// keyedRedis is a mock rocspClient which stores responses by the exact key
+// looked up.
+type keyedRedis map[string][]byte
+
+func (kr keyedRedis) GetResponse(ctx context.Context, serial string) ([]byte, error) {
+	resp, ok := kr[serial]
+	if !ok {
+		return nil, rocsp.ErrRedisNotFound
+	}
+	return resp, nil
+}
+
+func (kr keyedRedis) StoreResponse(ctx context.Context, resp *ocsp.Response) error {
+	kr[core.SerialToString(resp.SerialNumber)] = resp.Raw
+	return nil
+}
+
+func TestSerialCase(t *testing.T) {
+	clk := clock.NewFake()
+	serial := big.NewInt(0xabcdef)
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		ThisUpdate:   clk.Now(),
+		NextUpdate:   clk.Now().Add(time.Hour),
+	})
+	test.AssertNotError(t, err, "making fake response")
+	lower := core.SerialToString(serial)
+	upper := strings.ToUpper(lower)
+
+	testCases := []struct {
+		name       string
+		serialCase SerialCase
+		storedKey  string
+	}{
+		{"lower stored lower", SerialCaseLower, lower},
+		{"upper stored upper", SerialCaseUpper, upper},
+		// Responses written back by the responder itself are lowercase.
+		{"upper stored lower", SerialCaseUpper, lower},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src, err := NewRedisSource(nil, panicSource{}, RedisSourceConfig{LiveSigningPeriod: time.Hour, SerialCase: tc.serialCase, LogSampleRate: 1}, clk, metrics.NoopRegisterer, log.NewMock())
+			test.AssertNotError(t, err, "making source")
+			src.client = keyedRedis{tc.storedKey: resp.Raw}
+
+			served, err := src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+			test.AssertNotError(t, err, "getting response")
+			test.AssertByteEquals(t, served.Raw, resp.Raw)
+		})
+	}
+
+	// Without configuring the casing, uppercase keys aren't found.
+	recordingSigner := recordingSigner{}
+	src, err := NewRedisSource(nil, &recordingSigner, RedisSourceConfig{LiveSigningPeriod: time.Hour, LogSampleRate: 1}, clk, metrics.NoopRegisterer, log.NewMock())
+	test.AssertNotError(t, err, "making source")
+	src.client = keyedRedis{upper: resp.Raw}
+	_, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+	test.AssertNotError(t, err, "getting response")
+	test.AssertEquals(t, recordingSigner.serialRequested, serial)
+}
+
+// TestFilteredCrossIssuer checks that a response in Redis from a different
+// issuer than the one requested is refused by the filter in front of it, even
+// when the two issuers share a name, as happens during a key rotation.
+func TestFilteredCrossIssuer(t *testing.T) {
+	serial := big.NewInt(0xabcdef)
+	template := ocsp.Response{
+		SerialNumber: serial,
+		ThisUpdate:   time.Now(),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}
+	respA, certA, err := ocsp_test.FakeResponse(template)
+	test.AssertNotError(t, err, "making fake response")
+	_, certB, err := ocsp_test.FakeResponse(template)
+	test.AssertNotError(t, err, "making fake response")
+
+	issuerA, err := issuance.NewCertificate(certA)
+	test.AssertNotError(t, err, "making issuer")
+	issuerB, err := issuance.NewCertificate(certB)
+	test.AssertNotError(t, err, "making issuer")
+
+	src, err := NewRedisSource(nil, panicSource{}, RedisSourceConfig{LiveSigningPeriod: time.Hour, LogSampleRate: 1}, clock.New(), metrics.NoopRegisterer, log.NewMock())
+	test.AssertNotError(t, err, "making source")
+	src.client = keyedRedis{core.SerialToString(serial): respA.Raw}
+	filter, err := responder.NewFilterSource(responder.StaticIssuers{issuerA, issuerB}, responder.FilterConfig{}, src, metrics.NoopRegisterer, log.NewMock(), clock.New())
+	test.AssertNotError(t, err, "making filter")
+
+	requestFor := func(ic *issuance.Certificate) *ocsp.Request {
+		resolved, err := responder.NewResolvedIssuer(ic)
+		test.AssertNotError(t, err, "resolving issuer")
+		return &ocsp.Request{
+			HashAlgorithm:  crypto.SHA1,
+			IssuerNameHash: resolved.NameHash,
+			IssuerKeyHash:  resolved.KeyHash,
+			SerialNumber:   serial,
+		}
+	}
+
+	served, err := filter.Response(context.Background(), requestFor(issuerA))
+	test.AssertNotError(t, err, "getting response for its own issuer")
+	test.AssertByteEquals(t, served.Raw, respA.Raw)
+
+	_, err = filter.Response(context.Background(), requestFor(issuerB))
+	test.AssertErrorIs(t, err, responder.ErrResponseIssuerMismatch)
+}
+
+func TestIssuerClients(t *testing.T) {
+	clk := clock.NewFake()
+	serial := big.NewInt(1)
+	cannedResponse := func() []byte {
+		t.Helper()
+		resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+			SerialNumber: serial,
+			ThisUpdate:   clk.Now(),
+			NextUpdate:   clk.Now().Add(time.Hour),
+		})
+		test.AssertNotError(t, err, "making fake response")
+		return resp.Raw
+	}
+	issuerA := bytes.Repeat([]byte{0xaa}, 20)
+	issuerB := bytes.Repeat([]byte{0xbb}, 20)
+	redisA := &cannedRedis{body: cannedResponse()}
+	redisB := &cannedRedis{body: cannedResponse()}
+	redisDefault := &cannedRedis{body: cannedResponse()}
+
+	src, err := NewRedisSource(nil, panicSource{}, RedisSourceConfig{LiveSigningPeriod: time.Hour, LogSampleRate: 1}, clk, metrics.NoopRegisterer, log.NewMock())
+	test.AssertNotError(t, err, "making source")
+	src.client = redisDefault
+	src.issuerClients = map[string]rocspClient{
+		hex.EncodeToString(issuerA): redisA,
+		hex.EncodeToString(issuerB): redisB,
+	}
+
+	// Each issuer's lookups go to its own client, and those of any other
+	// issuer to the default one.
+	for _, tc := range []struct {
+		issuerKeyHash []byte
+		expected      []byte
+	}{
+		{issuerA, redisA.body},
+		{issuerB, redisB.body},
+		{bytes.Repeat([]byte{0xcc}, 20), redisDefault.body},
+		{nil, redisDefault.body},
+	} {
+		resp, err := src.Response(context.Background(), &ocsp.Request{SerialNumber: serial, IssuerKeyHash: tc.issuerKeyHash})
+		test.AssertNotError(t, err, "getting response")
+		test.AssertByteEquals(t, resp.Raw, tc.expected)
+	}
+
+	// Fresh responses are stored to the issuer's client, too.
+	recordingSigner := recordingSigner{}
+	src, err = NewRedisSource(nil, &recordingSigner, RedisSourceConfig{LiveSigningPeriod: time.Hour, LogSampleRate: 1}, clk, metrics.NoopRegisterer, log.NewMock())
+	test.AssertNotError(t, err, "making source")
+	src.client = &notFoundRedis{nil}
+	notFoundA := &notFoundRedis{make(chan *big.Int, 1)}
+	src.issuerClients = map[string]rocspClient{hex.EncodeToString(issuerA): notFoundA}
+	_, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: serial, IssuerKeyHash: issuerA})
+	test.AssertNotError(t, err, "signing response when not found")
+	test.AssertEquals(t, (<-notFoundA.serialStored).Cmp(serial), 0)
+}
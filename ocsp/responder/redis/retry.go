@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+const (
+	retryBackoffBase = 5 * time.Millisecond
+	retryBackoffMax  = 50 * time.Millisecond
+)
+
+// retryBudget is the number of retries remaining for a single request. It's
+// shared by every backend lookup made for the request, so that retries of one
+// backend leave fewer for the others and the total is bounded no matter which
+// backend is failing. A nil *retryBudget allows no retries.
+type retryBudget struct {
+	remaining atomic.Int64
+}
+
+type retryBudgetKey struct{}
+
+// withRetryBudget returns a context carrying a retryBudget of n retries.
+func withRetryBudget(ctx context.Context, n int) context.Context {
+	b := &retryBudget{}
+	b.remaining.Store(int64(n))
+	return context.WithValue(ctx, retryBudgetKey{}, b)
+}
+
+// retryBudgetFrom returns the retryBudget carried by ctx, or nil if there is
+// none.
+func retryBudgetFrom(ctx context.Context) *retryBudget {
+	b, _ := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	return b
+}
+
+// take spends one retry from the budget, returning false if none remain.
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return false
+	}
+	if b.remaining.Add(-1) < 0 {
+		b.remaining.Add(1)
+		return false
+	}
+	return true
+}
+
+// withRetries calls lookup, retrying with backoff while it returns an error
+// for which retryable returns true, the request's retry budget allows and
+// ctx isn't done. It returns the error from the last attempt.
+func withRetries(ctx context.Context, lookup func() error, retryable func(error) bool) error {
+	budget := retryBudgetFrom(ctx)
+	for attempt := 1; ; attempt++ {
+		err := lookup()
+		if err == nil || !retryable(err) || ctx.Err() != nil || !budget.take() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(core.RetryBackoff(attempt, retryBackoffBase, retryBackoffMax, 2)):
+		}
+	}
+}
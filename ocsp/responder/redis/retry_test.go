@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	ocsp_test "github.com/letsencrypt/boulder/ocsp/test"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// countingErrorSelector always returns an error, counting the calls made.
+type countingErrorSelector struct {
+	errorSelector
+	calls *atomic.Int64
+}
+
+func (s countingErrorSelector) SelectOne(ctx context.Context, output interface{}, query string, args ...interface{}) error {
+	s.calls.Add(1)
+	return s.errorSelector.SelectOne(ctx, output, query, args...)
+}
+
+func TestRetryBudgetSharedAcrossBackends(t *testing.T) {
+	serial := big.NewInt(8675309)
+	resp, _, err := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: serial,
+		Status:       ocsp.Good,
+		ThisUpdate:   time.Now().Truncate(time.Second).UTC(),
+	})
+	test.AssertNotError(t, err, "making fake response")
+
+	for _, retries := range []int{0, 1, 3} {
+		base, err := NewRedisSource(nil, echoSource{resp: resp}, RedisSourceConfig{LiveSigningPeriod: time.Hour, LogSampleRate: 1}, clock.NewFake(), metrics.NoopRegisterer, log.NewMock())
+		test.AssertNotError(t, err, "making source")
+		redis := &flakyRedis{down: true}
+		base.client = redis
+		var dbCalls atomic.Int64
+		src := newCheckedRedisSource(base, countingErrorSelector{calls: &dbCalls}, nil, metrics.NoopRegisterer, log.NewMock())
+		src.retries = retries
+
+		_, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: serial})
+		test.AssertError(t, err, "expected DB error")
+		// Each backend is tried once, and the retries are split between them.
+		test.AssertEquals(t, int(dbCalls.Load())+redis.calls, 2+retries)
+	}
+}
+
+func TestRetryBudgetNonRetryable(t *testing.T) {
+	ctx := withRetryBudget(context.Background(), 5)
+	calls := 0
+	err := withRetries(ctx, func() error {
+		calls++
+		return errors.New("not found")
+	}, func(error) bool { return false })
+	test.AssertError(t, err, "expected error")
+	test.AssertEquals(t, calls, 1)
+	test.AssertEquals(t, retryBudgetFrom(ctx).remaining.Load(), int64(5))
+}
+
+func TestRetryBudgetRespectsDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(withRetryBudget(context.Background(), 5))
+	calls := 0
+	err := withRetries(ctx, func() error {
+		calls++
+		cancel()
+		return errors.New("oops")
+	}, func(error) bool { return true })
+	test.AssertError(t, err, "expected error")
+	test.AssertEquals(t, calls, 1)
+
+	// Without a budget, nothing is retried.
+	calls = 0
+	err = withRetries(context.Background(), func() error {
+		calls++
+		return errors.New("oops")
+	}, func(error) bool { return true })
+	test.AssertError(t, err, "expected error")
+	test.AssertEquals(t, calls, 1)
+}
@@ -36,19 +36,24 @@ import (
 	"crypto"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"math/big"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/jmhodges/clock"
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/crypto/ocsp"
 
+	"github.com/letsencrypt/boulder/config"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 )
@@ -57,10 +62,24 @@ import (
 // indicate that the responder should reply with unauthorizedErrorResponse.
 var ErrNotFound = errors.New("request OCSP Response not found")
 
-// errOCSPResponseExpired indicates that the nextUpdate field of the requested
+// ErrTryLater indicates that the responder is temporarily overloaded and the
+// client should retry later. It results in an HTTP 503 and a tryLater OCSP
+// response.
+var ErrTryLater = errors.New("responder is overloaded")
+
+// ErrMalformed indicates that the request, though it parsed, can't be a
+// request for any certificate of ours. It results in a malformedRequest
+// response, with the configured Malformed status code.
+var ErrMalformed = errors.New("malformed OCSP request")
+
+// ErrExpired indicates that the nextUpdate field of the requested
 // OCSP response occurred in the past and an HTTP status code of 533 should be
 // returned to the caller.
-var errOCSPResponseExpired = errors.New("OCSP response is expired")
+var ErrExpired = errors.New("OCSP response is expired")
+
+// AllowedMethods lists the HTTP methods which the Responder answers, as sent
+// in the Allow header of responses to OPTIONS requests and of 405s.
+const AllowedMethods = "GET, HEAD, POST"
 
 var responseTypeToString = map[ocsp.ResponseStatus]string{
 	ocsp.Success:           "Success",
@@ -71,20 +90,255 @@ var responseTypeToString = map[ocsp.ResponseStatus]string{
 	ocsp.Unauthorized:      "Unauthorized",
 }
 
+// PriorityConfig configures a shorter timeout for requests which a CDN or
+// other upstream has marked as low priority, so that expensive lookups for
+// them don't tie up the responder. The zero value disables this.
+type PriorityConfig struct {
+	// Header is the name of the request header carrying the priority. Requests
+	// where it has the value "low" (case-insensitively) are low priority.
+	Header string
+
+	// LowPriorityFactor scales the timeout for low priority requests.
+	LowPriorityFactor float64 `validate:"required_with=Header,omitempty,gt=0,lte=1"`
+
+	// MinTimeout is the floor below which a low priority request's timeout
+	// will not be scaled.
+	MinTimeout config.Duration `validate:"-"`
+}
+
+// IssuerTimeoutConfig configures per-issuer overrides of the global request
+// timeout, for issuers whose backends are slower or faster than the rest.
+type IssuerTimeoutConfig struct {
+	// Overrides maps hex-encoded SHA-1 issuer key hashes, as logged in the
+	// issuerKeyHash field of each request, to the timeout for requests for
+	// that issuer's certificates.
+	Overrides map[string]config.Duration `validate:"dive,keys,hexadecimal,len=40,endkeys"`
+
+	// Max, if non-zero, caps the timeout of every request, whether it comes
+	// from Overrides or from the global timeout.
+	Max config.Duration `validate:"-"`
+}
+
+// StaplingConfig configures a shorter cache lifetime for responses served to
+// OCSP stapling clients, such as web servers, to encourage them to refresh
+// their stapled responses frequently. The zero value disables this.
+type StaplingConfig struct {
+	// Path is a path prefix, separate from the regular responder path, on
+	// which stapling clients are served.
+	Path string
+
+	// Header is the name of a request header which, if present with any
+	// value, marks the request as coming from a stapling client.
+	Header string
+
+	// MaxAge caps the max-age of the Cache-Control header sent to stapling
+	// clients. It only ever lowers the max-age implied by a response's
+	// nextUpdate, never raises it.
+	MaxAge config.Duration `validate:"-"`
+}
+
+// ProfileTagConfig derives, for each response, a tag naming the issuance
+// profile of its certificate. It is sent as an additional Edge-Cache-Tag, so
+// that a CDN can purge every response for a profile at once. The zero value
+// sends no profile tag.
+type ProfileTagConfig struct {
+	// SerialPrefixes maps hex serial prefixes to the profile tag of serials
+	// starting with them. If several match, the longest wins. Tags must be
+	// longer than two characters, so they can't be confused with the
+	// serial-derived tag.
+	SerialPrefixes map[string]string `validate:"dive,keys,hexadecimal,endkeys,min=3"`
+
+	// Issuers maps hex-encoded SHA-1 issuer key hashes to the profile tag of
+	// that issuer's certificates, for serials matching none of
+	// SerialPrefixes.
+	Issuers map[string]string `validate:"dive,keys,hexadecimal,len=40,endkeys,min=3"`
+}
+
+// tag returns the profile tag for the given serial, as formatted by
+// core.SerialToString, and issuer key hash, or "" if none is configured.
+func (pc ProfileTagConfig) tag(serial string, issuerKeyHash []byte) string {
+	var tag, longest string
+	for prefix, t := range pc.SerialPrefixes {
+		prefix = strings.ToLower(prefix)
+		if strings.HasPrefix(serial, prefix) && len(prefix) > len(longest) {
+			tag, longest = t, prefix
+		}
+	}
+	if tag != "" {
+		return tag
+	}
+	keyHash := hex.EncodeToString(issuerKeyHash)
+	for k, t := range pc.Issuers {
+		if strings.EqualFold(k, keyHash) {
+			return t
+		}
+	}
+	return ""
+}
+
+// StatusCodeConfig sets the HTTP status code sent for each reason a request
+// can fail, for CDNs which expect particular codes. Zero fields keep the
+// defaults.
+type StatusCodeConfig struct {
+	// NotFound is sent, with an unauthorized OCSP response, when we have no
+	// response for the request. Defaults to 200.
+	NotFound int `validate:"omitempty,min=200,max=599"`
+
+	// Malformed is sent when the request can't be decoded or parsed.
+	// Defaults to 400.
+	Malformed int `validate:"omitempty,min=200,max=599"`
+
+	// Expired is sent when the only response we have is expired. Defaults to
+	// 533, which is unassigned, so that such failures stand out.
+	Expired int `validate:"omitempty,min=200,max=599"`
+
+	// TryLater is sent when the request is shed because the responder or its
+	// backends are overloaded. Defaults to 503.
+	TryLater int `validate:"omitempty,min=200,max=599"`
+
+	// InternalError is sent when looking up the response fails for any other
+	// reason. Defaults to 500.
+	InternalError int `validate:"omitempty,min=200,max=599"`
+}
+
+// orDefault returns code, or def if code is unset.
+func orDefault(code, def int) int {
+	if code == 0 {
+		return def
+	}
+	return code
+}
+
+func (sc StatusCodeConfig) notFound() int {
+	return orDefault(sc.NotFound, http.StatusOK)
+}
+
+func (sc StatusCodeConfig) malformed() int {
+	return orDefault(sc.Malformed, http.StatusBadRequest)
+}
+
+func (sc StatusCodeConfig) expired() int {
+	// 533 is unassigned.
+	return orDefault(sc.Expired, 533)
+}
+
+func (sc StatusCodeConfig) tryLater() int {
+	return orDefault(sc.TryLater, http.StatusServiceUnavailable)
+}
+
+func (sc StatusCodeConfig) internalError() int {
+	return orDefault(sc.InternalError, http.StatusInternalServerError)
+}
+
+// staplingKey is the context key marking requests received on the stapling
+// path.
+type staplingKey struct{}
+
+// StaplingHandler returns a handler which marks requests as coming from a
+// stapling client before passing them to next.
+func StaplingHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), staplingKey{}, true)))
+	})
+}
+
+// shedExemptKey is the context key marking requests exempt from load
+// shedding.
+type shedExemptKey struct{}
+
+// WithShedExempt returns a context marking its request as exempt from load
+// shedding and negative caching, for example because it comes from our own
+// monitoring. Such requests are still answered correctly, just never refused
+// to protect the responder.
+func WithShedExempt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, shedExemptKey{}, true)
+}
+
+// ShedExempt returns true if ctx was marked by WithShedExempt.
+func ShedExempt(ctx context.Context) bool {
+	exempt, _ := ctx.Value(shedExemptKey{}).(bool)
+	return exempt
+}
+
 // A Responder object provides an HTTP wrapper around a Source.
 type Responder struct {
-	Source        Source
-	timeout       time.Duration
-	responseTypes *prometheus.CounterVec
-	responseAges  prometheus.Histogram
-	requestSizes  prometheus.Histogram
-	sampleRate    int
-	clk           clock.Clock
-	log           blog.Logger
-}
-
-// NewResponder instantiates a Responder with the give Source.
-func NewResponder(source Source, timeout time.Duration, stats prometheus.Registerer, logger blog.Logger, sampleRate int) *Responder {
+	Source         Source
+	timeout        time.Duration
+	issuerTimeouts map[string]time.Duration
+	maxTimeout     time.Duration
+	priority       PriorityConfig
+	stapling       StaplingConfig
+	statusCodes    StatusCodeConfig
+	profileTags    ProfileTagConfig
+	maxAgeJitter   time.Duration
+	// ifModifiedSince causes If-Modified-Since to be honored, as well as
+	// If-None-Match.
+	ifModifiedSince bool
+	maxGETSize      int
+	maxCertIDs      int
+	capture         *Capturer
+	slowRequests    *SlowRequests
+	inFlight        *InFlightBytes
+	extensions      *RequestExtensions
+	responseTypes   *prometheus.CounterVec
+	rejections      *prometheus.CounterVec
+	responseAges    prometheus.Histogram
+	requestSizes    prometheus.Histogram
+	serialLengths   prometheus.Histogram
+	oversizedGETs   prometheus.Counter
+	excessCertIDs   prometheus.Counter
+	sampleRate      int
+	clk             clock.Clock
+	log             blog.Logger
+}
+
+// Options configures the behaviour of a Responder. The zero value of each
+// field leaves the corresponding behaviour disabled.
+type Options struct {
+	// Timeout bounds each lookup in the Source.
+	Timeout        time.Duration
+	IssuerTimeouts IssuerTimeoutConfig
+	Priority       PriorityConfig
+	Stapling       StaplingConfig
+	StatusCodes    StatusCodeConfig
+	ProfileTags    ProfileTagConfig
+
+	// MaxAgeJitter shortens each response's max-age by up to that much,
+	// depending on its serial.
+	MaxAgeJitter time.Duration
+
+	// IfModifiedSince causes GET requests whose If-Modified-Since is no
+	// earlier than the response's thisUpdate to be answered with a 304.
+	IfModifiedSince bool
+
+	// MaxGETSize refuses GET requests whose base64-encoded OCSP request is
+	// longer than that many bytes, so that clients send them by POST instead.
+	MaxGETSize int
+
+	// MaxCertIDs rejects requests carrying more certIDs than that as
+	// malformed.
+	MaxCertIDs int
+
+	// Capture records requests and responses for matching serials.
+	Capture *Capturer
+
+	// SlowRequests records the timings of slow requests.
+	SlowRequests *SlowRequests
+
+	// InFlight sheds requests once the responses being written reach its
+	// ceiling.
+	InFlight *InFlightBytes
+
+	// Extensions counts the extensions in each request.
+	Extensions *RequestExtensions
+
+	// LogSampleRate logs one in that many sampled errors.
+	LogSampleRate int
+}
+
+// NewResponder instantiates a Responder with the given Source, configured by
+// opts.
+func NewResponder(source Source, opts Options, stats prometheus.Registerer, logger blog.Logger) *Responder {
 	requestSizes := prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Name:    "ocsp_request_sizes",
@@ -94,6 +348,17 @@ func NewResponder(source Source, timeout time.Duration, stats prometheus.Registe
 	)
 	stats.MustRegister(requestSizes)
 
+	// Our serials are 16 to 18 bytes long, so the buckets are finest there,
+	// with coarser ones either side to catch malformed serials.
+	serialLengths := prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "ocsp_request_serial_lengths",
+			Help:    "Length in bytes of the serial numbers in OCSP requests",
+			Buckets: []float64{1, 8, 12, 15, 16, 17, 18, 19, 20, 32},
+		},
+	)
+	stats.MustRegister(serialLengths)
+
 	// Set up 12-hour-wide buckets, measured in seconds.
 	buckets := make([]float64, 14)
 	for i := range buckets {
@@ -115,15 +380,56 @@ func NewResponder(source Source, timeout time.Duration, stats prometheus.Registe
 	)
 	stats.MustRegister(responseTypes)
 
+	rejections := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocsp_request_rejected",
+		Help: "Count of requests which the source declined to handle, by reason",
+	}, []string{"reason"})
+	stats.MustRegister(rejections)
+
+	oversizedGETs := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ocsp_oversized_get_requests",
+		Help: "Count of GET requests refused because their encoded OCSP request exceeded the maximum GET size",
+	})
+	stats.MustRegister(oversizedGETs)
+
+	excessCertIDs := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ocsp_excess_certid_requests",
+		Help: "Count of requests rejected as malformed because they carried more than the maximum number of certIDs",
+	})
+	stats.MustRegister(excessCertIDs)
+
+	overrides := make(map[string]time.Duration, len(opts.IssuerTimeouts.Overrides))
+	for keyHash, timeout := range opts.IssuerTimeouts.Overrides {
+		overrides[strings.ToLower(keyHash)] = timeout.Duration
+	}
+
 	return &Responder{
-		Source:        source,
-		timeout:       timeout,
-		responseTypes: responseTypes,
-		responseAges:  responseAges,
-		requestSizes:  requestSizes,
-		clk:           clock.New(),
-		log:           logger,
-		sampleRate:    sampleRate,
+		Source:          source,
+		timeout:         opts.Timeout,
+		issuerTimeouts:  overrides,
+		maxTimeout:      opts.IssuerTimeouts.Max.Duration,
+		priority:        opts.Priority,
+		stapling:        opts.Stapling,
+		statusCodes:     opts.StatusCodes,
+		profileTags:     opts.ProfileTags,
+		maxAgeJitter:    opts.MaxAgeJitter,
+		ifModifiedSince: opts.IfModifiedSince,
+		maxGETSize:      opts.MaxGETSize,
+		maxCertIDs:      opts.MaxCertIDs,
+		capture:         opts.Capture,
+		slowRequests:    opts.SlowRequests,
+		inFlight:        opts.InFlight,
+		extensions:      opts.Extensions,
+		responseTypes:   responseTypes,
+		rejections:      rejections,
+		responseAges:    responseAges,
+		requestSizes:    requestSizes,
+		serialLengths:   serialLengths,
+		oversizedGETs:   oversizedGETs,
+		excessCertIDs:   excessCertIDs,
+		clk:             clock.New(),
+		log:             logger,
+		sampleRate:      opts.LogSampleRate,
 	}
 }
 
@@ -140,7 +446,14 @@ type logEvent struct {
 	Serial         string `json:"serial,omitempty"`
 	IssuerKeyHash  string `json:"issuerKeyHash,omitempty"`
 	IssuerNameHash string `json:"issuerNameHash,omitempty"`
+	IssuerCN       string `json:"issuerCN,omitempty"`
 	HashAlg        string `json:"hashAlg,omitempty"`
+
+	PreferredSigAlgs []string `json:"preferredSigAlgs,omitempty"`
+
+	// Behaviors are the optional behaviours which affected the handling of
+	// the request, as noted by the Source.
+	Behaviors []string `json:"behaviors,omitempty"`
 }
 
 // hashToString contains mappings for the only hash functions
@@ -152,6 +465,86 @@ var hashToString = map[crypto.Hash]string{
 	crypto.SHA512: "SHA512",
 }
 
+// requestTimeout returns the timeout to apply to the given request. Requests
+// for an issuer with a timeout override get that instead of the global
+// timeout, and all timeouts are capped at the configured maximum. Requests
+// marked low priority then get the configured fraction of that timeout, but
+// never less than the configured floor.
+func (rs Responder) requestTimeout(request *http.Request, ocspRequest *ocsp.Request) time.Duration {
+	timeout := rs.timeout
+	if override, ok := rs.issuerTimeouts[hex.EncodeToString(ocspRequest.IssuerKeyHash)]; ok {
+		timeout = override
+	}
+	if rs.maxTimeout != 0 && (timeout == 0 || timeout > rs.maxTimeout) {
+		timeout = rs.maxTimeout
+	}
+	if timeout == 0 || rs.priority.Header == "" || rs.priority.LowPriorityFactor <= 0 {
+		return timeout
+	}
+	if !strings.EqualFold(request.Header.Get(rs.priority.Header), "low") {
+		return timeout
+	}
+	scaled := time.Duration(float64(timeout) * rs.priority.LowPriorityFactor)
+	if scaled < rs.priority.MinTimeout.Duration {
+		scaled = rs.priority.MinTimeout.Duration
+	}
+	return scaled
+}
+
+// maxAge returns the max-age, in seconds, to send with the response for serial
+// which is valid until nextUpdate. Stapling clients get at most the configured
+// stapling max-age. The result is then shortened by the serial's jitter.
+func (rs Responder) maxAge(request *http.Request, serial *big.Int, nextUpdate time.Time) int {
+	now := rs.clk.Now()
+	if !now.Before(nextUpdate) {
+		// TODO(#530): we want max-age=0 but this is technically an authorized OCSP response
+		//             (despite being stale) and 5019 forbids attaching no-cache
+		return 0
+	}
+	maxAge := nextUpdate.Sub(now)
+	if rs.stapling.MaxAge.Duration > 0 && maxAge > rs.stapling.MaxAge.Duration && rs.isStapling(request) {
+		maxAge = rs.stapling.MaxAge.Duration
+	}
+	maxAge -= maxAgeJitter(serial, rs.maxAgeJitter)
+	if maxAge < 0 {
+		return 0
+	}
+	return int(maxAge / time.Second)
+}
+
+// maxAgeJitter returns a whole number of seconds between zero and band,
+// inclusive, derived from serial. It's always the same for a given serial, so
+// that each response's max-age is stable, while the max-ages of different
+// serials are spread evenly across the band.
+func maxAgeJitter(serial *big.Int, band time.Duration) time.Duration {
+	seconds := uint64(band / time.Second)
+	if seconds == 0 || serial == nil {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write(serial.Bytes())
+	return time.Duration(h.Sum64()%(seconds+1)) * time.Second
+}
+
+// isStapling returns true if the request was received on the stapling path,
+// or carries the stapling header.
+func (rs Responder) isStapling(request *http.Request) bool {
+	if request.Context().Value(staplingKey{}) != nil {
+		return true
+	}
+	return rs.stapling.Header != "" && request.Header.Get(rs.stapling.Header) != ""
+}
+
+// headResponseWriter wraps an http.ResponseWriter, discarding the body of
+// the response, as is required for HEAD requests.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
 func SampledError(log blog.Logger, sampleRate int, format string, a ...interface{}) {
 	if sampleRate > 0 && rand.Intn(sampleRate) == 0 {
 		log.Errf(format, a...)
@@ -162,6 +555,51 @@ func (rs Responder) sampledError(format string, a ...interface{}) {
 	SampledError(rs.log, rs.sampleRate, format, a...)
 }
 
+// shed answers a request with an HTTP 503 and a tryLater response, because
+// the responder is overloaded for the given reason.
+func (rs Responder) shed(response http.ResponseWriter, req *ocsp.Request, reason string) {
+	rs.sampledError("Shedding request: serial %x: %s", req.SerialNumber, reason)
+	response.WriteHeader(rs.statusCodes.tryLater())
+	response.Write(ocsp.TryLaterErrorResponse)
+	rs.responseTypes.With(prometheus.Labels{"type": responseTypeToString[ocsp.TryLater]}).Inc()
+}
+
+// ifNoneMatch returns true if any of the If-None-Match header values match
+// etag. Per RFC 7232, Section 3.2, each value may be "*" or a comma-separated
+// list of entity tags, and the weak comparison function is used, so a "W/"
+// prefix is ignored.
+func ifNoneMatch(values []string, etag string) bool {
+	for _, value := range values {
+		for _, candidate := range strings.Split(value, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// notModifiedSince returns true if value, an If-Modified-Since header, is a
+// date no earlier than lastModified. Per RFC 7232, Section 3.3, a value which
+// isn't a valid date is ignored. Besides the formats net/http accepts, the
+// RFC 1123 format with a "UTC" zone, which we send as Last-Modified, is
+// accepted too, since clients echo that back.
+func notModifiedSince(value string, lastModified time.Time) bool {
+	if value == "" {
+		return false
+	}
+	since, err := http.ParseTime(value)
+	if err != nil {
+		since, err = time.Parse(time.RFC1123, value)
+		if err != nil {
+			return false
+		}
+	}
+	// HTTP dates have a resolution of one second.
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
 // ServeHTTP is a Responder that can process both GET and POST requests. The
 // mapping from an OCSP request to an OCSP response is done by the Source; the
 // Responder simply decodes the request, and passes back whatever response is
@@ -184,15 +622,9 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 	// We specifically ignore request.Context() because we would prefer for clients
 	// to not be able to cancel our operations in arbitrary places. Instead we
 	// start a new context, and apply timeouts in our various RPCs.
-	ctx := context.WithoutCancel(request.Context())
+	ctx, behaviors := WithBehaviors(context.WithoutCancel(request.Context()))
 	request = request.WithContext(ctx)
 
-	if rs.timeout != 0 {
-		var cancel func()
-		ctx, cancel = context.WithTimeout(ctx, rs.timeout)
-		defer cancel()
-	}
-
 	le := logEvent{
 		IP:       request.RemoteAddr,
 		UA:       request.UserAgent(),
@@ -200,10 +632,16 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 		Path:     request.URL.Path,
 		Received: time.Now(),
 	}
+	// Deferred first, so that it runs last and its total covers everything
+	// else done for the request, including the other deferred work.
+	defer func() {
+		behaviors.finish(time.Since(le.Received))
+	}()
 
 	defer func() {
 		le.Headers = response.Header()
 		le.Took = time.Since(le.Received)
+		le.Behaviors = behaviors.List()
 		jb, err := json.Marshal(le)
 		if err != nil {
 			// we log this error at the debug level as if we aren't at that level anyway
@@ -213,21 +651,37 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 		}
 		rs.log.Debugf("Received request: %s", string(jb))
 	}()
+	var parsed, lookedUp time.Time
+	defer func() {
+		source := behaviors.Source()
+		if source == "" {
+			source = fmt.Sprintf("%T", rs.Source)
+		}
+		rs.slowRequests.observe(le.Serial, source, le.Received, parsed, lookedUp, time.Now())
+	}()
 	// By default we set a 'max-age=0, no-cache' Cache-Control header, this
 	// is only returned to the client if a valid authorized OCSP response
 	// is not found or an error is returned. If a response if found the header
 	// will be altered to contain the proper max-age and modifiers.
 	response.Header().Add("Cache-Control", "max-age=0, no-cache")
+	// HEAD requests are handled as GET, but only the headers are sent.
+	if request.Method == http.MethodHead {
+		response = headResponseWriter{response}
+	}
 	// Read response from request
 	var requestBody []byte
 	var err error
 	switch request.Method {
-	case "GET":
+	case "OPTIONS":
+		response.Header().Set("Allow", AllowedMethods)
+		response.WriteHeader(http.StatusNoContent)
+		return
+	case "GET", "HEAD":
 		base64Request, err := url.QueryUnescape(request.URL.Path)
 		if err != nil {
 			rs.log.Debugf("Error decoding URL: %s", request.URL.Path)
 			rs.responseTypes.With(prometheus.Labels{"type": responseTypeToString[ocsp.Malformed]}).Inc()
-			response.WriteHeader(http.StatusBadRequest)
+			response.WriteHeader(rs.statusCodes.malformed())
 			return
 		}
 		// url.QueryUnescape not only unescapes %2B escaping, but it additionally
@@ -247,10 +701,20 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 		if len(base64RequestBytes) > 0 && base64RequestBytes[0] == '/' {
 			base64RequestBytes = base64RequestBytes[1:]
 		}
-		requestBody, err = base64.StdEncoding.DecodeString(string(base64RequestBytes))
+		// RFC 5019 Section 5 has clients use GET only for small requests.
+		// Larger ones belong in a POST body, where they can't be mangled by
+		// URL length limits along the way, so we refuse them here.
+		if rs.maxGETSize > 0 && len(base64RequestBytes) > rs.maxGETSize {
+			rs.log.Debugf("Refusing GET request of %d bytes, exceeding maximum of %d", len(base64RequestBytes), rs.maxGETSize)
+			rs.oversizedGETs.Inc()
+			response.Header().Set("Allow", "POST")
+			response.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		requestBody, err = decodeGETRequest(string(base64RequestBytes))
 		if err != nil {
 			rs.log.Debugf("Error decoding base64 from URL: %s", string(base64RequestBytes))
-			response.WriteHeader(http.StatusBadRequest)
+			response.WriteHeader(rs.statusCodes.malformed())
 			rs.responseTypes.With(prometheus.Labels{"type": responseTypeToString[ocsp.Malformed]}).Inc()
 			return
 		}
@@ -258,12 +722,13 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 		requestBody, err = io.ReadAll(http.MaxBytesReader(nil, request.Body, 10000))
 		if err != nil {
 			rs.log.Errf("Problem reading body of POST: %s", err)
-			response.WriteHeader(http.StatusBadRequest)
+			response.WriteHeader(rs.statusCodes.malformed())
 			rs.responseTypes.With(prometheus.Labels{"type": responseTypeToString[ocsp.Malformed]}).Inc()
 			return
 		}
 		rs.requestSizes.Observe(float64(len(requestBody)))
 	default:
+		response.Header().Set("Allow", AllowedMethods)
 		response.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
@@ -278,6 +743,21 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 	// seems unnecessariliy restrictive.
 	response.Header().Add("Content-Type", "application/ocsp-response")
 
+	// ocsp.ParseRequest answers only the first certID, but parses them all,
+	// so refuse requests carrying too many before doing any more work. If
+	// they can't be counted, ParseRequest will reject the request anyway.
+	if rs.maxCertIDs > 0 {
+		count, err := countCertIDs(requestBody)
+		if err == nil && count > rs.maxCertIDs {
+			rs.log.Debugf("Refusing OCSP request with %d certIDs, exceeding maximum of %d", count, rs.maxCertIDs)
+			rs.excessCertIDs.Inc()
+			response.WriteHeader(rs.statusCodes.malformed())
+			response.Write(ocsp.MalformedRequestErrorResponse)
+			rs.responseTypes.With(prometheus.Labels{"type": responseTypeToString[ocsp.Malformed]}).Inc()
+			return
+		}
+	}
+
 	// Parse response as an OCSP request
 	// XXX: This fails if the request contains the nonce extension.
 	//      We don't intend to support nonces anyway, but maybe we
@@ -285,61 +765,127 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 	ocspRequest, err := ocsp.ParseRequest(requestBody)
 	if err != nil {
 		rs.log.Debugf("Error decoding request body: %s", b64Body)
-		response.WriteHeader(http.StatusBadRequest)
+		response.WriteHeader(rs.statusCodes.malformed())
 		response.Write(ocsp.MalformedRequestErrorResponse)
 		rs.responseTypes.With(prometheus.Labels{"type": responseTypeToString[ocsp.Malformed]}).Inc()
 		return
 	}
+	parsed = time.Now()
+	rs.serialLengths.Observe(float64(len(ocspRequest.SerialNumber.Bytes())))
+	rs.extensions.observe(requestBody)
+	if serial := core.SerialToString(ocspRequest.SerialNumber); rs.capture.matches(serial) {
+		cw := &captureWriter{ResponseWriter: response, max: rs.capture.maxBytes}
+		response = cw
+		defer func() {
+			err := rs.capture.write(serial, cw.status, requestBody, cw.body)
+			if err != nil {
+				rs.log.Errf("Writing capture for serial %s: %s", serial, err)
+			}
+		}()
+	}
+
 	le.Serial = fmt.Sprintf("%x", ocspRequest.SerialNumber.Bytes())
 	le.IssuerKeyHash = fmt.Sprintf("%x", ocspRequest.IssuerKeyHash)
 	le.IssuerNameHash = fmt.Sprintf("%x", ocspRequest.IssuerNameHash)
+	if namer, ok := rs.Source.(IssuerNamer); ok {
+		le.IssuerCN = namer.IssuerCommonName(ocspRequest)
+	}
 	le.HashAlg = hashToString[ocspRequest.HashAlgorithm]
 
+	// The preferred signature algorithms extension is advisory, so if it's
+	// malformed we ignore it rather than rejecting the request.
+	preferredSigAlgs, err := PreferredSignatureAlgorithms(requestBody)
+	if err != nil {
+		rs.log.Debugf("Ignoring preferred signature algorithms: serial %x: %s", ocspRequest.SerialNumber, err)
+	}
+	for _, alg := range preferredSigAlgs {
+		le.PreferredSigAlgs = append(le.PreferredSigAlgs, alg.String())
+	}
+
+	if !ShedExempt(ctx) {
+		if rs.inFlight.full() {
+			rs.shed(response, ocspRequest, "in-flight response bytes ceiling reached")
+			return
+		}
+		if rs.inFlight.underMemoryPressure() {
+			rs.shed(response, ocspRequest, "memory usage near limit")
+			return
+		}
+	}
+
+	timeout := rs.requestTimeout(request, ocspRequest)
+	if timeout != 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	// Look up OCSP response from source
 	ocspResponse, err := rs.Source.Response(ctx, ocspRequest)
+	lookedUp = time.Now()
 	if err != nil {
+		var rejected *RejectedRequestError
+		if errors.As(err, &rejected) {
+			rs.rejections.WithLabelValues(rejected.Reason).Inc()
+		}
 		if errors.Is(err, ErrNotFound) {
+			response.WriteHeader(rs.statusCodes.notFound())
 			response.Write(ocsp.UnauthorizedErrorResponse)
 			rs.responseTypes.With(prometheus.Labels{"type": responseTypeToString[ocsp.Unauthorized]}).Inc()
 			return
-		} else if errors.Is(err, errOCSPResponseExpired) {
+		} else if errors.Is(err, ErrExpired) {
 			rs.sampledError("Requested ocsp response is expired: serial %x, request body %s",
 				ocspRequest.SerialNumber, b64Body)
-			// HTTP StatusCode - unassigned
-			response.WriteHeader(533)
+			response.WriteHeader(rs.statusCodes.expired())
 			response.Write(ocsp.InternalErrorErrorResponse)
 			rs.responseTypes.With(prometheus.Labels{"type": responseTypeToString[ocsp.Unauthorized]}).Inc()
 			return
+		} else if errors.Is(err, ErrTryLater) {
+			rs.shed(response, ocspRequest, err.Error())
+			return
+		} else if errors.Is(err, ErrMalformed) {
+			rs.log.Debugf("Refusing malformed OCSP request: %s", err)
+			response.WriteHeader(rs.statusCodes.malformed())
+			response.Write(ocsp.MalformedRequestErrorResponse)
+			rs.responseTypes.With(prometheus.Labels{"type": responseTypeToString[ocsp.Malformed]}).Inc()
+			return
 		}
 		rs.sampledError("Error retrieving response for request: serial %x, request body %s, error: %s",
 			ocspRequest.SerialNumber, b64Body, err)
-		response.WriteHeader(http.StatusInternalServerError)
+		response.WriteHeader(rs.statusCodes.internalError())
 		response.Write(ocsp.InternalErrorErrorResponse)
 		rs.responseTypes.With(prometheus.Labels{"type": responseTypeToString[ocsp.InternalError]}).Inc()
 		return
 	}
 
+	// Responses to exempt requests are written regardless of the ceiling,
+	// and so aren't counted against it.
+	if !ShedExempt(ctx) {
+		if !rs.inFlight.reserve(len(ocspResponse.Raw)) {
+			rs.shed(response, ocspRequest, "in-flight response bytes ceiling reached")
+			return
+		}
+		defer rs.inFlight.release(len(ocspResponse.Raw))
+	}
+
 	// Write OCSP response
 	response.Header().Add("Last-Modified", ocspResponse.ThisUpdate.Format(time.RFC1123))
-	response.Header().Add("Expires", ocspResponse.NextUpdate.Format(time.RFC1123))
-	now := rs.clk.Now()
-	var maxAge int
-	if now.Before(ocspResponse.NextUpdate) {
-		maxAge = int(ocspResponse.NextUpdate.Sub(now) / time.Second)
-	} else {
-		// TODO(#530): we want max-age=0 but this is technically an authorized OCSP response
-		//             (despite being stale) and 5019 forbids attaching no-cache
-		maxAge = 0
+	// A response without a nextUpdate never expires, but nor is there a
+	// point at which caches should refresh it, so it's sent without an
+	// Expires header and with a max-age of zero.
+	if !ocspResponse.NextUpdate.IsZero() {
+		response.Header().Add("Expires", ocspResponse.NextUpdate.Format(time.RFC1123))
 	}
 	response.Header().Set(
 		"Cache-Control",
 		fmt.Sprintf(
 			"max-age=%d, public, no-transform, must-revalidate",
-			maxAge,
+			rs.maxAge(request, ocspResponse.SerialNumber, ocspResponse.NextUpdate),
 		),
 	)
 	responseHash := sha256.Sum256(ocspResponse.Raw)
-	response.Header().Add("ETag", fmt.Sprintf("\"%X\"", responseHash))
+	etag := fmt.Sprintf("\"%X\"", responseHash)
+	response.Header().Add("ETag", etag)
 
 	serialString := core.SerialToString(ocspResponse.SerialNumber)
 	if len(serialString) > 2 {
@@ -348,18 +894,49 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 		// about 1/256 of our responses.
 		response.Header().Add("Edge-Cache-Tag", serialString[len(serialString)-2:])
 	}
+	if tag := rs.profileTags.tag(serialString, ocspRequest.IssuerKeyHash); tag != "" {
+		response.Header().Add("Edge-Cache-Tag", tag)
+	}
 
 	// RFC 7232 says that a 304 response must contain the above
 	// headers if they would also be sent for a 200 for the same
 	// request, so we have to wait until here to do this
-	if etag := request.Header.Get("If-None-Match"); etag != "" {
-		if etag == fmt.Sprintf("\"%X\"", responseHash) {
-			response.WriteHeader(http.StatusNotModified)
-			return
-		}
+	noneMatch := request.Header.Values("If-None-Match")
+	if ifNoneMatch(noneMatch, etag) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	// If-Modified-Since is only evaluated for GET and HEAD requests without
+	// an If-None-Match, per RFC 7232, Section 6.
+	if rs.ifModifiedSince && len(noneMatch) == 0 && request.Method != http.MethodPost &&
+		notModifiedSince(request.Header.Get("If-Modified-Since"), ocspResponse.ThisUpdate) {
+		response.WriteHeader(http.StatusNotModified)
+		return
 	}
 	response.WriteHeader(http.StatusOK)
 	response.Write(ocspResponse.Raw)
 	rs.responseAges.Observe(rs.clk.Now().Sub(ocspResponse.ThisUpdate).Seconds())
 	rs.responseTypes.With(prometheus.Labels{"type": responseTypeToString[ocsp.Success]}).Inc()
 }
+
+// decodeGETRequest decodes the base64-encoded OCSP request from a GET path.
+// '/' is a base64 character, so slashes within the path are part of the
+// request and are kept. Some clients append a trailing slash, though, which
+// makes a padded request undecodable. If the path doesn't decode as it is,
+// it's retried with any trailing slashes removed. A request whose encoding
+// legitimately ends in '/' decodes on the first attempt, so is unaffected.
+func decodeGETRequest(path string) ([]byte, error) {
+	der, err := base64.StdEncoding.DecodeString(path)
+	if err == nil || !strings.HasSuffix(path, "/") {
+		return der, err
+	}
+	path = strings.TrimRight(path, "/")
+	if path == "" {
+		return nil, err
+	}
+	trimmed, trimErr := base64.StdEncoding.DecodeString(path)
+	if trimErr != nil {
+		return nil, err
+	}
+	return trimmed, nil
+}
@@ -32,20 +32,32 @@ package responder
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/jmhodges/clock"
 	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
 	"golang.org/x/crypto/ocsp"
 
+	"github.com/letsencrypt/boulder/config"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/issuance"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/test"
 )
 
@@ -70,10 +82,29 @@ func (ts testSource) Response(_ context.Context, r *ocsp.Request) (*Response, er
 	return &Response{resp, respBytes}, nil
 }
 
+// panicSource is a Source which must not be consulted.
+type panicSource struct{}
+
+func (ps panicSource) Response(context.Context, *ocsp.Request) (*Response, error) {
+	panic("shouldn't happen")
+}
+
 type expiredSource struct{}
 
 func (es expiredSource) Response(_ context.Context, r *ocsp.Request) (*Response, error) {
-	return nil, errOCSPResponseExpired
+	return nil, ErrExpired
+}
+
+type tryLaterSource struct{}
+
+func (tls tryLaterSource) Response(_ context.Context, r *ocsp.Request) (*Response, error) {
+	return nil, fmt.Errorf("shedding: %w", ErrTryLater)
+}
+
+type malformedSource struct{}
+
+func (ms malformedSource) Response(_ context.Context, r *ocsp.Request) (*Response, error) {
+	return nil, fmt.Errorf("bad serial: %w", ErrMalformed)
 }
 
 type testCase struct {
@@ -87,7 +118,8 @@ func TestResponseExpired(t *testing.T) {
 	}
 
 	responder := Responder{
-		Source: expiredSource{},
+		Source:        expiredSource{},
+		serialLengths: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "serialLengths-test"}),
 		responseTypes: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "ocspResponses-test",
@@ -117,9 +149,61 @@ func TestResponseExpired(t *testing.T) {
 	}
 }
 
+func TestTryLater(t *testing.T) {
+	responder := Responder{
+		Source:        tryLaterSource{},
+		serialLengths: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "serialLengths-test"}),
+		responseTypes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ocspResponses-test",
+			},
+			[]string{"type"},
+		),
+		clk: clock.NewFake(),
+		log: blog.NewMock(),
+	}
+
+	rw := httptest.NewRecorder()
+	responder.ServeHTTP(rw, &http.Request{
+		Method: "GET",
+		URL: &url.URL{
+			Path: "/MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D",
+		},
+	})
+	test.AssertEquals(t, rw.Code, http.StatusServiceUnavailable)
+	test.AssertByteEquals(t, ocsp.TryLaterErrorResponse, rw.Body.Bytes())
+	test.AssertMetricWithLabelsEquals(t, responder.responseTypes, prometheus.Labels{"type": "TryLater"}, 1)
+}
+
+func TestSourceMalformed(t *testing.T) {
+	responder := Responder{
+		Source:        malformedSource{},
+		serialLengths: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "serialLengths-test"}),
+		responseTypes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ocspResponses-test",
+			},
+			[]string{"type"},
+		),
+		clk: clock.NewFake(),
+		log: blog.NewMock(),
+	}
+
+	rw := httptest.NewRecorder()
+	responder.ServeHTTP(rw, &http.Request{
+		Method: "GET",
+		URL: &url.URL{
+			Path: "/MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D",
+		},
+	})
+	test.AssertEquals(t, rw.Code, http.StatusBadRequest)
+	test.AssertByteEquals(t, ocsp.MalformedRequestErrorResponse, rw.Body.Bytes())
+	test.AssertMetricWithLabelsEquals(t, responder.responseTypes, prometheus.Labels{"type": "Malformed"}, 1)
+}
+
 func TestOCSP(t *testing.T) {
 	cases := []testCase{
-		{"OPTIONS", "/", http.StatusMethodNotAllowed},
+		{"PUT", "/", http.StatusMethodNotAllowed},
 		{"GET", "/", http.StatusBadRequest},
 		// Bad URL encoding
 		{"GET", "%ZZFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", http.StatusBadRequest},
@@ -136,7 +220,8 @@ func TestOCSP(t *testing.T) {
 	}
 
 	responder := Responder{
-		Source: testSource{},
+		Source:        testSource{},
+		serialLengths: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "serialLengths-test"}),
 		responseTypes: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "ocspResponses-test",
@@ -180,9 +265,89 @@ func TestOCSP(t *testing.T) {
 	test.AssertMetricWithLabelsEquals(t, responder.responseAges, prometheus.Labels{}, 2)
 }
 
+func TestDecodeGETRequest(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected []byte
+	}{
+		// Slashes are base64 characters, and are kept wherever they are.
+		{"////", []byte{0xff, 0xff, 0xff}},
+		{"//8=", []byte{0xff, 0xff}},
+		// A trailing slash which isn't part of the encoding is dropped.
+		{"//8=/", []byte{0xff, 0xff}},
+		{"//8=//", []byte{0xff, 0xff}},
+		{"//////", nil},
+		{"/", nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			der, err := decodeGETRequest(tc.path)
+			if tc.expected == nil {
+				test.AssertError(t, err, "decoded invalid path")
+				return
+			}
+			test.AssertNotError(t, err, "decoding path")
+			test.AssertByteEquals(t, der, tc.expected)
+		})
+	}
+}
+
+func TestHeadAndOptions(t *testing.T) {
+	responder := Responder{
+		Source:        testSource{},
+		serialLengths: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "serialLengths-test"}),
+		responseTypes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ocspResponses-test",
+			},
+			[]string{"type"},
+		),
+		responseAges: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "ocspAges-test",
+				Buckets: []float64{43200},
+			},
+		),
+		clk: clock.NewFake(),
+		log: blog.NewMock(),
+	}
+	const path = "MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D"
+
+	// HEAD gets the same status and headers as GET, but no body.
+	get := httptest.NewRecorder()
+	responder.ServeHTTP(get, &http.Request{Method: "GET", URL: &url.URL{Path: path}})
+	test.AssertEquals(t, get.Code, http.StatusOK)
+	head := httptest.NewRecorder()
+	responder.ServeHTTP(head, &http.Request{Method: "HEAD", URL: &url.URL{Path: path}})
+	test.AssertEquals(t, head.Code, http.StatusOK)
+	test.AssertEquals(t, head.Body.Len(), 0)
+	test.AssertDeepEquals(t, head.Header(), get.Header())
+
+	// A malformed HEAD request gets the same error status as GET.
+	head = httptest.NewRecorder()
+	responder.ServeHTTP(head, &http.Request{Method: "HEAD", URL: &url.URL{Path: "=="}})
+	test.AssertEquals(t, head.Code, http.StatusBadRequest)
+	test.AssertEquals(t, head.Body.Len(), 0)
+
+	// OPTIONS lists the allowed methods, without a lookup.
+	responder.Source = panicSource{}
+	options := httptest.NewRecorder()
+	responder.ServeHTTP(options, &http.Request{Method: "OPTIONS", URL: &url.URL{Path: path}})
+	test.AssertEquals(t, options.Code, http.StatusNoContent)
+	test.AssertEquals(t, options.Header().Get("Allow"), "GET, HEAD, POST")
+	test.AssertEquals(t, options.Body.Len(), 0)
+
+	// Other methods are refused, listing the same methods.
+	put := httptest.NewRecorder()
+	responder.ServeHTTP(put, &http.Request{Method: "PUT", URL: &url.URL{Path: path}})
+	test.AssertEquals(t, put.Code, http.StatusMethodNotAllowed)
+	test.AssertEquals(t, put.Header().Get("Allow"), "GET, HEAD, POST")
+}
+
 func TestRequestTooBig(t *testing.T) {
 	responder := Responder{
-		Source: testSource{},
+		Source:        testSource{},
+		serialLengths: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "serialLengths-test"}),
 		responseTypes: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "ocspResponses-test",
@@ -210,7 +375,7 @@ func TestRequestTooBig(t *testing.T) {
 }
 
 func TestCacheHeaders(t *testing.T) {
-	source, err := NewMemorySourceFromFile(responseFile, blog.NewMock())
+	source, err := NewMemorySourceFromFile(responseFile, metrics.NoopRegisterer, blog.NewMock())
 	if err != nil {
 		t.Fatalf("Error constructing source: %s", err)
 	}
@@ -218,7 +383,8 @@ func TestCacheHeaders(t *testing.T) {
 	fc := clock.NewFake()
 	fc.Set(time.Date(2015, 11, 12, 0, 0, 0, 0, time.UTC))
 	responder := Responder{
-		Source: source,
+		Source:        source,
+		serialLengths: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "serialLengths-test"}),
 		responseTypes: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "ocspResponses-test",
@@ -285,34 +451,646 @@ func TestCacheHeaders(t *testing.T) {
 	}
 }
 
+func TestCacheHeadersNoNextUpdate(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	fc := clock.NewFake()
+	cert := issuer.Cert.Certificate
+	der, err := ocsp.CreateResponse(cert, cert, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: big.NewInt(1),
+		ThisUpdate:   fc.Now(),
+	}, issuer.Signer)
+	test.AssertNotError(t, err, "signing response")
+	resp, err := ocsp.ParseResponse(der, nil)
+	test.AssertNotError(t, err, "parsing response")
+
+	responder := NewResponder(&echoSource{&Response{resp, der}}, Options{Timeout: time.Second, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+	responder.clk = fc
+	reqBytes, err := requestFor(t, issuer, 1).Marshal()
+	test.AssertNotError(t, err, "marshaling request")
+	rw := httptest.NewRecorder()
+	responder.ServeHTTP(rw, httptest.NewRequest("POST", "/", bytes.NewReader(reqBytes)))
+	test.AssertEquals(t, rw.Code, http.StatusOK)
+	test.AssertDeepEquals(t, rw.Body.Bytes(), der)
+	_, ok := rw.Result().Header["Expires"]
+	test.Assert(t, !ok, "response without nextUpdate sent with an Expires header")
+	test.AssertEquals(t, rw.Result().Header.Get("Cache-Control"), "max-age=0, public, no-transform, must-revalidate")
+}
+
+func TestProfileTags(t *testing.T) {
+	source, err := NewMemorySourceFromFile(responseFile, metrics.NoopRegisterer, blog.NewMock())
+	test.AssertNotError(t, err, "constructing source")
+
+	// The request is for serial 124d, from the issuer with this key hash.
+	keyHash := "e9a43fee9ea5e6f2d5d779603c93a62e248e97aa"
+	testCases := []struct {
+		name     string
+		conf     ProfileTagConfig
+		expected []string
+	}{
+		{"unconfigured", ProfileTagConfig{}, []string{"4d"}},
+		{"serial prefix", ProfileTagConfig{
+			SerialPrefixes: map[string]string{"00": "classic", "7f": "shortlived"},
+		}, []string{"4d", "classic"}},
+		{"longest serial prefix", ProfileTagConfig{
+			SerialPrefixes: map[string]string{"00": "classic", "0000": "tlsserver"},
+		}, []string{"4d", "tlsserver"}},
+		{"prefix before issuer", ProfileTagConfig{
+			SerialPrefixes: map[string]string{"00": "classic"},
+			Issuers:        map[string]string{keyHash: "r3"},
+		}, []string{"4d", "classic"}},
+		{"issuer", ProfileTagConfig{
+			SerialPrefixes: map[string]string{"7f": "shortlived"},
+			Issuers:        map[string]string{strings.ToUpper(keyHash): "r3"},
+		}, []string{"4d", "r3"}},
+		{"no match", ProfileTagConfig{
+			SerialPrefixes: map[string]string{"7f": "shortlived"},
+			Issuers:        map[string]string{strings.Repeat("ab", 20): "r3"},
+		}, []string{"4d"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			responder := NewResponder(source, Options{Timeout: time.Second, ProfileTags: tc.conf, LogSampleRate: 1}, prometheus.NewRegistry(), blog.NewMock())
+			rw := httptest.NewRecorder()
+			responder.ServeHTTP(rw, &http.Request{
+				Method: "GET",
+				URL: &url.URL{
+					Path: "MEMwQTA/MD0wOzAJBgUrDgMCGgUABBSwLsMRhyg1dJUwnXWk++D57lvgagQU6aQ/7p6l5vLV13lgPJOmLiSOl6oCAhJN",
+				},
+			})
+			test.AssertEquals(t, rw.Code, http.StatusOK)
+			test.AssertDeepEquals(t, rw.Result().Header.Values("Edge-Cache-Tag"), tc.expected)
+		})
+	}
+}
+
+func TestStaplingMaxAge(t *testing.T) {
+	source, err := NewMemorySourceFromFile(responseFile, metrics.NoopRegisterer, blog.NewMock())
+	test.AssertNotError(t, err, "constructing source")
+
+	fc := clock.NewFake()
+	fc.Set(time.Date(2015, 11, 12, 0, 0, 0, 0, time.UTC))
+	newResponder := func(maxAge time.Duration) http.Handler {
+		return Responder{
+			Source:        source,
+			serialLengths: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "serialLengths-test"}),
+			stapling:      StaplingConfig{Header: "X-Stapling", MaxAge: config.Duration{Duration: maxAge}},
+			responseTypes: prometheus.NewCounterVec(
+				prometheus.CounterOpts{Name: "ocspResponses-test"},
+				[]string{"type"},
+			),
+			responseAges: prometheus.NewHistogram(
+				prometheus.HistogramOpts{Name: "ocspAges-test"},
+			),
+			clk: fc,
+			log: blog.NewMock(),
+		}
+	}
+	const path = "MEMwQTA/MD0wOzAJBgUrDgMCGgUABBSwLsMRhyg1dJUwnXWk++D57lvgagQU6aQ/7p6l5vLV13lgPJOmLiSOl6oCAhJN"
+
+	testCases := []struct {
+		name     string
+		maxAge   time.Duration
+		header   bool
+		path     bool
+		expected string
+	}{
+		{"regular request", time.Hour, false, false, "max-age=471398400, public, no-transform, must-revalidate"},
+		{"stapling header", time.Hour, true, false, "max-age=3600, public, no-transform, must-revalidate"},
+		{"stapling path", time.Hour, false, true, "max-age=3600, public, no-transform, must-revalidate"},
+		{"longer than nextUpdate", 100 * 365 * 24 * time.Hour, true, true, "max-age=471398400, public, no-transform, must-revalidate"},
+		{"unset", 0, true, true, "max-age=471398400, public, no-transform, must-revalidate"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newResponder(tc.maxAge)
+			if tc.path {
+				h = StaplingHandler(h)
+			}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.URL.Path = path
+			if tc.header {
+				req.Header.Set("X-Stapling", "1")
+			}
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+			test.AssertEquals(t, rw.Code, http.StatusOK)
+			test.AssertEquals(t, rw.Header().Get("Cache-Control"), tc.expected)
+		})
+	}
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	etag := "\"8169FB0843B081A76E9F6F13FD70C8411597BEACF8B182136FFDD19FBD26140A\""
+	testCases := []struct {
+		name   string
+		values []string
+		match  bool
+	}{
+		{"absent", nil, false},
+		{"exact", []string{etag}, true},
+		{"different", []string{"\"ABCD\""}, false},
+		{"unquoted", []string{"8169FB0843B081A76E9F6F13FD70C8411597BEACF8B182136FFDD19FBD26140A"}, false},
+		{"weak", []string{"W/" + etag}, true},
+		{"list", []string{"\"ABCD\", " + etag}, true},
+		{"multiple headers", []string{"\"ABCD\"", etag}, true},
+		{"wildcard", []string{"*"}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			test.AssertEquals(t, ifNoneMatch(tc.values, etag), tc.match)
+		})
+	}
+}
+
+func TestNotModifiedSince(t *testing.T) {
+	lastModified := time.Date(2020, 6, 19, 0, 0, 0, 500, time.UTC)
+	testCases := []struct {
+		name        string
+		value       string
+		notModified bool
+	}{
+		{"absent", "", false},
+		{"equal", "Fri, 19 Jun 2020 00:00:00 GMT", true},
+		{"later", "Fri, 19 Jun 2020 00:00:01 GMT", true},
+		{"earlier", "Thu, 18 Jun 2020 23:59:59 GMT", false},
+		{"our Last-Modified format", lastModified.Format(time.RFC1123), true},
+		{"invalid", "yesterday", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			test.AssertEquals(t, notModifiedSince(tc.value, lastModified), tc.notModified)
+		})
+	}
+}
+
+func TestIfModifiedSince(t *testing.T) {
+	resp, err := testSource{}.Response(context.Background(), nil)
+	test.AssertNotError(t, err, "getting test response")
+	path := "/MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D"
+	der, err := base64.StdEncoding.DecodeString("MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx/o6OXOHa+Yfe32YhgQU+3hPEvlgFYMsnxd/NBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI//xsd4=")
+	test.AssertNotError(t, err, "decoding request")
+	matching := resp.ThisUpdate.Format(http.TimeFormat)
+	earlier := resp.ThisUpdate.Add(-time.Second).Format(http.TimeFormat)
+
+	testCases := []struct {
+		name     string
+		enabled  bool
+		method   string
+		headers  map[string]string
+		wantCode int
+	}{
+		{"matching", true, "GET", map[string]string{"If-Modified-Since": matching}, http.StatusNotModified},
+		{"matching Last-Modified", true, "GET", map[string]string{"If-Modified-Since": resp.ThisUpdate.Format(time.RFC1123)}, http.StatusNotModified},
+		{"non-matching", true, "GET", map[string]string{"If-Modified-Since": earlier}, http.StatusOK},
+		{"invalid", true, "GET", map[string]string{"If-Modified-Since": "yesterday"}, http.StatusOK},
+		{"disabled", false, "GET", map[string]string{"If-Modified-Since": matching}, http.StatusOK},
+		{"POST", true, "POST", map[string]string{"If-Modified-Since": matching}, http.StatusOK},
+		{"If-None-Match takes precedence", true, "GET", map[string]string{"If-Modified-Since": matching, "If-None-Match": "\"ABCD\""}, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			responder := NewResponder(testSource{}, Options{Timeout: time.Second, IfModifiedSince: tc.enabled, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+			req := httptest.NewRequest(tc.method, path, nil)
+			if tc.method == "POST" {
+				req = httptest.NewRequest(tc.method, "/", bytes.NewReader(der))
+			}
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rw := httptest.NewRecorder()
+			responder.ServeHTTP(rw, req)
+			test.AssertEquals(t, rw.Code, tc.wantCode)
+			test.AssertEquals(t, rw.Header().Get("Last-Modified"), resp.ThisUpdate.Format(time.RFC1123))
+			if tc.wantCode == http.StatusNotModified {
+				test.AssertEquals(t, rw.Body.Len(), 0)
+				test.AssertNotEquals(t, rw.Header().Get("ETag"), "")
+			}
+		})
+	}
+}
+
 func TestNewSourceFromFile(t *testing.T) {
 	logger := blog.NewMock()
-	_, err := NewMemorySourceFromFile("", logger)
+	_, err := NewMemorySourceFromFile("", metrics.NoopRegisterer, logger)
 	if err == nil {
 		t.Fatal("Didn't fail on non-file input")
 	}
 
 	// expected case
-	_, err = NewMemorySourceFromFile(responseFile, logger)
+	_, err = NewMemorySourceFromFile(responseFile, metrics.NoopRegisterer, logger)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// binary-formatted file
-	_, err = NewMemorySourceFromFile(binResponseFile, logger)
+	_, err = NewMemorySourceFromFile(binResponseFile, metrics.NoopRegisterer, logger)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// the response file from before, with stuff deleted
-	_, err = NewMemorySourceFromFile(brokenResponseFile, logger)
+	_, err = NewMemorySourceFromFile(brokenResponseFile, metrics.NoopRegisterer, logger)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// mix of a correct and malformed responses
-	_, err = NewMemorySourceFromFile(mixResponseFile, logger)
+	_, err = NewMemorySourceFromFile(mixResponseFile, metrics.NoopRegisterer, logger)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
+
+func TestNewSourceFromFileFormats(t *testing.T) {
+	contents, err := os.ReadFile(responseFile)
+	test.AssertNotError(t, err, "reading response file")
+	base64Source, err := NewMemorySourceFromFile(responseFile, metrics.NoopRegisterer, blog.NewMock())
+	test.AssertNotError(t, err, "loading base64 response file")
+	test.Assert(t, len(base64Source.responses) > 0, "no responses loaded from base64 response file")
+
+	var responsesB64 []string
+	var pemBuf bytes.Buffer
+	for _, b64 := range strings.Fields(string(contents)) {
+		der, err := base64.StdEncoding.DecodeString(b64)
+		test.AssertNotError(t, err, "decoding base64 response")
+		responsesB64 = append(responsesB64, b64)
+		err = pem.Encode(&pemBuf, &pem.Block{Type: "OCSP RESPONSE", Bytes: der})
+		test.AssertNotError(t, err, "encoding PEM response")
+	}
+	// Blocks of other types are skipped.
+	err = pem.Encode(&pemBuf, &pem.Block{Type: "CERTIFICATE", Bytes: []byte{0x30, 0x00}})
+	test.AssertNotError(t, err, "encoding PEM certificate")
+	jsonBytes, err := json.Marshal(responsesB64)
+	test.AssertNotError(t, err, "encoding JSON responses")
+
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name     string
+		contents []byte
+	}{
+		{"pem", pemBuf.Bytes()},
+		{"json", jsonBytes},
+		{"json with whitespace", append(append([]byte("\n  "), jsonBytes...), '\n')},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tc.name, " ", "_"))
+			err := os.WriteFile(path, tc.contents, 0600)
+			test.AssertNotError(t, err, "writing response file")
+			source, err := NewMemorySourceFromFile(path, metrics.NoopRegisterer, blog.NewMock())
+			test.AssertNotError(t, err, "loading response file")
+			test.AssertEquals(t, len(source.responses), len(base64Source.responses))
+			for serial, resp := range base64Source.responses {
+				test.AssertByteEquals(t, source.responses[serial].Raw, resp.Raw)
+			}
+		})
+	}
+
+	// A file which looks like JSON but isn't is an error, rather than being
+	// silently empty.
+	path := filepath.Join(dir, "bad.json")
+	err = os.WriteFile(path, []byte(`["unterminated`), 0600)
+	test.AssertNotError(t, err, "writing response file")
+	_, err = NewMemorySourceFromFile(path, metrics.NoopRegisterer, blog.NewMock())
+	test.AssertError(t, err, "loaded malformed JSON response file")
+}
+
+func TestNewSourceFromFileFreshness(t *testing.T) {
+	dir := t.TempDir()
+	modified := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	stats := prometheus.NewRegistry()
+
+	// Several files may be loaded, each with its own gauges.
+	contents, err := os.ReadFile(responseFile)
+	test.AssertNotError(t, err, "reading response file")
+	for _, name := range []string{"primary", "staging"} {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, contents, 0600)
+		test.AssertNotError(t, err, "writing response file")
+		err = os.Chtimes(path, modified, modified)
+		test.AssertNotError(t, err, "setting response file times")
+
+		source, err := NewMemorySourceFromFile(path, stats, blog.NewMock())
+		test.AssertNotError(t, err, "loading response file")
+		var newest time.Time
+		for _, resp := range source.responses {
+			if resp.ThisUpdate.After(newest) {
+				newest = resp.ThisUpdate
+			}
+		}
+		test.Assert(t, !newest.IsZero(), "no responses loaded")
+
+		gauges, err := stats.Gather()
+		test.AssertNotError(t, err, "gathering metrics")
+		values := make(map[string]float64)
+		for _, family := range gauges {
+			for _, m := range family.GetMetric() {
+				if m.GetLabel()[0].GetValue() == path {
+					values[family.GetName()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+		test.AssertEquals(t, values["ocsp_static_file_modified_seconds"], float64(modified.Unix()))
+		test.AssertEquals(t, values["ocsp_static_file_newest_thisupdate_seconds"], float64(newest.Unix()))
+	}
+}
+
+// deadlineSource records the time remaining until its context's deadline.
+type deadlineSource struct {
+	remaining time.Duration
+}
+
+func (ds *deadlineSource) Response(ctx context.Context, _ *ocsp.Request) (*Response, error) {
+	deadline, ok := ctx.Deadline()
+	if ok {
+		ds.remaining = time.Until(deadline)
+	}
+	return nil, ErrNotFound
+}
+
+func TestLowPriorityTimeout(t *testing.T) {
+	source := &deadlineSource{}
+	responder := Responder{
+		Source:        source,
+		serialLengths: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "serialLengths-test"}),
+		timeout:       10 * time.Second,
+		priority: PriorityConfig{
+			Header:            "X-Priority",
+			LowPriorityFactor: 0.1,
+			MinTimeout:        config.Duration{Duration: 2 * time.Second},
+		},
+		responseTypes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ocspResponses-test",
+			},
+			[]string{"type"},
+		),
+		clk: clock.NewFake(),
+		log: blog.NewMock(),
+	}
+
+	serve := func(priority string) time.Duration {
+		req := httptest.NewRequest("GET", "/MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", nil)
+		if priority != "" {
+			req.Header.Set("X-Priority", priority)
+		}
+		source.remaining = 0
+		responder.ServeHTTP(httptest.NewRecorder(), req)
+		return source.remaining
+	}
+
+	// Normal priority requests get the full timeout.
+	remaining := serve("")
+	test.Assert(t, remaining > 9*time.Second && remaining <= 10*time.Second, fmt.Sprintf("unexpected deadline %s", remaining))
+	remaining = serve("high")
+	test.Assert(t, remaining > 9*time.Second && remaining <= 10*time.Second, fmt.Sprintf("unexpected deadline %s", remaining))
+
+	// Low priority requests get the scaled timeout, clamped to the floor.
+	remaining = serve("LOW")
+	test.Assert(t, remaining > time.Second && remaining <= 2*time.Second, fmt.Sprintf("unexpected deadline %s", remaining))
+
+	// Without a floor, the scaled timeout is used as-is.
+	responder.priority.MinTimeout.Duration = 0
+	remaining = serve("low")
+	test.Assert(t, remaining > 0 && remaining <= time.Second, fmt.Sprintf("unexpected deadline %s", remaining))
+}
+
+func TestIssuerTimeouts(t *testing.T) {
+	slowIssuer := bytes.Repeat([]byte{0xaa}, 20)
+	fastIssuer := bytes.Repeat([]byte{0xbb}, 20)
+	greedyIssuer := bytes.Repeat([]byte{0xcc}, 20)
+	otherIssuer := bytes.Repeat([]byte{0xdd}, 20)
+
+	source := &deadlineSource{}
+	responder := NewResponder(source, Options{
+		Timeout: 5 * time.Second,
+		IssuerTimeouts: IssuerTimeoutConfig{
+			Overrides: map[string]config.Duration{
+				// Keys are matched case-insensitively.
+				strings.ToUpper(hex.EncodeToString(slowIssuer)): {Duration: 8 * time.Second},
+				hex.EncodeToString(fastIssuer):                  {Duration: time.Second},
+				hex.EncodeToString(greedyIssuer):                {Duration: time.Minute},
+			},
+			Max: config.Duration{Duration: 10 * time.Second},
+		},
+		LogSampleRate: 1,
+	}, metrics.NoopRegisterer, blog.NewMock())
+
+	serve := func(issuerKeyHash []byte) time.Duration {
+		t.Helper()
+		ocspReq := &ocsp.Request{
+			HashAlgorithm:  crypto.SHA1,
+			IssuerNameHash: make([]byte, 20),
+			IssuerKeyHash:  issuerKeyHash,
+			SerialNumber:   big.NewInt(1),
+		}
+		der, err := ocspReq.Marshal()
+		test.AssertNotError(t, err, "marshaling OCSP request")
+		source.remaining = 0
+		responder.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", bytes.NewReader(der)))
+		return source.remaining
+	}
+
+	testCases := []struct {
+		name          string
+		issuerKeyHash []byte
+		want          time.Duration
+	}{
+		{"slow issuer", slowIssuer, 8 * time.Second},
+		{"fast issuer", fastIssuer, time.Second},
+		{"override clamped to max", greedyIssuer, 10 * time.Second},
+		{"no override", otherIssuer, 5 * time.Second},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			remaining := serve(tc.issuerKeyHash)
+			test.Assert(t, remaining > tc.want-time.Second && remaining <= tc.want, fmt.Sprintf("unexpected deadline %s, expected about %s", remaining, tc.want))
+		})
+	}
+}
+
+func TestMaxAgeJitter(t *testing.T) {
+	fc := clock.NewFake()
+	rs := Responder{maxAgeJitter: time.Hour, clk: fc}
+	nextUpdate := fc.Now().Add(24 * time.Hour)
+	req := httptest.NewRequest("GET", "/", nil)
+
+	seen := make(map[int]bool)
+	for i := range int64(200) {
+		serial := big.NewInt(1000 + i)
+		maxAge := rs.maxAge(req, serial, nextUpdate)
+		// The same serial always gets the same max-age.
+		test.AssertEquals(t, rs.maxAge(req, new(big.Int).Set(serial), nextUpdate), maxAge)
+		test.Assert(t, maxAge <= 24*3600 && maxAge >= 23*3600, fmt.Sprintf("max-age %d outside the jitter band", maxAge))
+		seen[maxAge] = true
+	}
+	test.Assert(t, len(seen) > 100, fmt.Sprintf("only %d distinct max-ages for 200 serials", len(seen)))
+
+	// The jitter never makes the max-age negative.
+	test.Assert(t, rs.maxAge(req, big.NewInt(1), fc.Now().Add(time.Second)) >= 0, "negative max-age")
+
+	// Without jitter, every serial gets the full max-age.
+	rs.maxAgeJitter = 0
+	test.AssertEquals(t, rs.maxAge(req, big.NewInt(1000), nextUpdate), 24*3600)
+	test.AssertEquals(t, rs.maxAge(req, big.NewInt(1001), nextUpdate), 24*3600)
+}
+
+func TestLogIssuerCommonName(t *testing.T) {
+	issuer, err := issuance.LoadCertificate("./testdata/test-ca.der.pem")
+	test.AssertNotError(t, err, "failed to load issuer cert")
+	filter, err := NewFilterSource(StaticIssuers{issuer}, FilterConfig{}, expiredSource{}, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	test.AssertNotError(t, err, "creating filter")
+
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+
+	serve := func(der []byte) *blog.Mock {
+		t.Helper()
+		logger := blog.NewMock()
+		responder := NewResponder(filter, Options{Timeout: time.Second, LogSampleRate: 1}, metrics.NoopRegisterer, logger)
+		responder.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", bytes.NewReader(der)))
+		return logger
+	}
+
+	// A known issuer is named alongside its key hash.
+	logger := serve(reqBytes)
+	test.AssertEquals(t, len(logger.GetAllMatching(`"issuerKeyHash":"fb784f12f96015832c9f177f3419b32e36ea4189","issuerNameHash":"[0-9a-f]+","issuerCN":"happy hacker fake CA"`)), 1)
+
+	// An unknown issuer is logged by its hashes alone.
+	ocspReq, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+	ocspReq.IssuerKeyHash[0]++
+	der, err := ocspReq.Marshal()
+	test.AssertNotError(t, err, "marshaling OCSP request")
+	logger = serve(der)
+	test.AssertEquals(t, len(logger.GetAllMatching(`"issuerKeyHash":"fc784f12`)), 1)
+	test.AssertEquals(t, len(logger.GetAllMatching(`issuerCN`)), 0)
+}
+
+func TestRequestRejections(t *testing.T) {
+	issuer, err := issuance.LoadCertificate("./testdata/test-ca.der.pem")
+	test.AssertNotError(t, err, "failed to load issuer cert")
+	filter, err := NewFilterSource(StaticIssuers{issuer}, FilterConfig{SerialPrefixes: []string{"00"}}, testSource{}, metrics.NoopRegisterer, blog.NewMock(), clock.New())
+	test.AssertNotError(t, err, "creating filter")
+	responder := NewResponder(filter, Options{Timeout: time.Second, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	serve := func(modify func(*ocsp.Request)) []byte {
+		t.Helper()
+		ocspReq, err := ocsp.ParseRequest(reqBytes)
+		test.AssertNotError(t, err, "failed to parse OCSP request")
+		modify(ocspReq)
+		der, err := ocspReq.Marshal()
+		test.AssertNotError(t, err, "marshaling OCSP request")
+		rw := httptest.NewRecorder()
+		responder.ServeHTTP(rw, httptest.NewRequest("POST", "/", bytes.NewReader(der)))
+		return rw.Body.Bytes()
+	}
+
+	// A request which passes the checks isn't counted, even though the test
+	// source's response is then refused.
+	serve(func(*ocsp.Request) {})
+
+	test.AssertByteEquals(t, serve(func(req *ocsp.Request) { req.SerialNumber.SetInt64(0) }), ocsp.MalformedRequestErrorResponse)
+	test.AssertByteEquals(t, serve(func(req *ocsp.Request) { req.HashAlgorithm = crypto.SHA256 }), ocsp.UnauthorizedErrorResponse)
+	test.AssertByteEquals(t, serve(func(req *ocsp.Request) {
+		serialStr := []byte(core.SerialToString(req.SerialNumber))
+		serialStr[0]++
+		req.SerialNumber.SetString(string(serialStr), 16)
+	}), ocsp.UnauthorizedErrorResponse)
+	test.AssertByteEquals(t, serve(func(req *ocsp.Request) { req.IssuerKeyHash[0]++ }), ocsp.UnauthorizedErrorResponse)
+	test.AssertByteEquals(t, serve(func(req *ocsp.Request) { req.IssuerKeyHash[0]++ }), ocsp.UnauthorizedErrorResponse)
+
+	test.AssertMetricWithLabelsEquals(t, responder.rejections, prometheus.Labels{"reason": "invalid_serial"}, 1)
+	test.AssertMetricWithLabelsEquals(t, responder.rejections, prometheus.Labels{"reason": "wrong_hash_algorithm"}, 1)
+	test.AssertMetricWithLabelsEquals(t, responder.rejections, prometheus.Labels{"reason": "wrong_prefix"}, 1)
+	test.AssertMetricWithLabelsEquals(t, responder.rejections, prometheus.Labels{"reason": "wrong_issuer"}, 2)
+	test.AssertMetricWithLabelsEquals(t, responder.rejections, prometheus.Labels{}, 5)
+}
+
+func TestMaxGETSize(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	encoded := base64.StdEncoding.EncodeToString(reqBytes)
+
+	serve := func(maxGETSize int, req *http.Request) (*httptest.ResponseRecorder, *Responder) {
+		t.Helper()
+		responder := NewResponder(testSource{}, Options{Timeout: time.Second, MaxGETSize: maxGETSize, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+		rw := httptest.NewRecorder()
+		responder.ServeHTTP(rw, req)
+		return rw, responder
+	}
+	get := func() *http.Request {
+		return httptest.NewRequest("GET", "/"+url.PathEscape(encoded), nil)
+	}
+	post := func() *http.Request {
+		return httptest.NewRequest("POST", "/", bytes.NewReader(reqBytes))
+	}
+
+	// A GET at the threshold is answered.
+	rw, _ := serve(len(encoded), get())
+	test.AssertEquals(t, rw.Code, http.StatusOK)
+
+	// Just over it, the GET is refused, pointing the client at POST.
+	rw, responder := serve(len(encoded)-1, get())
+	test.AssertEquals(t, rw.Code, http.StatusMethodNotAllowed)
+	test.AssertEquals(t, rw.Header().Get("Allow"), "POST")
+	test.AssertMetricWithLabelsEquals(t, responder.oversizedGETs, prometheus.Labels{}, 1)
+
+	// The same request is answered by POST.
+	rw, responder = serve(len(encoded)-1, post())
+	test.AssertEquals(t, rw.Code, http.StatusOK)
+	test.AssertMetricWithLabelsEquals(t, responder.oversizedGETs, prometheus.Labels{}, 0)
+}
+
+func TestMaxCertIDs(t *testing.T) {
+	responder := NewResponder(testSource{}, Options{Timeout: time.Second, MaxCertIDs: 2, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+
+	// A request at the limit is answered.
+	rw := httptest.NewRecorder()
+	responder.ServeHTTP(rw, httptest.NewRequest("POST", "/", bytes.NewReader(requestWithCertIDs(t, 2))))
+	test.AssertEquals(t, rw.Code, http.StatusOK)
+	test.AssertMetricWithLabelsEquals(t, responder.excessCertIDs, prometheus.Labels{}, 0)
+
+	// Beyond it, the request is rejected as malformed.
+	rw = httptest.NewRecorder()
+	responder.ServeHTTP(rw, httptest.NewRequest("POST", "/", bytes.NewReader(requestWithCertIDs(t, 3))))
+	test.AssertEquals(t, rw.Code, http.StatusBadRequest)
+	test.AssertByteEquals(t, rw.Body.Bytes(), ocsp.MalformedRequestErrorResponse)
+	test.AssertMetricWithLabelsEquals(t, responder.excessCertIDs, prometheus.Labels{}, 1)
+	test.AssertMetricWithLabelsEquals(t, responder.responseTypes, prometheus.Labels{"type": "Malformed"}, 1)
+}
+
+func TestSerialLengths(t *testing.T) {
+	responder := NewResponder(testSource{}, Options{Timeout: time.Second, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+
+	for _, length := range []int{1, 16, 16, 18, 25} {
+		ocspReq := &ocsp.Request{
+			HashAlgorithm:  crypto.SHA1,
+			IssuerNameHash: make([]byte, 20),
+			IssuerKeyHash:  make([]byte, 20),
+			SerialNumber:   new(big.Int).SetBytes(bytes.Repeat([]byte{0x7f}, length)),
+		}
+		der, err := ocspReq.Marshal()
+		test.AssertNotError(t, err, "marshaling OCSP request")
+		responder.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", bytes.NewReader(der)))
+	}
+
+	var m io_prometheus_client.Metric
+	err := responder.serialLengths.Write(&m)
+	test.AssertNotError(t, err, "reading histogram")
+	test.AssertEquals(t, m.Histogram.GetSampleCount(), uint64(5))
+	test.AssertEquals(t, m.Histogram.GetSampleSum(), float64(1+16+16+18+25))
+
+	cumulative := make(map[float64]uint64)
+	for _, bucket := range m.Histogram.GetBucket() {
+		cumulative[bucket.GetUpperBound()] = bucket.GetCumulativeCount()
+	}
+	test.AssertEquals(t, cumulative[1], uint64(1))
+	test.AssertEquals(t, cumulative[15], uint64(1))
+	test.AssertEquals(t, cumulative[16], uint64(3))
+	test.AssertEquals(t, cumulative[18], uint64(4))
+	test.AssertEquals(t, cumulative[20], uint64(4))
+	test.AssertEquals(t, cumulative[32], uint64(5))
+}
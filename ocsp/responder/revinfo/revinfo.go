@@ -0,0 +1,82 @@
+// Package revinfo provides a responder.Source which looks up OCSP responses
+// in the revocation-info gRPC service.
+package revinfo
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/crypto/ocsp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	capb "github.com/letsencrypt/boulder/ca/proto"
+	"github.com/letsencrypt/boulder/core"
+	berrors "github.com/letsencrypt/boulder/errors"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	sapb "github.com/letsencrypt/boulder/sa/proto"
+)
+
+// getOCSPResponseMethod is the full name of the revocation-info service's
+// method returning the stored OCSP response for a serial. It answers with a
+// NotFound status for serials it has no response for.
+const getOCSPResponseMethod = "/revinfo.RevocationInfo/GetOCSPResponse"
+
+// ocspLookup looks up the stored OCSP response for a serial.
+type ocspLookup interface {
+	GetOCSPResponse(ctx context.Context, in *sapb.Serial, opts ...grpc.CallOption) (*capb.OCSPResponse, error)
+}
+
+// client is the ocspLookup for a connection to the revocation-info service.
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns an ocspLookup which calls the revocation-info service over
+// cc, which should come from bgrpc.ClientSetup for Boulder's standard TLS and
+// client auth.
+func NewClient(cc grpc.ClientConnInterface) ocspLookup {
+	return client{cc}
+}
+
+func (c client) GetOCSPResponse(ctx context.Context, in *sapb.Serial, opts ...grpc.CallOption) (*capb.OCSPResponse, error) {
+	out := new(capb.OCSPResponse)
+	err := c.cc.Invoke(ctx, getOCSPResponseMethod, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type Source struct {
+	lookup ocspLookup
+}
+
+func New(lookup ocspLookup) *Source {
+	return &Source{lookup: lookup}
+}
+
+// Response implements the responder.Source interface. A NotFound from the
+// service is returned as responder.ErrNotFound; other errors are returned
+// unchanged.
+func (s *Source) Response(ctx context.Context, req *ocsp.Request) (*responder.Response, error) {
+	resp, err := s.lookup.GetOCSPResponse(ctx, &sapb.Serial{
+		Serial: core.SerialToString(req.SerialNumber),
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound || errors.Is(err, berrors.NotFound) {
+			return nil, responder.ErrNotFound
+		}
+		return nil, err
+	}
+	parsed, err := ocsp.ParseResponse(resp.Response, nil)
+	if err != nil {
+		return nil, err
+	}
+	responder.NoteSource(ctx, "revinfo")
+	return &responder.Response{
+		Raw:      resp.Response,
+		Response: parsed,
+	}, nil
+}
@@ -0,0 +1,100 @@
+package revinfo
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ocsp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	capb "github.com/letsencrypt/boulder/ca/proto"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/ocsp/responder"
+	ocsp_test "github.com/letsencrypt/boulder/ocsp/test"
+	sapb "github.com/letsencrypt/boulder/sa/proto"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// mockServer is a revocation-info service which holds a response for serial
+// 1 only, and fails every lookup if err is set.
+type mockServer struct {
+	resp []byte
+	err  error
+}
+
+func (m *mockServer) getOCSPResponse(ctx context.Context, in *sapb.Serial) (*capb.OCSPResponse, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if in.Serial != core.SerialToString(big.NewInt(1)) {
+		return nil, status.Errorf(codes.NotFound, "no response for %s", in.Serial)
+	}
+	return &capb.OCSPResponse{Response: m.resp}, nil
+}
+
+// startMockServer serves m on a local port and returns a Source connected to
+// it.
+func startMockServer(t *testing.T, m *mockServer) *Source {
+	t.Helper()
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "revinfo.RevocationInfo",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "GetOCSPResponse",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				in := new(sapb.Serial)
+				err := dec(in)
+				if err != nil {
+					return nil, err
+				}
+				return srv.(*mockServer).getOCSPResponse(ctx, in)
+			},
+		}},
+	}, m)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	test.AssertNotError(t, err, "listening")
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	test.AssertNotError(t, err, "dialing mock server")
+	t.Cleanup(func() { conn.Close() })
+	return New(NewClient(conn))
+}
+
+func TestResponse(t *testing.T) {
+	fakeResp, _, _ := ocsp_test.FakeResponse(ocsp.Response{
+		SerialNumber: big.NewInt(1),
+	})
+	src := startMockServer(t, &mockServer{resp: fakeResp.Raw})
+
+	resp, err := src.Response(context.Background(), &ocsp.Request{SerialNumber: big.NewInt(1)})
+	test.AssertNotError(t, err, "getting response")
+	test.AssertByteEquals(t, resp.Raw, fakeResp.Raw)
+	test.AssertEquals(t, core.SerialToString(resp.SerialNumber), "000000000000000000000000000000000001")
+}
+
+func TestNotFound(t *testing.T) {
+	src := startMockServer(t, &mockServer{})
+
+	_, err := src.Response(context.Background(), &ocsp.Request{SerialNumber: big.NewInt(2)})
+	test.AssertErrorIs(t, err, responder.ErrNotFound)
+}
+
+func TestError(t *testing.T) {
+	src := startMockServer(t, &mockServer{err: status.Error(codes.Unavailable, "backend unavailable")})
+
+	_, err := src.Response(context.Background(), &ocsp.Request{SerialNumber: big.NewInt(1)})
+	test.AssertError(t, err, "expected an error")
+	if errors.Is(err, responder.ErrNotFound) {
+		t.Errorf("expected errors other than NotFound to be passed through, got %#v", err)
+	}
+	test.AssertEquals(t, status.Code(err), codes.Unavailable)
+}
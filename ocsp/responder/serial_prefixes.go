@@ -0,0 +1,81 @@
+package responder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/letsencrypt/boulder/issuance"
+	"github.com/letsencrypt/boulder/strictyaml"
+)
+
+// IssuerSerialPrefixes maps the common name of each issuer to the hex serial
+// prefixes of the certificates it issues, so that the prefixes required by
+// the filterSource are kept alongside the issuers they belong to.
+type IssuerSerialPrefixes map[string][]string
+
+// LoadIssuerSerialPrefixes reads an IssuerSerialPrefixes from the named YAML
+// file. Every issuer must have at least one prefix, and every prefix must be
+// hexadecimal.
+func LoadIssuerSerialPrefixes(filename string) (IssuerSerialPrefixes, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var isp IssuerSerialPrefixes
+	err = strictyaml.Unmarshal(contents, &isp)
+	if err != nil {
+		return nil, fmt.Errorf("parsing issuer serial prefixes %q: %w", filename, err)
+	}
+	if len(isp) == 0 {
+		return nil, fmt.Errorf("no issuers in %q", filename)
+	}
+	for issuer, prefixes := range isp {
+		if len(prefixes) == 0 {
+			return nil, fmt.Errorf("no serial prefixes for issuer %q", issuer)
+		}
+		for i, prefix := range prefixes {
+			if prefix == "" || strings.Trim(prefix, "0123456789abcdefABCDEF") != "" {
+				return nil, fmt.Errorf("invalid serial prefix %q for issuer %q", prefix, issuer)
+			}
+			// Normalize prefixes so they match core.SerialToString.
+			prefixes[i] = strings.ToLower(prefix)
+		}
+	}
+	return isp, nil
+}
+
+// Prefixes returns every prefix of every issuer, sorted and deduplicated, for
+// use as the filterSource's serial prefixes.
+func (isp IssuerSerialPrefixes) Prefixes() []string {
+	var all []string
+	for _, prefixes := range isp {
+		all = append(all, prefixes...)
+	}
+	slices.Sort(all)
+	return slices.Compact(all)
+}
+
+// Check returns an error unless isp names exactly the issuers whose
+// certificates are in issuerCerts, so that a prefix isn't missing for an
+// issuer, or left behind for one which is no longer configured.
+func (isp IssuerSerialPrefixes) Check(issuerCerts []*issuance.Certificate) error {
+	loaded := make(map[string]bool, len(issuerCerts))
+	var errs []error
+	for _, ic := range issuerCerts {
+		name := ic.Subject.CommonName
+		loaded[name] = true
+		if _, ok := isp[name]; !ok {
+			errs = append(errs, fmt.Errorf("no serial prefixes for loaded issuer %q", name))
+		}
+	}
+	for name := range isp {
+		if !loaded[name] {
+			errs = append(errs, fmt.Errorf("serial prefixes for issuer %q, which isn't loaded", name))
+		}
+	}
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
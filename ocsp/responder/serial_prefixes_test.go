@@ -0,0 +1,66 @@
+package responder
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func writeIssuerSerialPrefixes(t *testing.T, contents string) string {
+	t.Helper()
+	filename := path.Join(t.TempDir(), "prefixes.yaml")
+	err := os.WriteFile(filename, []byte(contents), 0600)
+	test.AssertNotError(t, err, "writing issuer serial prefixes")
+	return filename
+}
+
+func TestLoadIssuerSerialPrefixes(t *testing.T) {
+	isp, err := LoadIssuerSerialPrefixes(writeIssuerSerialPrefixes(t,
+		"\"(TEST) Radical Rhino R3\": [\"FF\", \"fe\"]\n\"(TEST) Elegant Elephant E1\": [\"fe\", \"00\"]\n"))
+	test.AssertNotError(t, err, "loading issuer serial prefixes")
+	test.AssertDeepEquals(t, isp["(TEST) Radical Rhino R3"], []string{"ff", "fe"})
+	test.AssertDeepEquals(t, isp.Prefixes(), []string{"00", "fe", "ff"})
+
+	_, err = LoadIssuerSerialPrefixes("./testdata/nonexistent.yaml")
+	test.AssertError(t, err, "loaded nonexistent issuer serial prefixes")
+
+	for name, contents := range map[string]string{
+		"no issuers":    "{}\n",
+		"no prefixes":   "\"(TEST) Radical Rhino R3\": []\n",
+		"empty prefix":  "\"(TEST) Radical Rhino R3\": [\"\"]\n",
+		"bad prefix":    "\"(TEST) Radical Rhino R3\": [\"zz\"]\n",
+		"unknown field": "- serial: \"ff\"\n",
+	} {
+		_, err = LoadIssuerSerialPrefixes(writeIssuerSerialPrefixes(t, contents))
+		test.AssertError(t, err, name)
+	}
+}
+
+func TestIssuerSerialPrefixesCheck(t *testing.T) {
+	certs, _, err := loadIssuerCertificates([]string{"./testdata/issuers.p7b"}, false, 0, blog.NewMock())
+	test.AssertNotError(t, err, "loading issuer certs")
+
+	isp := IssuerSerialPrefixes{
+		"happy hacker fake CA":       {"01"},
+		"(TEST) Elegant Elephant E1": {"02"},
+		"(TEST) Radical Rhino R3":    {"03"},
+	}
+	test.AssertNotError(t, isp.Check(certs), "prefixes for exactly the loaded issuers")
+
+	// A loaded issuer without prefixes is an error.
+	err = IssuerSerialPrefixes{
+		"happy hacker fake CA":    {"01"},
+		"(TEST) Radical Rhino R3": {"03"},
+	}.Check(certs)
+	test.AssertError(t, err, "missing prefixes for a loaded issuer")
+	test.AssertContains(t, err.Error(), `no serial prefixes for loaded issuer "(TEST) Elegant Elephant E1"`)
+
+	// So are prefixes for an issuer which isn't loaded.
+	isp["(TEST) Retired Raccoon R1"] = []string{"04"}
+	err = isp.Check(certs)
+	test.AssertError(t, err, "prefixes for an unloaded issuer")
+	test.AssertContains(t, err.Error(), `serial prefixes for issuer "(TEST) Retired Raccoon R1", which isn't loaded`)
+}
@@ -0,0 +1,140 @@
+package responder
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+// oidPreferredSignatureAlgorithms identifies the request extension in which a
+// client lists the signature algorithms it would like the response signed
+// with, most preferred first. See RFC 6960, Section 4.4.7.
+var oidPreferredSignatureAlgorithms = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 8}
+
+// errMalformedSigAlgs indicates that a request's preferred signature
+// algorithms extension could not be parsed.
+var errMalformedSigAlgs = errors.New("malformed preferred signature algorithms extension")
+
+// The following mirror the structure of an OCSP request, as far as is needed
+// to reach its request list and extensions, which golang.org/x/crypto/ocsp
+// doesn't expose.
+type ocspRequestExtensions struct {
+	TBSRequest tbsRequestExtensions
+}
+
+type tbsRequestExtensions struct {
+	Version       int           `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName asn1.RawValue `asn1:"explicit,tag:1,optional"`
+	RequestList   asn1.RawValue
+	Extensions    []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+// countCertIDs returns the number of certIDs in the requestList of a
+// DER-encoded OCSP request.
+func countCertIDs(der []byte) (int, error) {
+	var req ocspRequestExtensions
+	_, err := asn1.Unmarshal(der, &req)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	rest := req.TBSRequest.RequestList.Bytes
+	for len(rest) > 0 {
+		var single asn1.RawValue
+		rest, err = asn1.Unmarshal(rest, &single)
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// preferredSignatureAlgorithm is a single entry of the extension. It may be
+// followed by a pubKeyAlgIdentifier, which we don't need and so don't parse.
+type preferredSignatureAlgorithm struct {
+	SigIdentifier pkix.AlgorithmIdentifier
+}
+
+// signatureAlgorithmOIDs maps the signature algorithms we're willing to sign
+// responses with to their identifiers. Weaker algorithms, such as those using
+// SHA-1, are deliberately absent so that a client can't select them.
+var signatureAlgorithmOIDs = map[x509.SignatureAlgorithm]asn1.ObjectIdentifier{
+	x509.SHA256WithRSA:   {1, 2, 840, 113549, 1, 1, 11},
+	x509.SHA384WithRSA:   {1, 2, 840, 113549, 1, 1, 12},
+	x509.SHA512WithRSA:   {1, 2, 840, 113549, 1, 1, 13},
+	x509.ECDSAWithSHA256: {1, 2, 840, 10045, 4, 3, 2},
+	x509.ECDSAWithSHA384: {1, 2, 840, 10045, 4, 3, 3},
+	x509.ECDSAWithSHA512: {1, 2, 840, 10045, 4, 3, 4},
+	x509.PureEd25519:     {1, 3, 101, 112},
+}
+
+// PreferredSignatureAlgorithms returns the signature algorithms listed in the
+// preferred signature algorithms extension of a DER-encoded OCSP request, most
+// preferred first. Algorithms we don't recognize or won't sign with are
+// omitted. If the request has no such extension, it returns nil.
+func PreferredSignatureAlgorithms(der []byte) ([]x509.SignatureAlgorithm, error) {
+	var req ocspRequestExtensions
+	_, err := asn1.Unmarshal(der, &req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: parsing request: %s", errMalformedSigAlgs, err)
+	}
+
+	var value []byte
+	for _, ext := range req.TBSRequest.Extensions {
+		if !ext.Id.Equal(oidPreferredSignatureAlgorithms) {
+			continue
+		}
+		if value != nil {
+			return nil, fmt.Errorf("%w: extension present more than once", errMalformedSigAlgs)
+		}
+		value = ext.Value
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	var prefs []preferredSignatureAlgorithm
+	rest, err := asn1.Unmarshal(value, &prefs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errMalformedSigAlgs, err)
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing data", errMalformedSigAlgs)
+	}
+	if len(prefs) == 0 {
+		return nil, fmt.Errorf("%w: no algorithms listed", errMalformedSigAlgs)
+	}
+
+	var algs []x509.SignatureAlgorithm
+	for _, pref := range prefs {
+		for alg, oid := range signatureAlgorithmOIDs {
+			if pref.SigIdentifier.Algorithm.Equal(oid) {
+				algs = append(algs, alg)
+				break
+			}
+		}
+	}
+	return algs, nil
+}
+
+// SelectSignatureAlgorithm returns the first of the client's preferred
+// algorithms which the signer supports. If there is none, it returns the
+// signer's default, supported[0]: RFC 6960 allows a responder to ignore
+// preferences it can't satisfy. If supported is empty, it returns
+// x509.UnknownSignatureAlgorithm.
+func SelectSignatureAlgorithm(preferred, supported []x509.SignatureAlgorithm) x509.SignatureAlgorithm {
+	if len(supported) == 0 {
+		return x509.UnknownSignatureAlgorithm
+	}
+	for _, p := range preferred {
+		for _, s := range supported {
+			if p == s {
+				return s
+			}
+		}
+	}
+	return supported[0]
+}
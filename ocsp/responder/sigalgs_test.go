@@ -0,0 +1,171 @@
+package responder
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+// requestWithExtension returns testdata/ocsp.req with the given extension
+// value added under the preferred signature algorithms OID.
+func requestWithExtension(t *testing.T, value []byte) []byte {
+	t.Helper()
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+
+	var req ocspRequestExtensions
+	_, err = asn1.Unmarshal(reqBytes, &req)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+	req.TBSRequest.Extensions = append(req.TBSRequest.Extensions, pkix.Extension{
+		Id:    oidPreferredSignatureAlgorithms,
+		Value: value,
+	})
+	der, err := asn1.Marshal(req)
+	test.AssertNotError(t, err, "failed to marshal OCSP request")
+
+	// The extension must not stop the request from being parsed as usual.
+	_, err = ocsp.ParseRequest(der)
+	test.AssertNotError(t, err, "failed to parse OCSP request with extension")
+	return der
+}
+
+// preferences encodes a preferred signature algorithms extension value.
+func preferences(t *testing.T, oids ...asn1.ObjectIdentifier) []byte {
+	t.Helper()
+	var prefs []preferredSignatureAlgorithm
+	for _, oid := range oids {
+		prefs = append(prefs, preferredSignatureAlgorithm{pkix.AlgorithmIdentifier{Algorithm: oid}})
+	}
+	value, err := asn1.Marshal(prefs)
+	test.AssertNotError(t, err, "failed to marshal preferences")
+	return value
+}
+
+func TestPreferredSignatureAlgorithms(t *testing.T) {
+	sha1WithRSA := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	supported := []x509.SignatureAlgorithm{x509.SHA256WithRSA, x509.ECDSAWithSHA384}
+
+	testCases := []struct {
+		name     string
+		req      []byte
+		wantErr  bool
+		wantAlgs []x509.SignatureAlgorithm
+		selected x509.SignatureAlgorithm
+	}{
+		{
+			name: "absent",
+			req: func() []byte {
+				reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+				test.AssertNotError(t, err, "failed to read OCSP request")
+				return reqBytes
+			}(),
+			wantAlgs: nil,
+			selected: x509.SHA256WithRSA,
+		},
+		{
+			name: "matching",
+			req: requestWithExtension(t, preferences(t,
+				signatureAlgorithmOIDs[x509.PureEd25519],
+				signatureAlgorithmOIDs[x509.ECDSAWithSHA384],
+				signatureAlgorithmOIDs[x509.SHA256WithRSA],
+			)),
+			wantAlgs: []x509.SignatureAlgorithm{x509.PureEd25519, x509.ECDSAWithSHA384, x509.SHA256WithRSA},
+			selected: x509.ECDSAWithSHA384,
+		},
+		{
+			name: "non-matching",
+			req: requestWithExtension(t, preferences(t,
+				signatureAlgorithmOIDs[x509.PureEd25519],
+				signatureAlgorithmOIDs[x509.SHA512WithRSA],
+			)),
+			wantAlgs: []x509.SignatureAlgorithm{x509.PureEd25519, x509.SHA512WithRSA},
+			selected: x509.SHA256WithRSA,
+		},
+		{
+			name:     "only weak or unknown algorithms",
+			req:      requestWithExtension(t, preferences(t, sha1WithRSA, asn1.ObjectIdentifier{1, 2, 3})),
+			wantAlgs: nil,
+			selected: x509.SHA256WithRSA,
+		},
+		{
+			name:    "empty list",
+			req:     requestWithExtension(t, preferences(t)),
+			wantErr: true,
+		},
+		{
+			name:    "garbage",
+			req:     requestWithExtension(t, []byte{0x30, 0x03, 0x01}),
+			wantErr: true,
+		},
+		{
+			name:    "trailing data",
+			req:     requestWithExtension(t, append(preferences(t, sha1WithRSA), 0x00)),
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			algs, err := PreferredSignatureAlgorithms(tc.req)
+			if tc.wantErr {
+				test.AssertErrorIs(t, err, errMalformedSigAlgs)
+				return
+			}
+			test.AssertNotError(t, err, "parsing preferred signature algorithms")
+			test.AssertDeepEquals(t, algs, tc.wantAlgs)
+			test.AssertEquals(t, SelectSignatureAlgorithm(algs, supported), tc.selected)
+		})
+	}
+}
+
+func TestPreferredSignatureAlgorithmsDuplicate(t *testing.T) {
+	reqBytes := requestWithExtension(t, preferences(t, signatureAlgorithmOIDs[x509.SHA256WithRSA]))
+	var req ocspRequestExtensions
+	_, err := asn1.Unmarshal(reqBytes, &req)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+	req.TBSRequest.Extensions = append(req.TBSRequest.Extensions, req.TBSRequest.Extensions[0])
+	reqBytes, err = asn1.Marshal(req)
+	test.AssertNotError(t, err, "failed to marshal OCSP request")
+
+	_, err = PreferredSignatureAlgorithms(reqBytes)
+	test.AssertErrorIs(t, err, errMalformedSigAlgs)
+}
+
+func TestSelectSignatureAlgorithmNoneSupported(t *testing.T) {
+	test.AssertEquals(t, SelectSignatureAlgorithm([]x509.SignatureAlgorithm{x509.SHA256WithRSA}, nil), x509.UnknownSignatureAlgorithm)
+}
+
+// requestWithCertIDs returns testdata/ocsp.req with its single certID
+// repeated n times.
+func requestWithCertIDs(t *testing.T, n int) []byte {
+	t.Helper()
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+
+	var req ocspRequestExtensions
+	_, err = asn1.Unmarshal(reqBytes, &req)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+	list := &req.TBSRequest.RequestList
+	list.Bytes = bytes.Repeat(list.Bytes, n)
+	list.FullBytes = nil
+	der, err := asn1.Marshal(req)
+	test.AssertNotError(t, err, "failed to marshal OCSP request")
+	return der
+}
+
+func TestCountCertIDs(t *testing.T) {
+	for _, n := range []int{1, 2, 100} {
+		count, err := countCertIDs(requestWithCertIDs(t, n))
+		test.AssertNotError(t, err, "counting certIDs")
+		test.AssertEquals(t, count, n)
+	}
+
+	_, err := countCertIDs([]byte("not a request"))
+	test.AssertError(t, err, "counted certIDs in garbage")
+}
@@ -0,0 +1,106 @@
+package responder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/config"
+)
+
+// SlowRequestConfig configures recording of requests which take unusually
+// long to handle, for diagnosing occasional slow responses. The zero value
+// disables recording.
+type SlowRequestConfig struct {
+	// Threshold is the total handling time above which a request is recorded.
+	Threshold config.Duration `validate:"-"`
+
+	// Size is the number of most recent slow requests kept. Older ones are
+	// discarded. This defaults to 100.
+	Size int `validate:"min=0"`
+}
+
+// SlowRequest describes a single slow request and how long each phase of
+// handling it took. Phases which the request didn't reach, such as the lookup
+// for a malformed request, are zero. Durations are in nanoseconds when
+// encoded as JSON.
+type SlowRequest struct {
+	Time   time.Time `json:"time"`
+	Serial string    `json:"serial,omitempty"`
+	// Source is the backend which served the response, as noted with
+	// NoteSource, or else the type of the Responder's Source.
+	Source string        `json:"source"`
+	Parse  time.Duration `json:"parse"`
+	Lookup time.Duration `json:"lookup"`
+	Write  time.Duration `json:"write"`
+	Total  time.Duration `json:"total"`
+}
+
+// SlowRequests keeps the most recent requests whose handling took longer than
+// its threshold, in a ring buffer. A nil *SlowRequests records nothing.
+type SlowRequests struct {
+	threshold time.Duration
+
+	mu       sync.Mutex
+	requests []SlowRequest
+	next     int
+}
+
+// NewSlowRequests returns a SlowRequests as configured by conf, or nil if conf
+// has no Threshold.
+func NewSlowRequests(conf SlowRequestConfig) *SlowRequests {
+	if conf.Threshold.Duration == 0 {
+		return nil
+	}
+	size := conf.Size
+	if size == 0 {
+		size = 100
+	}
+	return &SlowRequests{
+		threshold: conf.Threshold.Duration,
+		requests:  make([]SlowRequest, 0, size),
+	}
+}
+
+// observe records a request if it was slow. Its phases are delimited by the
+// times at which handling started, the request was parsed, the lookup
+// finished and handling finished; parsed and looked up are zero if the
+// request didn't get that far.
+func (sr *SlowRequests) observe(serial, source string, start, parsed, lookedUp, end time.Time) {
+	if sr == nil || end.Sub(start) <= sr.threshold {
+		return
+	}
+	req := SlowRequest{
+		Time:   start,
+		Serial: serial,
+		Source: source,
+		Total:  end.Sub(start),
+	}
+	last := start
+	if !parsed.IsZero() {
+		req.Parse = parsed.Sub(last)
+		last = parsed
+	}
+	if !lookedUp.IsZero() {
+		req.Lookup = lookedUp.Sub(last)
+		req.Write = end.Sub(lookedUp)
+	}
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if len(sr.requests) < cap(sr.requests) {
+		sr.requests = append(sr.requests, req)
+		return
+	}
+	sr.requests[sr.next] = req
+	sr.next = (sr.next + 1) % len(sr.requests)
+}
+
+// Requests returns the recorded slow requests, oldest first.
+func (sr *SlowRequests) Requests() []SlowRequest {
+	if sr == nil {
+		return nil
+	}
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return append(append([]SlowRequest{}, sr.requests[sr.next:]...), sr.requests[:sr.next]...)
+}
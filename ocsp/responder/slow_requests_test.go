@@ -0,0 +1,96 @@
+package responder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/config"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// sleepySource is a Source which takes the given time to look up anything,
+// and never finds it. If backend is set, it's noted as the request's source.
+type sleepySource struct {
+	delay   time.Duration
+	backend string
+}
+
+func (ss sleepySource) Response(ctx context.Context, _ *ocsp.Request) (*Response, error) {
+	time.Sleep(ss.delay)
+	if ss.backend != "" {
+		NoteSource(ctx, ss.backend)
+	}
+	return nil, ErrNotFound
+}
+
+func TestSlowRequests(t *testing.T) {
+	reqBytes, err := os.ReadFile("./testdata/ocsp.req")
+	test.AssertNotError(t, err, "failed to read OCSP request")
+	req, err := ocsp.ParseRequest(reqBytes)
+	test.AssertNotError(t, err, "failed to parse OCSP request")
+
+	slow := NewSlowRequests(SlowRequestConfig{Threshold: config.Duration{Duration: 20 * time.Millisecond}})
+	serve := func(delay time.Duration, body []byte) {
+		rs := NewResponder(sleepySource{delay: delay}, Options{SlowRequests: slow, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+		r, err := http.NewRequest("POST", "/", bytes.NewReader(body))
+		test.AssertNotError(t, err, "creating request")
+		rs.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	// Fast requests, including malformed ones, aren't recorded.
+	serve(0, reqBytes)
+	serve(0, []byte("not an OCSP request"))
+	test.AssertEquals(t, len(slow.Requests()), 0)
+
+	// A slow lookup is recorded, with its time attributed to the lookup.
+	serve(50*time.Millisecond, reqBytes)
+	requests := slow.Requests()
+	test.AssertEquals(t, len(requests), 1)
+	test.AssertEquals(t, requests[0].Serial, fmt.Sprintf("%x", req.SerialNumber.Bytes()))
+	test.AssertEquals(t, requests[0].Source, "responder.sleepySource")
+	test.Assert(t, requests[0].Lookup >= 50*time.Millisecond, fmt.Sprintf("unexpected lookup time %s", requests[0].Lookup))
+	test.Assert(t, requests[0].Total >= requests[0].Parse+requests[0].Lookup+requests[0].Write, "phases exceed total")
+
+	// Requests are attributed to the backend noted by whichever Source
+	// served them, rather than to the Responder's outermost Source.
+	for _, backend := range []string{"redis", "mysql"} {
+		rs := NewResponder(sleepySource{delay: 50 * time.Millisecond, backend: backend}, Options{SlowRequests: slow, LogSampleRate: 1}, metrics.NoopRegisterer, blog.NewMock())
+		rs.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", bytes.NewReader(reqBytes)))
+	}
+	requests = slow.Requests()
+	test.AssertEquals(t, len(requests), 3)
+	test.AssertEquals(t, requests[1].Source, "redis")
+	test.AssertEquals(t, requests[2].Source, "mysql")
+}
+
+func TestSlowRequestsRing(t *testing.T) {
+	slow := NewSlowRequests(SlowRequestConfig{Threshold: config.Duration{Duration: time.Second}, Size: 3})
+	start := time.Now()
+	for i := range 5 {
+		slow.observe(fmt.Sprint(i), "", start, time.Time{}, time.Time{}, start.Add(2*time.Second))
+	}
+	// A request exactly at the threshold isn't slow.
+	slow.observe("fast", "", start, time.Time{}, time.Time{}, start.Add(time.Second))
+
+	var serials []string
+	for _, req := range slow.Requests() {
+		serials = append(serials, req.Serial)
+	}
+	test.AssertDeepEquals(t, serials, []string{"2", "3", "4"})
+
+	// A nil SlowRequests, as returned when disabled, records nothing.
+	slow = NewSlowRequests(SlowRequestConfig{})
+	test.Assert(t, slow == nil, "expected disabled SlowRequests to be nil")
+	slow.observe("0", "", start, time.Time{}, time.Time{}, start.Add(time.Hour))
+	test.AssertEquals(t, len(slow.Requests()), 0)
+}
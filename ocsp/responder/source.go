@@ -18,3 +18,12 @@ type Response struct {
 type Source interface {
 	Response(context.Context, *ocsp.Request) (*Response, error)
 }
+
+// IssuerNamer is implemented by Sources, such as the filterSource, which know
+// the issuers they answer for. The Responder uses it to name the requested
+// issuer in its logs, which is easier to read than a key hash.
+type IssuerNamer interface {
+	// IssuerCommonName returns the Subject Common Name of the issuer
+	// identified by the request, or "" if that issuer is unknown.
+	IssuerCommonName(*ocsp.Request) string
+}
@@ -0,0 +1,71 @@
+package responder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// stagingSource routes requests for an allowlisted set of serials to a
+// staging Source, and all other requests to the production Source. This
+// allows a new signing pipeline to be validated against a small subset of
+// real traffic. If the staging Source has no response for an allowlisted
+// serial, the production Source is consulted instead.
+type stagingSource struct {
+	staging    Source
+	production Source
+	serials    map[string]struct{}
+	counter    *prometheus.CounterVec
+}
+
+// NewStagingSource returns a stagingSource which serves responses for the
+// given hex-encoded serials from staging, and everything else from
+// production.
+func NewStagingSource(serials []string, staging Source, production Source, stats prometheus.Registerer) (*stagingSource, error) {
+	allowlist := make(map[string]struct{}, len(serials))
+	for _, s := range serials {
+		serial, err := core.StringToSerial(s)
+		if err != nil {
+			return nil, fmt.Errorf("parsing staging serial: %w", err)
+		}
+		allowlist[core.SerialToString(serial)] = struct{}{}
+	}
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocsp_staging_responses",
+		Help: "Count of OCSP requests for allowlisted staging serials, by result",
+	}, []string{"result"})
+	stats.MustRegister(counter)
+
+	return &stagingSource{
+		staging:    staging,
+		production: production,
+		serials:    allowlist,
+		counter:    counter,
+	}, nil
+}
+
+// Response implements the Source interface.
+func (src *stagingSource) Response(ctx context.Context, req *ocsp.Request) (*Response, error) {
+	_, ok := src.serials[core.SerialToString(req.SerialNumber)]
+	if !ok {
+		return src.production.Response(ctx, req)
+	}
+
+	resp, err := src.staging.Response(ctx, req)
+	if errors.Is(err, ErrNotFound) {
+		src.counter.WithLabelValues("staging_not_found").Inc()
+		return src.production.Response(ctx, req)
+	} else if err != nil {
+		src.counter.WithLabelValues("staging_error").Inc()
+		return nil, err
+	}
+	src.counter.WithLabelValues("staging_success").Inc()
+	NoteBehavior(ctx, "StagingSource")
+	return resp, nil
+}
@@ -0,0 +1,66 @@
+package responder
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// notFoundSource always returns ErrNotFound.
+type notFoundSource struct{}
+
+func (notFoundSource) Response(context.Context, *ocsp.Request) (*Response, error) {
+	return nil, ErrNotFound
+}
+
+// failingSource always returns an error.
+type failingSource struct{}
+
+func (failingSource) Response(context.Context, *ocsp.Request) (*Response, error) {
+	return nil, errors.New("staging pipeline broke")
+}
+
+func TestStagingSource(t *testing.T) {
+	stagingResp := &Response{Response: &ocsp.Response{Status: ocsp.Revoked}}
+	productionResp := &Response{Response: &ocsp.Response{Status: ocsp.Good}}
+
+	_, err := NewStagingSource([]string{"not a serial"}, &echoSource{stagingResp}, &echoSource{productionResp}, metrics.NoopRegisterer)
+	test.AssertError(t, err, "created staging source with invalid serial")
+
+	src, err := NewStagingSource([]string{"000000000000000000000000000000000001"}, &echoSource{stagingResp}, &echoSource{productionResp}, metrics.NoopRegisterer)
+	test.AssertNotError(t, err, "creating staging source")
+
+	// Allowlisted serials are served from staging.
+	resp, err := src.Response(context.Background(), &ocsp.Request{SerialNumber: big.NewInt(1)})
+	test.AssertNotError(t, err, "getting allowlisted response")
+	test.AssertEquals(t, resp, stagingResp)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "staging_success"}, 1)
+
+	// Everything else is served from production.
+	resp, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: big.NewInt(2)})
+	test.AssertNotError(t, err, "getting non-allowlisted response")
+	test.AssertEquals(t, resp, productionResp)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{}, 1)
+
+	// Allowlisted serials missing from staging fall back to production.
+	src, err = NewStagingSource([]string{"000000000000000000000000000000000001"}, notFoundSource{}, &echoSource{productionResp}, metrics.NoopRegisterer)
+	test.AssertNotError(t, err, "creating staging source")
+	resp, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: big.NewInt(1)})
+	test.AssertNotError(t, err, "getting allowlisted response")
+	test.AssertEquals(t, resp, productionResp)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "staging_not_found"}, 1)
+
+	// Other staging errors are returned rather than masked.
+	src, err = NewStagingSource([]string{"000000000000000000000000000000000001"}, failingSource{}, &echoSource{productionResp}, metrics.NoopRegisterer)
+	test.AssertNotError(t, err, "creating staging source")
+	_, err = src.Response(context.Background(), &ocsp.Request{SerialNumber: big.NewInt(1)})
+	test.AssertError(t, err, "expected staging error")
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "staging_error"}, 1)
+}
@@ -0,0 +1,116 @@
+package responder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// savedStatusEntry is the on-disk form of a statusEntry. The key is the
+// issuer key hash followed by the serial, as used by statusSource.
+type savedStatusEntry struct {
+	Key      []byte    `json:"key"`
+	Response []byte    `json:"response"`
+	Expires  time.Time `json:"expires"`
+}
+
+// SaveCache writes the unexpired entries of the signed response cache to
+// filename, so that it can be reloaded by LoadCache after a restart. The file
+// is written to a temporary name and renamed into place, so that a crash part
+// way through doesn't leave a truncated cache behind.
+func (src *statusSource) SaveCache(filename string) (int, error) {
+	src.mu.Lock()
+	now := src.clk.Now()
+	saved := make([]savedStatusEntry, 0, len(src.cache))
+	for key, entry := range src.cache {
+		if !now.Before(entry.expires) {
+			continue
+		}
+		saved = append(saved, savedStatusEntry{[]byte(key), entry.resp.Raw, entry.expires})
+	}
+	src.mu.Unlock()
+
+	contents, err := json.Marshal(saved)
+	if err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(contents)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return 0, err
+	}
+	err = os.Rename(tmp.Name(), filename)
+	if err != nil {
+		return 0, err
+	}
+	return len(saved), nil
+}
+
+// LoadCache fills the signed response cache from a file written by SaveCache,
+// and returns the number of entries loaded. Entries are discarded if their
+// cache TTL has passed, if the response's NextUpdate has passed, or if they
+// were signed by an issuer that isn't configured any more. A missing file
+// isn't an error, since there is nothing to load on the first start.
+func (src *statusSource) LoadCache(filename string) (int, error) {
+	contents, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	var saved []savedStatusEntry
+	err = json.Unmarshal(contents, &saved)
+	if err != nil {
+		return 0, fmt.Errorf("parsing status cache %q: %w", filename, err)
+	}
+
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	now := src.clk.Now()
+	loaded := 0
+	for _, entry := range saved {
+		if len(src.cache) >= src.size {
+			break
+		}
+		if !now.Before(entry.Expires) {
+			continue
+		}
+		signer := src.signerForKey(entry.Key)
+		if signer == nil {
+			continue
+		}
+		parsed, err := ocsp.ParseResponse(entry.Response, signer.issuer.Cert.Certificate)
+		if err != nil || !now.Before(parsed.NextUpdate) {
+			continue
+		}
+		src.cache[string(entry.Key)] = statusEntry{&Response{Response: parsed, Raw: entry.Response}, entry.Expires}
+		loaded++
+	}
+	return loaded, nil
+}
+
+// signerForKey returns the signer whose key hash prefixes the cache key, or
+// nil if there is none.
+func (src *statusSource) signerForKey(key []byte) *localSigner {
+	for i := range src.signers {
+		if bytes.HasPrefix(key, src.signers[i].id.keyHash) {
+			return &src.signers[i]
+		}
+	}
+	return nil
+}
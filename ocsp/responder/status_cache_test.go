@@ -0,0 +1,120 @@
+package responder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"golang.org/x/crypto/ocsp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/letsencrypt/boulder/config"
+	"github.com/letsencrypt/boulder/issuance"
+	"github.com/letsencrypt/boulder/metrics"
+	sapb "github.com/letsencrypt/boulder/sa/proto"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestStatusCacheRoundTrip(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	clk := clock.NewFake()
+	statuses := &mapStatuses{statuses: map[string]*sapb.RevocationStatus{
+		"000000000000000000000000000000000001": {Status: ocsp.Good, RevokedDate: timestamppb.New(time.Time{})},
+		"000000000000000000000000000000000002": {Status: ocsp.Good, RevokedDate: timestamppb.New(time.Time{})},
+	}}
+	conf := StatusSigningConfig{
+		Lifetime: config.Duration{Duration: 24 * time.Hour},
+		CacheTTL: config.Duration{Duration: time.Hour},
+	}
+	src, err := NewStatusSource(statuses, []*issuance.Issuer{issuer}, conf, metrics.NoopRegisterer, clk)
+	test.AssertNotError(t, err, "creating status source")
+
+	first, err := src.Response(context.Background(), requestFor(t, issuer, 1))
+	test.AssertNotError(t, err, "getting response")
+	_, err = src.Response(context.Background(), requestFor(t, issuer, 2))
+	test.AssertNotError(t, err, "getting response")
+
+	filename := filepath.Join(t.TempDir(), "status-cache.json")
+	saved, err := src.SaveCache(filename)
+	test.AssertNotError(t, err, "saving cache")
+	test.AssertEquals(t, saved, 2)
+
+	// A restarted source serves the saved responses without any lookups.
+	statuses.calls = 0
+	restarted, err := NewStatusSource(statuses, []*issuance.Issuer{issuer}, conf, metrics.NoopRegisterer, clk)
+	test.AssertNotError(t, err, "creating restarted status source")
+	loaded, err := restarted.LoadCache(filename)
+	test.AssertNotError(t, err, "loading cache")
+	test.AssertEquals(t, loaded, 2)
+	resp, err := restarted.Response(context.Background(), requestFor(t, issuer, 1))
+	test.AssertNotError(t, err, "getting reloaded response")
+	test.AssertByteEquals(t, resp.Raw, first.Raw)
+	test.AssertEquals(t, statuses.calls, 0)
+
+	// Entries whose TTL passed while the responder was down are discarded.
+	clk.Add(time.Hour)
+	later, err := NewStatusSource(statuses, []*issuance.Issuer{issuer}, conf, metrics.NoopRegisterer, clk)
+	test.AssertNotError(t, err, "creating later status source")
+	loaded, err = later.LoadCache(filename)
+	test.AssertNotError(t, err, "loading cache")
+	test.AssertEquals(t, loaded, 0)
+
+	// So are entries signed by issuers which are no longer configured.
+	clk.Add(-time.Hour)
+	other, err := NewStatusSource(statuses, []*issuance.Issuer{makeNamedTestIssuer(t, "other test CA")}, conf, metrics.NoopRegisterer, clk)
+	test.AssertNotError(t, err, "creating status source with another issuer")
+	loaded, err = other.LoadCache(filename)
+	test.AssertNotError(t, err, "loading cache")
+	test.AssertEquals(t, loaded, 0)
+}
+
+func TestStatusCacheDiscardsStale(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	clk := clock.NewFake()
+	statuses := &mapStatuses{statuses: map[string]*sapb.RevocationStatus{
+		"000000000000000000000000000000000001": {Status: ocsp.Good, RevokedDate: timestamppb.New(time.Time{})},
+	}}
+	// The cache TTL outlives the responses, which can only happen if the
+	// configured lifetime was shortened between saving and loading.
+	src, err := NewStatusSource(statuses, []*issuance.Issuer{issuer}, StatusSigningConfig{
+		Lifetime: config.Duration{Duration: 2 * time.Hour},
+		CacheTTL: config.Duration{Duration: time.Hour},
+	}, metrics.NoopRegisterer, clk)
+	test.AssertNotError(t, err, "creating status source")
+	_, err = src.Response(context.Background(), requestFor(t, issuer, 1))
+	test.AssertNotError(t, err, "getting response")
+	for key, entry := range src.cache {
+		entry.expires = clk.Now().Add(3 * time.Hour)
+		src.cache[key] = entry
+	}
+	filename := filepath.Join(t.TempDir(), "status-cache.json")
+	_, err = src.SaveCache(filename)
+	test.AssertNotError(t, err, "saving cache")
+
+	// Past the response's NextUpdate, it's discarded even though its cache
+	// entry hasn't expired.
+	clk.Add(2 * time.Hour)
+	loaded, err := src.LoadCache(filename)
+	test.AssertNotError(t, err, "loading cache")
+	test.AssertEquals(t, loaded, 0)
+}
+
+func TestStatusCacheLoadErrors(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	src, err := NewStatusSource(&mapStatuses{}, []*issuance.Issuer{issuer}, StatusSigningConfig{}, metrics.NoopRegisterer, clock.NewFake())
+	test.AssertNotError(t, err, "creating status source")
+
+	// A missing file is an empty cache.
+	loaded, err := src.LoadCache(filepath.Join(t.TempDir(), "missing.json"))
+	test.AssertNotError(t, err, "loading missing cache")
+	test.AssertEquals(t, loaded, 0)
+
+	filename := filepath.Join(t.TempDir(), "garbage.json")
+	err = os.WriteFile(filename, []byte("not json"), 0600)
+	test.AssertNotError(t, err, "writing cache file")
+	_, err = src.LoadCache(filename)
+	test.AssertError(t, err, "loaded garbage cache")
+}
@@ -0,0 +1,220 @@
+package responder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+	"google.golang.org/grpc"
+
+	"github.com/letsencrypt/boulder/config"
+	"github.com/letsencrypt/boulder/core"
+	berrors "github.com/letsencrypt/boulder/errors"
+	"github.com/letsencrypt/boulder/issuance"
+	sapb "github.com/letsencrypt/boulder/sa/proto"
+)
+
+// StatusGetter looks up the stored revocation status of a serial. It is the
+// subset of the SA's read-only interface used by statusSource.
+type StatusGetter interface {
+	GetRevocationStatus(ctx context.Context, req *sapb.Serial, opts ...grpc.CallOption) (*sapb.RevocationStatus, error)
+}
+
+// StatusSigningConfig configures a statusSource.
+type StatusSigningConfig struct {
+	// Issuers are the issuers whose certificates' responses are signed. Each
+	// must have its key available to sign with.
+	Issuers []issuance.IssuerConfig `validate:"dive"`
+
+	// Lifetime is the validity period, from thisUpdate to nextUpdate, of the
+	// signed responses. It defaults to 96 hours.
+	Lifetime config.Duration `validate:"-"`
+
+	// CacheTTL is how long a signed response is reused before signing a new
+	// one. A certificate revoked within that time can still be served as Good
+	// until the entry expires. It defaults to one hour, and must be shorter
+	// than Lifetime.
+	CacheTTL config.Duration `validate:"-"`
+
+	// CacheSize is the most responses cached at once. It defaults to 10000.
+	CacheSize int `validate:"min=0"`
+
+	// CacheFile, if set, is where the cache is saved on graceful shutdown
+	// and reloaded from at startup, so that a restart doesn't begin with
+	// every response needing to be signed again.
+	CacheFile string
+
+	// WarmFile, if set, lists hex serials, one per line, whose responses are
+	// signed and cached at startup, after CacheFile is loaded, so that the
+	// first requests for them are cache hits. At most CacheSize are cached.
+	WarmFile string
+
+	// WarmConcurrency is the most lookups made at once while warming the
+	// cache from WarmFile. It defaults to 10.
+	WarmConcurrency int `validate:"min=0"`
+}
+
+// statusEntry is a signed response cached by statusSource.
+type statusEntry struct {
+	resp    *Response
+	expires time.Time
+}
+
+// statusSource serves responses for backends that store only the revocation
+// status of each certificate, not pre-signed responses. It looks up the
+// status, signs a response for it with the matching issuer's key, and caches
+// the signed response for a fixed TTL.
+type statusSource struct {
+	statuses StatusGetter
+	signers  []localSigner
+	lifetime time.Duration
+	ttl      time.Duration
+	size     int
+	counter  *prometheus.CounterVec
+	clk      clock.Clock
+
+	mu    sync.Mutex
+	cache map[string]statusEntry
+}
+
+// NewStatusSource returns a statusSource which looks up statuses with
+// statuses and signs responses for them with the issuers, as configured by
+// conf.
+func NewStatusSource(statuses StatusGetter, issuers []*issuance.Issuer, conf StatusSigningConfig, stats prometheus.Registerer, clk clock.Clock) (*statusSource, error) {
+	if len(issuers) == 0 {
+		return nil, errors.New("status signing requires at least one issuer")
+	}
+	lifetime := conf.Lifetime.Duration
+	if lifetime == 0 {
+		lifetime = 96 * time.Hour
+	}
+	ttl := conf.CacheTTL.Duration
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+	if ttl < 0 || ttl >= lifetime {
+		return nil, fmt.Errorf("status signing cache TTL %s must be between 0 and the response lifetime %s", ttl, lifetime)
+	}
+	size := conf.CacheSize
+	if size == 0 {
+		size = 10000
+	}
+
+	signers, err := newLocalSigners(issuers)
+	if err != nil {
+		return nil, err
+	}
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocsp_status_source_responses",
+		Help: "Count of OCSP responses signed on demand from a stored status, by result",
+	}, []string{"result"})
+	stats.MustRegister(counter)
+
+	return &statusSource{
+		statuses: statuses,
+		signers:  signers,
+		lifetime: lifetime,
+		ttl:      ttl,
+		size:     size,
+		counter:  counter,
+		clk:      clk,
+		cache:    make(map[string]statusEntry),
+	}, nil
+}
+
+// Response implements the Source interface. It serves a cached response if
+// one is fresh, and otherwise signs a new one for the serial's stored status.
+func (src *statusSource) Response(ctx context.Context, req *ocsp.Request) (*Response, error) {
+	signer := findLocalSigner(src.signers, req)
+	if signer == nil {
+		src.counter.WithLabelValues("no_signer").Inc()
+		return nil, ErrNotFound
+	}
+
+	serial := core.SerialToString(req.SerialNumber)
+	// The same serial may be requested under different issuers, and each
+	// needs its own signature.
+	key := string(signer.id.keyHash) + serial
+	if resp := src.cached(key); resp != nil {
+		src.counter.WithLabelValues("cache_hit").Inc()
+		NoteSource(ctx, "status")
+		return resp, nil
+	}
+
+	status, err := src.statuses.GetRevocationStatus(ctx, &sapb.Serial{Serial: serial})
+	if err != nil {
+		if errors.Is(err, berrors.NotFound) {
+			src.counter.WithLabelValues("not_found").Inc()
+			return nil, ErrNotFound
+		}
+		src.counter.WithLabelValues("lookup_error").Inc()
+		return nil, fmt.Errorf("looking up status of %s: %w", serial, err)
+	}
+
+	now := src.clk.Now().Truncate(time.Minute)
+	template := ocsp.Response{
+		Status:       int(status.Status),
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(src.lifetime),
+	}
+	if template.Status == ocsp.Revoked {
+		template.RevokedAt = status.RevokedDate.AsTime()
+		template.RevocationReason = int(status.RevokedReason)
+	}
+
+	cert := signer.issuer.Cert.Certificate
+	der, err := ocsp.CreateResponse(cert, cert, template, signer.issuer.Signer)
+	if err != nil {
+		src.counter.WithLabelValues("signing_error").Inc()
+		return nil, fmt.Errorf("signing response for %s: %w", serial, err)
+	}
+	parsed, err := ocsp.ParseResponse(der, nil)
+	if err != nil {
+		src.counter.WithLabelValues("signing_error").Inc()
+		return nil, err
+	}
+
+	resp := &Response{Response: parsed, Raw: der}
+	src.store(key, resp)
+	src.counter.WithLabelValues("signed").Inc()
+	NoteSource(ctx, "status")
+	return resp, nil
+}
+
+// cached returns the response cached under key, or nil if there is none or
+// it has expired.
+func (src *statusSource) cached(key string) *Response {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	entry, ok := src.cache[key]
+	if !ok || !src.clk.Now().Before(entry.expires) {
+		return nil
+	}
+	return entry.resp
+}
+
+// store caches resp under key for the TTL. If the cache is full, expired
+// entries are dropped first, and if it is still full resp isn't cached.
+func (src *statusSource) store(key string, resp *Response) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	now := src.clk.Now()
+	if len(src.cache) >= src.size {
+		for k, entry := range src.cache {
+			if !now.Before(entry.expires) {
+				delete(src.cache, k)
+			}
+		}
+		if len(src.cache) >= src.size {
+			return
+		}
+	}
+	src.cache[key] = statusEntry{resp, now.Add(src.ttl)}
+}
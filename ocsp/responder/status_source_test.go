@@ -0,0 +1,172 @@
+package responder
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/letsencrypt/boulder/config"
+	berrors "github.com/letsencrypt/boulder/errors"
+	"github.com/letsencrypt/boulder/issuance"
+	"github.com/letsencrypt/boulder/metrics"
+	sapb "github.com/letsencrypt/boulder/sa/proto"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// mapStatuses is a StatusGetter which returns the status stored for each
+// serial, and NotFound for any other serial. It counts its lookups.
+type mapStatuses struct {
+	statuses map[string]*sapb.RevocationStatus
+	mu       sync.Mutex
+	calls    int
+}
+
+func (m *mapStatuses) GetRevocationStatus(_ context.Context, req *sapb.Serial, _ ...grpc.CallOption) (*sapb.RevocationStatus, error) {
+	m.mu.Lock()
+	m.calls++
+	m.mu.Unlock()
+	status, ok := m.statuses[req.Serial]
+	if !ok {
+		return nil, berrors.NotFoundError("no status for %s", req.Serial)
+	}
+	return status, nil
+}
+
+// errorStatuses is a StatusGetter which always fails.
+type errorStatuses struct{}
+
+func (errorStatuses) GetRevocationStatus(_ context.Context, _ *sapb.Serial, _ ...grpc.CallOption) (*sapb.RevocationStatus, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestNewStatusSource(t *testing.T) {
+	issuers := []*issuance.Issuer{makeTestIssuer(t)}
+
+	_, err := NewStatusSource(&mapStatuses{}, nil, StatusSigningConfig{}, metrics.NoopRegisterer, clock.NewFake())
+	test.AssertError(t, err, "created status source without an issuer")
+
+	_, err = NewStatusSource(&mapStatuses{}, issuers, StatusSigningConfig{
+		Lifetime: config.Duration{Duration: time.Hour},
+		CacheTTL: config.Duration{Duration: 2 * time.Hour},
+	}, metrics.NoopRegisterer, clock.NewFake())
+	test.AssertError(t, err, "created status source with a TTL longer than the lifetime")
+
+	_, err = NewStatusSource(&mapStatuses{}, issuers, StatusSigningConfig{}, metrics.NoopRegisterer, clock.NewFake())
+	test.AssertNotError(t, err, "creating status source with defaults")
+}
+
+func TestStatusSource(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	other := makeNamedTestIssuer(t, "other test CA")
+	clk := clock.NewFake()
+	clk.Set(time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC))
+	revokedAt := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	statuses := &mapStatuses{statuses: map[string]*sapb.RevocationStatus{
+		"000000000000000000000000000000000001": {Status: ocsp.Good, RevokedDate: timestamppb.New(time.Time{})},
+		"000000000000000000000000000000000002": {Status: ocsp.Revoked, RevokedDate: timestamppb.New(revokedAt), RevokedReason: ocsp.KeyCompromise},
+	}}
+	src, err := NewStatusSource(statuses, []*issuance.Issuer{issuer, other}, StatusSigningConfig{
+		Lifetime: config.Duration{Duration: 24 * time.Hour},
+		CacheTTL: config.Duration{Duration: time.Hour},
+	}, metrics.NoopRegisterer, clk)
+	test.AssertNotError(t, err, "creating status source")
+
+	// A good status is signed into a valid good response.
+	resp, err := src.Response(context.Background(), requestFor(t, issuer, 1))
+	test.AssertNotError(t, err, "getting good response")
+	test.AssertEquals(t, resp.Status, ocsp.Good)
+	test.AssertEquals(t, resp.ThisUpdate, clk.Now().Truncate(time.Minute))
+	test.AssertEquals(t, resp.NextUpdate, resp.ThisUpdate.Add(24*time.Hour))
+	parsed, err := ocsp.ParseResponse(resp.Raw, issuer.Cert.Certificate)
+	test.AssertNotError(t, err, "verifying good response")
+	test.AssertEquals(t, parsed.SerialNumber.Int64(), int64(1))
+
+	// A revoked status carries its revocation time and reason.
+	resp, err = src.Response(context.Background(), requestFor(t, issuer, 2))
+	test.AssertNotError(t, err, "getting revoked response")
+	test.AssertEquals(t, resp.Status, ocsp.Revoked)
+	test.AssertEquals(t, resp.RevokedAt, revokedAt)
+	test.AssertEquals(t, resp.RevocationReason, ocsp.KeyCompromise)
+	_, err = ocsp.ParseResponse(resp.Raw, issuer.Cert.Certificate)
+	test.AssertNotError(t, err, "verifying revoked response")
+	test.AssertEquals(t, statuses.calls, 2)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "signed"}, 2)
+
+	// Within the TTL, the same signed bytes are served without a lookup.
+	again, err := src.Response(context.Background(), requestFor(t, issuer, 1))
+	test.AssertNotError(t, err, "getting cached response")
+	test.AssertByteEquals(t, again.Raw, src.cache[string(src.signers[0].id.keyHash)+"000000000000000000000000000000000001"].resp.Raw)
+	test.AssertEquals(t, statuses.calls, 2)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "cache_hit"}, 1)
+
+	// The same serial under another issuer is signed by that issuer.
+	resp, err = src.Response(context.Background(), requestFor(t, other, 1))
+	test.AssertNotError(t, err, "getting response from other issuer")
+	_, err = ocsp.ParseResponse(resp.Raw, other.Cert.Certificate)
+	test.AssertNotError(t, err, "verifying response from other issuer")
+	test.AssertEquals(t, statuses.calls, 3)
+
+	// After the TTL, the status is looked up and signed again.
+	clk.Add(time.Hour)
+	resp, err = src.Response(context.Background(), requestFor(t, issuer, 1))
+	test.AssertNotError(t, err, "getting re-signed response")
+	test.AssertEquals(t, resp.ThisUpdate, clk.Now().Truncate(time.Minute))
+	test.AssertEquals(t, statuses.calls, 4)
+
+	// Serials without a status are not found.
+	_, err = src.Response(context.Background(), requestFor(t, issuer, 3))
+	test.AssertErrorIs(t, err, ErrNotFound)
+
+	// Issuers we can't sign for are not found.
+	_, err = src.Response(context.Background(), requestFor(t, makeNamedTestIssuer(t, "unknown CA"), 1))
+	test.AssertErrorIs(t, err, ErrNotFound)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "no_signer"}, 1)
+}
+
+func TestStatusSourceLookupError(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	src, err := NewStatusSource(errorStatuses{}, []*issuance.Issuer{issuer}, StatusSigningConfig{}, metrics.NoopRegisterer, clock.NewFake())
+	test.AssertNotError(t, err, "creating status source")
+
+	_, err = src.Response(context.Background(), requestFor(t, issuer, 1))
+	test.AssertError(t, err, "expected lookup error")
+	test.AssertContains(t, err.Error(), "connection refused")
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "lookup_error"}, 1)
+}
+
+func TestStatusSourceCacheSize(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	clk := clock.NewFake()
+	statuses := &mapStatuses{statuses: map[string]*sapb.RevocationStatus{
+		"000000000000000000000000000000000001": {Status: ocsp.Good, RevokedDate: timestamppb.New(time.Time{})},
+		"000000000000000000000000000000000002": {Status: ocsp.Good, RevokedDate: timestamppb.New(time.Time{})},
+	}}
+	src, err := NewStatusSource(statuses, []*issuance.Issuer{issuer}, StatusSigningConfig{CacheSize: 1}, metrics.NoopRegisterer, clk)
+	test.AssertNotError(t, err, "creating status source")
+
+	// With the cache full, further responses are signed but not cached.
+	for _, serial := range []int64{1, 2, 2} {
+		_, err = src.Response(context.Background(), requestFor(t, issuer, serial))
+		test.AssertNotError(t, err, "getting response")
+	}
+	test.AssertEquals(t, len(src.cache), 1)
+	test.AssertEquals(t, statuses.calls, 3)
+
+	// Once the cached entry expires, it makes room for another.
+	clk.Add(time.Hour)
+	for _, serial := range []int64{2, 2} {
+		_, err = src.Response(context.Background(), requestFor(t, issuer, serial))
+		test.AssertNotError(t, err, "getting response")
+	}
+	test.AssertEquals(t, len(src.cache), 1)
+	test.AssertEquals(t, statuses.calls, 4)
+}
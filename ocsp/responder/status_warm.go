@@ -0,0 +1,118 @@
+package responder
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// LoadWarmSerials reads the serials listed in filename, one hex serial per
+// line, for WarmCache. Blank lines and lines starting with "#" are skipped.
+// Serials are normalized to the form of core.SerialToString.
+func LoadWarmSerials(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var serials []string
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		serial, err := core.StringToSerial(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filename, line, err)
+		}
+		serials = append(serials, core.SerialToString(serial))
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filename, err)
+	}
+	return serials, nil
+}
+
+// WarmCache looks up, signs and caches the response for each of serials under
+// each configured issuer, through Response, so that the first requests for
+// them after a start are cache hits. Responses already cached, for example by
+// LoadCache, aren't signed again. At most concurrency lookups run at once,
+// one if it's less than one. Warming stops once the cache is full, or ctx is
+// done. It returns the number of responses found, which are cached unless
+// the cache filled up meanwhile. Serials without a stored status are skipped;
+// other failed lookups don't stop the warm-up, but the first is returned with
+// a count of them.
+func (src *statusSource) WarmCache(ctx context.Context, serials []string, concurrency int) (int, error) {
+	reqs := make([]*ocsp.Request, 0, len(serials)*len(src.signers))
+	for _, hex := range serials {
+		serial, err := core.StringToSerial(hex)
+		if err != nil {
+			return 0, err
+		}
+		for _, signer := range src.signers {
+			reqs = append(reqs, &ocsp.Request{
+				HashAlgorithm:  crypto.SHA1,
+				IssuerNameHash: signer.id.nameHash,
+				IssuerKeyHash:  signer.id.keyHash,
+				SerialNumber:   serial,
+			})
+		}
+	}
+
+	var mu sync.Mutex
+	var warmed, failed int
+	var firstErr error
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(concurrency, 1))
+	for _, req := range reqs {
+		sem <- struct{}{}
+		if ctx.Err() != nil || src.full() {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			_, err := src.Response(ctx, req)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				warmed++
+			case errors.Is(err, ErrNotFound):
+			default:
+				failed++
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if failed > 0 {
+		return warmed, fmt.Errorf("%d of %d lookups failed, the first with: %w", failed, len(reqs), firstErr)
+	}
+	return warmed, ctx.Err()
+}
+
+// full returns true if the cache holds as many entries as it may.
+func (src *statusSource) full() bool {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return len(src.cache) >= src.size
+}
@@ -0,0 +1,125 @@
+package responder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/letsencrypt/boulder/issuance"
+	"github.com/letsencrypt/boulder/metrics"
+	sapb "github.com/letsencrypt/boulder/sa/proto"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestLoadWarmSerials(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "serials.txt")
+	err := os.WriteFile(filename, []byte("# hot serials\n000000000000000000000000000000000001\n\n  00000000000000000000000000000000000A  \n"), 0600)
+	test.AssertNotError(t, err, "writing serials")
+	serials, err := LoadWarmSerials(filename)
+	test.AssertNotError(t, err, "loading serials")
+	test.AssertDeepEquals(t, serials, []string{
+		"000000000000000000000000000000000001",
+		"00000000000000000000000000000000000a",
+	})
+
+	err = os.WriteFile(filename, []byte("000000000000000000000000000000000001\nnot a serial\n"), 0600)
+	test.AssertNotError(t, err, "writing serials")
+	_, err = LoadWarmSerials(filename)
+	test.AssertError(t, err, "loaded an invalid serial")
+	test.AssertContains(t, err.Error(), "serials.txt:2")
+
+	_, err = LoadWarmSerials(filepath.Join(t.TempDir(), "missing.txt"))
+	test.AssertError(t, err, "loaded a missing file")
+}
+
+func TestWarmCache(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	other := makeNamedTestIssuer(t, "other test CA")
+	good := &sapb.RevocationStatus{Status: ocsp.Good, RevokedDate: timestamppb.New(time.Time{})}
+	statuses := &mapStatuses{statuses: map[string]*sapb.RevocationStatus{
+		"000000000000000000000000000000000001": good,
+		"000000000000000000000000000000000002": good,
+	}}
+	src, err := NewStatusSource(statuses, []*issuance.Issuer{issuer, other}, StatusSigningConfig{}, metrics.NoopRegisterer, clock.NewFake())
+	test.AssertNotError(t, err, "creating status source")
+
+	// Each listed serial is cached under each issuer. Serial 3 has no status,
+	// so it's skipped.
+	warmed, err := src.WarmCache(context.Background(), []string{
+		"000000000000000000000000000000000001",
+		"000000000000000000000000000000000002",
+		"000000000000000000000000000000000003",
+	}, 4)
+	test.AssertNotError(t, err, "warming cache")
+	test.AssertEquals(t, warmed, 4)
+	test.AssertEquals(t, len(src.cache), 4)
+	test.AssertEquals(t, statuses.calls, 6)
+
+	// The first requests for them are then cache hits.
+	for _, iss := range []*issuance.Issuer{issuer, other} {
+		for _, serial := range []int64{1, 2} {
+			_, err = src.Response(context.Background(), requestFor(t, iss, serial))
+			test.AssertNotError(t, err, "getting warmed response")
+		}
+	}
+	test.AssertEquals(t, statuses.calls, 6)
+	test.AssertMetricWithLabelsEquals(t, src.counter, prometheus.Labels{"result": "cache_hit"}, 4)
+
+	// Warming again finds them cached, without signing them again.
+	warmed, err = src.WarmCache(context.Background(), []string{"000000000000000000000000000000000001"}, 1)
+	test.AssertNotError(t, err, "warming cache again")
+	test.AssertEquals(t, warmed, 2)
+	test.AssertEquals(t, statuses.calls, 6)
+
+	_, err = src.WarmCache(context.Background(), []string{"not a serial"}, 1)
+	test.AssertError(t, err, "warmed an invalid serial")
+}
+
+func TestWarmCacheBounds(t *testing.T) {
+	issuer := makeTestIssuer(t)
+	good := &sapb.RevocationStatus{Status: ocsp.Good, RevokedDate: timestamppb.New(time.Time{})}
+	statuses := &mapStatuses{statuses: map[string]*sapb.RevocationStatus{
+		"000000000000000000000000000000000001": good,
+		"000000000000000000000000000000000002": good,
+		"000000000000000000000000000000000003": good,
+	}}
+	serials := []string{
+		"000000000000000000000000000000000001",
+		"000000000000000000000000000000000002",
+		"000000000000000000000000000000000003",
+	}
+
+	// Warming stops once the cache is full.
+	src, err := NewStatusSource(statuses, []*issuance.Issuer{issuer}, StatusSigningConfig{CacheSize: 2}, metrics.NoopRegisterer, clock.NewFake())
+	test.AssertNotError(t, err, "creating status source")
+	warmed, err := src.WarmCache(context.Background(), serials, 1)
+	test.AssertNotError(t, err, "warming cache")
+	test.AssertEquals(t, warmed, 2)
+	test.AssertEquals(t, len(src.cache), 2)
+	test.AssertEquals(t, statuses.calls, 2)
+
+	// Or once ctx is done.
+	src, err = NewStatusSource(statuses, []*issuance.Issuer{issuer}, StatusSigningConfig{}, metrics.NoopRegisterer, clock.NewFake())
+	test.AssertNotError(t, err, "creating status source")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	warmed, err = src.WarmCache(ctx, serials, 1)
+	test.AssertErrorIs(t, err, context.Canceled)
+	test.AssertEquals(t, warmed, 0)
+
+	// Failed lookups don't stop the warm-up, but are reported.
+	src, err = NewStatusSource(errorStatuses{}, []*issuance.Issuer{issuer}, StatusSigningConfig{}, metrics.NoopRegisterer, clock.NewFake())
+	test.AssertNotError(t, err, "creating status source")
+	warmed, err = src.WarmCache(context.Background(), serials, 2)
+	test.AssertError(t, err, "warmed despite lookup errors")
+	test.AssertContains(t, err.Error(), "3 of 3 lookups failed")
+	test.AssertContains(t, err.Error(), "connection refused")
+	test.AssertEquals(t, warmed, 0)
+}